@@ -0,0 +1,51 @@
+// Package backplane доставка сообщений сессиям между репликами сервиса:
+// сообщение попадает на реплику, к которой подключён клиент, или ждёт его подключения
+package backplane
+
+import (
+	"context"
+	"time"
+)
+
+// PresenceTTL срок отметки о подключении клиента. Реплика продлевает отметки своих клиентов,
+// а если она упала, не сняв их, сообщения через этот срок снова начнут сохраняться
+const PresenceTTL = time.Minute
+
+// Message сообщение сессии. ID растёт с каждой публикацией: по нему клиент сообщает,
+// какие сообщения уже получил, а повторно выданные отбрасываются
+type Message struct {
+	ID   int64  `json:"id"`
+	Body []byte `json:"body"`
+}
+
+// Handler получает сообщения для клиентов, подключённых к этой реплике
+type Handler func(sessionID string, message Message)
+
+type Backplane interface {
+	// Register отметить, что к этой реплике подключены клиенты сессии. Сессия может быть подключена к нескольким репликам
+	Register(ctx context.Context, sessionID string) error
+	// Unregister снять отметку этой реплики, когда у сессии не осталось на ней клиентов
+	Unregister(ctx context.Context, sessionID string) error
+	// Publish присвоить сообщению номер и доставить всем репликам с клиентами сессии
+	// или сохранить до подключения клиента
+	Publish(ctx context.Context, sessionID string, body []byte) error
+	// Enqueue сохранить уже пронумерованное сообщение до подключения клиента
+	Enqueue(ctx context.Context, sessionID string, message Message) error
+	// Drain забрать сохранённые сообщения сессии в порядке отправки
+	Drain(ctx context.Context, sessionID string) ([]Message, error)
+	// Subscribe передавать в handler сообщения для клиентов этой реплики, пока не отменят контекст
+	Subscribe(ctx context.Context, handler Handler) error
+	// Ping проверить соединение с хранилищем
+	Ping(ctx context.Context) error
+	// Close закрыть соединение с хранилищем
+	Close() error
+}
+
+// Options хранение сообщений для клиентов, которые ещё не подключились.
+// Пакет используется из common/http, поэтому настройки не берутся из core напрямую
+type Options struct {
+	// PendingTTL сколько хранить сообщения сессии после последнего добавленного
+	PendingTTL time.Duration
+	// MaxPending сколько сообщений хранить для одной сессии, старые отбрасываются
+	MaxPending int64
+}
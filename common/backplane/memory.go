@@ -0,0 +1,139 @@
+package backplane
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type pendingMessage struct {
+	message   Message
+	expiresAt time.Time
+}
+
+type memory struct {
+	opts Options
+
+	mu sync.Mutex
+	// sequence номер последнего сообщения, общий для всех сессий
+	sequence  int64
+	sessions  map[string]struct{}
+	pending   map[string][]pendingMessage
+	handler   Handler
+	nextPrune time.Time
+}
+
+// NewMemory backplane в памяти процесса, для тестов и запуска одной репликой
+func NewMemory(opts Options) Backplane {
+	return &memory{
+		opts:     opts,
+		sessions: make(map[string]struct{}),
+		pending:  make(map[string][]pendingMessage),
+	}
+}
+
+func (m *memory) Register(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[sessionID] = struct{}{}
+
+	return nil
+}
+
+func (m *memory) Unregister(ctx context.Context, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, sessionID)
+
+	return nil
+}
+
+func (m *memory) Publish(ctx context.Context, sessionID string, body []byte) error {
+	m.mu.Lock()
+	m.sequence++
+	message := Message{ID: m.sequence, Body: body}
+	_, connected := m.sessions[sessionID]
+	handler := m.handler
+	if !connected || handler == nil {
+		m.enqueueLocked(sessionID, message)
+		m.mu.Unlock()
+		return nil
+	}
+	m.mu.Unlock()
+
+	handler(sessionID, message)
+
+	return nil
+}
+
+func (m *memory) Enqueue(ctx context.Context, sessionID string, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.enqueueLocked(sessionID, message)
+
+	return nil
+}
+
+func (m *memory) enqueueLocked(sessionID string, message Message) {
+	now := time.Now()
+	if now.After(m.nextPrune) {
+		m.pruneLocked(now)
+		m.nextPrune = now.Add(PresenceTTL)
+	}
+
+	queue := append(m.pending[sessionID], pendingMessage{message: message, expiresAt: now.Add(m.opts.PendingTTL)})
+	if int64(len(queue)) > m.opts.MaxPending {
+		queue = queue[int64(len(queue))-m.opts.MaxPending:]
+	}
+	m.pending[sessionID] = queue
+}
+
+// pruneLocked удаляет истёкшие сообщения сессий, клиенты которых так и не подключились
+func (m *memory) pruneLocked(now time.Time) {
+	for sessionID, queue := range m.pending {
+		if len(queue) > 0 && now.After(queue[len(queue)-1].expiresAt) {
+			delete(m.pending, sessionID)
+		}
+	}
+}
+
+func (m *memory) Drain(ctx context.Context, sessionID string) ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	messages := make([]Message, 0, len(m.pending[sessionID]))
+	for _, msg := range m.pending[sessionID] {
+		if now.Before(msg.expiresAt) {
+			messages = append(messages, msg.message)
+		}
+	}
+	delete(m.pending, sessionID)
+
+	return messages, nil
+}
+
+func (m *memory) Subscribe(ctx context.Context, handler Handler) error {
+	m.mu.Lock()
+	m.handler = handler
+	m.mu.Unlock()
+
+	<-ctx.Done()
+
+	m.mu.Lock()
+	m.handler = nil
+	m.mu.Unlock()
+
+	return nil
+}
+
+func (m *memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
@@ -0,0 +1,196 @@
+package backplane
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const keyPrefix = "docshade:ws:"
+
+// sequenceKey счётчик номеров сообщений, общий для всех сессий, чтобы номер не начинался заново,
+// когда истекает очередь сессии
+const sequenceKey = keyPrefix + "sequence"
+
+// envelope сообщение, пересылаемое реплике через pub/sub
+type envelope struct {
+	SessionID string  `json:"session_id"`
+	Message   Message `json:"message"`
+}
+
+// redisBackplane отметки о подключении хранит в sorted set сессии: участник — реплика, счёт — срок отметки.
+// Ожидающие сообщения лежат списками, а живые пересылаются в каналы pub/sub реплик, к которым подключены клиенты
+type redisBackplane struct {
+	opts      Options
+	client    *redis.Client
+	replicaID string
+}
+
+// NewRedis backplane поверх клиента Redis, клиент закрывается вместе с ним
+func NewRedis(client *redis.Client, opts Options) Backplane {
+	return &redisBackplane{
+		opts:      opts,
+		client:    client,
+		replicaID: uuid.NewString(),
+	}
+}
+
+func presenceKey(sessionID string) string {
+	return keyPrefix + "presence:" + sessionID
+}
+
+func pendingKey(sessionID string) string {
+	return keyPrefix + "pending:" + sessionID
+}
+
+func replicaChannel(replicaID string) string {
+	return keyPrefix + "replica:" + replicaID
+}
+
+func (r *redisBackplane) Register(ctx context.Context, sessionID string) error {
+	key := presenceKey(sessionID)
+	now := time.Now()
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(PresenceTTL).UnixMilli()), Member: r.replicaID})
+		pipe.Expire(ctx, key, PresenceTTL)
+		return nil
+	})
+
+	return err
+}
+
+func (r *redisBackplane) Unregister(ctx context.Context, sessionID string) error {
+	return r.client.ZRem(ctx, presenceKey(sessionID), r.replicaID).Err()
+}
+
+// Publish отправляет сообщение каждой реплике с клиентами сессии
+func (r *redisBackplane) Publish(ctx context.Context, sessionID string, body []byte) error {
+	id, err := r.client.Incr(ctx, sequenceKey).Result()
+	if err != nil {
+		return err
+	}
+	message := Message{ID: id, Body: body}
+
+	key := presenceKey(sessionID)
+	replicas, err := r.client.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(envelope{SessionID: sessionID, Message: message})
+	if err != nil {
+		return err
+	}
+
+	delivered := false
+	for _, replicaID := range replicas {
+		receivers, err := r.client.Publish(ctx, replicaChannel(replicaID), payload).Result()
+		if err != nil {
+			return err
+		}
+		if receivers > 0 {
+			delivered = true
+			continue
+		}
+		// Реплика упала, не сняв отметку
+		r.client.ZRem(ctx, key, replicaID)
+	}
+
+	// Клиентов нет ни на одной живой реплике: сообщение дождётся подключения
+	if !delivered {
+		return r.Enqueue(ctx, sessionID, message)
+	}
+
+	return nil
+}
+
+func (r *redisBackplane) Enqueue(ctx context.Context, sessionID string, message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	key := pendingKey(sessionID)
+	_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, data)
+		pipe.LTrim(ctx, key, -r.opts.MaxPending, -1)
+		pipe.Expire(ctx, key, r.opts.PendingTTL)
+		return nil
+	})
+
+	return err
+}
+
+func (r *redisBackplane) Drain(ctx context.Context, sessionID string) ([]Message, error) {
+	key := pendingKey(sessionID)
+	var messages *redis.StringSliceCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		messages = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Message, 0, len(messages.Val()))
+	for _, data := range messages.Val() {
+		var msg Message
+		if err := json.Unmarshal([]byte(data), &msg); err != nil {
+			return nil, fmt.Errorf("failed to decode pending message of session %s: %w", sessionID, err)
+		}
+		result = append(result, msg)
+	}
+
+	return result, nil
+}
+
+// Subscribe слушает канал реплики. После разрыва соединения клиент Redis подписывается заново сам
+func (r *redisBackplane) Subscribe(ctx context.Context, handler Handler) error {
+	sub := r.client.Subscribe(ctx, replicaChannel(r.replicaID))
+	defer sub.Close()
+
+	if _, err := sub.Receive(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	messages := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-messages:
+			if !ok {
+				return nil
+			}
+
+			var env envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("Failed to decode backplane message: %v", err)
+				continue
+			}
+			handler(env.SessionID, env.Message)
+		}
+	}
+}
+
+func (r *redisBackplane) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *redisBackplane) Close() error {
+	return r.client.Close()
+}
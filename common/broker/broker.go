@@ -0,0 +1,441 @@
+// Package broker соединение с RabbitMQ, которое переживает перезапуск брокера
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gitlab.com/docshade/common/core"
+)
+
+// State состояние соединения с брокером
+type State string
+
+const (
+	StateConnecting   State = "connecting"
+	StateConnected    State = "connected"
+	StateReconnecting State = "reconnecting"
+	StateClosed       State = "closed"
+)
+
+const (
+	// connectAttempts попытки первого подключения, после которых сервис не стартует
+	connectAttempts = 10
+
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+
+	// publishChannels сколько каналов публикации держать открытыми между вызовами
+	publishChannels = 8
+)
+
+var (
+	// ErrNotConnected соединение с брокером сейчас потеряно
+	ErrNotConnected = errors.New("rabbitmq is not connected")
+	// ErrClosed менеджер закрыт
+	ErrClosed = errors.New("rabbitmq connection manager is closed")
+	// ErrUnroutable брокер вернул сообщение: ни одна очередь не привязана к обменнику с таким ключом
+	ErrUnroutable = errors.New("message is unroutable")
+	// ErrNacked брокер не принял сообщение на хранение
+	ErrNacked = errors.New("message was nacked by broker")
+)
+
+// TopologyFunc объявление обменников, очередей и привязок. Повторяется после каждого переподключения,
+// поэтому должно быть идемпотентным
+type TopologyFunc func(ch *amqp.Channel) error
+
+// Manager держит соединение с RabbitMQ: переподключается с нарастающей задержкой, заново объявляет
+// топологию, возобновляет потребителей и переиспользует каналы публикации
+type Manager struct {
+	uri string
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	state    State
+	ready    chan struct{}
+	topology []TopologyFunc
+	closed   bool
+
+	// channels свободные каналы публикации текущего соединения
+	channels chan *publishChannel
+	done     chan struct{}
+}
+
+// publishChannel канал публикации в режиме подтверждений. Каналом пользуется
+// один издатель за раз, поэтому возврат, пришедший во время публикации, относится к его сообщению
+type publishChannel struct {
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+// NewManager менеджер соединения, подключение выполняет Connect
+func NewManager(cfg core.RabbitMQConfig) *Manager {
+	return &Manager{
+		uri:      cfg.URI,
+		state:    StateConnecting,
+		ready:    make(chan struct{}),
+		channels: make(chan *publishChannel, publishChannels),
+		done:     make(chan struct{}),
+	}
+}
+
+// Connect подключается к брокеру и запускает наблюдение за соединением.
+// Возвращает ошибку, если брокер недоступен после всех попыток
+func (m *Manager) Connect(ctx context.Context) error {
+	var conn *amqp.Connection
+	var err error
+	backoff := minBackoff
+	for attempt := 1; attempt <= connectAttempts; attempt++ {
+		conn, err = m.dial()
+		if err == nil {
+			break
+		}
+
+		log.Printf("Failed to connect to RabbitMQ (attempt %d of %d): %v", attempt, connectAttempts, err)
+		if attempt == connectAttempts {
+			return fmt.Errorf("failed to connect to rabbitmq: %w", err)
+		}
+		if err := sleep(ctx, backoff); err != nil {
+			return err
+		}
+		backoff = nextBackoff(backoff)
+	}
+
+	// Подписка до публикации соединения, иначе его разрыв в этот момент прошёл бы незамеченным
+	closes := conn.NotifyClose(make(chan *amqp.Error, 1))
+	if !m.setConnected(conn) {
+		conn.Close()
+		return ErrClosed
+	}
+	go m.watch(closes)
+
+	return nil
+}
+
+// State текущее состояние соединения
+func (m *Manager) State() State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state
+}
+
+// Ping возвращает ErrNotConnected, пока соединения с брокером нет
+func (m *Manager) Ping(ctx context.Context) error {
+	_, err := m.connection()
+
+	return err
+}
+
+// Declare объявляет топологию сейчас и запоминает её, чтобы повторить после переподключения
+func (m *Manager) Declare(ctx context.Context, declare TopologyFunc) error {
+	ch, err := m.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	if err := declare(ch); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.topology = append(m.topology, declare)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Channel открывает отдельный канал текущего соединения, его нужно закрыть после использования
+func (m *Manager) Channel() (*amqp.Channel, error) {
+	conn, err := m.connection()
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.Channel()
+}
+
+// Publish публикует сообщение с флагом mandatory и ждёт подтверждения брокера.
+// Возвращает ErrUnroutable, если сообщение некуда доставить, и ErrNacked, если брокер его не принял.
+// Пока соединения нет, сразу возвращает ErrNotConnected
+func (m *Manager) Publish(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+	pc, err := m.acquire()
+	if err != nil {
+		return err
+	}
+
+	confirmation, err := pc.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, true, false, msg)
+	if err != nil {
+		// После ошибки брокер мог закрыть канал, такой в пул не возвращаем
+		pc.ch.Close()
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		// Подтверждение ещё может прийти и достаться следующему издателю
+		pc.ch.Close()
+		return err
+	}
+
+	// Брокер отправляет возврат раньше подтверждения, поэтому к этому моменту он уже в канале
+	select {
+	case returned := <-pc.returns:
+		m.release(pc)
+		return fmt.Errorf("%w: %s %s", ErrUnroutable, returned.ReplyText, routingKey)
+	default:
+	}
+
+	m.release(pc)
+	if !acked {
+		return ErrNacked
+	}
+
+	return nil
+}
+
+// Close закрывает соединение, после чего менеджер не переподключается
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	m.state = StateClosed
+	conn := m.conn
+	m.conn = nil
+	close(m.done)
+	m.mu.Unlock()
+
+	m.drainChannels()
+
+	if conn == nil || conn.IsClosed() {
+		return nil
+	}
+
+	return conn.Close()
+}
+
+// watch ждёт разрыва соединения и переподключается, пока менеджер не закрыт
+func (m *Manager) watch(closes chan *amqp.Error) {
+	for {
+		closeErr := <-closes
+		if !m.setReconnecting() {
+			// Соединение закрыто нами в Close
+			return
+		}
+		log.Printf("RabbitMQ connection lost: %v", closeErr)
+
+		closes = m.reconnect()
+		if closes == nil {
+			return
+		}
+	}
+}
+
+// reconnect подключается заново и повторяет объявление топологии.
+// Возвращает канал уведомления о разрыве нового соединения или nil, если менеджер закрыли
+func (m *Manager) reconnect() chan *amqp.Error {
+	backoff := minBackoff
+	for {
+		select {
+		case <-m.done:
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = nextBackoff(backoff)
+
+		conn, err := m.dial()
+		if err != nil {
+			log.Printf("Failed to reconnect to RabbitMQ: %v", err)
+			continue
+		}
+
+		if err := m.redeclare(conn); err != nil {
+			log.Printf("Failed to redeclare RabbitMQ topology: %v", err)
+			conn.Close()
+			continue
+		}
+
+		closes := conn.NotifyClose(make(chan *amqp.Error, 1))
+		if !m.setConnected(conn) {
+			conn.Close()
+			return nil
+		}
+		log.Printf("Reconnected to RabbitMQ")
+
+		return closes
+	}
+}
+
+func (m *Manager) redeclare(conn *amqp.Connection) error {
+	m.mu.Lock()
+	topology := append([]TopologyFunc(nil), m.topology...)
+	m.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	for _, declare := range topology {
+		if err := declare(ch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manager) dial() (*amqp.Connection, error) {
+	return amqp.Dial(m.uri)
+}
+
+// setConnected делает conn текущим соединением и будит всех, кто ждёт подключения
+func (m *Manager) setConnected(conn *amqp.Connection) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false
+	}
+
+	m.conn = conn
+	m.state = StateConnected
+	close(m.ready)
+
+	return true
+}
+
+// setReconnecting забывает разорванное соединение вместе с его каналами публикации
+func (m *Manager) setReconnecting() bool {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return false
+	}
+	m.conn = nil
+	m.state = StateReconnecting
+	m.ready = make(chan struct{})
+	m.mu.Unlock()
+
+	m.drainChannels()
+
+	return true
+}
+
+func (m *Manager) connection() (*amqp.Connection, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+	if m.conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	return m.conn, nil
+}
+
+// waitConnected ждёт подключения и возвращает текущее соединение
+func (m *Manager) waitConnected(ctx context.Context) (*amqp.Connection, error) {
+	for {
+		m.mu.Lock()
+		closed, conn, ready := m.closed, m.conn, m.ready
+		m.mu.Unlock()
+
+		if closed {
+			return nil, ErrClosed
+		}
+		if conn != nil {
+			return conn, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-m.done:
+			return nil, ErrClosed
+		case <-ready:
+		}
+	}
+}
+
+func (m *Manager) acquire() (*publishChannel, error) {
+	for {
+		select {
+		case pc := <-m.channels:
+			if !pc.ch.IsClosed() {
+				return pc, nil
+			}
+		default:
+			return m.openPublishChannel()
+		}
+	}
+}
+
+func (m *Manager) openPublishChannel() (*publishChannel, error) {
+	ch, err := m.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	return &publishChannel{
+		ch:      ch,
+		returns: ch.NotifyReturn(make(chan amqp.Return, 1)),
+	}, nil
+}
+
+func (m *Manager) release(pc *publishChannel) {
+	select {
+	case m.channels <- pc:
+	default:
+		pc.ch.Close()
+	}
+}
+
+func (m *Manager) drainChannels() {
+	for {
+		select {
+		case pc := <-m.channels:
+			pc.ch.Close()
+		default:
+			return
+		}
+	}
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
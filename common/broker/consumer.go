@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ConsumeOptions параметры потребителя
+type ConsumeOptions struct {
+	Queue string
+	Tag   string
+	// Prefetch сколько неподтверждённых сообщений брокер отдаёт потребителю, 0 без ограничения
+	Prefetch int
+	AutoAck  bool
+}
+
+// DeliveryHandler обрабатывает сообщение. ch канал, из которого сообщение получено,
+// через него можно подтвердить сообщение или переопубликовать его
+type DeliveryHandler func(ctx context.Context, ch *amqp.Channel, d amqp.Delivery)
+
+// Consume читает очередь до отмены ctx. При разрыве соединения ждёт переподключения
+// и возобновляет чтение. После отмены ctx останавливает доставку и дообрабатывает
+// уже полученные сообщения
+func (m *Manager) Consume(ctx context.Context, opts ConsumeOptions, handler DeliveryHandler) error {
+	for {
+		conn, err := m.waitConnected(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		stopped, err := m.consume(ctx, conn, opts, handler)
+		if stopped {
+			log.Printf("Consumer for %s stopped", opts.Queue)
+			return nil
+		}
+		if errors.Is(err, ErrClosed) {
+			return err
+		}
+
+		log.Printf("Consumer for %s interrupted, waiting for reconnect: %v", opts.Queue, err)
+		// Не переоткрываем канал на том же соединении в цикле, если брокер отклоняет потребителя
+		if err := sleep(ctx, minBackoff); err != nil {
+			return nil
+		}
+	}
+}
+
+// consume читает очередь через один канал. stopped означает штатную остановку по ctx
+func (m *Manager) consume(ctx context.Context, conn *amqp.Connection, opts ConsumeOptions, handler DeliveryHandler) (stopped bool, err error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, err
+	}
+	defer ch.Close()
+
+	if opts.Prefetch > 0 {
+		if err := ch.Qos(opts.Prefetch, 0, false); err != nil {
+			return false, err
+		}
+	}
+
+	deliveries, err := ch.Consume(opts.Queue, opts.Tag, opts.AutoAck, false, false, false, nil)
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("Waiting for messages from %s", opts.Queue)
+	for {
+		select {
+		case <-ctx.Done():
+			if err := ch.Cancel(opts.Tag, false); err != nil {
+				return true, err
+			}
+			for d := range deliveries {
+				handler(ctx, ch, d)
+			}
+			return true, nil
+		case d, ok := <-deliveries:
+			if !ok {
+				return false, amqp.ErrClosed
+			}
+			handler(ctx, ch, d)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"os"
+	"time"
 
 	"gitlab.com/docshade/common/log"
 
@@ -23,10 +24,72 @@ type Config interface {
 	GetLogConfig() log.LoggerConfig
 	// GetPort получить порт приложения
 	GetPort() string
+	// GetShutdownTimeout получить время, отведённое на корректную остановку сервиса
+	GetShutdownTimeout() time.Duration
+	// GetMaxUploadSize получить максимальный размер загружаемого документа в байтах
+	GetMaxUploadSize() int64
+	// GetMaxBatchFiles получить максимальное число документов в одном пакете
+	GetMaxBatchFiles() int
+	// GetMaxBatchSize получить максимальный размер запроса пакетной загрузки в байтах
+	GetMaxBatchSize() int64
+	// GetAllowedOrigins получить источники, которым разрешены CORS запросы и подключение к WebSocket
+	GetAllowedOrigins() []string
+	// GetSessionConfig получить настройки токенов доступа к сессиям
+	GetSessionConfig() SessionConfig
+	// GetRetentionConfig получить сроки хранения документов
+	GetRetentionConfig() RetentionConfig
+	// GetTracingConfig получить настройки экспорта трассировок
+	GetTracingConfig() TracingConfig
+	// GetHealthConfig получить настройки проверок готовности
+	GetHealthConfig() HealthConfig
+	// GetWebSocketConfig получить настройки доставки уведомлений по WebSocket, SSE и long-poll
+	GetWebSocketConfig() WebSocketConfig
+	// GetWebhookConfig получить настройки доставки вебхуков
+	GetWebhookConfig() WebhookConfig
+	// GetResumableConfig получить настройки возобновляемых загрузок
+	GetResumableConfig() ResumableConfig
+	// GetScanConfig получить настройки проверки документов перед анонимизацией
+	GetScanConfig() ScanConfig
 }
 
 const (
-	defaultPort = "8080"
+	defaultPort            = "8080"
+	defaultShutdownTimeout = 30 * time.Second
+	defaultMaxUploadSize   = 200 << 20
+	defaultMaxBatchFiles   = 100
+	defaultMaxBatchSize    = 1 << 30
+
+	defaultIncomingTTL   = 24 * time.Hour
+	defaultProcessedTTL  = time.Hour
+	defaultSweepInterval = 5 * time.Minute
+
+	defaultTraceSampleRatio = 1.0
+
+	defaultHealthTimeout  = 2 * time.Second
+	defaultHealthCacheTTL = 5 * time.Second
+
+	defaultWebSocketPendingTTL = time.Hour
+	defaultWebSocketMaxPending = 1000
+	defaultWebSocketPing       = 30 * time.Second
+	defaultWebSocketWrite      = 10 * time.Second
+	defaultWebSocketSendBuffer = 64
+	defaultLongPollTimeout     = 25 * time.Second
+
+	defaultSessionTokenTTL = time.Hour
+
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookMaxAttempts = 8
+	defaultWebhookMinBackoff  = 10 * time.Second
+	defaultWebhookMaxBackoff  = time.Hour
+
+	defaultResumableUploadTTL    = 24 * time.Hour
+	defaultResumableMaxChunkSize = 64 << 20
+	defaultResumableSweep        = 10 * time.Minute
+	defaultResumablePresignTTL   = time.Hour
+
+	defaultClamdTimeout           = 2 * time.Minute
+	defaultPDFMaxDecodedSize      = 1 << 30
+	defaultPDFMaxCompressionRatio = 1000
 )
 
 type config struct {
@@ -45,6 +108,7 @@ type PostgresConfig struct {
 	Port     string `yaml:"postgres_port"`
 }
 
+// RedisConfig подключение к Redis, пустой Host отключает Redis там, где есть замена в памяти
 type RedisConfig struct {
 	Host     string `yaml:"redis_host"`
 	Password string `yaml:"redis_password"`
@@ -53,23 +117,150 @@ type RedisConfig struct {
 }
 
 type S3Config struct {
+	// Driver драйвер хранилища: minio (по умолчанию) или local
+	Driver          string `yaml:"s3_driver"`
 	Endpoint        string `yaml:"s3_endpoint"`
 	AccessKeyID     string `yaml:"s3_accessKeyID"`
 	SecretAccessKey string `yaml:"s3_secretAccessKey"`
+	UseSSL          bool   `yaml:"s3_use_ssl"`
+	Region          string `yaml:"s3_region"`
+	BucketIn        string `yaml:"s3_bucket_in"`
+	BucketOut       string `yaml:"s3_bucket_out"`
+	// BucketQuarantine документы, отклонённые проверкой перед анонимизацией
+	BucketQuarantine string `yaml:"s3_bucket_quarantine"`
+	// LocalPath каталог с объектами для драйвера local
+	LocalPath string `yaml:"s3_local_path"`
+	// PublicURL внешний адрес сервиса, отдающего подписанные ссылки на скачивание
+	PublicURL string `yaml:"s3_public_url"`
+	// EncryptionKeys мастер-ключи шифрования документов: идентификатор и 32 байта в base64
+	EncryptionKeys map[string]string `yaml:"s3_encryption_keys"`
+	// EncryptionKeyID идентификатор мастер-ключа для новых объектов, пустой отключает шифрование
+	EncryptionKeyID string `yaml:"s3_encryption_key_id"`
 }
 
 type RabbitMQConfig struct {
-	URI      string `yaml:"rabbitmq_uri"`
-	Username string `yaml:"rabbitmq_username"`
-	Password string `yaml:"rabbitmq_password"`
+	URI        string `yaml:"rabbitmq_uri"`
+	Username   string `yaml:"rabbitmq_username"`
+	Password   string `yaml:"rabbitmq_password"`
+	MaxRetries int    `yaml:"rabbitmq_max_retries"`
+	// RetryMinBackoff задержка перед первой повторной попыткой, дальше она удваивается до RetryMaxBackoff
+	RetryMinBackoff time.Duration `yaml:"rabbitmq_retry_min_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"rabbitmq_retry_max_backoff"`
 }
 
 type AnonymizerConfig struct {
 	URI string `yaml:"anonymizer_url"`
 }
 
+// RetentionConfig сроки хранения документов, после которых они удаляются вместе с состояниями
+type RetentionConfig struct {
+	// IncomingTTL срок хранения загруженных документов, которые так и не были обработаны
+	IncomingTTL time.Duration `yaml:"retention_incoming_ttl"`
+	// ProcessedTTL срок хранения анонимизированных документов и завершённых состояний
+	ProcessedTTL time.Duration `yaml:"retention_processed_ttl"`
+	// SweepInterval период проверки сроков хранения
+	SweepInterval time.Duration `yaml:"retention_sweep_interval"`
+}
+
+// TracingConfig экспорт трассировок OpenTelemetry по OTLP/HTTP
+type TracingConfig struct {
+	// Endpoint адрес коллектора в виде host:port, пустой отключает экспорт.
+	// Контекст трассировки между сервисами передаётся и без него
+	Endpoint string `yaml:"tracing_otlp_endpoint"`
+	// Insecure отправлять трассировки без TLS
+	Insecure bool `yaml:"tracing_otlp_insecure"`
+	// SampleRatio доля трассировок, которые сервис начинает сам, от 0 до 1
+	SampleRatio float64 `yaml:"tracing_sample_ratio"`
+	// ServiceName имя сервиса в трассировках, по умолчанию имя из NewConfig
+	ServiceName string `yaml:"tracing_service_name"`
+}
+
+// HealthConfig проверки зависимостей для /readyz
+type HealthConfig struct {
+	// Timeout время, за которое зависимость должна ответить на проверку
+	Timeout time.Duration `yaml:"health_check_timeout"`
+	// CacheTTL сколько переиспользовать результат проверки между пробами
+	CacheTTL time.Duration `yaml:"health_cache_ttl"`
+}
+
+// WebSocketConfig доставка уведомлений клиентам по WebSocket, SSE и long-poll
+type WebSocketConfig struct {
+	// PendingTTL сколько хранить сообщения для клиента, который ещё не подключился
+	PendingTTL time.Duration `yaml:"websocket_pending_ttl"`
+	// MaxPending сколько сообщений хранить для одной сессии, старые отбрасываются
+	MaxPending int64 `yaml:"websocket_max_pending"`
+	// PingInterval период ping кадров, по которым проверяется, что клиент жив
+	PingInterval time.Duration `yaml:"websocket_ping_interval"`
+	// PongTimeout сколько ждать любого кадра от клиента, прежде чем считать соединение мёртвым
+	PongTimeout time.Duration `yaml:"websocket_pong_timeout"`
+	// WriteTimeout предельное время записи одного кадра
+	WriteTimeout time.Duration `yaml:"websocket_write_timeout"`
+	// SendBuffer сколько сообщений может ждать отправки одному соединению.
+	// Соединение, не успевающее их забирать, закрывается, а сообщения ждут переподключения
+	SendBuffer int `yaml:"websocket_send_buffer"`
+	// LongPollTimeout сколько держать long-poll запрос без сообщений, меньше таймаутов прокси
+	LongPollTimeout time.Duration `yaml:"long_poll_timeout"`
+}
+
+// SessionConfig токены доступа к сессии, которые выдаёт upload-service и проверяет notification-service
+type SessionConfig struct {
+	// Secret ключ подписи токенов, должен совпадать у всех сервисов
+	Secret string `yaml:"session_secret"`
+	// TokenTTL срок действия токена
+	TokenTTL time.Duration `yaml:"session_token_ttl"`
+}
+
+// WebhookConfig доставка итогов обработки на адреса клиентов API
+type WebhookConfig struct {
+	// Timeout предельное время одного запроса к получателю
+	Timeout time.Duration `yaml:"webhook_timeout"`
+	// MaxAttempts после стольких неудачных попыток доставка считается проваленной
+	MaxAttempts int `yaml:"webhook_max_attempts"`
+	// MinBackoff задержка после первой неудачи, дальше она удваивается до MaxBackoff
+	MinBackoff time.Duration `yaml:"webhook_min_backoff"`
+	MaxBackoff time.Duration `yaml:"webhook_max_backoff"`
+	// AllowPrivateNetworks разрешить адреса получателей во внутренних сетях и на localhost.
+	// Только для разработки: иначе через callback_url клиент API достаёт до внутренних сервисов
+	AllowPrivateNetworks bool `yaml:"webhook_allow_private_networks"`
+}
+
+// ResumableConfig загрузка документа частями с докачкой после обрыва
+type ResumableConfig struct {
+	// UploadTTL незавершённая загрузка отменяется, если столько времени не приходило новых частей
+	UploadTTL time.Duration `yaml:"resumable_upload_ttl"`
+	// MaxChunkSize предельный размер одной части
+	MaxChunkSize int64 `yaml:"resumable_max_chunk_size"`
+	// SweepInterval период поиска просроченных загрузок
+	SweepInterval time.Duration `yaml:"resumable_sweep_interval"`
+	// PresignTTL срок ссылки для прямой загрузки в хранилище, не больше UploadTTL
+	PresignTTL time.Duration `yaml:"resumable_presign_ttl"`
+}
+
+// ScanConfig проверка документов перед анонимизацией антивирусом и разбором структуры PDF
+type ScanConfig struct {
+	// ClamAVEnabled проверять документы антивирусом, по умолчанию включено. Тогда адрес clamd обязателен,
+	// а отключить антивирус можно только явно
+	ClamAVEnabled *bool `yaml:"scan_clamav_enabled"`
+	// ClamdAddress адрес clamd в виде host:port или путь к unix сокету
+	ClamdAddress string `yaml:"scan_clamd_address"`
+	// ClamdTimeout предельное время проверки одного документа антивирусом
+	ClamdTimeout time.Duration `yaml:"scan_clamd_timeout"`
+	// PDFMaxDecodedSize сколько байт могут занять все распакованные потоки одного PDF
+	PDFMaxDecodedSize int64 `yaml:"scan_pdf_max_decoded_size"`
+	// PDFMaxCompressionRatio во сколько раз может распаковаться большой поток PDF.
+	// Один проход deflate даёт не больше тысячи, выше бывает только у вложенного сжатия
+	PDFMaxCompressionRatio int64 `yaml:"scan_pdf_max_compression_ratio"`
+}
+
 type ServerConfig struct {
-	Port string `yaml:"port"`
+	Port            string        `yaml:"port"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	MaxUploadSize   int64         `yaml:"max_upload_size"`
+	MaxBatchFiles   int           `yaml:"max_batch_files"`
+	MaxBatchSize    int64         `yaml:"max_batch_size"`
+	// AllowedOrigins источники вида https://docshade.example, "*" разрешает любой. Пустой список
+	// запрещает запросы с других источников, фронтенд на отдельном домене нужно перечислить
+	AllowedOrigins []string `yaml:"allowed_origins"`
 }
 
 type Services struct {
@@ -80,6 +271,14 @@ type Services struct {
 	RabbitMQConfig   RabbitMQConfig   `yaml:"rabbitmq"`
 	ServerConfig     ServerConfig     `yaml:"server"`
 	AnonymizerConfig AnonymizerConfig `yaml:"py_anonymizer"`
+	RetentionConfig  RetentionConfig  `yaml:"retention"`
+	TracingConfig    TracingConfig    `yaml:"tracing"`
+	HealthConfig     HealthConfig     `yaml:"health"`
+	WebSocketConfig  WebSocketConfig  `yaml:"websocket"`
+	SessionConfig    SessionConfig    `yaml:"session"`
+	WebhookConfig    WebhookConfig    `yaml:"webhook"`
+	ResumableConfig  ResumableConfig  `yaml:"resumable"`
+	ScanConfig       ScanConfig       `yaml:"scan"`
 }
 
 func NewConfig(name string) Config {
@@ -136,6 +335,140 @@ func (c *config) GetPort() string {
 	return c.port
 }
 
+func (c *config) GetShutdownTimeout() time.Duration {
+	if c.services.ServerConfig.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+
+	return c.services.ServerConfig.ShutdownTimeout
+}
+
+func (c *config) GetMaxUploadSize() int64 {
+	if c.services.ServerConfig.MaxUploadSize <= 0 {
+		return defaultMaxUploadSize
+	}
+
+	return c.services.ServerConfig.MaxUploadSize
+}
+
+func (c *config) GetMaxBatchFiles() int {
+	if c.services.ServerConfig.MaxBatchFiles <= 0 {
+		return defaultMaxBatchFiles
+	}
+
+	return c.services.ServerConfig.MaxBatchFiles
+}
+
+func (c *config) GetMaxBatchSize() int64 {
+	if c.services.ServerConfig.MaxBatchSize <= 0 {
+		return defaultMaxBatchSize
+	}
+
+	return c.services.ServerConfig.MaxBatchSize
+}
+
+// GetAllowedOrigins без настройки запросы с других источников запрещены, любой источник разрешает только явный "*"
+func (c *config) GetAllowedOrigins() []string {
+	return c.services.ServerConfig.AllowedOrigins
+}
+
+func (c *config) GetSessionConfig() SessionConfig {
+	session := c.services.SessionConfig
+	if session.TokenTTL <= 0 {
+		session.TokenTTL = defaultSessionTokenTTL
+	}
+
+	return session
+}
+
+func (c *config) GetRetentionConfig() RetentionConfig {
+	retention := c.services.RetentionConfig
+	if retention.IncomingTTL <= 0 {
+		retention.IncomingTTL = defaultIncomingTTL
+	}
+	if retention.ProcessedTTL <= 0 {
+		retention.ProcessedTTL = defaultProcessedTTL
+	}
+	if retention.SweepInterval <= 0 {
+		retention.SweepInterval = defaultSweepInterval
+	}
+
+	return retention
+}
+
+func (c *config) GetTracingConfig() TracingConfig {
+	tracing := c.services.TracingConfig
+	if tracing.ServiceName == "" {
+		tracing.ServiceName = c.name
+	}
+	if tracing.SampleRatio <= 0 || tracing.SampleRatio > 1 {
+		tracing.SampleRatio = defaultTraceSampleRatio
+	}
+
+	return tracing
+}
+
+func (c *config) GetWebSocketConfig() WebSocketConfig {
+	ws := c.services.WebSocketConfig
+	if ws.PendingTTL <= 0 {
+		ws.PendingTTL = defaultWebSocketPendingTTL
+	}
+	if ws.MaxPending <= 0 {
+		ws.MaxPending = defaultWebSocketMaxPending
+	}
+	if ws.PingInterval <= 0 {
+		ws.PingInterval = defaultWebSocketPing
+	}
+	// Ответ на ping должен успеть прийти до истечения ожидания
+	if ws.PongTimeout <= ws.PingInterval {
+		ws.PongTimeout = 2 * ws.PingInterval
+	}
+	if ws.WriteTimeout <= 0 {
+		ws.WriteTimeout = defaultWebSocketWrite
+	}
+	if ws.SendBuffer <= 0 {
+		ws.SendBuffer = defaultWebSocketSendBuffer
+	}
+	if ws.LongPollTimeout <= 0 {
+		ws.LongPollTimeout = defaultLongPollTimeout
+	}
+
+	return ws
+}
+
+func (c *config) GetWebhookConfig() WebhookConfig {
+	webhook := c.services.WebhookConfig
+	if webhook.Timeout <= 0 {
+		webhook.Timeout = defaultWebhookTimeout
+	}
+	if webhook.MaxAttempts <= 0 {
+		webhook.MaxAttempts = defaultWebhookMaxAttempts
+	}
+	if webhook.MinBackoff <= 0 {
+		webhook.MinBackoff = defaultWebhookMinBackoff
+	}
+	if webhook.MaxBackoff <= 0 {
+		webhook.MaxBackoff = defaultWebhookMaxBackoff
+	}
+	if webhook.MaxBackoff < webhook.MinBackoff {
+		webhook.MaxBackoff = webhook.MinBackoff
+	}
+
+	return webhook
+}
+
+func (c *config) GetHealthConfig() HealthConfig {
+	health := c.services.HealthConfig
+	if health.Timeout <= 0 {
+		health.Timeout = defaultHealthTimeout
+	}
+	if health.CacheTTL <= 0 {
+		health.CacheTTL = defaultHealthCacheTTL
+	}
+
+	return health
+}
+
 func (c *config) GetLogConfig() log.LoggerConfig {
 	return c.services.LogConfig
 }
@@ -147,3 +480,44 @@ func (c *config) GetS3Config() S3Config {
 func (c *config) GetRabbitMQConfig() RabbitMQConfig {
 	return c.services.RabbitMQConfig
 }
+
+func (c *config) GetResumableConfig() ResumableConfig {
+	resumable := c.services.ResumableConfig
+	if resumable.UploadTTL <= 0 {
+		resumable.UploadTTL = defaultResumableUploadTTL
+	}
+	if resumable.MaxChunkSize <= 0 {
+		resumable.MaxChunkSize = defaultResumableMaxChunkSize
+	}
+	if resumable.SweepInterval <= 0 {
+		resumable.SweepInterval = defaultResumableSweep
+	}
+	if resumable.PresignTTL <= 0 {
+		resumable.PresignTTL = defaultResumablePresignTTL
+	}
+	// Ссылка не должна пережить загрузку: состояние удалит очистка, и документ некому будет завершить
+	if resumable.PresignTTL > resumable.UploadTTL {
+		resumable.PresignTTL = resumable.UploadTTL
+	}
+
+	return resumable
+}
+
+func (c *config) GetScanConfig() ScanConfig {
+	scan := c.services.ScanConfig
+	if scan.ClamAVEnabled == nil {
+		enabled := true
+		scan.ClamAVEnabled = &enabled
+	}
+	if scan.ClamdTimeout <= 0 {
+		scan.ClamdTimeout = defaultClamdTimeout
+	}
+	if scan.PDFMaxDecodedSize <= 0 {
+		scan.PDFMaxDecodedSize = defaultPDFMaxDecodedSize
+	}
+	if scan.PDFMaxCompressionRatio <= 0 {
+		scan.PDFMaxCompressionRatio = defaultPDFMaxCompressionRatio
+	}
+
+	return scan
+}
@@ -13,3 +13,23 @@ type Handler interface {
 	// Do метод, который вызывается при обращении к ручке
 	Do(ctx echo.Context) error
 }
+
+type middlewareHandler struct {
+	Handler
+	do echo.HandlerFunc
+}
+
+// WithMiddlewares ручка handler, запросы к которой сначала проходят middlewares по порядку.
+// Промежуточные функции входят в саму ручку, поэтому их не отключить вместе с общими
+func WithMiddlewares(handler Handler, middlewares ...echo.MiddlewareFunc) Handler {
+	do := handler.Do
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		do = middlewares[i](do)
+	}
+
+	return &middlewareHandler{Handler: handler, do: do}
+}
+
+func (h *middlewareHandler) Do(ctx echo.Context) error {
+	return h.do(ctx)
+}
@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"gitlab.com/docshade/common/log"
+)
+
+// Task фоновая задача сервиса. Должна завершиться после отмены контекста,
+// дообработав то, что уже взяла в работу
+type Task func(ctx context.Context) error
+
+// Closer освобождение ресурса при остановке сервиса
+type Closer func(ctx context.Context) error
+
+type namedTask struct {
+	name string
+	run  Task
+}
+
+type namedCloser struct {
+	name  string
+	close Closer
+}
+
+// startTasks запускает зарегистрированные задачи. Первый канал закрывается, когда
+// завершились все задачи, во второй попадает ошибка задачи, завершившейся раньше времени
+func (m *microservice) startTasks(ctx context.Context) (<-chan struct{}, <-chan error) {
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	errs := make(chan error, len(m.tasks))
+
+	for _, task := range m.tasks {
+		wg.Add(1)
+		go func(task namedTask) {
+			defer wg.Done()
+
+			err := task.run(ctx)
+			if ctx.Err() != nil {
+				if err != nil {
+					log.Warnf("Task %s stopped with error: %v", task.name, err)
+				}
+				return
+			}
+			if err == nil {
+				err = fmt.Errorf("exited unexpectedly")
+			}
+			errs <- fmt.Errorf("task %s: %w", task.name, err)
+		}(task)
+	}
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done, errs
+}
+
+// shutdown останавливает сервис в порядке: HTTP сервер, фоновые задачи, ресурсы.
+// Весь процесс ограничен таймаутом из конфигурации. Возвращает false, если какой-то из шагов не удался
+func (m *microservice) shutdown(cancelTasks context.CancelFunc, tasksDone <-chan struct{}) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.GetShutdownTimeout())
+	defer cancel()
+
+	ok := true
+
+	if err := m.service.Shutdown(ctx); err != nil {
+		log.Errorf("Failed to drain HTTP server: %v", err)
+		ok = false
+	}
+
+	cancelTasks()
+	select {
+	case <-tasksDone:
+	case <-ctx.Done():
+		log.Errorf("Background tasks did not stop in time: %v", ctx.Err())
+		ok = false
+	}
+
+	for _, closer := range m.closers {
+		if err := closer.close(ctx); err != nil {
+			log.Errorf("Failed to close %s: %v", closer.name, err)
+			ok = false
+		}
+	}
+
+	log.Infof("Service stopped")
+
+	return ok
+}
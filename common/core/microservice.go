@@ -1,14 +1,24 @@
 package core
 
 import (
+	"context"
+	"errors"
+	stdhttp "net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/labstack/echo/v4"
 	echoSwagger "github.com/swaggo/echo-swagger"
+	"gitlab.com/docshade/common/health"
 	http "gitlab.com/docshade/common/http"
 	"gitlab.com/docshade/common/log"
+	"gitlab.com/docshade/common/metrics"
+	"gitlab.com/docshade/common/tracing"
 )
 
 type Microservice interface {
-	// Run запустить сервис
+	// Run запустить сервис и заблокироваться до его полной остановки
 	Run()
 	// GetService получить текущий эхо сервис
 	GetService() *echo.Echo
@@ -16,10 +26,16 @@ type Microservice interface {
 	DisableGlobalMiddleware() Microservice
 	// DisableMiddleware отключить промежуточные функции локального скоупа, относящиеся к конкретным хэндлерам
 	DisableMiddleware() Microservice
+	// AddTask зарегистрировать фоновую задачу, которая живёт вместе с сервисом
+	AddTask(name string, task Task) Microservice
+	// AddCloser зарегистрировать освобождение ресурса, выполняется после остановки задач в порядке регистрации
+	AddCloser(name string, closer Closer) Microservice
 }
 type microservice struct {
 	config  Config
 	service *echo.Echo
+	tasks   []namedTask
+	closers []namedCloser
 
 	disableGlobalMiddleware bool
 	disableMiddleware       bool
@@ -40,14 +56,67 @@ func NewMicroservice(
 	}
 }
 
-// Run запустить сервис на исполнение
+// Run запустить сервис на исполнение.
+// Блокируется до получения SIGINT/SIGTERM или падения одной из задач, после чего
+// останавливает HTTP сервер, дожидается завершения задач и закрывает ресурсы.
 func (m *microservice) Run() {
+	if err := m.initTracing(); err != nil {
+		log.Fatalf("Failed to configure tracing: %v", err)
+	}
+
 	globalGroup := m.configureGlobalMiddlewares(m.service)
 	m.addRoutes(globalGroup)
 	m.addSwagger(m.service)
+	m.addMetrics(m.service)
+	m.addHealth(m.service)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	failed := false
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- m.service.Start(":" + m.config.GetPort())
+	}()
+
+	tasksCtx, cancelTasks := context.WithCancel(context.Background())
+	defer cancelTasks()
+	tasksDone, taskErrs := m.startTasks(tasksCtx)
+
+	select {
+	case <-ctx.Done():
+		log.Infof("Shutdown signal received")
+	case err := <-serverErr:
+		if err != nil && !errors.Is(err, stdhttp.ErrServerClosed) {
+			log.Errorf("HTTP server stopped: %v", err)
+			failed = true
+		}
+	case err := <-taskErrs:
+		log.Errorf("Background task failed: %v", err)
+		failed = true
+	}
+
+	if !m.shutdown(cancelTasks, tasksDone) {
+		failed = true
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func (m *microservice) AddTask(name string, task Task) Microservice {
+	m.tasks = append(m.tasks, namedTask{name: name, run: task})
 
-	m.service.Logger.Fatal(m.service.Start(":" + m.config.GetPort()))
+	return m
+}
+
+func (m *microservice) AddCloser(name string, closer Closer) Microservice {
+	m.closers = append(m.closers, namedCloser{name: name, close: closer})
+
+	return m
 }
+
 func (m *microservice) GetService() *echo.Echo {
 	return m.service
 }
@@ -79,6 +148,8 @@ func (m *microservice) addRoutes(globalGroup *echo.Group) {
 			globalGroup.DELETE(handler.GetRoute(), handler.Do, middlewares...)
 		case http.PatchMethod:
 			globalGroup.PATCH(handler.GetRoute(), handler.Do, middlewares...)
+		case http.HeadMethod:
+			globalGroup.HEAD(handler.GetRoute(), handler.Do, middlewares...)
 		}
 	}
 }
@@ -87,6 +158,8 @@ func (m *microservice) configureGlobalMiddlewares(service *echo.Echo) *echo.Grou
 	service.Use(
 		echo.WrapMiddleware(log.RequestIDMiddleware),
 		log.EchoLogger(),
+		metrics.EchoMiddleware(),
+		tracing.EchoMiddleware(),
 	)
 
 	if m.disableGlobalMiddleware {
@@ -105,3 +178,17 @@ func (m *microservice) configureGlobalMiddlewares(service *echo.Echo) *echo.Grou
 func (m *microservice) addSwagger(service *echo.Echo) {
 	service.GET(http.SwaggerRoute, echoSwagger.WrapHandler)
 }
+
+func (m *microservice) addMetrics(service *echo.Echo) {
+	service.GET(http.MetricsRoute, echo.WrapHandler(metrics.Handler()))
+}
+
+// addHealth пробы живости и готовности. Проверки зависимостей регистрируют провайдеры в health.Default
+func (m *microservice) addHealth(service *echo.Echo) {
+	cfg := m.config.GetHealthConfig()
+	registry := health.Default()
+	registry.Configure(cfg.Timeout, cfg.CacheTTL)
+
+	service.GET(http.LivenessRoute, echo.WrapHandler(health.LivenessHandler()))
+	service.GET(http.ReadinessRoute, echo.WrapHandler(registry.ReadinessHandler()))
+}
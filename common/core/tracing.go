@@ -0,0 +1,51 @@
+package core
+
+import (
+	"context"
+
+	"gitlab.com/docshade/common/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// initTracing настраивает глобальные трассировщик и формат распространения контекста.
+// Без адреса коллектора спаны не экспортируются, но контекст трассировки всё равно передаётся дальше,
+// чтобы не рвать трассировку, начатую в другом сервисе
+func (m *microservice) initTracing() error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	cfg := m.config.GetTracingConfig()
+	if cfg.Endpoint == "" {
+		return nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	// Закрывается последним, чтобы выгрузить и спаны, записанные при закрытии остальных ресурсов
+	m.AddCloser("tracing", provider.Shutdown)
+	log.Infof("Exporting traces of %s to %s", cfg.ServiceName, cfg.Endpoint)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+// Package database общий пул соединений с Postgres. Сервис открывает один пул и передаёт его
+// всем хранилищам, которые работают с этой базой
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// connectAttempts попытки первого подключения, после которых сервис не стартует
+	connectAttempts = 10
+	retryDelay      = 5 * time.Second
+)
+
+// Connect открывает пул и ждёт, пока база начнёт отвечать: при общем старте она может подняться
+// позже сервиса. Ожидание прерывается отменой ctx. Пул закрывает вызывающий
+func Connect(ctx context.Context, cfg core.PostgresConfig) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, ConnString(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = pool.Ping(ctx)
+		if err == nil {
+			return pool, nil
+		}
+
+		log.Printf("Failed to connect to Postgres (attempt %d of %d): %v", attempt, connectAttempts, err)
+		if attempt == connectAttempts || ctx.Err() != nil {
+			break
+		}
+		if err = sleep(ctx, retryDelay); err != nil {
+			break
+		}
+	}
+
+	pool.Close()
+
+	return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+}
+
+// ConnString строка подключения к базе из конфигурации
+func ConnString(cfg core.PostgresConfig) string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.UserName, cfg.Password),
+		Host:   net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:   cfg.DBName,
+	}
+
+	return u.String()
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,173 @@
+// Package formats реестр поддерживаемых форматов документов и их определение по содержимому
+package formats
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// SniffSize сколько первых байт документа нужно для определения формата
+const SniffSize = 8 << 10
+
+// ErrUnsupported формат документа не поддерживается
+var ErrUnsupported = errors.New("unsupported document format")
+
+// Format поддерживаемый формат документа
+type Format struct {
+	// Name короткое имя формата, передаётся в сообщениях между сервисами
+	Name      string
+	MediaType string
+	Extension string
+}
+
+var (
+	PDF  = Format{Name: "pdf", MediaType: "application/pdf", Extension: ".pdf"}
+	DOCX = Format{Name: "docx", MediaType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", Extension: ".docx"}
+	TXT  = Format{Name: "txt", MediaType: "text/plain; charset=utf-8", Extension: ".txt"}
+	CSV  = Format{Name: "csv", MediaType: "text/csv; charset=utf-8", Extension: ".csv"}
+	PNG  = Format{Name: "png", MediaType: "image/png", Extension: ".png"}
+	JPEG = Format{Name: "jpeg", MediaType: "image/jpeg", Extension: ".jpg"}
+	TIFF = Format{Name: "tiff", MediaType: "image/tiff", Extension: ".tiff"}
+)
+
+// Default формат документов, загруженных до появления реестра
+var Default = PDF
+
+var registry = []Format{PDF, DOCX, TXT, CSV, PNG, JPEG, TIFF}
+
+// ObjectKey ключ документа в хранилище
+func (f Format) ObjectKey(documentID string) string {
+	return documentID + f.Extension
+}
+
+// All поддерживаемые форматы
+func All() []Format {
+	return append([]Format(nil), registry...)
+}
+
+// Names имена поддерживаемых форматов через запятую, для сообщений об ошибках
+func Names() string {
+	names := make([]string, 0, len(registry))
+	for _, format := range registry {
+		names = append(names, format.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// ByName формат по имени из сообщения
+func ByName(name string) (Format, bool) {
+	for _, format := range registry {
+		if format.Name == name {
+			return format, true
+		}
+	}
+
+	return Format{}, false
+}
+
+// Sniff определяет формат по первым байтам потока. Возвращённый поток отдаёт документ целиком,
+// включая прочитанные для определения байты
+func Sniff(r io.Reader) (Format, io.Reader, error) {
+	buffered := bufio.NewReaderSize(r, SniffSize)
+
+	head, err := buffered.Peek(SniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return Format{}, nil, err
+	}
+
+	format, err := Detect(head, len(head) < SniffSize)
+	if err != nil {
+		return Format{}, nil, err
+	}
+
+	return format, buffered, nil
+}
+
+// Detect определяет формат по началу документа. complete означает, что head содержит документ целиком
+func Detect(head []byte, complete bool) (Format, error) {
+	switch {
+	case bytes.HasPrefix(head, []byte("%PDF-")):
+		return PDF, nil
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case bytes.HasPrefix(head, []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG, nil
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return TIFF, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		// DOCX это ZIP архив, отличить его от других архивов можно по каталогу word/
+		if bytes.Contains(head, []byte("word/")) {
+			return DOCX, nil
+		}
+		return Format{}, ErrUnsupported
+	case isText(head, complete):
+		if isCSV(head, complete) {
+			return CSV, nil
+		}
+		return TXT, nil
+	default:
+		return Format{}, ErrUnsupported
+	}
+}
+
+// isText UTF-8 текст без управляющих символов, кроме переводов строк и табуляции
+func isText(head []byte, complete bool) bool {
+	head = bytes.TrimPrefix(head, []byte("\xEF\xBB\xBF"))
+	if len(head) == 0 {
+		return false
+	}
+
+	for len(head) > 0 {
+		r, size := utf8.DecodeRune(head)
+		if r == utf8.RuneError && size <= 1 {
+			// Окно могло разрезать последний символ пополам
+			return !complete && !utf8.FullRune(head)
+		}
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' || r == 0x7F {
+			return false
+		}
+		head = head[size:]
+	}
+
+	return true
+}
+
+// isCSV в первых строках одинаковое ненулевое количество разделителей
+func isCSV(head []byte, complete bool) bool {
+	lines := bytes.Split(bytes.TrimRight(head, "\r\n"), []byte("\n"))
+	if !complete && len(lines) > 1 {
+		// Последняя строка окна может быть обрезана
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 5 {
+		lines = lines[:5]
+	}
+	if len(lines) < 2 {
+		return false
+	}
+
+	for _, delimiter := range []byte{',', ';', '\t'} {
+		count := bytes.Count(lines[0], []byte{delimiter})
+		if count == 0 {
+			continue
+		}
+
+		consistent := true
+		for _, line := range lines[1:] {
+			if bytes.Count(line, []byte{delimiter}) != count {
+				consistent = false
+				break
+			}
+		}
+		if consistent {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,109 @@
+package formats
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestSniff(t *testing.T) {
+	// longText текст длиннее окна, последний символ которого разрезан границей окна
+	longText := strings.Repeat("a", SniffSize-1) + "ж" + "конец"
+	// longCSV таблица длиннее окна, последняя строка окна обрезана
+	longCSV := strings.Repeat("id;name;email\n", SniffSize/14) + "1;Иван;ivan@example.com\n"
+
+	testCases := []struct {
+		name   string
+		data   []byte
+		format Format
+		err    error
+	}{
+		{name: "pdf", data: []byte("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n1 0 obj"), format: PDF},
+		{name: "png", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), format: PNG},
+		{name: "jpeg", data: []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F'}, format: JPEG},
+		{name: "tiff little endian", data: []byte("II*\x00\x08\x00\x00\x00"), format: TIFF},
+		{name: "tiff big endian", data: []byte("MM\x00*\x00\x00\x00\x08"), format: TIFF},
+		{name: "docx", data: []byte("PK\x03\x04\x14\x00\x06\x00word/document.xml"), format: DOCX},
+		{name: "txt", data: []byte("Договор № 15\r\nФИО: Иванов Иван\tИванович\n"), format: TXT},
+		{name: "txt with bom", data: []byte("\xEF\xBB\xBFпривет"), format: TXT},
+		{name: "csv", data: []byte("id,name\n1,Иван\n2,Пётр\n"), format: CSV},
+		{name: "csv with tabs", data: []byte("id\tname\n1\tИван\n"), format: CSV},
+		{name: "long txt cut inside a rune", data: []byte(longText), format: TXT},
+		{name: "long csv cut inside a line", data: []byte(longCSV), format: CSV},
+
+		{name: "empty", data: nil, err: ErrUnsupported},
+		{name: "truncated png magic", data: []byte("\x89PN"), err: ErrUnsupported},
+		{name: "truncated jpeg magic", data: []byte{0xFF, 0xD8}, err: ErrUnsupported},
+		{name: "truncated tiff magic", data: []byte("MM\x00"), err: ErrUnsupported},
+		{name: "complete text ending inside a rune", data: []byte("привет\xD0"), err: ErrUnsupported},
+		{name: "binary", data: []byte("\x00\x01\x02\x03"), err: ErrUnsupported},
+		{name: "zip without word directory", data: []byte("PK\x03\x04\x14\x00\x00\x00data.bin"), err: ErrUnsupported},
+		{name: "text with control characters", data: []byte("hello\x1bworld"), err: ErrUnsupported},
+		{name: "executable", data: []byte("MZ\x90\x00\x03\x00"), err: ErrUnsupported},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			format, body, err := Sniff(bytes.NewReader(tc.data))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if format != tc.format {
+				t.Fatalf("expected %s, got %s", tc.format.Name, format.Name)
+			}
+
+			// Прочитанные для определения байты возвращаются вместе с остальным документом
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatalf("failed to read document: %v", err)
+			}
+			if !bytes.Equal(got, tc.data) {
+				t.Fatalf("document changed after sniffing")
+			}
+		})
+	}
+}
+
+func TestSniff_MislabelledExtension(t *testing.T) {
+	// Формат определяется по содержимому, имя файла и его расширение не учитываются
+	testCases := []struct {
+		fileName string
+		data     []byte
+		format   Format
+		err      error
+	}{
+		{fileName: "scan.pdf", data: []byte("\x89PNG\r\n\x1a\n"), format: PNG},
+		{fileName: "photo.png", data: []byte("%PDF-1.4\n"), format: PDF},
+		{fileName: "contract.docx", data: []byte("plain text contract"), format: TXT},
+		{fileName: "table.csv", data: []byte{0xFF, 0xD8, 0xFF, 0xDB}, format: JPEG},
+		{fileName: "report.txt", data: []byte("a;b\n1;2\n"), format: CSV},
+		{fileName: "report.pdf", data: []byte("MZ\x90\x00"), err: ErrUnsupported},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fileName, func(t *testing.T) {
+			format, _, err := Sniff(bytes.NewReader(tc.data))
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if format != tc.format {
+				t.Fatalf("expected %q, got %q", tc.format.Name, format.Name)
+			}
+		})
+	}
+}
+
+func TestSniff_ReadError(t *testing.T) {
+	readErr := errors.New("connection reset")
+
+	_, _, err := Sniff(io.MultiReader(strings.NewReader("%PDF-"), iotest.ErrReader(readErr)))
+	if !errors.Is(err, readErr) {
+		t.Fatalf("expected read error, got %v", err)
+	}
+}
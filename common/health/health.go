@@ -0,0 +1,206 @@
+// Package health проверки зависимостей сервиса для проб живости и готовности
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/docshade/common/metrics"
+)
+
+const (
+	// DefaultTimeout время, за которое зависимость должна ответить на проверку
+	DefaultTimeout = 2 * time.Second
+	// DefaultCacheTTL сколько переиспользовать результат проверки, чтобы частые пробы не нагружали зависимости
+	DefaultCacheTTL = 5 * time.Second
+)
+
+// Status результат проверки
+type Status string
+
+const (
+	StatusUp   Status = "up"
+	StatusDown Status = "down"
+)
+
+// CheckFunc проверяет доступность зависимости, nil означает, что она готова
+type CheckFunc func(ctx context.Context) error
+
+// Result результат проверки одной зависимости
+type Result struct {
+	Name      string    `json:"name"`
+	Status    Status    `json:"status"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report результаты всех проверок, сервис готов, только если готовы все зависимости
+type Report struct {
+	Status Status   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+var dependencyUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "health",
+	Name:      "dependency_up",
+	Help:      "Whether the last readiness check of a dependency succeeded.",
+}, []string{"dependency"})
+
+type check struct {
+	name string
+	fn   CheckFunc
+
+	// mu один запуск проверки на всех, кто пришёл за результатом одновременно
+	mu        sync.Mutex
+	result    Result
+	checkedAt time.Time
+}
+
+// Registry проверки зависимостей, которые регистрируют провайдеры
+type Registry struct {
+	mu       sync.RWMutex
+	checks   map[string]*check
+	timeout  time.Duration
+	cacheTTL time.Duration
+}
+
+// NewRegistry пустой реестр проверок
+func NewRegistry(timeout, cacheTTL time.Duration) *Registry {
+	return &Registry{
+		checks:   make(map[string]*check),
+		timeout:  timeout,
+		cacheTTL: cacheTTL,
+	}
+}
+
+var defaultRegistry = NewRegistry(DefaultTimeout, DefaultCacheTTL)
+
+// Default реестр, в котором регистрируют проверки провайдеры и который отдаёт core
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Register добавляет проверку в реестр по умолчанию
+func Register(name string, fn CheckFunc) {
+	defaultRegistry.Register(name, fn)
+}
+
+// Register добавляет проверку зависимости, проверка с тем же именем заменяется
+func (r *Registry) Register(name string, fn CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checks[name] = &check{name: name, fn: fn}
+}
+
+// Configure меняет таймаут проверок и время жизни их результатов
+func (r *Registry) Configure(timeout, cacheTTL time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.timeout = timeout
+	r.cacheTTL = cacheTTL
+}
+
+// Check выполняет проверки параллельно, свежие результаты берутся из кэша
+func (r *Registry) Check(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make([]*check, 0, len(r.checks))
+	for _, c := range r.checks {
+		checks = append(checks, c)
+	}
+	timeout, cacheTTL := r.timeout, r.cacheTTL
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, timeout, cacheTTL)
+		}(i, c)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+
+	report := Report{Status: StatusUp, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusUp {
+			report.Status = StatusDown
+		}
+	}
+
+	return report
+}
+
+func (c *check) run(ctx context.Context, timeout, cacheTTL time.Duration) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < cacheTTL {
+		return c.result
+	}
+
+	// Результат кэшируется для всех, поэтому отмена запроса одного клиента не должна его испортить
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.fn(ctx)
+	result := Result{
+		Name:      c.name,
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		CheckedAt: start.UTC(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+		dependencyUp.WithLabelValues(c.name).Set(0)
+	} else {
+		dependencyUp.WithLabelValues(c.name).Set(1)
+	}
+
+	c.result = result
+	c.checkedAt = start
+
+	return result
+}
+
+// LivenessHandler отвечает, пока процесс способен обслуживать запросы. Зависимости здесь не проверяются:
+// их недоступность не лечится перезапуском сервиса
+func LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusUp, Checks: []Result{}})
+	})
+}
+
+// ReadinessHandler отвечает 200, если готовы все зависимости, и 503 с отчётом по каждой в противном случае
+func (r *Registry) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		report := r.Check(request.Context())
+
+		status := http.StatusOK
+		if report.Status != StatusUp {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
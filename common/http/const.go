@@ -9,6 +9,7 @@ const (
 	PostMethod
 	DeleteMethod
 	PatchMethod
+	HeadMethod
 )
 
 // MaskHeaders карта заголовков
@@ -18,7 +19,35 @@ const (
 	AccessToken = "AccessToken"
 )
 
-// SwaggerRoute путь до сваггера
+// Заголовки протокола возобновляемой загрузки tus
 const (
+	TusResumableHeader   = "Tus-Resumable"
+	UploadOffsetHeader   = "Upload-Offset"
+	UploadLengthHeader   = "Upload-Length"
+	UploadMetadataHeader = "Upload-Metadata"
+	UploadExpiresHeader  = "Upload-Expires"
+	// TusVersion поддерживаемая версия протокола
+	TusVersion = "1.0.0"
+	// OffsetOctetStream тип тела запроса с частью загрузки
+	OffsetOctetStream = "application/offset+octet-stream"
+)
+
+const (
+	// SwaggerRoute путь до сваггера
 	SwaggerRoute = "/swagger/*"
+	// MetricsRoute путь, по которому Prometheus забирает метрики сервиса
+	MetricsRoute = "/metrics"
+	// LivenessRoute проба живости процесса
+	LivenessRoute = "/livez"
+	// ReadinessRoute проба готовности с проверкой зависимостей
+	ReadinessRoute = "/readyz"
+)
+
+const (
+	// WebSocketRoute подключение к уведомлениям сессии по WebSocket
+	WebSocketRoute = "/ws/:id"
+	// EventsRoute поток уведомлений сессии Server-Sent Events
+	EventsRoute = "/v1/sessions/:id/events"
+	// LongPollRoute ожидание уведомлений сессии long-poll запросом
+	LongPollRoute = "/v1/sessions/:id/poll"
 )
@@ -0,0 +1,105 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/docshade/common/backplane"
+)
+
+// AfterParam параметр long-poll запроса с номером последнего полученного сообщения
+const AfterParam = "after"
+
+// PollEvent сообщение сессии в ответе long-poll
+type PollEvent struct {
+	ID   int64           `json:"id"`
+	Data json.RawMessage `json:"data"`
+}
+
+// PollResponse ответ long-poll запроса
+type PollResponse struct {
+	// Events сообщения после запрошенного номера, пустой список, если за время ожидания ничего не пришло
+	Events []PollEvent `json:"events"`
+	// LastEventID номер, который нужно передать в параметре after следующего запроса
+	LastEventID int64 `json:"last_event_id"`
+}
+
+// LongPollTransport доставка уведомлений long-poll запросами для клиентов, которым недоступны
+// ни WebSocket, ни SSE. Запрос сразу возвращает накопленные сообщения, а если их нет,
+// ждёт первого сообщения не дольше LongPollTimeout
+type LongPollTransport struct {
+	hub *NotificationHub
+}
+
+func NewLongPollTransport(hub *NotificationHub) *LongPollTransport {
+	return &LongPollTransport{hub: hub}
+}
+
+func (t *LongPollTransport) RegisterRoutes(e *echo.Echo) {
+	e.GET(LongPollRoute, t.handle)
+}
+
+func (t *LongPollTransport) handle(c echo.Context) error {
+	clientID, ok, err := t.hub.authorize(c)
+	if !ok {
+		return err
+	}
+
+	after, err := parseEventID(c.QueryParam(AfterParam))
+	if err != nil {
+		return ReturnBadRequestError(c, err, "Parameter after must be a message number")
+	}
+
+	ctx := context.WithoutCancel(c.Request().Context())
+	sub := t.hub.attach(ctx, clientID, "long_poll")
+	defer close(sub.done)
+
+	pending := t.hub.pending(ctx, clientID, after)
+	var live []backplane.Message
+	if len(pending) == 0 {
+		timer := time.NewTimer(t.hub.opts.LongPollTimeout)
+		defer timer.Stop()
+
+		select {
+		case msg := <-sub.send:
+			live = append(live, msg)
+		case <-timer.C:
+		case <-sub.quit:
+		case <-c.Request().Context().Done():
+		}
+	}
+
+	t.hub.remove(ctx, sub)
+	// Живые сообщения, пришедшие до снятия подписки, уходят в этом же ответе
+	live = append(live, drainSend(sub)...)
+
+	if c.Request().Context().Err() != nil {
+		// Клиент ушёл, не дождавшись ответа: сообщения дождутся следующего запроса
+		t.hub.requeue(ctx, clientID, pending...)
+		if !t.hub.hasClients(clientID) {
+			t.hub.requeue(ctx, clientID, live...)
+		}
+		return nil
+	}
+
+	response := pollResponse(after, append(pending, live...))
+	notificationsDelivered.WithLabelValues(sub.transport).Add(float64(len(response.Events)))
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// pollResponse собирает ответ; без сообщений номер для следующего запроса остаётся прежним
+func pollResponse(after int64, messages []backplane.Message) PollResponse {
+	response := PollResponse{Events: make([]PollEvent, 0, len(messages)), LastEventID: after}
+	for _, msg := range messages {
+		response.Events = append(response.Events, PollEvent{ID: msg.ID, Data: msg.Body})
+		if msg.ID > response.LastEventID {
+			response.LastEventID = msg.ID
+		}
+	}
+
+	return response
+}
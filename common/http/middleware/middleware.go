@@ -3,6 +3,7 @@ package middleware
 import (
 	"github.com/labstack/echo/v4"
 	echomw "github.com/labstack/echo/v4/middleware"
+	httpUtils "gitlab.com/docshade/common/http"
 	"net/http"
 )
 
@@ -18,18 +19,22 @@ type BaseMW struct {
 	JwtValidationMiddleware echo.MiddlewareFunc
 }
 
-// NewBaseMiddleware базовый набор промежуточный функций
-func NewBaseMiddleware() *BaseMW {
+// NewBaseMiddleware базовый набор промежуточный функций, CORS разрешён источникам allowedOrigins
+func NewBaseMiddleware(allowedOrigins []string) *BaseMW {
 	return &BaseMW{
-		CorsConfigMiddleware: CorsConfigMiddleware(),
+		CorsConfigMiddleware: CorsConfigMiddleware(allowedOrigins),
 	}
 }
 
-func CorsConfigMiddleware() echo.MiddlewareFunc {
+func CorsConfigMiddleware(allowedOrigins []string) echo.MiddlewareFunc {
 	defaultConfig := echomw.CORSConfig{
-		Skipper:      echomw.DefaultSkipper,
-		AllowOrigins: []string{"*"},
+		Skipper: echomw.DefaultSkipper,
+		AllowOriginFunc: func(origin string) (bool, error) {
+			return httpUtils.OriginAllowed(allowedOrigins, origin), nil
+		},
 		AllowMethods: []string{http.MethodGet, http.MethodHead, http.MethodPut, http.MethodPatch, http.MethodPost, http.MethodDelete},
+		// Заголовки возобновляемой загрузки должны быть видны браузерным клиентам
+		ExposeHeaders: []string{echo.HeaderLocation, httpUtils.TusResumableHeader, httpUtils.UploadOffsetHeader, httpUtils.UploadLengthHeader, httpUtils.UploadExpiresHeader},
 	}
 
 	return echomw.CORSWithConfig(defaultConfig)
@@ -0,0 +1,426 @@
+package http
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/docshade/common/backplane"
+	"gitlab.com/docshade/common/metrics"
+)
+
+// SessionTokenParam параметр запроса с токеном доступа к сессии: браузер не даёт задать заголовки
+// ни WebSocket, ни EventSource
+const SessionTokenParam = "token"
+
+// presenceRefresh период продления отметок о подключении клиентов этой реплики
+const presenceRefresh = backplane.PresenceTTL / 3
+
+var (
+	notificationSubscribers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "notifications",
+		Name:      "subscribers",
+		Help:      "Number of clients waiting for session notifications on this replica.",
+	}, []string{"transport"})
+
+	notificationsDelivered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "notifications",
+		Name:      "delivered_messages_total",
+		Help:      "Number of messages written to clients of this replica, live or after reconnect.",
+	}, []string{"transport"})
+
+	notificationSlowSubscribers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "notifications",
+		Name:      "slow_subscriber_disconnects_total",
+		Help:      "Number of clients disconnected because their send buffer was full.",
+	}, []string{"transport"})
+)
+
+// TokenVerifier проверяет токен доступа к сессии, например session.Signer
+type TokenVerifier interface {
+	Verify(sessionID, token string) error
+}
+
+// Transport способ доставки уведомлений клиенту: WebSocket, SSE или long-poll
+type Transport interface {
+	// RegisterRoutes добавить обработчики подключения клиентов
+	RegisterRoutes(e *echo.Echo)
+}
+
+// RegisterNotificationRoutes подключает маршруты всех транспортов уведомлений
+func RegisterNotificationRoutes(e *echo.Echo, transports ...Transport) {
+	for _, transport := range transports {
+		transport.RegisterRoutes(e)
+	}
+}
+
+// NotificationOptions настройки доставки уведомлений клиентам
+type NotificationOptions struct {
+	// AllowedOrigins источники, с которых браузеру разрешено подключаться к WebSocket
+	AllowedOrigins []string
+	// PingInterval период проверки связи: ping кадры WebSocket и комментарии SSE, которые не дают прокси закрыть поток
+	PingInterval time.Duration
+	// PongTimeout сколько ждать любого кадра от клиента WebSocket, должен быть больше PingInterval
+	PongTimeout time.Duration
+	// WriteTimeout предельное время записи одного сообщения
+	WriteTimeout time.Duration
+	// SendBuffer сколько сообщений может ждать отправки одному клиенту
+	SendBuffer int
+	// LongPollTimeout сколько держать long-poll запрос, если сообщений нет
+	LongPollTimeout time.Duration
+}
+
+// subscriber один подключённый клиент любого транспорта. Писать клиенту может только
+// обработчик транспорта, остальные передают сообщения через send
+type subscriber struct {
+	sessionID string
+	transport string
+	send      chan backplane.Message
+	// quit закрывается, когда клиент убран из хаба и обработчик должен завершиться
+	quit     chan struct{}
+	quitOnce sync.Once
+	// done закрывает обработчик транспорта, когда перестал писать клиенту
+	done chan struct{}
+}
+
+func (s *subscriber) stop() {
+	s.quitOnce.Do(func() { close(s.quit) })
+}
+
+// streamWriter запись в долгоживущее соединение клиента: WebSocket или поток SSE
+type streamWriter interface {
+	WriteMessage(msg backplane.Message) error
+	Ping() error
+	// Close завершает поток; graceful — поток закрывает сервер, а не ошибка записи
+	Close(graceful bool)
+}
+
+// NotificationHub держит клиентов этой реплики всех транспортов, у одной сессии их может быть несколько.
+// Сообщения доставляются через backplane: отправить сообщение сессии можно с любой реплики,
+// а неподключённый клиент получит его при подключении
+type NotificationHub struct {
+	backplane backplane.Backplane
+	tokens    TokenVerifier
+	opts      NotificationOptions
+	clients   map[string]map[*subscriber]struct{}
+	mu        sync.Mutex
+}
+
+// NewNotificationHub принимает клиентов только с действующим токеном сессии
+func NewNotificationHub(bp backplane.Backplane, tokens TokenVerifier, opts NotificationOptions) *NotificationHub {
+	return &NotificationHub{
+		backplane: bp,
+		tokens:    tokens,
+		opts:      opts,
+		clients:   make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// authorize проверяет токен сессии из запроса. Если он не подошёл, ответ клиенту уже записан
+func (hub *NotificationHub) authorize(c echo.Context) (string, bool, error) {
+	sessionID := c.Param("id")
+	if err := hub.tokens.Verify(sessionID, c.QueryParam(SessionTokenParam)); err != nil {
+		return "", false, ReturnUnauthorizedError(c, err, "Session token is missing, invalid or expired")
+	}
+
+	return sessionID, true, nil
+}
+
+// attach добавляет клиента в хаб и отмечает сессию в backplane. Клиент попадает к хабу до отметки,
+// а очередь сессии выбирается в pending после неё: сообщение либо уже лежит в очереди, либо придёт в send
+func (hub *NotificationHub) attach(ctx context.Context, sessionID, transport string) *subscriber {
+	sub := &subscriber{
+		sessionID: sessionID,
+		transport: transport,
+		send:      make(chan backplane.Message, hub.opts.SendBuffer),
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	hub.mu.Lock()
+	if hub.clients[sessionID] == nil {
+		hub.clients[sessionID] = make(map[*subscriber]struct{})
+	}
+	hub.clients[sessionID][sub] = struct{}{}
+	notificationSubscribers.WithLabelValues(transport).Inc()
+	hub.mu.Unlock()
+
+	if err := hub.backplane.Register(ctx, sessionID); err != nil {
+		log.Printf("Failed to register client %s in backplane: %v", sessionID, err)
+	}
+
+	return sub
+}
+
+// pending забирает сообщения, накопленные до подключения, кроме уже полученных клиентом
+func (hub *NotificationHub) pending(ctx context.Context, sessionID string, lastEventID int64) []backplane.Message {
+	queued, err := hub.backplane.Drain(ctx, sessionID)
+	if err != nil {
+		log.Printf("Failed to load queued messages for client %s: %v", sessionID, err)
+		return nil
+	}
+
+	messages := queued[:0]
+	for _, msg := range queued {
+		// Сообщения без номера сохранены до появления номеров, клиент их получить не мог
+		if msg.ID == 0 || msg.ID > lastEventID {
+			messages = append(messages, msg)
+		}
+	}
+
+	return messages
+}
+
+// stream пишет клиенту сначала сообщения, накопленные до подключения, затем живые сообщения
+// и проверки связи, пока клиента не уберут из хаба или запись не сорвётся
+func (hub *NotificationHub) stream(ctx context.Context, sub *subscriber, pending []backplane.Message, w streamWriter) {
+	defer close(sub.done)
+
+	ticker := time.NewTicker(hub.opts.PingInterval)
+	defer ticker.Stop()
+
+	for i, msg := range pending {
+		if err := w.WriteMessage(msg); err != nil {
+			log.Printf("Failed to send queued message to client %s: %v", sub.sessionID, err)
+			// Накопленные сообщения забрал только этот клиент
+			hub.requeue(ctx, sub.sessionID, pending[i:]...)
+			hub.stopSubscriber(ctx, sub)
+			w.Close(false)
+			return
+		}
+		notificationsDelivered.WithLabelValues(sub.transport).Inc()
+	}
+	if len(pending) > 0 {
+		log.Printf("Sent %d queued messages to client %s", len(pending), sub.sessionID)
+	}
+
+	for {
+		select {
+		case msg := <-sub.send:
+			if err := w.WriteMessage(msg); err != nil {
+				log.Printf("Failed to send message to client %s: %v", sub.sessionID, err)
+				hub.stopSubscriber(ctx, sub, msg)
+				w.Close(false)
+				return
+			}
+			notificationsDelivered.WithLabelValues(sub.transport).Inc()
+		case <-ticker.C:
+			if err := w.Ping(); err != nil {
+				hub.stopSubscriber(ctx, sub)
+				w.Close(false)
+				return
+			}
+		case <-sub.quit:
+			w.Close(true)
+			hub.requeueUnsent(ctx, sub)
+			return
+		}
+	}
+}
+
+// stopSubscriber убирает клиента после ошибки записи; failed сообщение, которое не удалось записать
+func (hub *NotificationHub) stopSubscriber(ctx context.Context, sub *subscriber, failed ...backplane.Message) {
+	hub.remove(ctx, sub)
+	if !hub.hasClients(sub.sessionID) {
+		hub.requeue(ctx, sub.sessionID, failed...)
+	}
+	hub.requeueUnsent(ctx, sub)
+}
+
+// requeueUnsent возвращает в очередь сессии сообщения из буфера убранного клиента.
+// Если у сессии есть другие клиенты, они эти сообщения уже получили
+func (hub *NotificationHub) requeueUnsent(ctx context.Context, sub *subscriber) {
+	unsent := drainSend(sub)
+	if len(unsent) == 0 || hub.hasClients(sub.sessionID) {
+		return
+	}
+	hub.requeue(ctx, sub.sessionID, unsent...)
+}
+
+func drainSend(sub *subscriber) []backplane.Message {
+	var unsent []backplane.Message
+	for {
+		select {
+		case msg := <-sub.send:
+			unsent = append(unsent, msg)
+		default:
+			return unsent
+		}
+	}
+}
+
+// remove убирает клиента из хаба и снимает отметку в backplane, если он был последним у сессии
+func (hub *NotificationHub) remove(ctx context.Context, sub *subscriber) {
+	hub.mu.Lock()
+	removed := hub.removeLocked(sub)
+	last := len(hub.clients[sub.sessionID]) == 0
+	if last {
+		delete(hub.clients, sub.sessionID)
+	}
+	hub.mu.Unlock()
+
+	if removed && last {
+		if err := hub.backplane.Unregister(ctx, sub.sessionID); err != nil {
+			log.Printf("Failed to unregister client %s in backplane: %v", sub.sessionID, err)
+		}
+	}
+}
+
+// removeLocked вызывается под hub.mu, возвращает false, если клиент уже убран
+func (hub *NotificationHub) removeLocked(sub *subscriber) bool {
+	clients := hub.clients[sub.sessionID]
+	if _, ok := clients[sub]; !ok {
+		return false
+	}
+
+	delete(clients, sub)
+	notificationSubscribers.WithLabelValues(sub.transport).Dec()
+	sub.stop()
+
+	return true
+}
+
+func (hub *NotificationHub) hasClients(sessionID string) bool {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	return len(hub.clients[sessionID]) > 0
+}
+
+// SendMessageToClient отправляет сообщение сессии, к какой бы реплике ни были подключены её клиенты
+func (hub *NotificationHub) SendMessageToClient(ctx context.Context, clientID string, message []byte) error {
+	return hub.backplane.Publish(ctx, clientID, message)
+}
+
+// Run получает сообщения для клиентов этой реплики и продлевает их отметки о подключении,
+// пока не отменят контекст
+func (hub *NotificationHub) Run(ctx context.Context) error {
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		hub.refreshPresence(ctx)
+	}()
+	defer func() { <-refreshed }()
+
+	return hub.backplane.Subscribe(ctx, hub.deliver)
+}
+
+// deliver передаёт сообщение из backplane всем клиентам сессии, не дожидаясь записи.
+// Клиент с заполненным буфером отключается, чтобы медленный клиент не задерживал остальных.
+// Если сообщение не принял никто, оно возвращается в очередь сессии до переподключения
+func (hub *NotificationHub) deliver(clientID string, message backplane.Message) {
+	accepted, dropped := false, false
+	var unsent []backplane.Message
+
+	hub.mu.Lock()
+	for sub := range hub.clients[clientID] {
+		select {
+		case sub.send <- message:
+			accepted = true
+		default:
+			log.Printf("Client %s is too slow, disconnecting", clientID)
+			notificationSlowSubscribers.WithLabelValues(sub.transport).Inc()
+			hub.removeLocked(sub)
+			dropped = true
+			unsent = append(unsent, drainSend(sub)...)
+		}
+	}
+	if len(hub.clients[clientID]) == 0 {
+		delete(hub.clients, clientID)
+	}
+	hub.mu.Unlock()
+
+	if accepted {
+		return
+	}
+
+	ctx := context.Background()
+	if dropped {
+		// Сессия осталась без клиентов на этой реплике
+		if err := hub.backplane.Unregister(ctx, clientID); err != nil {
+			log.Printf("Failed to unregister client %s in backplane: %v", clientID, err)
+		}
+	}
+
+	log.Printf("Queueing message for client %s", clientID)
+	hub.requeue(ctx, clientID, append(unsent, message)...)
+}
+
+func (hub *NotificationHub) requeue(ctx context.Context, clientID string, messages ...backplane.Message) {
+	for _, msg := range messages {
+		if err := hub.backplane.Enqueue(ctx, clientID, msg); err != nil {
+			log.Printf("Failed to queue message for client %s: %v", clientID, err)
+			return
+		}
+	}
+}
+
+func (hub *NotificationHub) refreshPresence(ctx context.Context) {
+	ticker := time.NewTicker(presenceRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		hub.mu.Lock()
+		clientIDs := make([]string, 0, len(hub.clients))
+		for clientID := range hub.clients {
+			clientIDs = append(clientIDs, clientID)
+		}
+		hub.mu.Unlock()
+
+		for _, clientID := range clientIDs {
+			if err := hub.backplane.Register(ctx, clientID); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to refresh presence of client %s: %v", clientID, err)
+			}
+		}
+	}
+}
+
+// Close отключает всех клиентов: WebSocket получают кадр закрытия, потоки SSE и long-poll запросы
+// завершаются. Сообщения, не успевшие уйти, возвращаются в очереди сессий
+func (hub *NotificationHub) Close(ctx context.Context) error {
+	hub.mu.Lock()
+	subscribers := make([]*subscriber, 0)
+	for _, sessionClients := range hub.clients {
+		for sub := range sessionClients {
+			subscribers = append(subscribers, sub)
+		}
+	}
+	hub.mu.Unlock()
+
+	for _, sub := range subscribers {
+		hub.remove(ctx, sub)
+	}
+
+	for _, sub := range subscribers {
+		select {
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+// parseEventID номер последнего полученного сообщения, пустая строка — клиент ещё ничего не получал
+func parseEventID(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
@@ -0,0 +1,15 @@
+package http
+
+import "strings"
+
+// OriginAllowed источник есть в списке allowed или список содержит "*".
+// Один список используют CORS и проверка источника WebSocket
+func OriginAllowed(allowed []string, origin string) bool {
+	for _, candidate := range allowed {
+		if candidate == "*" || strings.EqualFold(strings.TrimSuffix(candidate, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
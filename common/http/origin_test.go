@@ -0,0 +1,24 @@
+package http
+
+import "testing"
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{name: "not configured", allowed: nil, origin: "https://evil.example"},
+		{name: "listed", allowed: []string{"https://docshade.example/"}, origin: "https://docshade.example", ok: true},
+		{name: "case insensitive", allowed: []string{"https://DocShade.example"}, origin: "https://docshade.example", ok: true},
+		{name: "not listed", allowed: []string{"https://docshade.example"}, origin: "https://evil.example"},
+		{name: "explicit wildcard", allowed: []string{"*"}, origin: "https://evil.example", ok: true},
+	}
+
+	for _, tt := range tests {
+		if got := OriginAllowed(tt.allowed, tt.origin); got != tt.ok {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.ok, got)
+		}
+	}
+}
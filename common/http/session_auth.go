@@ -0,0 +1,50 @@
+package http
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+)
+
+// errUnknownSession ресурс запроса не относится ни к одной сессии
+var errUnknownSession = errors.New("unknown session")
+
+// SessionResolver определяет сессию, к которой относится ресурс запроса.
+// Пустая сессия без ошибки означает, что ресурса нет
+type SessionResolver func(c echo.Context) (string, error)
+
+// SessionFromParam сессия из параметра пути name
+func SessionFromParam(name string) SessionResolver {
+	return func(c echo.Context) (string, error) {
+		return c.Param(name), nil
+	}
+}
+
+// RequireSessionToken пропускает запрос, только если в параметре SessionTokenParam передан действующий токен
+// сессии, к которой относится ресурс. Несуществующий ресурс отвечает так же, как неверный токен,
+// чтобы по ответам нельзя было перебирать идентификаторы
+func RequireSessionToken(tokens TokenVerifier, resolve SessionResolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := c.QueryParam(SessionTokenParam)
+			if token == "" {
+				return ReturnUnauthorizedError(c, errors.New("session token is required"), "Session token is missing, invalid or expired")
+			}
+
+			sessionID, err := resolve(c)
+			if err != nil {
+				return ReturnInternalError(c, err, "Failed to check session token")
+			}
+			if sessionID == "" {
+				err = errUnknownSession
+			} else {
+				err = tokens.Verify(sessionID, token)
+			}
+			if err != nil {
+				return ReturnUnauthorizedError(c, err, "Session token is missing, invalid or expired")
+			}
+
+			return next(c)
+		}
+	}
+}
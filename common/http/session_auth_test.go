@@ -0,0 +1,65 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+type fakeVerifier map[string]string
+
+func (f fakeVerifier) Verify(sessionID, token string) error {
+	if f[sessionID] != token {
+		return errors.New("invalid session token")
+	}
+	return nil
+}
+
+func TestRequireSessionToken(t *testing.T) {
+	tokens := fakeVerifier{"session-1": "good"}
+	// Документ doc-1 принадлежит session-1, остальных документов нет
+	documents := func(c echo.Context) (string, error) {
+		if c.Param("document_id") == "doc-1" {
+			return "session-1", nil
+		}
+		return "", nil
+	}
+
+	tests := []struct {
+		name     string
+		param    string
+		value    string
+		resolve  SessionResolver
+		query    string
+		expected int
+	}{
+		{name: "valid session token", param: "session_id", value: "session-1", resolve: SessionFromParam("session_id"), query: "?token=good", expected: http.StatusOK},
+		{name: "missing token", param: "session_id", value: "session-1", resolve: SessionFromParam("session_id"), expected: http.StatusUnauthorized},
+		{name: "token of another session", param: "session_id", value: "session-2", resolve: SessionFromParam("session_id"), query: "?token=good", expected: http.StatusUnauthorized},
+		{name: "valid document token", param: "document_id", value: "doc-1", resolve: documents, query: "?token=good", expected: http.StatusOK},
+		{name: "wrong document token", param: "document_id", value: "doc-1", resolve: documents, query: "?token=bad", expected: http.StatusUnauthorized},
+		{name: "unknown document", param: "document_id", value: "doc-2", resolve: documents, query: "?token=good", expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/"+tt.query, nil), rec)
+			c.SetParamNames(tt.param)
+			c.SetParamValues(tt.value)
+
+			handler := RequireSessionToken(tokens, tt.resolve)(func(c echo.Context) error {
+				return c.NoContent(http.StatusOK)
+			})
+			if err := handler(c); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if rec.Code != tt.expected {
+				t.Fatalf("expected status %d, got %d", tt.expected, rec.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/docshade/common/backplane"
+)
+
+// LastEventIDParam параметр запроса с номером последнего полученного сообщения
+// для клиентов, которые не умеют передавать заголовок Last-Event-ID
+const LastEventIDParam = "last_event_id"
+
+// sseRetry через сколько браузеру переподключаться после разрыва потока
+const sseRetry = 3 * time.Second
+
+// SSETransport доставка уведомлений потоком Server-Sent Events для клиентов за прокси,
+// которые не пропускают WebSocket. После переподключения браузер присылает Last-Event-ID,
+// и из накопленных сообщений отправляются только ещё не полученные
+type SSETransport struct {
+	hub *NotificationHub
+}
+
+func NewSSETransport(hub *NotificationHub) *SSETransport {
+	return &SSETransport{hub: hub}
+}
+
+func (t *SSETransport) RegisterRoutes(e *echo.Echo) {
+	e.GET(EventsRoute, t.handle)
+}
+
+func (t *SSETransport) handle(c echo.Context) error {
+	clientID, ok, err := t.hub.authorize(c)
+	if !ok {
+		return err
+	}
+
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam(LastEventIDParam)
+	}
+	after, err := parseEventID(lastEventID)
+	if err != nil {
+		return ReturnBadRequestError(c, err, "Last-Event-ID must be a message number")
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	// Иначе nginx копит поток в буфере и клиент получает сообщения с опозданием
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+
+	w := &sseWriter{
+		res:        res,
+		controller: http.NewResponseController(res),
+		timeout:    t.hub.opts.WriteTimeout,
+	}
+	if err := w.write([]byte(fmt.Sprintf("retry: %d\n\n", sseRetry.Milliseconds()))); err != nil {
+		return nil
+	}
+
+	// Запрос отменяется при отключении клиента, а снять отметку о подключении нужно и после этого
+	ctx := context.WithoutCancel(c.Request().Context())
+	log.Printf("Client %s subscribed to events", clientID)
+
+	sub := t.hub.attach(ctx, clientID, "sse")
+	pending := t.hub.pending(ctx, clientID, after)
+	go t.hub.stream(ctx, sub, pending, w)
+
+	select {
+	case <-c.Request().Context().Done():
+	case <-sub.done:
+	}
+
+	t.hub.remove(ctx, sub)
+	<-sub.done
+	log.Printf("Client %s unsubscribed from events", clientID)
+
+	return nil
+}
+
+// sseWriter пишет события в ответ и сразу отправляет их клиенту
+type sseWriter struct {
+	res        *echo.Response
+	controller *http.ResponseController
+	timeout    time.Duration
+}
+
+// WriteMessage пишет событие с номером сообщения, каждая строка тела идёт отдельным полем data
+func (w *sseWriter) WriteMessage(msg backplane.Message) error {
+	var event bytes.Buffer
+	fmt.Fprintf(&event, "id: %d\n", msg.ID)
+	for _, line := range bytes.Split(msg.Body, []byte("\n")) {
+		event.WriteString("data: ")
+		event.Write(bytes.TrimSuffix(line, []byte("\r")))
+		event.WriteByte('\n')
+	}
+	event.WriteByte('\n')
+
+	return w.write(event.Bytes())
+}
+
+// Ping пишет комментарий, который браузер пропускает, а прокси считает активностью
+func (w *sseWriter) Ping() error {
+	return w.write([]byte(": ping\n\n"))
+}
+
+// Close ничего не пишет: поток заканчивается вместе с ответом на запрос
+func (w *sseWriter) Close(graceful bool) {}
+
+func (w *sseWriter) write(data []byte) error {
+	err := w.controller.SetWriteDeadline(time.Now().Add(w.timeout))
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	if _, err := w.res.Write(data); err != nil {
+		return err
+	}
+
+	return w.controller.Flush()
+}
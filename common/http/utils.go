@@ -22,3 +22,59 @@ func ReturnBadRequestError(ctx echo.Context, err error, detail string) error {
 		Details:   []string{detail},
 	})
 }
+
+// ReturnNotFoundError вернуть ошибку отсутствующего ресурса 404
+func ReturnNotFoundError(ctx echo.Context, err error, detail string) error {
+	return ctx.JSON(http.StatusNotFound, ErrorHttp{
+		ErrorText: fmt.Sprintf("%s", err),
+		Details:   []string{detail},
+	})
+}
+
+// ReturnPayloadTooLargeError вернуть ошибку слишком большого тела запроса 413
+func ReturnPayloadTooLargeError(ctx echo.Context, err error, detail string) error {
+	return ctx.JSON(http.StatusRequestEntityTooLarge, ErrorHttp{
+		ErrorText: fmt.Sprintf("%s", err),
+		Details:   []string{detail},
+	})
+}
+
+// ReturnUnauthorizedError вернуть ошибку отсутствующих или неверных учётных данных 401
+func ReturnUnauthorizedError(ctx echo.Context, err error, detail string) error {
+	return ctx.JSON(http.StatusUnauthorized, ErrorHttp{
+		ErrorText: fmt.Sprintf("%s", err),
+		Details:   []string{detail},
+	})
+}
+
+// ReturnForbiddenError вернуть ошибку запрета доступа 403
+func ReturnForbiddenError(ctx echo.Context, err error, detail string) error {
+	return ctx.JSON(http.StatusForbidden, ErrorHttp{
+		ErrorText: fmt.Sprintf("%s", err),
+		Details:   []string{detail},
+	})
+}
+
+// ReturnConflictError вернуть ошибку конфликта с состоянием ресурса 409
+func ReturnConflictError(ctx echo.Context, err error, detail string) error {
+	return ctx.JSON(http.StatusConflict, ErrorHttp{
+		ErrorText: fmt.Sprintf("%s", err),
+		Details:   []string{detail},
+	})
+}
+
+// ReturnUnsupportedMediaTypeError вернуть ошибку неподдерживаемого типа тела запроса 415
+func ReturnUnsupportedMediaTypeError(ctx echo.Context, err error, detail string) error {
+	return ctx.JSON(http.StatusUnsupportedMediaType, ErrorHttp{
+		ErrorText: fmt.Sprintf("%s", err),
+		Details:   []string{detail},
+	})
+}
+
+// ReturnNotImplementedError вернуть ошибку неподдерживаемой сервисом возможности 501
+func ReturnNotImplementedError(ctx echo.Context, err error, detail string) error {
+	return ctx.JSON(http.StatusNotImplemented, ErrorHttp{
+		ErrorText: fmt.Sprintf("%s", err),
+		Details:   []string{detail},
+	})
+}
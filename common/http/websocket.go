@@ -1,32 +1,42 @@
 package http
 
 import (
+	"context"
 	"log"
 	"net/http"
-	"sync"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	"gitlab.com/docshade/common/backplane"
 )
 
-type WebSocketServer struct {
-	clients       map[string]*websocket.Conn
-	messageQueues map[string][][]byte
-	mu            sync.Mutex
+// maxClientMessage клиенты ничего не присылают, кроме управляющих кадров
+const maxClientMessage = 4 << 10
+
+// WebSocketTransport доставка уведомлений по WebSocket
+type WebSocketTransport struct {
+	hub *NotificationHub
 }
 
-func NewWebSocketServer() *WebSocketServer {
-	return &WebSocketServer{
-		clients:       make(map[string]*websocket.Conn),
-		messageQueues: make(map[string][][]byte),
-	}
+func NewWebSocketTransport(hub *NotificationHub) *WebSocketTransport {
+	return &WebSocketTransport{hub: hub}
+}
+
+func (t *WebSocketTransport) RegisterRoutes(e *echo.Echo) {
+	e.GET(WebSocketRoute, t.handle)
 }
 
-func (server *WebSocketServer) handleWebSocket(c echo.Context) error {
+func (t *WebSocketTransport) handle(c echo.Context) error {
+	clientID, ok, err := t.hub.authorize(c)
+	if !ok {
+		return err
+	}
+
 	upgrader := websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		CheckOrigin: t.checkOrigin,
 	}
 
 	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
@@ -35,51 +45,80 @@ func (server *WebSocketServer) handleWebSocket(c echo.Context) error {
 	}
 	defer conn.Close()
 
-	clientID := c.Param("id")
+	// Запрос завершится вместе с соединением, а снять отметку о подключении нужно и после этого
+	ctx := context.WithoutCancel(c.Request().Context())
 	log.Printf("Client %s connected", clientID)
 
-	server.mu.Lock()
-	server.clients[clientID] = conn
-	messageQueue := server.messageQueues[clientID]
-	delete(server.messageQueues, clientID)
-	server.mu.Unlock()
-
-	// Send queued messages
-	for _, msg := range messageQueue {
-		if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
-			log.Printf("Failed to send queued message to client %s: %v", clientID, err)
-			break
-		}
-		log.Printf("Queued message sent to client %s", clientID)
-	}
+	sub := t.hub.attach(ctx, clientID, "websocket")
+	pending := t.hub.pending(ctx, clientID, 0)
+	go t.hub.stream(ctx, sub, pending, &wsWriter{conn: conn, timeout: t.hub.opts.WriteTimeout})
+	t.readPump(conn)
+
+	t.hub.remove(ctx, sub)
+	<-sub.done
+	log.Printf("Client %s disconnected", clientID)
+
+	return nil
+}
+
+// readPump читает кадры клиента, пока он отвечает на ping. Сами сообщения клиента не нужны,
+// но без чтения не обрабатываются pong и закрытие соединения
+func (t *WebSocketTransport) readPump(conn *websocket.Conn) {
+	timeout := t.hub.opts.PongTimeout
+	conn.SetReadLimit(maxClientMessage)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
 
 	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			server.mu.Lock()
-			delete(server.clients, clientID)
-			server.mu.Unlock()
-			log.Printf("Client %s disconnected", clientID)
-			break
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
 		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
 	}
-	return nil
 }
 
-func (server *WebSocketServer) SendMessageToClient(clientID string, message []byte) error {
-	server.mu.Lock()
-	defer server.mu.Unlock()
-
-	if conn, ok := server.clients[clientID]; ok {
-		log.Printf("Sending message to connected client %s", clientID)
-		return conn.WriteMessage(websocket.TextMessage, message)
+// checkOrigin пропускает клиентов без заголовка Origin: это не браузеры, и от подделки запроса
+// со стороннего сайта их защищать не нужно, а доступ к сессии всё равно требует токена.
+// Страница с того же хоста тоже пропускается, остальные источники должны быть в списке
+func (t *WebSocketTransport) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
 	}
 
-	log.Printf("Queueing message for client %s", clientID)
-	server.messageQueues[clientID] = append(server.messageQueues[clientID], message)
-	return nil
+	return OriginAllowed(t.hub.opts.AllowedOrigins, origin)
+}
+
+// wsWriter пишет в соединение WebSocket. Номер сообщения клиенту WebSocket не нужен:
+// накопленные сообщения он получает при каждом подключении
+type wsWriter struct {
+	conn    *websocket.Conn
+	timeout time.Duration
+}
+
+func (w *wsWriter) WriteMessage(msg backplane.Message) error {
+	return w.write(websocket.TextMessage, msg.Body)
+}
+
+func (w *wsWriter) Ping() error {
+	return w.write(websocket.PingMessage, nil)
 }
 
-func RegisterWebSocketRoutes(e *echo.Echo, wsServer *WebSocketServer) {
-	e.GET("/ws/:id", wsServer.handleWebSocket)
+// Close закрывает соединение, чтобы прервать чтение, если писатель завершился первым
+func (w *wsWriter) Close(graceful bool) {
+	if graceful {
+		w.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, ""))
+	}
+	w.conn.Close()
+}
+
+func (w *wsWriter) write(messageType int, data []byte) error {
+	w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+
+	return w.conn.WriteMessage(messageType, data)
 }
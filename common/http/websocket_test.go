@@ -0,0 +1,270 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"gitlab.com/docshade/common/backplane"
+)
+
+type wsTestServer struct {
+	hub       *NotificationHub
+	backplane backplane.Backplane
+	url       string
+}
+
+func newWSTestServer(t *testing.T, opts NotificationOptions) *wsTestServer {
+	t.Helper()
+
+	bp := backplane.NewMemory(backplane.Options{PendingTTL: time.Minute, MaxPending: 1000})
+	hub := NewNotificationHub(bp, fakeVerifier{"session-1": "good"}, opts)
+
+	e := echo.New()
+	NewWebSocketTransport(hub).RegisterRoutes(e)
+	srv := httptest.NewServer(e)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := hub.Close(ctx); err != nil {
+			t.Errorf("failed to close hub: %v", err)
+		}
+		srv.Close()
+	})
+
+	return &wsTestServer{hub: hub, backplane: bp, url: "ws" + strings.TrimPrefix(srv.URL, "http")}
+}
+
+func (s *wsTestServer) dial(t *testing.T, sessionID, token string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	conn, resp, err := websocket.DefaultDialer.Dial(s.url+"/ws/"+sessionID+"?token="+token, nil)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+func (s *wsTestServer) connect(t *testing.T) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := s.dial(t, "session-1", "good")
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	return conn
+}
+
+func (s *wsTestServer) clients(sessionID string) int {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return len(s.hub.clients[sessionID])
+}
+
+// waitFor ждёт выполнения условия, подключение клиента к хабу заканчивается уже после рукопожатия
+func waitFor(t *testing.T, timeout time.Duration, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func readText(t *testing.T, conn *websocket.Conn) string {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	return string(data)
+}
+
+func wsTestOptions() NotificationOptions {
+	return NotificationOptions{
+		PingInterval: time.Minute,
+		PongTimeout:  2 * time.Minute,
+		WriteTimeout: 5 * time.Second,
+		SendBuffer:   8,
+	}
+}
+
+func TestWebSocket_Unauthorized(t *testing.T) {
+	s := newWSTestServer(t, wsTestOptions())
+
+	for _, token := range []string{"", "bad"} {
+		_, resp, err := s.dial(t, "session-1", token)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("token %q: expected 401, got %v", token, err)
+		}
+	}
+	if s.clients("session-1") != 0 {
+		t.Fatalf("unauthorized client attached to the hub")
+	}
+}
+
+func TestWebSocket_SeveralConnectionsPerSession(t *testing.T) {
+	s := newWSTestServer(t, wsTestOptions())
+
+	// Сообщение, отправленное до подключения, ждёт клиента в очереди сессии
+	if err := s.hub.SendMessageToClient(context.Background(), "session-1", []byte("queued")); err != nil {
+		t.Fatalf("failed to send message: %v", err)
+	}
+
+	first := s.connect(t)
+	if got := readText(t, first); got != "queued" {
+		t.Fatalf("expected queued message, got %q", got)
+	}
+	second := s.connect(t)
+	third := s.connect(t)
+	waitFor(t, 5*time.Second, "three clients", func() bool { return s.clients("session-1") == 3 })
+
+	s.hub.deliver("session-1", backplane.Message{ID: 2, Body: []byte("live")})
+	for i, conn := range []*websocket.Conn{first, second, third} {
+		if got := readText(t, conn); got != "live" {
+			t.Fatalf("client %d: expected live message, got %q", i, got)
+		}
+	}
+
+	// Отключение одного клиента не мешает остальным
+	third.Close()
+	waitFor(t, 5*time.Second, "disconnect", func() bool { return s.clients("session-1") == 2 })
+	s.hub.deliver("session-1", backplane.Message{ID: 3, Body: []byte("after disconnect")})
+	for i, conn := range []*websocket.Conn{first, second} {
+		if got := readText(t, conn); got != "after disconnect" {
+			t.Fatalf("client %d: expected message after disconnect, got %q", i, got)
+		}
+	}
+	if queued, _ := s.backplane.Drain(context.Background(), "session-1"); len(queued) != 0 {
+		t.Fatalf("delivered messages must not be queued, got %d", len(queued))
+	}
+}
+
+func TestWebSocket_SlowClientDropped(t *testing.T) {
+	opts := wsTestOptions()
+	opts.SendBuffer = 1
+	s := newWSTestServer(t, opts)
+
+	fast := s.connect(t)
+	slow := s.connect(t)
+	waitFor(t, 5*time.Second, "two clients", func() bool { return s.clients("session-1") == 2 })
+
+	// Медленный клиент не читает: когда заполнятся буферы сокета, запись ему встанет, а его буфер
+	// отправки переполнится. Быстрый клиент читает каждое сообщение и остаётся подключённым
+	body := bytes.Repeat([]byte("x"), 256<<10)
+	dropped := false
+	for i := 0; i < 400 && !dropped; i++ {
+		s.hub.deliver("session-1", backplane.Message{ID: int64(i + 1), Body: body})
+		if got := readText(t, fast); len(got) != len(body) {
+			t.Fatalf("fast client got %d bytes", len(got))
+		}
+		dropped = s.clients("session-1") == 1
+	}
+	if !dropped {
+		t.Fatalf("slow client was not disconnected")
+	}
+
+	s.hub.deliver("session-1", backplane.Message{ID: 1000, Body: []byte("still here")})
+	if got := readText(t, fast); got != "still here" {
+		t.Fatalf("fast client: expected message after drop, got %q", got)
+	}
+
+	// Соединение медленного клиента закрыто: дочитав уже отправленное, он получает ошибку
+	slow.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		if _, _, err := slow.ReadMessage(); err != nil {
+			if netErr, ok := err.(interface{ Timeout() bool }); ok && netErr.Timeout() {
+				t.Fatalf("slow client connection was not closed")
+			}
+			break
+		}
+	}
+}
+
+func TestWebSocket_SlowOnlyClientMessagesQueued(t *testing.T) {
+	opts := wsTestOptions()
+	opts.SendBuffer = 1
+	s := newWSTestServer(t, opts)
+
+	s.connect(t)
+	waitFor(t, 5*time.Second, "client", func() bool { return s.clients("session-1") == 1 })
+
+	body := bytes.Repeat([]byte("x"), 256<<10)
+	var last int64
+	for i := 0; i < 400 && s.clients("session-1") == 1; i++ {
+		last = int64(i + 1)
+		s.hub.deliver("session-1", backplane.Message{ID: last, Body: body})
+	}
+	if s.clients("session-1") != 0 {
+		t.Fatalf("slow client was not disconnected")
+	}
+
+	// Сообщение, на котором клиент отключён, ждёт следующего подключения
+	queued, err := s.backplane.Drain(context.Background(), "session-1")
+	if err != nil {
+		t.Fatalf("failed to drain queue: %v", err)
+	}
+	if len(queued) == 0 || queued[len(queued)-1].ID != last {
+		t.Fatalf("expected message %d to be queued, got %d messages", last, len(queued))
+	}
+}
+
+func TestWebSocket_PingPong(t *testing.T) {
+	opts := wsTestOptions()
+	opts.PingInterval = 50 * time.Millisecond
+	opts.PongTimeout = 300 * time.Millisecond
+	s := newWSTestServer(t, opts)
+
+	// Клиент, который читает соединение, отвечает на ping и остаётся подключённым дольше PongTimeout
+	alive := s.connect(t)
+	var pings atomic.Int32
+	alive.SetPingHandler(func(data string) error {
+		pings.Add(1)
+		return alive.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+	})
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Клиент, который не читает, на ping не отвечает и отключается по истечении PongTimeout
+	silent := s.connect(t)
+	waitFor(t, 5*time.Second, "two clients", func() bool { return s.clients("session-1") == 2 })
+	connected := time.Now()
+
+	waitFor(t, 5*time.Second, "silent client disconnect", func() bool { return s.clients("session-1") == 1 })
+	if elapsed := time.Since(connected); elapsed < opts.PongTimeout/2 {
+		t.Fatalf("silent client disconnected after %v, before the pong deadline", elapsed)
+	}
+
+	time.Sleep(3 * opts.PongTimeout)
+	if s.clients("session-1") != 1 {
+		t.Fatalf("responsive client was disconnected")
+	}
+	if pings.Load() < 3 {
+		t.Fatalf("expected regular pings, got %d", pings.Load())
+	}
+
+	silent.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := silent.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
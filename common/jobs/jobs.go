@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/docshade/common/outbox"
+)
+
+// Status состояние обработки документа
+type Status string
+
+// Состояния документа в порядке прохождения конвейера
+const (
+	StatusQueued      Status = "queued"
+	StatusAnonymizing Status = "anonymizing"
+	StatusDone        Status = "done"
+	StatusFailed      Status = "failed"
+	// StatusQuarantined документ отклонён проверкой перед анонимизацией и перенесён в карантин
+	StatusQuarantined Status = "quarantined"
+)
+
+// ErrNotFound документ с таким идентификатором не зарегистрирован
+var ErrNotFound = errors.New("job not found")
+
+// ErrBatchNotFound пакет с таким идентификатором не зарегистрирован
+var ErrBatchNotFound = errors.New("batch not found")
+
+// Job состояние обработки одного документа
+type Job struct {
+	DocumentID       string
+	SessionID        string
+	OriginalFileName string
+	// Format имя формата документа из реестра formats
+	Format string
+	// BatchID идентификатор пакета, пустой для документов, загруженных по одному
+	BatchID string
+	Status  Status
+	// ErrorReason причина ошибки для состояний failed и quarantined
+	ErrorReason string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	// FinishedAt время перехода в done, failed или quarantined
+	FinishedAt *time.Time
+}
+
+// Batch пакет документов, загруженных одним запросом
+type Batch struct {
+	ID        string
+	SessionID string
+	// Total число документов в пакете
+	Total     int
+	CreatedAt time.Time
+	// CompletedAt время, когда обработка всех документов пакета завершилась
+	CompletedAt *time.Time
+}
+
+// BatchProgress ход обработки пакета
+type BatchProgress struct {
+	Batch
+	// Done документы, обработанные успешно
+	Done int
+	// Failed документы с ошибкой или отклонённые проверкой
+	Failed int
+}
+
+// Finished число документов пакета, обработка которых завершилась
+func (p BatchProgress) Finished() int {
+	return p.Done + p.Failed
+}
+
+// IsFinal обработка документа завершена, успешно или нет
+func (s Status) IsFinal() bool {
+	return s == StatusDone || s == StatusFailed || s == StatusQuarantined
+}
+
+type Repository interface {
+	// Init подготовить хранилище, например создать таблицы
+	Init(ctx context.Context) error
+	// Create зарегистрировать новый документ
+	Create(ctx context.Context, job Job) error
+	// Enqueue зарегистрировать документ вместе с сообщением для брокера в одной транзакции.
+	// Таблицу сообщений создаёт outbox.Store, его Init должен выполниться раньше
+	Enqueue(ctx context.Context, job Job, msg outbox.Message) error
+	// EnqueueBatch зарегистрировать пакет, его документы и сообщения для брокера в одной транзакции
+	EnqueueBatch(ctx context.Context, batch Batch, jobs []Job, msgs []outbox.Message) error
+	// GetBatch получить пакет и число завершённых документов
+	GetBatch(ctx context.Context, batchID string) (BatchProgress, error)
+	// CompleteBatch отметить пакет завершённым, если обработка всех его документов закончилась.
+	// Возвращает true только для вызова, который отметил пакет: завершение сообщается один раз
+	CompleteBatch(ctx context.Context, batchID string) (bool, error)
+	// SetStatus перевести документ в новое состояние, errorReason заполняется для состояния failed
+	SetStatus(ctx context.Context, documentID string, status Status, errorReason string) error
+	// Get получить состояние документа
+	Get(ctx context.Context, documentID string) (Job, error)
+	// ListBySession получить документы сессии в порядке загрузки
+	ListBySession(ctx context.Context, sessionID string) ([]Job, error)
+	// Delete удалить состояние документа, отсутствие записи ошибкой не считается
+	Delete(ctx context.Context, documentID string) error
+	// DeleteFinishedBefore удалить состояния документов, обработка которых завершилась раньше before,
+	// и вернуть их идентификаторы. Пакеты, завершённые раньше before, удаляются вместе с ними
+	DeleteFinishedBefore(ctx context.Context, before time.Time) ([]string, error)
+	// Ping проверить соединение с хранилищем
+	Ping(ctx context.Context) error
+	// Close освободить ресурсы хранилища. Общий пул соединений с базой закрывает его владелец
+	Close() error
+}
@@ -0,0 +1,206 @@
+package jobs
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/docshade/common/outbox"
+)
+
+type memory struct {
+	mu      sync.RWMutex
+	jobs    map[string]Job
+	batches map[string]Batch
+	// messages сообщения Enqueue: ретранслятора у хранилища в памяти нет, они только копятся
+	messages []outbox.Message
+}
+
+// NewMemoryRepository хранилище состояний в памяти процесса, для тестов и локального запуска
+func NewMemoryRepository() Repository {
+	return &memory{jobs: make(map[string]Job), batches: make(map[string]Batch)}
+}
+
+func (m *memory) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Create(ctx context.Context, job Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	m.jobs[job.DocumentID] = job
+
+	return nil
+}
+
+func (m *memory) Enqueue(ctx context.Context, job Job, msg outbox.Message) error {
+	if err := m.Create(ctx, job); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	msg.CreatedAt = time.Now().UTC()
+	m.messages = append(m.messages, msg)
+
+	return nil
+}
+
+func (m *memory) EnqueueBatch(ctx context.Context, batch Batch, jobs []Job, msgs []outbox.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now().UTC()
+	batch.CreatedAt = now
+	batch.CompletedAt = nil
+	m.batches[batch.ID] = batch
+	for _, job := range jobs {
+		job.CreatedAt = now
+		job.UpdatedAt = now
+		m.jobs[job.DocumentID] = job
+	}
+	for _, msg := range msgs {
+		msg.CreatedAt = now
+		m.messages = append(m.messages, msg)
+	}
+
+	return nil
+}
+
+func (m *memory) GetBatch(ctx context.Context, batchID string) (BatchProgress, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	batch, ok := m.batches[batchID]
+	if !ok {
+		return BatchProgress{}, ErrBatchNotFound
+	}
+
+	return m.progress(batch), nil
+}
+
+func (m *memory) CompleteBatch(ctx context.Context, batchID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	batch, ok := m.batches[batchID]
+	if !ok || batch.CompletedAt != nil || m.progress(batch).Finished() < batch.Total {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	batch.CompletedAt = &now
+	m.batches[batchID] = batch
+
+	return true, nil
+}
+
+func (m *memory) progress(batch Batch) BatchProgress {
+	progress := BatchProgress{Batch: batch}
+	for _, job := range m.jobs {
+		if job.BatchID != batch.ID {
+			continue
+		}
+		switch job.Status {
+		case StatusDone:
+			progress.Done++
+		case StatusFailed, StatusQuarantined:
+			progress.Failed++
+		}
+	}
+
+	return progress
+}
+
+func (m *memory) SetStatus(ctx context.Context, documentID string, status Status, errorReason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[documentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	now := time.Now().UTC()
+	job.Status = status
+	job.ErrorReason = errorReason
+	job.UpdatedAt = now
+	if status.IsFinal() {
+		job.FinishedAt = &now
+	}
+	m.jobs[documentID] = job
+
+	return nil
+}
+
+func (m *memory) Get(ctx context.Context, documentID string) (Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	job, ok := m.jobs[documentID]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	return job, nil
+}
+
+func (m *memory) ListBySession(ctx context.Context, sessionID string) ([]Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	result := make([]Job, 0)
+	for _, job := range m.jobs {
+		if job.SessionID == sessionID {
+			result = append(result, job)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+
+	return result, nil
+}
+
+func (m *memory) Delete(ctx context.Context, documentID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.jobs, documentID)
+
+	return nil
+}
+
+func (m *memory) DeleteFinishedBefore(ctx context.Context, before time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := make([]string, 0)
+	for id, job := range m.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(before) {
+			delete(m.jobs, id)
+			deleted = append(deleted, id)
+		}
+	}
+	for id, batch := range m.batches {
+		if batch.CompletedAt != nil && batch.CompletedAt.Before(before) {
+			delete(m.batches, id)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
@@ -0,0 +1,266 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/docshade/common/outbox"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const createTableQuery = `
+CREATE TABLE IF NOT EXISTS document_jobs (
+	document_id        TEXT PRIMARY KEY,
+	session_id         TEXT NOT NULL,
+	original_file_name TEXT NOT NULL DEFAULT '',
+	status             TEXT NOT NULL,
+	error_reason       TEXT NOT NULL DEFAULT '',
+	created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+	finished_at        TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS document_jobs_session_id_idx ON document_jobs (session_id, created_at);
+ALTER TABLE document_jobs ADD COLUMN IF NOT EXISTS format TEXT NOT NULL DEFAULT 'pdf';
+ALTER TABLE document_jobs ADD COLUMN IF NOT EXISTS batch_id TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS document_jobs_batch_id_idx ON document_jobs (batch_id) WHERE batch_id <> '';
+CREATE TABLE IF NOT EXISTS document_batches (
+	batch_id     TEXT PRIMARY KEY,
+	session_id   TEXT NOT NULL,
+	total        INT NOT NULL,
+	created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+	completed_at TIMESTAMPTZ
+);
+`
+
+const jobColumns = `document_id, session_id, original_file_name, format, batch_id, status, error_reason, created_at, updated_at, finished_at`
+
+type postgres struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRepository хранилище состояний документов в Postgres на общем пуле соединений
+func NewPostgresRepository(pool *pgxpool.Pool) Repository {
+	return &postgres{pool: pool}
+}
+
+// Init создаёт таблицу состояний, если её ещё нет
+func (p *postgres) Init(ctx context.Context) error {
+	_, err := p.pool.Exec(ctx, createTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create jobs table: %w", err)
+	}
+
+	return nil
+}
+
+func (p *postgres) Create(ctx context.Context, job Job) error {
+	return insertJob(ctx, p.pool, job)
+}
+
+func (p *postgres) Enqueue(ctx context.Context, job Job, msg outbox.Message) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	if err := insertJob(ctx, tx, job); err != nil {
+		return err
+	}
+	if err := outbox.Insert(ctx, tx, msg); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (p *postgres) EnqueueBatch(ctx context.Context, batch Batch, jobs []Job, msgs []outbox.Message) error {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO document_batches (batch_id, session_id, total)
+		VALUES ($1, $2, $3)`,
+		batch.ID, batch.SessionID, batch.Total,
+	)
+	if err != nil {
+		return err
+	}
+	for _, job := range jobs {
+		if err := insertJob(ctx, tx, job); err != nil {
+			return err
+		}
+	}
+	for _, msg := range msgs {
+		if err := outbox.Insert(ctx, tx, msg); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func insertJob(ctx context.Context, db outbox.Execer, job Job) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO document_jobs (document_id, session_id, original_file_name, format, batch_id, status)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		job.DocumentID, job.SessionID, job.OriginalFileName, job.Format, job.BatchID, string(job.Status),
+	)
+
+	return err
+}
+
+func (p *postgres) GetBatch(ctx context.Context, batchID string) (BatchProgress, error) {
+	var progress BatchProgress
+	err := p.pool.QueryRow(ctx, `
+		SELECT b.batch_id, b.session_id, b.total, b.created_at, b.completed_at,
+			count(*) FILTER (WHERE j.status = 'done'),
+			count(*) FILTER (WHERE j.status IN ('failed', 'quarantined'))
+		FROM document_batches b
+		LEFT JOIN document_jobs j ON j.batch_id = b.batch_id
+		WHERE b.batch_id = $1
+		GROUP BY b.batch_id`, batchID,
+	).Scan(
+		&progress.ID,
+		&progress.SessionID,
+		&progress.Total,
+		&progress.CreatedAt,
+		&progress.CompletedAt,
+		&progress.Done,
+		&progress.Failed,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return BatchProgress{}, ErrBatchNotFound
+	}
+
+	return progress, err
+}
+
+// CompleteBatch проверяет документы и отмечает пакет одним запросом: из нескольких экземпляров,
+// завершивших последние документы одновременно, строку обновит только один
+func (p *postgres) CompleteBatch(ctx context.Context, batchID string) (bool, error) {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE document_batches b
+		SET completed_at = now()
+		WHERE b.batch_id = $1
+			AND b.completed_at IS NULL
+			AND b.total <= (
+				SELECT count(*) FROM document_jobs j
+				WHERE j.batch_id = b.batch_id AND j.status IN ('done', 'failed', 'quarantined')
+			)`, batchID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+func (p *postgres) SetStatus(ctx context.Context, documentID string, status Status, errorReason string) error {
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE document_jobs
+		SET status = $2,
+			error_reason = $3,
+			updated_at = now(),
+			finished_at = CASE WHEN $4 THEN now() ELSE finished_at END
+		WHERE document_id = $1`,
+		documentID, string(status), errorReason, status.IsFinal(),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (p *postgres) Get(ctx context.Context, documentID string) (Job, error) {
+	row := p.pool.QueryRow(ctx, `SELECT `+jobColumns+` FROM document_jobs WHERE document_id = $1`, documentID)
+
+	job, err := scanJob(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, ErrNotFound
+	}
+
+	return job, err
+}
+
+func (p *postgres) ListBySession(ctx context.Context, sessionID string) ([]Job, error) {
+	rows, err := p.pool.Query(ctx, `SELECT `+jobColumns+` FROM document_jobs WHERE session_id = $1 ORDER BY created_at`, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]Job, 0)
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, job)
+	}
+
+	return result, rows.Err()
+}
+
+func (p *postgres) Delete(ctx context.Context, documentID string) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM document_jobs WHERE document_id = $1`, documentID)
+
+	return err
+}
+
+func (p *postgres) DeleteFinishedBefore(ctx context.Context, before time.Time) ([]string, error) {
+	rows, err := p.pool.Query(ctx, `DELETE FROM document_jobs WHERE finished_at < $1 RETURNING document_id`, before)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = p.pool.Exec(ctx, `DELETE FROM document_batches WHERE completed_at < $1`, before)
+	if err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+func (p *postgres) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+// Close ничего не закрывает: пул общий, его закрывает тот, кто открыл
+func (p *postgres) Close() error {
+	return nil
+}
+
+func scanJob(row pgx.Row) (Job, error) {
+	var job Job
+	var status string
+	err := row.Scan(
+		&job.DocumentID,
+		&job.SessionID,
+		&job.OriginalFileName,
+		&job.Format,
+		&job.BatchID,
+		&status,
+		&job.ErrorReason,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	)
+	job.Status = Status(status)
+
+	return job, err
+}
@@ -177,6 +177,16 @@ func memLog() string {
 /* Default log functions
 ========================================================================= */
 
+// Infof is for logging informational messages
+func Infof(format string, args ...interface{}) {
+	log.Infof(format, args...)
+}
+
+// Warnf is for logging messages about possible issues
+func Warnf(format string, args ...interface{}) {
+	log.Warnf(format, args...)
+}
+
 // Warne is for logging the concrete error
 func Warne(err error) {
 	log.Warnf("%s", err)
@@ -0,0 +1,78 @@
+package messaging
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// legacyMessage сообщение без версии, которое сервисы публиковали до появления контракта
+type legacyMessage struct {
+	SessionID        string `json:"session_id"`
+	DocumentID       string `json:"document_id"`
+	S3Path           string `json:"s3_path"`
+	OriginalFileName string `json:"original_file_name"`
+	Status           string `json:"status"`
+}
+
+// legacyObjectKey старые сервисы всегда хранили документ под именем <document_id>.pdf,
+// а s3_path заполняли непоследовательно, поэтому из пути берётся только бакет
+func legacyObjectKey(documentID string) string {
+	return documentID + ".pdf"
+}
+
+func legacyBucket(s3Path string) string {
+	bucket, _, _ := strings.Cut(s3Path, "/")
+	return bucket
+}
+
+func decodeLegacy(body []byte) (legacyMessage, error) {
+	var legacy legacyMessage
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return legacyMessage{}, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	return legacy, nil
+}
+
+func upgradeDocumentUploaded(body []byte, event Event) error {
+	legacy, err := decodeLegacy(body)
+	if err != nil {
+		return err
+	}
+
+	*event.(*DocumentUploaded) = DocumentUploaded{
+		SessionID:        legacy.SessionID,
+		DocumentID:       legacy.DocumentID,
+		Bucket:           legacyBucket(legacy.S3Path),
+		ObjectKey:        legacyObjectKey(legacy.DocumentID),
+		OriginalFileName: legacy.OriginalFileName,
+	}
+
+	return nil
+}
+
+func upgradeDocumentProcessed(body []byte, event Event) error {
+	legacy, err := decodeLegacy(body)
+	if err != nil {
+		return err
+	}
+
+	processed := DocumentProcessed{
+		SessionID:        legacy.SessionID,
+		DocumentID:       legacy.DocumentID,
+		OriginalFileName: legacy.OriginalFileName,
+		Status:           StatusOK,
+	}
+	if legacy.Status == string(StatusOK) {
+		processed.Bucket = legacyBucket(legacy.S3Path)
+		processed.ObjectKey = legacyObjectKey(legacy.DocumentID)
+	} else {
+		// Старый queue-service писал в status текст ошибки
+		processed.Status = StatusError
+		processed.Error = legacy.Status
+	}
+	*event.(*DocumentProcessed) = processed
+
+	return nil
+}
@@ -0,0 +1,297 @@
+// Package messaging описывает события, которыми сервисы обмениваются через RabbitMQ.
+//
+// Каждое событие несёт тип и версию схемы. Новые необязательные поля добавляются без смены версии,
+// несовместимые изменения требуют увеличения SchemaVersion. Сообщения без версии, которые
+// публиковали сервисы до появления контракта, читаются как версия 0 и приводятся к текущей схеме.
+package messaging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"gitlab.com/docshade/common/formats"
+)
+
+// SchemaVersion текущая версия схемы событий
+const SchemaVersion = 1
+
+// EventType тип события
+type EventType string
+
+const (
+	// DocumentUploadedType документ загружен и ожидает анонимизации
+	DocumentUploadedType EventType = "document.uploaded"
+	// DocumentProcessedType обработка документа завершена
+	DocumentProcessedType EventType = "document.processed"
+)
+
+// ProcessingStatus итог обработки документа
+type ProcessingStatus string
+
+const (
+	StatusOK    ProcessingStatus = "ok"
+	StatusError ProcessingStatus = "error"
+	// StatusRejected документ не прошёл проверку перед анонимизацией и помещён в карантин.
+	// Потребители, которые его не знают, читают его как StatusError
+	StatusRejected ProcessingStatus = "rejected"
+)
+
+var (
+	// ErrUnsupportedVersion сообщение опубликовано более новой версией сервиса
+	ErrUnsupportedVersion = errors.New("unsupported message schema version")
+	// ErrUnexpectedType в очереди оказалось событие другого типа
+	ErrUnexpectedType = errors.New("unexpected message type")
+	// ErrInvalidMessage сообщение не прошло проверку обязательных полей
+	ErrInvalidMessage = errors.New("invalid message")
+)
+
+// Envelope общие поля всех событий
+type Envelope struct {
+	Type          EventType `json:"type"`
+	SchemaVersion int       `json:"schema_version"`
+}
+
+// Event событие, которое можно опубликовать
+type Event interface {
+	// Validate проверить обязательные поля события
+	Validate() error
+
+	envelope() *Envelope
+	eventType() EventType
+}
+
+// DocumentUploaded документ сохранён во входящий бакет и ожидает анонимизации
+type DocumentUploaded struct {
+	Envelope
+	SessionID        string `json:"session_id"`
+	DocumentID       string `json:"document_id"`
+	Bucket           string `json:"bucket"`
+	ObjectKey        string `json:"object_key"`
+	OriginalFileName string `json:"original_file_name"`
+	// Format имя формата документа из реестра formats, пустое означает formats.Default
+	Format     string    `json:"format,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	// Callback куда отправить итог обработки, если клиент API его указал
+	Callback *Callback `json:"callback,omitempty"`
+	// BatchID пакет, в составе которого загружен документ
+	BatchID string `json:"batch_id,omitempty"`
+	// SHA256 контрольная сумма загруженного документа в hex, пустая в сообщениях старых версий
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// DocumentProcessed обработка документа завершена успешно или с ошибкой
+type DocumentProcessed struct {
+	Envelope
+	SessionID        string `json:"session_id"`
+	DocumentID       string `json:"document_id"`
+	OriginalFileName string `json:"original_file_name"`
+	// Format имя формата документа из реестра formats, пустое означает formats.Default
+	Format string           `json:"format,omitempty"`
+	Status ProcessingStatus `json:"status"`
+	// Bucket и ObjectKey указывают на результат и заполнены только при успешной обработке
+	Bucket    string `json:"bucket,omitempty"`
+	ObjectKey string `json:"object_key,omitempty"`
+	// Error причина ошибки для статуса error или отказа для статуса rejected
+	Error       string    `json:"error,omitempty"`
+	ProcessedAt time.Time `json:"processed_at"`
+	// Callback переносится из DocumentUploaded без изменений
+	Callback *Callback `json:"callback,omitempty"`
+	// BatchID переносится из DocumentUploaded без изменений
+	BatchID string `json:"batch_id,omitempty"`
+	// SHA256 контрольная сумма анонимизированного документа в hex, заполнена только при успешной обработке
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Callback адрес, на который сервис уведомлений отправит итог обработки, и ключ подписи запроса
+type Callback struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// Validate адрес должен быть абсолютным http или https, без ключа подписи вебхук не отправляется
+func (c *Callback) Validate() error {
+	if c.Secret == "" {
+		return fmt.Errorf("%w: callback secret is required", ErrInvalidMessage)
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("%w: callback url: %v", ErrInvalidMessage, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: callback url must be an absolute http or https url", ErrInvalidMessage)
+	}
+
+	return nil
+}
+
+func (e *DocumentUploaded) envelope() *Envelope { return &e.Envelope }
+
+func (e *DocumentUploaded) eventType() EventType { return DocumentUploadedType }
+
+func (e *DocumentUploaded) Validate() error {
+	err := requireFields(map[string]string{
+		"session_id":  e.SessionID,
+		"document_id": e.DocumentID,
+		"bucket":      e.Bucket,
+		"object_key":  e.ObjectKey,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := validateCallback(e.Callback); err != nil {
+		return err
+	}
+
+	if err := validateChecksum(e.SHA256); err != nil {
+		return err
+	}
+
+	return validateFormat(e.Format)
+}
+
+func (e *DocumentProcessed) envelope() *Envelope { return &e.Envelope }
+
+func (e *DocumentProcessed) eventType() EventType { return DocumentProcessedType }
+
+func (e *DocumentProcessed) Validate() error {
+	err := requireFields(map[string]string{
+		"session_id":  e.SessionID,
+		"document_id": e.DocumentID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := validateFormat(e.Format); err != nil {
+		return err
+	}
+
+	if err := validateCallback(e.Callback); err != nil {
+		return err
+	}
+
+	if err := validateChecksum(e.SHA256); err != nil {
+		return err
+	}
+
+	switch e.Status {
+	case StatusOK:
+		return requireFields(map[string]string{
+			"bucket":     e.Bucket,
+			"object_key": e.ObjectKey,
+		})
+	case StatusError, StatusRejected:
+		return nil
+	default:
+		// Статусы добавляются без смены версии схемы, поэтому незнакомый статус от более новой
+		// версии сервиса читается как ошибка обработки, а не отбрасывает сообщение
+		e.Status = StatusError
+		return nil
+	}
+}
+
+// Encode проставляет тип и версию схемы и сериализует событие
+func Encode(event Event) ([]byte, error) {
+	*event.envelope() = Envelope{Type: event.eventType(), SchemaVersion: SchemaVersion}
+
+	if err := event.Validate(); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(event)
+}
+
+// DecodeDocumentUploaded разбирает и проверяет событие о загрузке документа
+func DecodeDocumentUploaded(body []byte) (DocumentUploaded, error) {
+	var event DocumentUploaded
+	err := decode(body, &event, upgradeDocumentUploaded)
+	if event.Format == "" {
+		event.Format = formats.Default.Name
+	}
+
+	return event, err
+}
+
+// DecodeDocumentProcessed разбирает и проверяет событие о завершении обработки
+func DecodeDocumentProcessed(body []byte) (DocumentProcessed, error) {
+	var event DocumentProcessed
+	err := decode(body, &event, upgradeDocumentProcessed)
+	if event.Format == "" {
+		event.Format = formats.Default.Name
+	}
+
+	return event, err
+}
+
+func decode(body []byte, event Event, upgradeLegacy func(body []byte, event Event) error) error {
+	var envelope Envelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+
+	switch {
+	case envelope.SchemaVersion == 0:
+		if err := upgradeLegacy(body, event); err != nil {
+			return err
+		}
+		*event.envelope() = Envelope{Type: event.eventType(), SchemaVersion: SchemaVersion}
+	case envelope.SchemaVersion > SchemaVersion:
+		return fmt.Errorf("%w: %d, supported up to %d", ErrUnsupportedVersion, envelope.SchemaVersion, SchemaVersion)
+	case envelope.Type != event.eventType():
+		return fmt.Errorf("%w: got %q, want %q", ErrUnexpectedType, envelope.Type, event.eventType())
+	default:
+		if err := json.Unmarshal(body, event); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+		}
+	}
+
+	return event.Validate()
+}
+
+func validateFormat(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := formats.ByName(name); !ok {
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidMessage, name)
+	}
+
+	return nil
+}
+
+func validateCallback(callback *Callback) error {
+	if callback == nil {
+		return nil
+	}
+
+	return callback.Validate()
+}
+
+// validateChecksum контрольная сумма необязательна, но если указана, это SHA-256 в hex
+func validateChecksum(sum string) error {
+	if sum == "" {
+		return nil
+	}
+	if digest, err := hex.DecodeString(sum); err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("%w: sha256 must be a hex encoded SHA-256 digest", ErrInvalidMessage)
+	}
+
+	return nil
+}
+
+func requireFields(fields map[string]string) error {
+	for name, value := range fields {
+		if value == "" {
+			return fmt.Errorf("%w: field %s is required", ErrInvalidMessage, name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package messaging
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/docshade/common/formats"
+)
+
+func TestDecodeDocumentUploaded(t *testing.T) {
+	uploadedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	current, err := Encode(&DocumentUploaded{
+		SessionID:        "session",
+		DocumentID:       "document",
+		Bucket:           "preprocessing",
+		ObjectKey:        "document.pdf",
+		OriginalFileName: "report.pdf",
+		Format:           "pdf",
+		UploadedAt:       uploadedAt,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected DocumentUploaded
+		err      error
+	}{
+		{
+			name: "current version",
+			body: string(current),
+			expected: DocumentUploaded{
+				Envelope:         Envelope{Type: DocumentUploadedType, SchemaVersion: SchemaVersion},
+				SessionID:        "session",
+				DocumentID:       "document",
+				Bucket:           "preprocessing",
+				ObjectKey:        "document.pdf",
+				OriginalFileName: "report.pdf",
+				Format:           "pdf",
+				UploadedAt:       uploadedAt,
+			},
+		},
+		{
+			name: "legacy without version",
+			body: `{"session_id":"session","document_id":"document","s3_path":"preprocessing/whatever","original_file_name":"report.pdf"}`,
+			expected: DocumentUploaded{
+				Envelope:         Envelope{Type: DocumentUploadedType, SchemaVersion: SchemaVersion},
+				SessionID:        "session",
+				DocumentID:       "document",
+				Bucket:           "preprocessing",
+				ObjectKey:        "document.pdf",
+				OriginalFileName: "report.pdf",
+				Format:           formats.Default.Name,
+			},
+		},
+		{
+			name: "legacy without document id",
+			body: `{"session_id":"session","s3_path":"preprocessing/document.pdf"}`,
+			err:  ErrInvalidMessage,
+		},
+		{
+			name: "newer version",
+			body: `{"type":"document.uploaded","schema_version":2,"session_id":"session","document_id":"document","bucket":"b","object_key":"k"}`,
+			err:  ErrUnsupportedVersion,
+		},
+		{
+			name: "other event type",
+			body: `{"type":"document.processed","schema_version":1,"session_id":"session","document_id":"document","status":"ok"}`,
+			err:  ErrUnexpectedType,
+		},
+		{
+			name: "missing required field",
+			body: `{"type":"document.uploaded","schema_version":1,"session_id":"session","document_id":"document","bucket":"b"}`,
+			err:  ErrInvalidMessage,
+		},
+		{
+			name: "unknown format",
+			body: `{"type":"document.uploaded","schema_version":1,"session_id":"session","document_id":"document","bucket":"b","object_key":"k","format":"exe"}`,
+			err:  ErrInvalidMessage,
+		},
+		{
+			name: "not json",
+			body: `document`,
+			err:  ErrInvalidMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := DecodeDocumentUploaded([]byte(tt.body))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(event, tt.expected) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, event)
+			}
+		})
+	}
+}
+
+func TestDecodeDocumentProcessed(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected DocumentProcessed
+		err      error
+	}{
+		{
+			name: "current version",
+			body: `{"type":"document.processed","schema_version":1,"session_id":"session","document_id":"document","status":"ok","bucket":"postprocessing","object_key":"document.pdf"}`,
+			expected: DocumentProcessed{
+				Envelope:   Envelope{Type: DocumentProcessedType, SchemaVersion: SchemaVersion},
+				SessionID:  "session",
+				DocumentID: "document",
+				Format:     formats.Default.Name,
+				Status:     StatusOK,
+				Bucket:     "postprocessing",
+				ObjectKey:  "document.pdf",
+			},
+		},
+		{
+			name: "legacy success",
+			body: `{"session_id":"session","document_id":"document","s3_path":"postprocessing/document.pdf","original_file_name":"report.pdf","status":"ok"}`,
+			expected: DocumentProcessed{
+				Envelope:         Envelope{Type: DocumentProcessedType, SchemaVersion: SchemaVersion},
+				SessionID:        "session",
+				DocumentID:       "document",
+				OriginalFileName: "report.pdf",
+				Format:           formats.Default.Name,
+				Status:           StatusOK,
+				Bucket:           "postprocessing",
+				ObjectKey:        "document.pdf",
+			},
+		},
+		{
+			name: "legacy error text in status",
+			body: `{"session_id":"session","document_id":"document","status":"anonymizer is unavailable"}`,
+			expected: DocumentProcessed{
+				Envelope:   Envelope{Type: DocumentProcessedType, SchemaVersion: SchemaVersion},
+				SessionID:  "session",
+				DocumentID: "document",
+				Format:     formats.Default.Name,
+				Status:     StatusError,
+				Error:      "anonymizer is unavailable",
+			},
+		},
+		{
+			name: "unknown status read as error",
+			body: `{"type":"document.processed","schema_version":1,"session_id":"session","document_id":"document","status":"postponed","error":"try later"}`,
+			expected: DocumentProcessed{
+				Envelope:   Envelope{Type: DocumentProcessedType, SchemaVersion: SchemaVersion},
+				SessionID:  "session",
+				DocumentID: "document",
+				Format:     formats.Default.Name,
+				Status:     StatusError,
+				Error:      "try later",
+			},
+		},
+		{
+			name: "newer version",
+			body: `{"type":"document.processed","schema_version":2,"session_id":"session","document_id":"document","status":"ok"}`,
+			err:  ErrUnsupportedVersion,
+		},
+		{
+			name: "success without result",
+			body: `{"type":"document.processed","schema_version":1,"session_id":"session","document_id":"document","status":"ok"}`,
+			err:  ErrInvalidMessage,
+		},
+		{
+			name: "malformed checksum",
+			body: `{"type":"document.processed","schema_version":1,"session_id":"session","document_id":"document","status":"error","sha256":"abc"}`,
+			err:  ErrInvalidMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := DecodeDocumentProcessed([]byte(tt.body))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(event, tt.expected) {
+				t.Fatalf("expected %+v, got %+v", tt.expected, event)
+			}
+		})
+	}
+}
+
+func TestEncodeRejectsInvalidEvent(t *testing.T) {
+	_, err := Encode(&DocumentProcessed{SessionID: "session", DocumentID: "document", Status: StatusOK})
+	if !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected %v, got %v", ErrInvalidMessage, err)
+	}
+}
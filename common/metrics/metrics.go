@@ -0,0 +1,85 @@
+// Package metrics метрики Prometheus, общие для всех сервисов
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace префикс имён метрик сервисов
+const Namespace = "docshade"
+
+// unmatchedRoute метка запросов, не попавших ни в один маршрут, чтобы сканеры не раздували число рядов
+const unmatchedRoute = "unmatched"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+)
+
+// SizeBuckets границы гистограмм размеров документов: от 16 КиБ до 1 ГиБ
+var SizeBuckets = prometheus.ExponentialBuckets(16<<10, 4, 9)
+
+// Handler отдаёт метрики процесса в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// EchoMiddleware считает запросы и их длительность. Маршрут берётся из шаблона пути,
+// а не из URL, чтобы идентификаторы в пути не порождали новые ряды
+func EchoMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			err := next(c)
+
+			status := responseStatus(c, err)
+			route := c.Path()
+			if route == "" || status == http.StatusNotFound && route == "/*" {
+				route = unmatchedRoute
+			}
+			labels := prometheus.Labels{
+				"method": c.Request().Method,
+				"route":  route,
+				"status": strconv.Itoa(status),
+			}
+			httpRequests.With(labels).Inc()
+			httpDuration.With(labels).Observe(time.Since(start).Seconds())
+
+			return err
+		}
+	}
+}
+
+// responseStatus код ответа. Если обработчик вернул ошибку, ответ ещё не записан:
+// его запишет обработчик ошибок echo уже после всех промежуточных функций
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+
+	if httpErr, ok := err.(*echo.HTTPError); ok {
+		return httpErr.Code
+	}
+
+	return http.StatusInternalServerError
+}
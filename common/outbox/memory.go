@@ -0,0 +1,117 @@
+package outbox
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryMessage struct {
+	Message
+	nextAttemptAt time.Time
+}
+
+type memory struct {
+	mu       sync.Mutex
+	nextID   int64
+	messages map[int64]*memoryMessage
+	// publishing сообщения, которые сейчас публикует Dispatch
+	publishing map[int64]bool
+	wake       chan struct{}
+}
+
+// NewMemoryStore хранилище исходящих сообщений в памяти процесса, для тестов и локального запуска
+func NewMemoryStore() Store {
+	return &memory{
+		messages:   make(map[int64]*memoryMessage),
+		publishing: make(map[int64]bool),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+func (m *memory) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Add(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	now := time.Now().UTC()
+	msg.ID = m.nextID
+	msg.Attempts = 0
+	msg.LastError = ""
+	msg.CreatedAt = now
+	m.messages[msg.ID] = &memoryMessage{Message: msg, nextAttemptAt: now}
+
+	return nil
+}
+
+// Dispatch публикует без блокировки хранилища: сообщения на время публикации помечаются занятыми
+// и удаляются, только когда publish подтвердил публикацию
+func (m *memory) Dispatch(ctx context.Context, limit int, publish PublishFunc) (int, error) {
+	due := m.claim(limit)
+
+	published := 0
+	for _, msg := range due {
+		err := publish(ctx, msg)
+
+		m.mu.Lock()
+		delete(m.publishing, msg.ID)
+		if err == nil {
+			delete(m.messages, msg.ID)
+			published++
+		} else if stored := m.messages[msg.ID]; stored != nil {
+			stored.Attempts++
+			stored.LastError = err.Error()
+			stored.nextAttemptAt = time.Now().Add(backoff(stored.Attempts))
+		}
+		m.mu.Unlock()
+	}
+
+	return published, nil
+}
+
+func (m *memory) claim(limit int) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var due []*memoryMessage
+	for id, msg := range m.messages {
+		if !m.publishing[id] && !msg.nextAttemptAt.After(now) {
+			due = append(due, msg)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	result := make([]Message, 0, len(due))
+	for _, msg := range due {
+		m.publishing[msg.ID] = true
+		result = append(result, msg.Message)
+	}
+
+	return result
+}
+
+func (m *memory) Wake() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *memory) Wakeups() <-chan struct{} {
+	return m.wake
+}
+
+func (m *memory) Close() error {
+	return nil
+}
@@ -0,0 +1,59 @@
+// Package outbox исходящие сообщения брокера, сохранённые в базе вместе с изменением данных.
+// Relay публикует их позже, поэтому сообщение не теряется, если брокер недоступен в момент записи
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+// Message сообщение, ожидающее публикации
+type Message struct {
+	ID         int64
+	Exchange   string
+	RoutingKey string
+	Body       []byte
+	// Headers заголовки сообщения, в том числе контекст трассировки отправителя
+	Headers map[string]interface{}
+	// Attempts число неудачных попыток публикации
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+// PublishFunc публикует сообщение и возвращает ошибку, если брокер его не подтвердил
+type PublishFunc func(ctx context.Context, msg Message) error
+
+type Store interface {
+	// Init создать таблицу сообщений
+	Init(ctx context.Context) error
+	// Add сохранить сообщение для публикации
+	Add(ctx context.Context, msg Message) error
+	// Dispatch опубликовать до limit готовых сообщений. Опубликованные удаляются,
+	// остальные откладываются с нарастающей задержкой. Возвращает число опубликованных
+	Dispatch(ctx context.Context, limit int, publish PublishFunc) (int, error)
+	// Wake разбудить ретранслятор, не дожидаясь очередного опроса
+	Wake()
+	// Wakeups канал пробуждений ретранслятора
+	Wakeups() <-chan struct{}
+	// Close освободить ресурсы хранилища. Общий пул соединений с базой закрывает его владелец
+	Close() error
+}
+
+const (
+	minBackoff = time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// backoff задержка перед следующей попыткой после attempts неудачных
+func backoff(attempts int) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+
+	return delay
+}
@@ -0,0 +1,154 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// CreateTableQuery таблица сообщений. Её создаёт Init, но выполнять запрос повторно безопасно
+const CreateTableQuery = `
+CREATE TABLE IF NOT EXISTS outbox_messages (
+	id              BIGSERIAL PRIMARY KEY,
+	exchange        TEXT NOT NULL,
+	routing_key     TEXT NOT NULL,
+	headers         JSONB NOT NULL DEFAULT '{}',
+	body            BYTEA NOT NULL,
+	attempts        INT NOT NULL DEFAULT 0,
+	last_error      TEXT NOT NULL DEFAULT '',
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS outbox_messages_next_attempt_idx ON outbox_messages (next_attempt_at, id);
+`
+
+const messageColumns = `id, exchange, routing_key, headers, body, attempts, last_error, created_at`
+
+type postgres struct {
+	pool *pgxpool.Pool
+	wake chan struct{}
+}
+
+// NewPostgresStore хранилище исходящих сообщений в Postgres
+func NewPostgresStore(pool *pgxpool.Pool) Store {
+	return &postgres{pool: pool, wake: make(chan struct{}, 1)}
+}
+
+// Init создаёт таблицу сообщений, если её ещё нет
+func (p *postgres) Init(ctx context.Context) error {
+	_, err := p.pool.Exec(ctx, CreateTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create outbox table: %w", err)
+	}
+
+	return nil
+}
+
+func (p *postgres) Add(ctx context.Context, msg Message) error {
+	return Insert(ctx, p.pool, msg)
+}
+
+// Execer пул или транзакция pgx
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Insert сохраняет сообщение через db. Передав транзакцию, сообщение можно записать
+// атомарно с изменением данных, ради которого оно отправляется
+func Insert(ctx context.Context, db Execer, msg Message) error {
+	headers := msg.Headers
+	if headers == nil {
+		headers = map[string]interface{}{}
+	}
+
+	_, err := db.Exec(ctx, `
+		INSERT INTO outbox_messages (exchange, routing_key, headers, body)
+		VALUES ($1, $2, $3, $4)`,
+		msg.Exchange, msg.RoutingKey, headers, msg.Body,
+	)
+
+	return err
+}
+
+// Dispatch забирает готовые сообщения с блокировкой строк: несколько экземпляров сервиса
+// разбирают таблицу параллельно, не публикуя одно сообщение дважды
+func (p *postgres) Dispatch(ctx context.Context, limit int, publish PublishFunc) (int, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(context.WithoutCancel(ctx))
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+messageColumns+` FROM outbox_messages
+		WHERE next_attempt_at <= now()
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED`, limit)
+	if err != nil {
+		return 0, err
+	}
+	messages, err := pgx.CollectRows(rows, scanMessage)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, msg := range messages {
+		if err := publish(ctx, msg); err != nil {
+			_, err = tx.Exec(ctx, `
+				UPDATE outbox_messages
+				SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+				WHERE id = $1`,
+				msg.ID, err.Error(), time.Now().Add(backoff(msg.Attempts+1)),
+			)
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM outbox_messages WHERE id = $1`, msg.ID); err != nil {
+			return 0, err
+		}
+		published++
+	}
+
+	return published, tx.Commit(ctx)
+}
+
+func (p *postgres) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *postgres) Wakeups() <-chan struct{} {
+	return p.wake
+}
+
+// Close ничего не закрывает: пул общий, его закрывает тот, кто открыл
+func (p *postgres) Close() error {
+	return nil
+}
+
+func scanMessage(row pgx.CollectableRow) (Message, error) {
+	var msg Message
+	err := row.Scan(
+		&msg.ID,
+		&msg.Exchange,
+		&msg.RoutingKey,
+		&msg.Headers,
+		&msg.Body,
+		&msg.Attempts,
+		&msg.LastError,
+		&msg.CreatedAt,
+	)
+
+	return msg, err
+}
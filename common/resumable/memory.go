@@ -0,0 +1,160 @@
+package resumable
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/docshade/common/storage"
+
+	"github.com/google/uuid"
+)
+
+type memoryUpload struct {
+	Upload
+	lockToken   string
+	lockedUntil time.Time
+}
+
+type memory struct {
+	mu      sync.Mutex
+	uploads map[string]*memoryUpload
+}
+
+// NewMemoryStore хранилище загрузок в памяти процесса, для тестов и локального запуска
+func NewMemoryStore() Store {
+	return &memory{uploads: make(map[string]*memoryUpload)}
+}
+
+func (m *memory) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Create(ctx context.Context, u Upload) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u.Offset = 0
+	u.Format = ""
+	u.Parts = nil
+	u.HashState = nil
+	u.CreatedAt = time.Now().UTC()
+	m.uploads[u.ID] = &memoryUpload{Upload: u}
+
+	return nil
+}
+
+func (m *memory) Get(ctx context.Context, id string) (Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.uploads[id]
+	if !ok || !u.ExpiresAt.After(time.Now()) {
+		return Upload{}, ErrNotFound
+	}
+
+	return copyUpload(u.Upload), nil
+}
+
+func (m *memory) Lock(ctx context.Context, id string, offset int64, until time.Time) (Upload, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	u, ok := m.uploads[id]
+	if !ok || !u.ExpiresAt.After(now) {
+		return Upload{}, "", ErrNotFound
+	}
+	if u.Offset != offset {
+		return Upload{}, "", ErrOffsetMismatch
+	}
+	if u.lockedUntil.After(now) {
+		return Upload{}, "", ErrLocked
+	}
+
+	u.lockToken = uuid.New().String()
+	u.lockedUntil = until
+
+	return copyUpload(u.Upload), u.lockToken, nil
+}
+
+func (m *memory) Advance(ctx context.Context, next Upload, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.uploads[next.ID]
+	if !ok || u.lockToken != token {
+		return ErrLocked
+	}
+
+	u.Offset = next.Offset
+	u.Format = next.Format
+	u.Multipart = next.Multipart
+	u.Parts = append([]storage.Part(nil), next.Parts...)
+	u.HashState = append([]byte(nil), next.HashState...)
+	u.ExpiresAt = next.ExpiresAt
+	u.lockToken = ""
+	u.lockedUntil = time.Time{}
+
+	return nil
+}
+
+func (m *memory) Unlock(ctx context.Context, id, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if u, ok := m.uploads[id]; ok && u.lockToken == token {
+		u.lockToken = ""
+		u.lockedUntil = time.Time{}
+	}
+
+	return nil
+}
+
+func (m *memory) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.uploads, id)
+
+	return nil
+}
+
+func (m *memory) ListExpired(ctx context.Context, before time.Time, limit int) ([]Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var result []Upload
+	for _, u := range m.uploads {
+		if u.ExpiresAt.Before(before) && !u.lockedUntil.After(now) {
+			result = append(result, copyUpload(u.Upload))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ExpiresAt.Before(result[j].ExpiresAt)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func (m *memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
+
+// copyUpload копия загрузки, не делящая с хранилищем список частей и состояние суммы
+func copyUpload(u Upload) Upload {
+	u.Parts = append([]storage.Part(nil), u.Parts...)
+	u.HashState = append([]byte(nil), u.HashState...)
+
+	return u
+}
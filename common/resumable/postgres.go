@@ -0,0 +1,197 @@
+package resumable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/docshade/common/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// createTableQuery части и загрузка в хранилище хранятся как JSON: читаются только целиком
+const createTableQuery = `
+CREATE TABLE IF NOT EXISTS resumable_uploads (
+	id           TEXT PRIMARY KEY,
+	session_id   TEXT NOT NULL,
+	document_id  TEXT NOT NULL,
+	file_name    TEXT NOT NULL,
+	length       BIGINT NOT NULL,
+	"offset"     BIGINT NOT NULL DEFAULT 0,
+	format       TEXT NOT NULL DEFAULT '',
+	callback     JSONB,
+	multipart    JSONB NOT NULL DEFAULT '{}',
+	parts        JSONB NOT NULL DEFAULT '[]',
+	lock_token   TEXT NOT NULL DEFAULT '',
+	locked_until TIMESTAMPTZ,
+	created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at   TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS resumable_uploads_expires_at_idx ON resumable_uploads (expires_at);
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS object_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS sha256 TEXT NOT NULL DEFAULT '';
+ALTER TABLE resumable_uploads ADD COLUMN IF NOT EXISTS hash_state BYTEA;
+`
+
+const uploadColumns = `id, session_id, document_id, file_name, length, "offset", format, callback, object_key, sha256, hash_state, multipart, parts, created_at, expires_at`
+
+type postgres struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresStore хранилище загрузок в Postgres
+func NewPostgresStore(pool *pgxpool.Pool) Store {
+	return &postgres{pool: pool}
+}
+
+// Init создаёт таблицу загрузок, если её ещё нет
+func (p *postgres) Init(ctx context.Context) error {
+	_, err := p.pool.Exec(ctx, createTableQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create resumable_uploads table: %w", err)
+	}
+
+	return nil
+}
+
+func (p *postgres) Create(ctx context.Context, u Upload) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO resumable_uploads (id, session_id, document_id, file_name, length, callback, object_key, sha256, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		u.ID, u.SessionID, u.DocumentID, u.FileName, u.Length, u.Callback, u.ObjectKey, u.SHA256, u.ExpiresAt,
+	)
+
+	return err
+}
+
+func (p *postgres) Get(ctx context.Context, id string) (Upload, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+uploadColumns+` FROM resumable_uploads
+		WHERE id = $1 AND expires_at > now()`, id)
+	if err != nil {
+		return Upload{}, err
+	}
+	upload, err := pgx.CollectOneRow(rows, scanUpload)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Upload{}, ErrNotFound
+	}
+
+	return upload, err
+}
+
+// Lock закрепляет загрузку одним UPDATE, а при неудаче перечитывает её, чтобы назвать причину
+func (p *postgres) Lock(ctx context.Context, id string, offset int64, until time.Time) (Upload, string, error) {
+	token := uuid.New().String()
+	rows, err := p.pool.Query(ctx, `
+		UPDATE resumable_uploads
+		SET lock_token = $3, locked_until = $4
+		WHERE id = $1 AND "offset" = $2 AND expires_at > now()
+			AND (locked_until IS NULL OR locked_until < now())
+		RETURNING `+uploadColumns, id, offset, token, until)
+	if err != nil {
+		return Upload{}, "", err
+	}
+	upload, err := pgx.CollectOneRow(rows, scanUpload)
+	if err == nil {
+		return upload, token, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return Upload{}, "", err
+	}
+
+	current, err := p.Get(ctx, id)
+	if err != nil {
+		return Upload{}, "", err
+	}
+	if current.Offset != offset {
+		return Upload{}, "", ErrOffsetMismatch
+	}
+
+	return Upload{}, "", ErrLocked
+}
+
+func (p *postgres) Advance(ctx context.Context, u Upload, token string) error {
+	parts := u.Parts
+	if parts == nil {
+		parts = []storage.Part{}
+	}
+
+	tag, err := p.pool.Exec(ctx, `
+		UPDATE resumable_uploads
+		SET "offset" = $3, format = $4, multipart = $5, parts = $6, expires_at = $7, hash_state = $8, lock_token = '', locked_until = NULL
+		WHERE id = $1 AND lock_token = $2`,
+		u.ID, token, u.Offset, u.Format, u.Multipart, parts, u.ExpiresAt, u.HashState,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLocked
+	}
+
+	return nil
+}
+
+func (p *postgres) Unlock(ctx context.Context, id, token string) error {
+	_, err := p.pool.Exec(ctx, `
+		UPDATE resumable_uploads
+		SET lock_token = '', locked_until = NULL
+		WHERE id = $1 AND lock_token = $2`, id, token)
+
+	return err
+}
+
+func (p *postgres) Delete(ctx context.Context, id string) error {
+	_, err := p.pool.Exec(ctx, `DELETE FROM resumable_uploads WHERE id = $1`, id)
+
+	return err
+}
+
+func (p *postgres) ListExpired(ctx context.Context, before time.Time, limit int) ([]Upload, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+uploadColumns+` FROM resumable_uploads
+		WHERE expires_at < $1 AND (locked_until IS NULL OR locked_until < now())
+		ORDER BY expires_at
+		LIMIT $2`, before, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, scanUpload)
+}
+
+func (p *postgres) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+// Close ничего не закрывает: пул общий, его закрывает тот, кто открыл
+func (p *postgres) Close() error {
+	return nil
+}
+
+func scanUpload(row pgx.CollectableRow) (Upload, error) {
+	var u Upload
+	err := row.Scan(
+		&u.ID,
+		&u.SessionID,
+		&u.DocumentID,
+		&u.FileName,
+		&u.Length,
+		&u.Offset,
+		&u.Format,
+		&u.Callback,
+		&u.ObjectKey,
+		&u.SHA256,
+		&u.HashState,
+		&u.Multipart,
+		&u.Parts,
+		&u.CreatedAt,
+		&u.ExpiresAt,
+	)
+
+	return u, err
+}
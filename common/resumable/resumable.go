@@ -0,0 +1,79 @@
+// Package resumable состояние загрузок документа частями: сколько байт уже принято,
+// загруженные части объекта в хранилище и срок, после которого брошенная загрузка отменяется
+package resumable
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/storage"
+)
+
+var (
+	ErrNotFound = errors.New("upload not found")
+	// ErrOffsetMismatch клиент продолжает загрузку не с того смещения, на котором она остановилась
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	// ErrLocked загрузку сейчас продолжает другой запрос
+	ErrLocked = errors.New("upload is locked by another request")
+	// ErrLengthExceeded часть выходит за заявленный размер документа
+	ErrLengthExceeded = errors.New("chunk exceeds upload length")
+	// ErrUploadMode операция не подходит загрузке: части отправляются только в загрузку через сервис,
+	// а завершить по ссылке можно только прямую загрузку
+	ErrUploadMode = errors.New("operation does not match the upload mode")
+)
+
+// Upload незавершённая загрузка документа: частями через сервис или напрямую в хранилище по подписанной ссылке
+type Upload struct {
+	ID         string
+	SessionID  string
+	DocumentID string
+	FileName   string
+	// Length заявленный клиентом размер документа
+	Length int64
+	// Offset сколько байт документа уже сохранено в частях
+	Offset int64
+	// Format имя формата, определяется по первой части
+	Format   string
+	Callback *messaging.Callback
+	// ObjectKey ключ, под который клиент загружает документ напрямую. Пустой для загрузки частями
+	ObjectKey string
+	// SHA256 контрольная сумма документа в hex. Для прямой загрузки заявляется клиентом и может быть пустой,
+	// для загрузки частями считается после последней части
+	SHA256 string
+	// HashState состояние SHA-256 уже принятых частей, сумма документа считается по мере загрузки
+	HashState []byte
+	// Multipart загрузка объекта в хранилище, начинается вместе с первой частью
+	Multipart storage.MultipartUpload
+	Parts     []storage.Part
+	CreatedAt time.Time
+	// ExpiresAt срок, до которого ждём следующую часть
+	ExpiresAt time.Time
+}
+
+// Store хранилище состояний загрузок. Часть принимается под блокировкой: Lock проверяет смещение
+// и закрепляет загрузку за запросом, Advance сохраняет новую часть и снимает блокировку
+type Store interface {
+	// Init создать таблицу загрузок
+	Init(ctx context.Context) error
+	// Create сохранить новую загрузку
+	Create(ctx context.Context, upload Upload) error
+	// Get получить загрузку, просроченные загрузки не возвращаются
+	Get(ctx context.Context, id string) (Upload, error)
+	// Lock закрепить загрузку за запросом до until, если она остановилась на offset.
+	// Возвращает загрузку и токен блокировки
+	Lock(ctx context.Context, id string, offset int64, until time.Time) (Upload, string, error)
+	// Advance сохранить смещение, части и срок загрузки и снять блокировку token
+	Advance(ctx context.Context, upload Upload, token string) error
+	// Unlock снять блокировку token, не меняя загрузку
+	Unlock(ctx context.Context, id, token string) error
+	// Delete удалить загрузку
+	Delete(ctx context.Context, id string) error
+	// ListExpired до limit незаблокированных загрузок, срок которых истёк раньше before
+	ListExpired(ctx context.Context, before time.Time, limit int) ([]Upload, error)
+	// Ping проверить соединение с базой
+	Ping(ctx context.Context) error
+	// Close освободить ресурсы хранилища. Общий пул соединений с базой закрывает его владелец
+	Close() error
+}
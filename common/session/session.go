@@ -0,0 +1,80 @@
+// Package session подписанные токены доступа к сессии. upload-service выдаёт токен вместе с SessionID,
+// а notification-service проверяет его, прежде чем отдавать уведомления сессии
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+)
+
+var (
+	// ErrNoSecret ключ подписи не задан, без него токены можно подделать
+	ErrNoSecret = errors.New("session secret is not configured")
+	// ErrInvalidToken токен повреждён или выдан для другой сессии
+	ErrInvalidToken = errors.New("invalid session token")
+	// ErrTokenExpired срок действия токена истёк
+	ErrTokenExpired = errors.New("session token expired")
+)
+
+// Signer выдаёт и проверяет токены вида <unix-время истечения>.<hmac-sha256>
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewSigner подписывает токены секретом из конфигурации
+func NewSigner(cfg core.SessionConfig) (*Signer, error) {
+	if cfg.Secret == "" {
+		return nil, ErrNoSecret
+	}
+
+	return &Signer{
+		secret: []byte(cfg.Secret),
+		ttl:    cfg.TokenTTL,
+		now:    time.Now,
+	}, nil
+}
+
+// Issue токен доступа к сессии и время, до которого он действует
+func (s *Signer) Issue(sessionID string) (string, time.Time) {
+	expiresAt := s.now().Add(s.ttl).Truncate(time.Second)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	return expires + "." + s.signature(sessionID, expires), expiresAt.UTC()
+}
+
+// Verify проверяет, что токен выдан для этой сессии и ещё действует
+func (s *Signer) Verify(sessionID, token string) error {
+	expires, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(sessionID, expires))) {
+		return ErrInvalidToken
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if s.now().Unix() > expiresAt {
+		return ErrTokenExpired
+	}
+
+	return nil
+}
+
+func (s *Signer) signature(sessionID, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(sessionID + "\n" + expires))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
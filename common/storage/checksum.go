@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+)
+
+// MetadataSHA256 ключ метаданных объекта с SHA-256 содержимого в hex. Записан в том виде,
+// в котором его возвращает MinIO
+const MetadataSHA256 = "Sha256"
+
+// ErrChecksumMismatch содержимое объекта не совпадает с ожидаемой контрольной суммой
+var ErrChecksumMismatch = errors.New("object checksum mismatch")
+
+// Checksum контрольная сумма объекта из его метаданных, пустая, если она не записана
+func Checksum(info ObjectInfo) string {
+	return lookupMeta(info.Metadata, MetadataSHA256)
+}
+
+// SetChecksum записывает контрольную сумму в метаданные уже сохранённого объекта, не перезаписывая содержимое.
+// Нужна, когда сумма известна только после записи: объект собран из частей или скопирован
+func SetChecksum(ctx context.Context, s Storage, bucket, key, sum string) error {
+	return CopyWithChecksum(ctx, s, bucket, key, bucket, key, sum)
+}
+
+// CopyWithChecksum копирует объект вместе с метаданными, добавляя к ним контрольную сумму,
+// за одно копирование
+func CopyWithChecksum(ctx context.Context, s Storage, srcBucket, srcKey, dstBucket, dstKey, sum string) error {
+	copier, ok := s.(metadataCopier)
+	if !ok {
+		return fmt.Errorf("storage driver does not support metadata updates")
+	}
+
+	info, err := s.Stat(ctx, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+
+	metadata := make(map[string]string, len(info.Metadata)+1)
+	for k, v := range info.Metadata {
+		metadata[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	metadata[MetadataSHA256] = sum
+
+	return copier.copyWithMetadata(ctx, srcBucket, srcKey, dstBucket, dstKey, info, metadata)
+}
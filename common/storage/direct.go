@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDirectUploadUnsupported драйвер хранилища не принимает объекты от клиента напрямую
+var ErrDirectUploadUnsupported = errors.New("storage driver does not support direct uploads")
+
+// PutPresigner хранилище, в которое клиент загружает объект сам, минуя сервис
+type PutPresigner interface {
+	// PresignPut получить временную ссылку для загрузки объекта запросом PUT
+	PresignPut(ctx context.Context, bucket, key string, expiry time.Duration) (string, error)
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"gitlab.com/docshade/common/core"
+	httpUtils "gitlab.com/docshade/common/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+const defaultContentType = "application/octet-stream"
+
+type downloadHandler struct {
+	storage Storage
+	signer  *URLSigner
+}
+
+// NewDownloadHandler ручка, отдающая объекты по подписанным ссылкам хранилища
+func NewDownloadHandler(storage Storage, cfg core.S3Config) core.Handler {
+	return &downloadHandler{
+		storage: storage,
+		signer:  NewURLSigner(cfg),
+	}
+}
+
+// GetMethod Get handler method
+func (h *downloadHandler) GetMethod() httpUtils.Methods {
+	return httpUtils.GetMethod
+}
+
+// GetRoute Get handler route
+func (h *downloadHandler) GetRoute() string {
+	return DownloadRoute
+}
+
+// Do отдаёт объект потоком, если ссылка подписана и не просрочена
+func (h *downloadHandler) Do(ctx echo.Context) error {
+	bucket := ctx.Param("bucket")
+	key, err := url.PathUnescape(ctx.Param("*"))
+	if err != nil {
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid object key")
+	}
+
+	query := ctx.QueryParams()
+	if err := h.signer.Verify(bucket, key, query); err != nil {
+		return httpUtils.ReturnForbiddenError(ctx, err, "Invalid download link")
+	}
+
+	request := ctx.Request()
+	info, err := h.storage.Stat(request.Context(), bucket, key)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return httpUtils.ReturnNotFoundError(ctx, err, "Object not found")
+		}
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to get object")
+	}
+
+	object, err := h.storage.Get(request.Context(), bucket, key)
+	if err != nil {
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to get object")
+	}
+	defer object.Close()
+
+	if downloadName := query.Get("filename"); downloadName != "" {
+		ctx.Response().Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+	}
+
+	contentType := info.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+
+	return ctx.Stream(http.StatusOK, contentType, object)
+}
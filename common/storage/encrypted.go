@@ -0,0 +1,341 @@
+package storage
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log"
+	"net/textproto"
+	"time"
+)
+
+// Метаданные зашифрованного объекта. Ключи записаны в каноническом виде,
+// в котором их возвращает MinIO
+const (
+	metaEncryption = "Docshade-Encryption"
+	metaKeyID      = "Docshade-Key-Id"
+	metaWrappedKey = "Docshade-Wrapped-Key"
+
+	encryptionScheme = "aes-256-gcm-stream-v1"
+)
+
+// metadataCopier драйвер, умеющий скопировать объект с новыми метаданными. Если источник совпадает
+// с назначением, заменяются только метаданные без перезаписи содержимого
+type metadataCopier interface {
+	copyWithMetadata(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, info ObjectInfo, metadata map[string]string) error
+}
+
+// KeyRotator хранилище, умеющее перешифровать ключи данных активным мастер-ключом
+type KeyRotator interface {
+	// RotateKeys перешифровывает ключи объектов бакета, обёрнутые неактивными мастер-ключами,
+	// и возвращает количество обновлённых объектов
+	RotateKeys(ctx context.Context, bucket string) (int, error)
+}
+
+// encryptedStorage шифрует объекты конвертным шифрованием: у каждого объекта свой ключ данных,
+// который хранится в метаданных объекта обёрнутым мастер-ключом. Объекты без метаданных шифрования,
+// сохранённые до его включения, читаются как есть
+type encryptedStorage struct {
+	Storage
+	keyring *Keyring
+	signer  *URLSigner
+}
+
+// NewEncrypted прозрачно шифрует объекты inner при записи и расшифровывает при чтении
+func NewEncrypted(inner Storage, keyring *Keyring, signer *URLSigner) Storage {
+	return &encryptedStorage{
+		Storage: inner,
+		keyring: keyring,
+		signer:  signer,
+	}
+}
+
+func (s *encryptedStorage) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutOptions) error {
+	aead, metadata, err := s.newDataKey(opts.Metadata)
+	if err != nil {
+		return err
+	}
+
+	encSize := int64(-1)
+	if size >= 0 {
+		encSize = encryptedSize(size)
+	}
+
+	return s.Storage.Put(ctx, bucket, key, newEncryptReader(aead, body), encSize, PutOptions{
+		ContentType: opts.ContentType,
+		Metadata:    metadata,
+	})
+}
+
+func (s *encryptedStorage) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	info, err := s.Storage.Stat(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := s.Storage.Get(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if lookupMeta(info.Metadata, metaEncryption) == "" {
+		return object, nil
+	}
+
+	aead, err := s.dataCipher(info.Metadata)
+	if err != nil {
+		object.Close()
+		return nil, fmt.Errorf("object %s/%s: %w", bucket, key, err)
+	}
+
+	return newDecryptReader(aead, object), nil
+}
+
+func (s *encryptedStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	info, err := s.Storage.Stat(ctx, bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return plainInfo(info), nil
+}
+
+func (s *encryptedStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	objects, err := s.Storage.List(ctx, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range objects {
+		objects[i] = plainInfo(objects[i])
+	}
+
+	return objects, nil
+}
+
+// Presign ведёт на DownloadHandler: хранилище отдало бы по прямой ссылке шифртекст.
+// PutPresigner не реализован намеренно: объект, загруженный клиентом напрямую, лёг бы в хранилище открытым
+func (s *encryptedStorage) Presign(ctx context.Context, bucket, key string, expiry time.Duration, downloadName string) (string, error) {
+	if _, err := s.Storage.Stat(ctx, bucket, key); err != nil {
+		return "", err
+	}
+
+	return s.signer.Sign(bucket, key, expiry, downloadName), nil
+}
+
+func (s *encryptedStorage) RotateKeys(ctx context.Context, bucket string) (int, error) {
+	copier, ok := s.Storage.(metadataCopier)
+	if !ok {
+		return 0, fmt.Errorf("storage driver does not support key rotation")
+	}
+
+	objects, err := s.Storage.List(ctx, bucket, "")
+	if err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return rotated, err
+		}
+
+		// List может не вернуть метаданные, поэтому актуальные берём из Stat
+		info, err := s.Storage.Stat(ctx, bucket, object.Key)
+		if err != nil {
+			return rotated, err
+		}
+
+		keyID := lookupMeta(info.Metadata, metaKeyID)
+		if lookupMeta(info.Metadata, metaEncryption) == "" || keyID == s.keyring.ActiveID() {
+			continue
+		}
+
+		dataKey, err := s.keyring.Unwrap(keyID, lookupMeta(info.Metadata, metaWrappedKey))
+		if err != nil {
+			return rotated, fmt.Errorf("object %s/%s: %w", bucket, object.Key, err)
+		}
+
+		newKeyID, wrapped, err := s.keyring.Wrap(dataKey)
+		if err != nil {
+			return rotated, err
+		}
+
+		metadata := make(map[string]string, len(info.Metadata))
+		for k, v := range info.Metadata {
+			metadata[textproto.CanonicalMIMEHeaderKey(k)] = v
+		}
+		metadata[metaKeyID] = newKeyID
+		metadata[metaWrappedKey] = wrapped
+
+		if err := copier.copyWithMetadata(ctx, bucket, object.Key, bucket, object.Key, info, metadata); err != nil {
+			return rotated, fmt.Errorf("object %s/%s: %w", bucket, object.Key, err)
+		}
+
+		log.Printf("Rotated data key of %s/%s from %s to %s", bucket, object.Key, keyID, newKeyID)
+		rotated++
+	}
+
+	return rotated, nil
+}
+
+// copyWithMetadata сохраняет метаданные шифрования: вызывающий получил сведения об объекте из Stat без них
+func (s *encryptedStorage) copyWithMetadata(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, info ObjectInfo, metadata map[string]string) error {
+	copier, ok := s.Storage.(metadataCopier)
+	if !ok {
+		return fmt.Errorf("storage driver does not support metadata updates")
+	}
+
+	raw, err := s.Storage.Stat(ctx, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]string, len(metadata)+3)
+	for k, v := range metadata {
+		merged[k] = v
+	}
+	for _, k := range []string{metaEncryption, metaKeyID, metaWrappedKey} {
+		if v := lookupMeta(raw.Metadata, k); v != "" {
+			merged[k] = v
+		}
+	}
+
+	return copier.copyWithMetadata(ctx, srcBucket, srcKey, dstBucket, dstKey, raw, merged)
+}
+
+func (s *encryptedStorage) CreateMultipart(ctx context.Context, bucket, key string, opts PutOptions) (MultipartUpload, error) {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return MultipartUpload{}, ErrMultipartUnsupported
+	}
+
+	_, metadata, err := s.newDataKey(opts.Metadata)
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+
+	return uploader.CreateMultipart(ctx, bucket, key, PutOptions{ContentType: opts.ContentType, Metadata: metadata})
+}
+
+// UploadPart шифрует часть ключом данных из метаданных загрузки, продолжая нумерацию сегментов
+// с offset. Поэтому части выравниваются по сегментам, а признак последнего сегмента ставит только последняя часть
+func (s *encryptedStorage) UploadPart(ctx context.Context, upload MultipartUpload, number int, offset int64, body io.Reader, size int64, last bool) (Part, error) {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return Part{}, ErrMultipartUnsupported
+	}
+	if err := ValidatePart(offset, size, last); err != nil {
+		return Part{}, err
+	}
+
+	aead, err := s.dataCipher(upload.Metadata)
+	if err != nil {
+		return Part{}, err
+	}
+
+	encrypted := newPartEncryptReader(aead, body, uint64(offset/segmentSize), last)
+	part, err := uploader.UploadPart(ctx, upload, number, offset, encrypted, encryptedPartSize(size, last), last)
+	if err != nil {
+		return Part{}, err
+	}
+	part.Size = size
+
+	return part, nil
+}
+
+func (s *encryptedStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []Part) error {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return ErrMultipartUnsupported
+	}
+
+	return uploader.CompleteMultipart(ctx, upload, parts)
+}
+
+func (s *encryptedStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return ErrMultipartUnsupported
+	}
+
+	return uploader.AbortMultipart(ctx, upload)
+}
+
+// newDataKey создаёт ключ данных нового объекта и метаданные с ключом, обёрнутым активным мастер-ключом
+func (s *encryptedStorage) newDataKey(objectMetadata map[string]string) (cipher.AEAD, map[string]string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyID, wrapped, err := s.keyring.Wrap(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metadata := make(map[string]string, len(objectMetadata)+3)
+	for k, v := range objectMetadata {
+		metadata[k] = v
+	}
+	metadata[metaEncryption] = encryptionScheme
+	metadata[metaKeyID] = keyID
+	metadata[metaWrappedKey] = wrapped
+
+	return aead, metadata, nil
+}
+
+func (s *encryptedStorage) dataCipher(metadata map[string]string) (cipher.AEAD, error) {
+	if scheme := lookupMeta(metadata, metaEncryption); scheme != encryptionScheme {
+		return nil, fmt.Errorf("unsupported encryption scheme %q", scheme)
+	}
+
+	dataKey, err := s.keyring.Unwrap(lookupMeta(metadata, metaKeyID), lookupMeta(metadata, metaWrappedKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return newGCM(dataKey)
+}
+
+// plainInfo сведения об объекте так, как их видит вызывающий: размер открытого текста, без служебных метаданных
+func plainInfo(info ObjectInfo) ObjectInfo {
+	if lookupMeta(info.Metadata, metaEncryption) == "" {
+		return info
+	}
+
+	metadata := make(map[string]string, len(info.Metadata))
+	for k, v := range info.Metadata {
+		switch textproto.CanonicalMIMEHeaderKey(k) {
+		case metaEncryption, metaKeyID, metaWrappedKey:
+		default:
+			metadata[k] = v
+		}
+	}
+
+	info.Size = plainSize(info.Size)
+	info.Metadata = metadata
+
+	return info
+}
+
+// lookupMeta значение метаданных без учёта регистра ключа: драйверы по-разному нормализуют ключи
+func lookupMeta(metadata map[string]string, key string) string {
+	if v, ok := metadata[key]; ok {
+		return v
+	}
+	for k, v := range metadata {
+		if textproto.CanonicalMIMEHeaderKey(k) == key {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"testing"
+
+	"gitlab.com/docshade/common/core"
+)
+
+const testBucket = "documents"
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("failed to generate random bytes: %v", err)
+	}
+
+	return b
+}
+
+// testKeyring связка с мастер-ключами keys, активный ключ activeID
+func testKeyring(t *testing.T, activeID string, keys map[string][]byte) *Keyring {
+	t.Helper()
+
+	encoded := make(map[string]string, len(keys))
+	for id, key := range keys {
+		encoded[id] = base64.StdEncoding.EncodeToString(key)
+	}
+
+	keyring, err := NewKeyring(core.S3Config{EncryptionKeyID: activeID, EncryptionKeys: encoded})
+	if err != nil {
+		t.Fatalf("failed to create keyring: %v", err)
+	}
+
+	return keyring
+}
+
+// testStorages локальное хранилище во временном каталоге и шифрующая обёртка над ним
+func testStorages(t *testing.T, keyring *Keyring) (raw Storage, encrypted Storage) {
+	t.Helper()
+
+	raw = newLocal(core.S3Config{LocalPath: t.TempDir()})
+	if err := raw.Init(context.Background(), testBucket); err != nil {
+		t.Fatalf("failed to init storage: %v", err)
+	}
+
+	return raw, NewEncrypted(raw, keyring, NewURLSigner(core.S3Config{}))
+}
+
+func readObject(t *testing.T, s Storage, key string) ([]byte, error) {
+	t.Helper()
+
+	object, err := s.Get(context.Background(), testBucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	keyring := testKeyring(t, "k1", map[string][]byte{"k1": randomBytes(t, masterKeySize)})
+	raw, encrypted := testStorages(t, keyring)
+	ctx := context.Background()
+
+	sizes := []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 2 * segmentSize, 3*segmentSize + 7}
+	for _, size := range sizes {
+		plain := randomBytes(t, size)
+
+		// Размер известен при загрузке формы и неизвестен для результата анонимайзера
+		for _, putSize := range []int64{int64(size), -1} {
+			if err := encrypted.Put(ctx, testBucket, "doc", bytes.NewReader(plain), putSize, PutOptions{}); err != nil {
+				t.Fatalf("size %d: failed to put: %v", size, err)
+			}
+
+			got, err := readObject(t, encrypted, "doc")
+			if err != nil {
+				t.Fatalf("size %d: failed to read: %v", size, err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatalf("size %d: decrypted content differs", size)
+			}
+
+			info, err := encrypted.Stat(ctx, testBucket, "doc")
+			if err != nil {
+				t.Fatalf("size %d: failed to stat: %v", size, err)
+			}
+			if info.Size != int64(size) {
+				t.Fatalf("size %d: stat reports %d", size, info.Size)
+			}
+			if lookupMeta(info.Metadata, metaWrappedKey) != "" {
+				t.Fatalf("size %d: stat exposes the wrapped key", size)
+			}
+
+			stored, err := readObject(t, raw, "doc")
+			if err != nil {
+				t.Fatalf("size %d: failed to read raw object: %v", size, err)
+			}
+			if int64(len(stored)) != encryptedSize(int64(size)) {
+				t.Fatalf("size %d: expected %d bytes of ciphertext, got %d", size, encryptedSize(int64(size)), len(stored))
+			}
+			if size > 0 && bytes.Contains(stored, plain[:min(size, 64)]) {
+				t.Fatalf("size %d: plaintext stored as is", size)
+			}
+		}
+	}
+}
+
+func TestEncryptedMultipartRoundTrip(t *testing.T) {
+	keyring := testKeyring(t, "k1", map[string][]byte{"k1": randomBytes(t, masterKeySize)})
+	_, encrypted := testStorages(t, keyring)
+	ctx := context.Background()
+
+	plain := randomBytes(t, MinPartSize+segmentSize+5)
+	uploader := encrypted.(MultipartUploader)
+
+	upload, err := uploader.CreateMultipart(ctx, testBucket, "doc", PutOptions{})
+	if err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+
+	var parts []Part
+	for i, bounds := range [][2]int{{0, MinPartSize}, {MinPartSize, len(plain)}} {
+		body := plain[bounds[0]:bounds[1]]
+		last := bounds[1] == len(plain)
+		part, err := uploader.UploadPart(ctx, upload, i+1, int64(bounds[0]), bytes.NewReader(body), int64(len(body)), last)
+		if err != nil {
+			t.Fatalf("failed to upload part %d: %v", i+1, err)
+		}
+		parts = append(parts, part)
+	}
+
+	if err := uploader.CompleteMultipart(ctx, upload, parts); err != nil {
+		t.Fatalf("failed to complete upload: %v", err)
+	}
+
+	got, err := readObject(t, encrypted, "doc")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("decrypted content differs")
+	}
+}
+
+func TestDecryptDetectsTampering(t *testing.T) {
+	aead, err := newGCM(randomBytes(t, dataKeySize))
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+
+	ciphertext, err := io.ReadAll(newEncryptReader(aead, bytes.NewReader(randomBytes(t, 3*segmentSize+100))))
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	sealed := segmentSize + tagSize
+	segment := func(i int) []byte {
+		return ciphertext[i*sealed : min((i+1)*sealed, len(ciphertext))]
+	}
+	join := func(chunks ...[]byte) []byte {
+		return bytes.Join(chunks, nil)
+	}
+	flipped := bytes.Clone(ciphertext)
+	flipped[sealed+10] ^= 1
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{name: "truncated at segment boundary", ciphertext: ciphertext[:2*sealed]},
+		{name: "truncated inside segment", ciphertext: ciphertext[:2*sealed+100]},
+		{name: "last segment dropped", ciphertext: join(segment(0), segment(1), segment(2))},
+		{name: "segments reordered", ciphertext: join(segment(1), segment(0), segment(2), segment(3))},
+		{name: "segment duplicated", ciphertext: join(segment(0), segment(0), segment(1), segment(2), segment(3))},
+		{name: "final segment appended twice", ciphertext: join(ciphertext, segment(3))},
+		{name: "bit flipped", ciphertext: flipped},
+		{name: "empty", ciphertext: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := io.ReadAll(newDecryptReader(aead, io.NopCloser(bytes.NewReader(tt.ciphertext))))
+			if !errors.Is(err, errCorruptedObject) {
+				t.Fatalf("expected %v, got %v", errCorruptedObject, err)
+			}
+		})
+	}
+}
+
+func TestEncryptedWrongKey(t *testing.T) {
+	ctx := context.Background()
+	writer := testKeyring(t, "k1", map[string][]byte{"k1": randomBytes(t, masterKeySize)})
+	raw, encrypted := testStorages(t, writer)
+
+	if err := encrypted.Put(ctx, testBucket, "doc", bytes.NewReader(randomBytes(t, 1000)), 1000, PutOptions{}); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	// Ключ с тем же идентификатором, но другим содержимым
+	replaced := NewEncrypted(raw, testKeyring(t, "k1", map[string][]byte{"k1": randomBytes(t, masterKeySize)}), NewURLSigner(core.S3Config{}))
+	if _, err := readObject(t, replaced, "doc"); err == nil {
+		t.Fatalf("expected read with a different master key to fail")
+	}
+
+	// Ключа, которым обёрнут ключ данных, нет в конфигурации
+	missing := NewEncrypted(raw, testKeyring(t, "k2", map[string][]byte{"k2": randomBytes(t, masterKeySize)}), NewURLSigner(core.S3Config{}))
+	if _, err := readObject(t, missing, "doc"); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected %v, got %v", ErrUnknownKey, err)
+	}
+}
+
+func TestEncryptedReadsLegacyObjects(t *testing.T) {
+	ctx := context.Background()
+	keyring := testKeyring(t, "k1", map[string][]byte{"k1": randomBytes(t, masterKeySize)})
+	raw, encrypted := testStorages(t, keyring)
+
+	// Объект сохранён до включения шифрования
+	plain := randomBytes(t, 2*segmentSize+3)
+	err := raw.Put(ctx, testBucket, "legacy", bytes.NewReader(plain), int64(len(plain)), PutOptions{
+		ContentType: "application/pdf",
+		Metadata:    map[string]string{"Original-Name": "report.pdf"},
+	})
+	if err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	got, err := readObject(t, encrypted, "legacy")
+	if err != nil {
+		t.Fatalf("failed to read: %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("legacy content differs")
+	}
+
+	info, err := encrypted.Stat(ctx, testBucket, "legacy")
+	if err != nil {
+		t.Fatalf("failed to stat: %v", err)
+	}
+	if info.Size != int64(len(plain)) || lookupMeta(info.Metadata, "Original-Name") != "report.pdf" {
+		t.Fatalf("unexpected legacy object info %+v", info)
+	}
+}
+
+func TestEncryptedRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := randomBytes(t, masterKeySize), randomBytes(t, masterKeySize)
+	raw, encrypted := testStorages(t, testKeyring(t, "old", map[string][]byte{"old": oldKey}))
+
+	plain := randomBytes(t, segmentSize+1)
+	if err := encrypted.Put(ctx, testBucket, "doc", bytes.NewReader(plain), int64(len(plain)), PutOptions{}); err != nil {
+		t.Fatalf("failed to put: %v", err)
+	}
+
+	rotating := NewEncrypted(raw, testKeyring(t, "new", map[string][]byte{"old": oldKey, "new": newKey}), NewURLSigner(core.S3Config{}))
+	rotated, err := rotating.(KeyRotator).RotateKeys(ctx, testBucket)
+	if err != nil || rotated != 1 {
+		t.Fatalf("expected one rotated object, got %d: %v", rotated, err)
+	}
+
+	// После ротации старый мастер-ключ для чтения не нужен
+	current := NewEncrypted(raw, testKeyring(t, "new", map[string][]byte{"new": newKey}), NewURLSigner(core.S3Config{}))
+	got, err := readObject(t, current, "doc")
+	if err != nil {
+		t.Fatalf("failed to read rotated object: %v", err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("rotated content differs")
+	}
+}
+
+func TestSetChecksum(t *testing.T) {
+	ctx := context.Background()
+	raw, encrypted := testStorages(t, testKeyring(t, "k1", map[string][]byte{"k1": randomBytes(t, masterKeySize)}))
+
+	plain := randomBytes(t, segmentSize+1)
+	for _, s := range []Storage{raw, encrypted} {
+		err := s.Put(ctx, testBucket, "doc", bytes.NewReader(plain), int64(len(plain)), PutOptions{
+			ContentType: "application/pdf",
+			Metadata:    map[string]string{"Original-Name": "report.pdf"},
+		})
+		if err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+
+		if err := SetChecksum(ctx, s, testBucket, "doc", "abc"); err != nil {
+			t.Fatalf("failed to set checksum: %v", err)
+		}
+
+		info, err := s.Stat(ctx, testBucket, "doc")
+		if err != nil {
+			t.Fatalf("failed to stat: %v", err)
+		}
+		if Checksum(info) != "abc" || lookupMeta(info.Metadata, "Original-Name") != "report.pdf" || info.ContentType != "application/pdf" {
+			t.Fatalf("unexpected object info %+v", info)
+		}
+
+		// Метаданные шифрования остались на месте, объект по-прежнему читается
+		got, err := readObject(t, s, "doc")
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("content differs after checksum update")
+		}
+	}
+}
+
+func TestCopyWithChecksum(t *testing.T) {
+	ctx := context.Background()
+	raw, encrypted := testStorages(t, testKeyring(t, "k1", map[string][]byte{"k1": randomBytes(t, masterKeySize)}))
+
+	plain := randomBytes(t, segmentSize+1)
+	for _, s := range []Storage{raw, encrypted} {
+		err := s.Put(ctx, testBucket, "staged", bytes.NewReader(plain), int64(len(plain)), PutOptions{
+			ContentType: "application/pdf",
+			Metadata:    map[string]string{"Original-Name": "report.pdf"},
+		})
+		if err != nil {
+			t.Fatalf("failed to put: %v", err)
+		}
+
+		if err := CopyWithChecksum(ctx, s, testBucket, "staged", testBucket, "doc", "abc"); err != nil {
+			t.Fatalf("failed to copy: %v", err)
+		}
+
+		info, err := s.Stat(ctx, testBucket, "doc")
+		if err != nil {
+			t.Fatalf("failed to stat: %v", err)
+		}
+		if Checksum(info) != "abc" || lookupMeta(info.Metadata, "Original-Name") != "report.pdf" || info.ContentType != "application/pdf" || info.Size != int64(len(plain)) {
+			t.Fatalf("unexpected object info %+v", info)
+		}
+
+		// Источник не изменился, копия читается с теми же ключами шифрования
+		source, err := s.Stat(ctx, testBucket, "staged")
+		if err != nil {
+			t.Fatalf("failed to stat source: %v", err)
+		}
+		if Checksum(source) != "" {
+			t.Fatalf("source metadata changed: %+v", source)
+		}
+		got, err := readObject(t, s, "doc")
+		if err != nil {
+			t.Fatalf("failed to read: %v", err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("copied content differs")
+		}
+	}
+}
+
+func TestEncryptedSizes(t *testing.T) {
+	for _, size := range []int64{0, 1, segmentSize, segmentSize + 1, 10 * segmentSize} {
+		if got := plainSize(encryptedSize(size)); got != size {
+			t.Fatalf("size %d: plainSize(encryptedSize) = %d", size, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"gitlab.com/docshade/common/core"
+)
+
+const masterKeySize = 32
+
+// ErrUnknownKey объект зашифрован мастер-ключом, которого нет в конфигурации
+var ErrUnknownKey = errors.New("unknown master key")
+
+// Keyring мастер-ключи, которыми оборачиваются ключи данных объектов.
+// Новые объекты шифруются активным ключом, остальные нужны для чтения старых объектов до ротации
+type Keyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// NewKeyring мастер-ключи из конфигурации
+func NewKeyring(cfg core.S3Config) (*Keyring, error) {
+	keyring := &Keyring{
+		activeID: cfg.EncryptionKeyID,
+		keys:     make(map[string]cipher.AEAD, len(cfg.EncryptionKeys)),
+	}
+
+	for id, encoded := range cfg.EncryptionKeys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", id, err)
+		}
+		if len(key) != masterKeySize {
+			return nil, fmt.Errorf("master key %s: expected %d bytes, got %d", id, masterKeySize, len(key))
+		}
+
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, fmt.Errorf("master key %s: %w", id, err)
+		}
+		keyring.keys[id] = aead
+	}
+
+	if _, ok := keyring.keys[keyring.activeID]; !ok {
+		return nil, fmt.Errorf("%w: active key %q is not configured", ErrUnknownKey, keyring.activeID)
+	}
+
+	return keyring, nil
+}
+
+// ActiveID идентификатор ключа, которым шифруются новые объекты
+func (k *Keyring) ActiveID() string {
+	return k.activeID
+}
+
+// Wrap шифрует ключ данных активным мастер-ключом
+func (k *Keyring) Wrap(dataKey []byte) (keyID, wrapped string, err error) {
+	aead := k.keys[k.activeID]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, dataKey, []byte(k.activeID))
+
+	return k.activeID, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Unwrap расшифровывает ключ данных мастер-ключом keyID
+func (k *Keyring) Unwrap(keyID, wrapped string) ([]byte, error) {
+	aead, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("malformed wrapped key: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed wrapped key: too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	return dataKey, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,475 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+)
+
+const (
+	defaultLocalPath = "./data"
+	// metaDir каталог с метаданными объектов, лежит рядом с бакетами и не виден в List
+	metaDir = ".meta"
+	// multipartDir каталог с частями незавершённых загрузок, по подкаталогу на загрузку
+	multipartDir = ".multipart"
+)
+
+// localStorage хранит объекты файлами в каталоге <LocalPath>/<bucket>/<key>,
+// предназначен для разработки и интеграционных тестов без MinIO
+type localStorage struct {
+	root    string
+	signer  *URLSigner
+	buckets []string
+}
+
+// localMeta метаданные объекта, которые не хранит файловая система
+type localMeta struct {
+	ContentType string            `json:"content_type"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+func newLocal(cfg core.S3Config) Storage {
+	root := cfg.LocalPath
+	if root == "" {
+		root = defaultLocalPath
+	}
+
+	return &localStorage{
+		root:   root,
+		signer: NewURLSigner(cfg),
+	}
+}
+
+func (s *localStorage) Init(ctx context.Context, buckets ...string) error {
+	s.buckets = buckets
+	for _, bucket := range buckets {
+		dir, err := s.bucketPath(bucket)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *localStorage) Ping(ctx context.Context) error {
+	for _, bucket := range s.buckets {
+		dir, err := s.bucketPath(bucket)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("bucket %s is unavailable: %w", bucket, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *localStorage) Close() error {
+	return nil
+}
+
+// Put пишет объект во временный файл и переименовывает его, чтобы читатели не видели недописанный объект
+func (s *localStorage) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutOptions) error {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, contextReader{ctx: ctx, r: body})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && written != size {
+		return fmt.Errorf("object size mismatch: expected %d bytes, got %d", size, written)
+	}
+
+	if err := s.writeMeta(bucket, key, localMeta{ContentType: opts.ContentType, Metadata: opts.Metadata}); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), objectPath)
+}
+
+func (s *localStorage) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(objectPath)
+	if err != nil {
+		return nil, convertFSError(err)
+	}
+
+	return file, nil
+}
+
+func (s *localStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	stat, err := os.Stat(objectPath)
+	if err != nil {
+		return ObjectInfo{}, convertFSError(err)
+	}
+	if stat.IsDir() {
+		return ObjectInfo{}, ErrNotFound
+	}
+
+	meta, err := s.readMeta(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	return ObjectInfo{
+		Bucket:       bucket,
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  meta.ContentType,
+		LastModified: stat.ModTime(),
+		Metadata:     meta.Metadata,
+	}, nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, bucket, key string) error {
+	objectPath, err := s.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(objectPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	metaPath, err := s.metaPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(metaPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *localStorage) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	info, err := s.Stat(ctx, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+
+	src, err := s.Get(ctx, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return s.Put(ctx, dstBucket, dstKey, src, info.Size, PutOptions{ContentType: info.ContentType, Metadata: info.Metadata})
+}
+
+func (s *localStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	dir, err := s.bucketPath(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := s.Stat(ctx, bucket, key)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, info)
+
+		return nil
+	})
+	if err != nil {
+		return nil, convertFSError(err)
+	}
+
+	return objects, nil
+}
+
+// Presign выдаёт подписанную ссылку на DownloadHandler, так как у файловой системы нет своего HTTP API
+func (s *localStorage) Presign(ctx context.Context, bucket, key string, expiry time.Duration, downloadName string) (string, error) {
+	if _, err := s.Stat(ctx, bucket, key); err != nil {
+		return "", err
+	}
+
+	return s.signer.Sign(bucket, key, expiry, downloadName), nil
+}
+
+func (s *localStorage) CreateMultipart(ctx context.Context, bucket, key string, opts PutOptions) (MultipartUpload, error) {
+	if _, err := s.objectPath(bucket, key); err != nil {
+		return MultipartUpload{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Join(s.root, multipartDir), 0o755); err != nil {
+		return MultipartUpload{}, err
+	}
+	dir, err := os.MkdirTemp(filepath.Join(s.root, multipartDir), "upload-")
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+
+	return MultipartUpload{
+		Bucket:      bucket,
+		Key:         key,
+		ID:          filepath.Base(dir),
+		ContentType: opts.ContentType,
+		Metadata:    opts.Metadata,
+	}, nil
+}
+
+// UploadPart пишет часть отдельным файлом, повторная загрузка части с тем же номером её заменяет
+func (s *localStorage) UploadPart(ctx context.Context, upload MultipartUpload, number int, offset int64, body io.Reader, size int64, last bool) (Part, error) {
+	dir, err := s.multipartPath(upload)
+	if err != nil {
+		return Part{}, err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".part-*")
+	if err != nil {
+		return Part{}, convertFSError(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, contextReader{ctx: ctx, r: body})
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Part{}, err
+	}
+	if size >= 0 && written != size {
+		return Part{}, fmt.Errorf("part size mismatch: expected %d bytes, got %d", size, written)
+	}
+
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, strconv.Itoa(number))); err != nil {
+		return Part{}, err
+	}
+
+	return Part{Number: number, ETag: strconv.Itoa(number), Size: written}, nil
+}
+
+// CompleteMultipart склеивает части через Put, поэтому объект появляется атомарно
+func (s *localStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []Part) error {
+	dir, err := s.multipartPath(upload)
+	if err != nil {
+		return err
+	}
+
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		file, err := os.Open(filepath.Join(dir, strconv.Itoa(part.Number)))
+		if err != nil {
+			return convertFSError(err)
+		}
+		defer file.Close()
+		readers = append(readers, file)
+	}
+
+	err = s.Put(ctx, upload.Bucket, upload.Key, io.MultiReader(readers...), -1, PutOptions{
+		ContentType: upload.ContentType,
+		Metadata:    upload.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (s *localStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	dir, err := s.multipartPath(upload)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (s *localStorage) multipartPath(upload MultipartUpload) (string, error) {
+	if !strings.HasPrefix(upload.ID, "upload-") || strings.ContainsAny(upload.ID, `/\.`) {
+		return "", fmt.Errorf("invalid upload id %q", upload.ID)
+	}
+
+	dir := filepath.Join(s.root, multipartDir, upload.ID)
+	if _, err := os.Stat(dir); err != nil {
+		return "", convertFSError(err)
+	}
+
+	return dir, nil
+}
+
+func (s *localStorage) copyWithMetadata(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, info ObjectInfo, metadata map[string]string) error {
+	if srcBucket == dstBucket && srcKey == dstKey {
+		return s.writeMeta(dstBucket, dstKey, localMeta{ContentType: info.ContentType, Metadata: metadata})
+	}
+
+	src, err := s.Get(ctx, srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return s.Put(ctx, dstBucket, dstKey, src, info.Size, PutOptions{ContentType: info.ContentType, Metadata: metadata})
+}
+
+func (s *localStorage) bucketPath(bucket string) (string, error) {
+	if bucket == "" || bucket == metaDir || bucket == multipartDir || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+
+	return filepath.Join(s.root, bucket), nil
+}
+
+// objectPath путь к файлу объекта; ключ не может выйти за пределы бакета
+func (s *localStorage) objectPath(bucket, key string) (string, error) {
+	dir, err := s.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+
+	cleanKey, err := cleanObjectKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(cleanKey)), nil
+}
+
+func (s *localStorage) metaPath(bucket, key string) (string, error) {
+	if _, err := s.bucketPath(bucket); err != nil {
+		return "", err
+	}
+
+	cleanKey, err := cleanObjectKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, metaDir, bucket, filepath.FromSlash(cleanKey)+".json"), nil
+}
+
+func (s *localStorage) writeMeta(bucket, key string, meta localMeta) error {
+	metaPath, err := s.metaPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0o755); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(metaPath, body, 0o644)
+}
+
+func (s *localStorage) readMeta(bucket, key string) (localMeta, error) {
+	metaPath, err := s.metaPath(bucket, key)
+	if err != nil {
+		return localMeta{}, err
+	}
+
+	body, err := os.ReadFile(metaPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Объект положили в каталог в обход хранилища
+		return localMeta{}, nil
+	}
+	if err != nil {
+		return localMeta{}, err
+	}
+
+	var meta localMeta
+	if err := json.Unmarshal(body, &meta); err != nil {
+		return localMeta{}, err
+	}
+
+	return meta, nil
+}
+
+func cleanObjectKey(key string) (string, error) {
+	cleanKey := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if key == "" || cleanKey == "" || cleanKey != key {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+
+	return cleanKey, nil
+}
+
+func convertFSError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+
+	return err
+}
+
+// contextReader прерывает копирование потока при отмене контекста
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	maxRetries = 10
+	retryDelay = 5 * time.Second
+	// streamPartSize размер части multipart загрузки, ограничивает буфер при загрузке потока неизвестной длины
+	streamPartSize = 16 << 20
+
+	minioNotFoundCode     = "NoSuchKey"
+	minioNoSuchUploadCode = "NoSuchUpload"
+	amzMetaPrefix         = "X-Amz-Meta-"
+)
+
+type minioStorage struct {
+	cfg       core.S3Config
+	client    *minio.Client
+	transport *http.Transport
+	buckets   []string
+}
+
+func newMinio(cfg core.S3Config) Storage {
+	return &minioStorage{cfg: cfg}
+}
+
+// Init создаёт клиент и бакеты, дожидаясь готовности MinIO
+func (s *minioStorage) Init(ctx context.Context, buckets ...string) error {
+	var err error
+
+	s.transport, err = minio.DefaultTransport(s.cfg.UseSSL)
+	if err != nil {
+		return err
+	}
+
+	s.client, err = minio.New(
+		s.cfg.Endpoint,
+		&minio.Options{
+			Creds:     credentials.NewStaticV4(s.cfg.AccessKeyID, s.cfg.SecretAccessKey, ""),
+			Secure:    s.cfg.UseSSL,
+			Region:    s.cfg.Region,
+			Transport: s.transport,
+		})
+	if err != nil {
+		return err
+	}
+
+	s.buckets = buckets
+	for i := 0; i < maxRetries; i++ {
+		err = s.createBuckets(ctx, buckets)
+		if err == nil {
+			return nil
+		}
+		time.Sleep(retryDelay)
+	}
+
+	return err
+}
+
+func (s *minioStorage) createBuckets(ctx context.Context, buckets []string) error {
+	for _, bucket := range buckets {
+		exists, err := s.client.BucketExists(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		err = s.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: s.cfg.Region})
+		if err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *minioStorage) Ping(ctx context.Context) error {
+	for _, bucket := range s.buckets {
+		exists, err := s.client.BucketExists(ctx, bucket)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("bucket %s does not exist", bucket)
+		}
+	}
+
+	return nil
+}
+
+// Close закрывает простаивающие соединения с MinIO
+func (s *minioStorage) Close() error {
+	if s.transport != nil {
+		s.transport.CloseIdleConnections()
+	}
+
+	return nil
+}
+
+func (s *minioStorage) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutOptions) error {
+	_, err := s.client.PutObject(ctx, bucket, key, body, size, minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.Metadata,
+		PartSize:     streamPartSize,
+	})
+
+	return err
+}
+
+func (s *minioStorage) Get(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, convertMinioError(err)
+	}
+
+	// GetObject ленив, поэтому отсутствие объекта выясняем до начала чтения
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, convertMinioError(err)
+	}
+
+	return object, nil
+}
+
+func (s *minioStorage) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, convertMinioError(err)
+	}
+
+	return objectInfo(bucket, info), nil
+}
+
+func (s *minioStorage) Delete(ctx context.Context, bucket, key string) error {
+	return s.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{ForceDelete: true})
+}
+
+func (s *minioStorage) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: dstBucket, Object: dstKey},
+		minio.CopySrcOptions{Bucket: srcBucket, Object: srcKey},
+	)
+
+	return convertMinioError(err)
+}
+
+func (s *minioStorage) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for info := range s.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, WithMetadata: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		objects = append(objects, objectInfo(bucket, info))
+	}
+
+	return objects, nil
+}
+
+func (s *minioStorage) Presign(ctx context.Context, bucket, key string, expiry time.Duration, downloadName string) (string, error) {
+	reqParams := make(url.Values)
+	if downloadName != "" {
+		reqParams.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": downloadName}))
+	}
+
+	presignedURL, err := s.client.PresignedGetObject(ctx, bucket, key, expiry, reqParams)
+	if err != nil {
+		return "", err
+	}
+
+	return presignedURL.String(), nil
+}
+
+func (s *minioStorage) PresignPut(ctx context.Context, bucket, key string, expiry time.Duration) (string, error) {
+	presignedURL, err := s.client.PresignedPutObject(ctx, bucket, key, expiry)
+	if err != nil {
+		return "", err
+	}
+
+	return presignedURL.String(), nil
+}
+
+// copyWithMetadata копирует объект на стороне MinIO, заменяя метаданные. Метаданные уже сохранённого
+// объекта меняются копированием в самого себя
+func (s *minioStorage) copyWithMetadata(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, info ObjectInfo, metadata map[string]string) error {
+	userMetadata := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		userMetadata[k] = v
+	}
+	if info.ContentType != "" {
+		userMetadata["Content-Type"] = info.ContentType
+	}
+
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: dstBucket, Object: dstKey, UserMetadata: userMetadata, ReplaceMetadata: true},
+		minio.CopySrcOptions{Bucket: srcBucket, Object: srcKey},
+	)
+
+	return convertMinioError(err)
+}
+
+func objectInfo(bucket string, info minio.ObjectInfo) ObjectInfo {
+	// В листинге с метаданными MinIO отдаёт ключи вместе с префиксом X-Amz-Meta-
+	metadata := make(map[string]string, len(info.UserMetadata))
+	for k, v := range info.UserMetadata {
+		canonical := textproto.CanonicalMIMEHeaderKey(k)
+		metadata[strings.TrimPrefix(canonical, amzMetaPrefix)] = v
+	}
+
+	return ObjectInfo{
+		Bucket:       bucket,
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+		Metadata:     metadata,
+	}
+}
+
+func (s *minioStorage) CreateMultipart(ctx context.Context, bucket, key string, opts PutOptions) (MultipartUpload, error) {
+	id, err := minio.Core{Client: s.client}.NewMultipartUpload(ctx, bucket, key, minio.PutObjectOptions{
+		ContentType:  opts.ContentType,
+		UserMetadata: opts.Metadata,
+	})
+	if err != nil {
+		return MultipartUpload{}, err
+	}
+
+	return MultipartUpload{Bucket: bucket, Key: key, ID: id, ContentType: opts.ContentType, Metadata: opts.Metadata}, nil
+}
+
+func (s *minioStorage) UploadPart(ctx context.Context, upload MultipartUpload, number int, offset int64, body io.Reader, size int64, last bool) (Part, error) {
+	part, err := minio.Core{Client: s.client}.PutObjectPart(ctx, upload.Bucket, upload.Key, upload.ID, number, body, size, minio.PutObjectPartOptions{})
+	if err != nil {
+		return Part{}, err
+	}
+
+	return Part{Number: number, ETag: part.ETag, Size: size}, nil
+}
+
+func (s *minioStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []Part) error {
+	completed := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completed = append(completed, minio.CompletePart{PartNumber: part.Number, ETag: part.ETag})
+	}
+
+	_, err := minio.Core{Client: s.client}.CompleteMultipartUpload(ctx, upload.Bucket, upload.Key, upload.ID, completed, minio.PutObjectOptions{})
+
+	return err
+}
+
+func (s *minioStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) error {
+	err := minio.Core{Client: s.client}.AbortMultipartUpload(ctx, upload.Bucket, upload.Key, upload.ID)
+	if minio.ToErrorResponse(err).Code == minioNoSuchUploadCode {
+		return nil
+	}
+
+	return err
+}
+
+func convertMinioError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if minio.ToErrorResponse(err).Code == minioNotFoundCode {
+		return fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+
+	return err
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"mime"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+func TestMinioPresign_DownloadName(t *testing.T) {
+	// С указанным регионом клиент подписывает ссылку, не обращаясь к серверу
+	client, err := minio.New("minio.local:9000", &minio.Options{
+		Creds:  credentials.NewStaticV4("access", "secret", ""),
+		Region: "us-east-1",
+	})
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	s := &minioStorage{client: client}
+
+	names := []string{
+		"report.pdf",
+		`evil".pdf; filename="other.exe`,
+		"отчёт за май.docx",
+	}
+	for _, name := range names {
+		link, err := s.Presign(context.Background(), "processed", "doc-1", time.Minute, name)
+		if err != nil {
+			t.Fatalf("failed to presign %q: %v", name, err)
+		}
+		parsed, err := url.Parse(link)
+		if err != nil {
+			t.Fatalf("failed to parse link: %v", err)
+		}
+
+		disposition, params, err := mime.ParseMediaType(parsed.Query().Get("response-content-disposition"))
+		if err != nil {
+			t.Fatalf("invalid disposition for %q: %v", name, err)
+		}
+		if disposition != "attachment" || params["filename"] != name {
+			t.Errorf("expected attachment with filename %q, got %s %v", name, disposition, params)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// Ограничения частей multipart загрузки. MinPartSize нижний предел S3 для всех частей, кроме последней,
+// PartAlignment кратность частей, при которой зашифрованный объект собирается из частей без перешифрования
+const (
+	MinPartSize   = 5 << 20
+	PartAlignment = segmentSize
+)
+
+var (
+	// ErrMultipartUnsupported драйвер хранилища не умеет загружать объект частями
+	ErrMultipartUnsupported = errors.New("storage driver does not support multipart uploads")
+	// ErrInvalidPart часть не подходит под ограничения MinPartSize и PartAlignment
+	ErrInvalidPart = errors.New("invalid multipart upload part")
+)
+
+// MultipartUpload незавершённая загрузка объекта частями. Структура сохраняется вызывающим
+// между запросами и передаётся в каждую операцию с загрузкой
+type MultipartUpload struct {
+	Bucket string
+	Key    string
+	// ID идентификатор загрузки в хранилище
+	ID          string
+	ContentType string
+	// Metadata метаданные будущего объекта, в том числе нужные для шифрования частей
+	Metadata map[string]string
+}
+
+// Part загруженная часть объекта
+type Part struct {
+	// Number номер части, начиная с 1
+	Number int
+	ETag   string
+	// Size размер части до шифрования
+	Size int64
+}
+
+// MultipartUploader хранилище, принимающее объект частями. Объект становится виден только после CompleteMultipart
+type MultipartUploader interface {
+	// CreateMultipart начать загрузку объекта частями
+	CreateMultipart(ctx context.Context, bucket, key string, opts PutOptions) (MultipartUpload, error)
+	// UploadPart загрузить часть размером size, начинающуюся со смещения offset. last отмечает последнюю часть объекта
+	UploadPart(ctx context.Context, upload MultipartUpload, number int, offset int64, body io.Reader, size int64, last bool) (Part, error)
+	// CompleteMultipart собрать объект из частей в порядке номеров
+	CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []Part) error
+	// AbortMultipart отменить загрузку и удалить загруженные части, отсутствие загрузки ошибкой не считается
+	AbortMultipart(ctx context.Context, upload MultipartUpload) error
+}
+
+// ValidatePart проверяет часть, которая не последняя в объекте
+func ValidatePart(offset, size int64, last bool) error {
+	if offset%PartAlignment != 0 {
+		return ErrInvalidPart
+	}
+	if !last && (size < MinPartSize || size%PartAlignment != 0) {
+		return ErrInvalidPart
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+)
+
+// DownloadRoute путь DownloadHandler, на который ведут подписанные ссылки
+const DownloadRoute = "/storage/:bucket/*"
+
+const downloadPathPrefix = "/storage/"
+
+var (
+	// ErrInvalidSignature подпись ссылки не совпадает
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrLinkExpired срок действия ссылки истёк
+	ErrLinkExpired = errors.New("link expired")
+)
+
+// URLSigner подписывает ссылки на скачивание объектов через DownloadHandler
+type URLSigner struct {
+	secret  []byte
+	baseURL string
+	now     func() time.Time
+}
+
+// NewURLSigner подписывает ссылки секретным ключом хранилища
+func NewURLSigner(cfg core.S3Config) *URLSigner {
+	return &URLSigner{
+		secret:  []byte(cfg.SecretAccessKey),
+		baseURL: strings.TrimSuffix(cfg.PublicURL, "/"),
+		now:     time.Now,
+	}
+}
+
+// Sign ссылка на объект, действующая в течение expiry
+func (s *URLSigner) Sign(bucket, key string, expiry time.Duration, downloadName string) string {
+	expires := strconv.FormatInt(s.now().Add(expiry).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	if downloadName != "" {
+		query.Set("filename", downloadName)
+	}
+	query.Set("signature", s.signature(bucket, key, expires, downloadName))
+
+	objectPath := (&url.URL{Path: downloadPathPrefix + bucket + "/" + key}).EscapedPath()
+
+	return s.baseURL + objectPath + "?" + query.Encode()
+}
+
+// Verify проверяет подпись и срок действия ссылки
+func (s *URLSigner) Verify(bucket, key string, query url.Values) error {
+	expires := query.Get("expires")
+	expected := s.signature(bucket, key, expires, query.Get("filename"))
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if s.now().Unix() > expiresAt {
+		return ErrLinkExpired
+	}
+
+	return nil
+}
+
+func (s *URLSigner) signature(bucket, key, expires, downloadName string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(bucket + "\n" + key + "\n" + expires + "\n" + downloadName))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,131 @@
+// Package storage объектное хранилище документов с драйверами для MinIO/S3 и локального диска
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+)
+
+// Драйверы хранилища
+const (
+	DriverMinio = "minio"
+	DriverLocal = "local"
+)
+
+const (
+	defaultBucketIn  = "preprocessing"
+	defaultBucketOut = "postprocessing"
+
+	defaultBucketQuarantine = "quarantine"
+)
+
+// ErrNotFound объекта с таким ключом нет в бакете
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo сведения об объекте
+type ObjectInfo struct {
+	Bucket       string
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+	Metadata     map[string]string
+}
+
+// PutOptions параметры сохранения объекта
+type PutOptions struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+type Storage interface {
+	// Init подключиться к хранилищу и создать бакеты, если их ещё нет
+	Init(ctx context.Context, buckets ...string) error
+	// Close закрыть соединения с хранилищем
+	Close() error
+	// Ping проверить, что хранилище доступно и бакеты из Init на месте
+	Ping(ctx context.Context) error
+	// Put сохранить объект потоком, size равен -1, если размер заранее неизвестен
+	Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutOptions) error
+	// Get открыть объект на чтение, поток нужно закрыть после использования
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	// Stat получить сведения об объекте
+	Stat(ctx context.Context, bucket, key string) (ObjectInfo, error)
+	// Delete удалить объект, отсутствие объекта ошибкой не считается
+	Delete(ctx context.Context, bucket, key string) error
+	// Copy скопировать объект вместе с метаданными
+	Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error
+	// List получить объекты бакета, ключи которых начинаются с prefix
+	List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+	// Presign получить временную ссылку на скачивание объекта под именем downloadName
+	Presign(ctx context.Context, bucket, key string, expiry time.Duration, downloadName string) (string, error)
+}
+
+// Buckets бакеты, через которые проходит документ
+type Buckets struct {
+	// Incoming загруженные документы, ожидающие анонимизации
+	Incoming string
+	// Processed анонимизированные документы
+	Processed string
+	// Quarantine документы, отклонённые проверкой перед анонимизацией. Очистка по сроку хранения
+	// их не удаляет, они остаются для разбора
+	Quarantine string
+}
+
+// NewBuckets имена бакетов из конфигурации
+func NewBuckets(cfg core.S3Config) Buckets {
+	buckets := Buckets{Incoming: cfg.BucketIn, Processed: cfg.BucketOut, Quarantine: cfg.BucketQuarantine}
+	if buckets.Incoming == "" {
+		buckets.Incoming = defaultBucketIn
+	}
+	if buckets.Processed == "" {
+		buckets.Processed = defaultBucketOut
+	}
+	if buckets.Quarantine == "" {
+		buckets.Quarantine = defaultBucketQuarantine
+	}
+
+	return buckets
+}
+
+// New хранилище с драйвером, выбранным в конфигурации
+func New(cfg core.S3Config) (Storage, error) {
+	driverName := cfg.Driver
+	if driverName == "" {
+		driverName = DriverMinio
+	}
+
+	var driver Storage
+	switch driverName {
+	case DriverMinio:
+		driver = newMinio(cfg)
+	case DriverLocal:
+		driver = newLocal(cfg)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", cfg.Driver)
+	}
+	// Трассировка оборачивает драйвер, а не шифрование: спаны показывают обращения к самому хранилищу
+	driver = newTraced(driver, driverName)
+
+	if cfg.EncryptionKeyID == "" {
+		return driver, nil
+	}
+
+	keyring, err := NewKeyring(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEncrypted(driver, keyring, NewURLSigner(cfg)), nil
+}
+
+// ProxiesDownloads ссылки на скачивание ведут на DownloadHandler, и сервис, который их выдаёт,
+// должен его зарегистрировать: у локального диска нет HTTP API, а из MinIO зашифрованный объект отдавать нельзя
+func ProxiesDownloads(cfg core.S3Config) bool {
+	return cfg.Driver == DriverLocal || cfg.EncryptionKeyID != ""
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Объект шифруется сегментами по segmentSize байт, каждый сегмент запечатывается AES-GCM отдельно,
+// поэтому ни запись, ни чтение не держат документ в памяти целиком. Номер сегмента входит в nonce,
+// а признак последнего сегмента в дополнительные данные, так что переставить или обрезать сегменты нельзя
+const (
+	segmentSize = 64 << 10
+	tagSize     = 16
+	dataKeySize = 32
+)
+
+var errCorruptedObject = errors.New("encrypted object is corrupted")
+
+// encryptedSize размер шифртекста для открытого текста известной длины
+func encryptedSize(plainSize int64) int64 {
+	segments := (plainSize + segmentSize - 1) / segmentSize
+	if segments == 0 {
+		segments = 1
+	}
+
+	return plainSize + segments*tagSize
+}
+
+// plainSize размер открытого текста по размеру шифртекста
+func plainSize(encSize int64) int64 {
+	segments := (encSize + segmentSize + tagSize - 1) / (segmentSize + tagSize)
+
+	return encSize - segments*tagSize
+}
+
+func segmentNonce(aead cipher.AEAD, counter uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+
+	return nonce
+}
+
+func segmentAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+
+	return []byte{0}
+}
+
+// segmentReader читает поток блоками по size байт и сообщает, последний ли это блок
+type segmentReader struct {
+	src  *bufio.Reader
+	buf  []byte
+	done bool
+}
+
+func newSegmentReader(src io.Reader, size int) *segmentReader {
+	return &segmentReader{src: bufio.NewReader(src), buf: make([]byte, size)}
+}
+
+func (r *segmentReader) next() (segment []byte, final bool, err error) {
+	if r.done {
+		return nil, false, io.EOF
+	}
+
+	n, err := io.ReadFull(r.src, r.buf)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		r.done = true
+		return r.buf[:n], true, nil
+	case err != nil:
+		return nil, false, err
+	}
+
+	if _, err := r.src.Peek(1); err == io.EOF {
+		r.done = true
+		return r.buf[:n], true, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return r.buf[:n], false, nil
+}
+
+// encryptReader шифрует поток на лету
+type encryptReader struct {
+	aead     cipher.AEAD
+	segments *segmentReader
+	counter  uint64
+	// last поток заканчивает объект, и его последний сегмент отмечается как последний
+	last    bool
+	out     []byte
+	pending []byte
+}
+
+func newEncryptReader(aead cipher.AEAD, src io.Reader) *encryptReader {
+	return newPartEncryptReader(aead, src, 0, true)
+}
+
+// newPartEncryptReader шифрует часть объекта, которая начинается с сегмента firstSegment
+func newPartEncryptReader(aead cipher.AEAD, src io.Reader, firstSegment uint64, last bool) *encryptReader {
+	return &encryptReader{
+		aead:     aead,
+		segments: newSegmentReader(src, segmentSize),
+		counter:  firstSegment,
+		last:     last,
+		out:      make([]byte, 0, segmentSize+tagSize),
+	}
+}
+
+// encryptedPartSize размер шифртекста части. Все части, кроме последней, выровнены по сегментам
+func encryptedPartSize(plainSize int64, last bool) int64 {
+	if last {
+		return encryptedSize(plainSize)
+	}
+
+	return plainSize + plainSize/segmentSize*tagSize
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		segment, final, err := r.segments.next()
+		if err != nil {
+			return 0, err
+		}
+		r.pending = r.aead.Seal(r.out[:0], segmentNonce(r.aead, r.counter), segment, segmentAD(final && r.last))
+		r.counter++
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+// decryptReader расшифровывает поток на лету и проверяет целостность каждого сегмента
+type decryptReader struct {
+	aead     cipher.AEAD
+	src      io.ReadCloser
+	segments *segmentReader
+	counter  uint64
+	out      []byte
+	pending  []byte
+}
+
+func newDecryptReader(aead cipher.AEAD, src io.ReadCloser) *decryptReader {
+	return &decryptReader{
+		aead:     aead,
+		src:      src,
+		segments: newSegmentReader(src, segmentSize+tagSize),
+		out:      make([]byte, 0, segmentSize),
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		segment, final, err := r.segments.next()
+		if err != nil {
+			return 0, err
+		}
+
+		r.pending, err = r.aead.Open(r.out[:0], segmentNonce(r.aead, r.counter), segment, segmentAD(final))
+		if err != nil {
+			return 0, errCorruptedObject
+		}
+		r.counter++
+	}
+
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+
+	return n, nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "gitlab.com/docshade/common/storage"
+
+// tracedStorage открывает клиентский спан на каждую операцию с хранилищем
+type tracedStorage struct {
+	Storage
+	driver string
+	tracer trace.Tracer
+}
+
+func newTraced(inner Storage, driver string) Storage {
+	return &tracedStorage{
+		Storage: inner,
+		driver:  driver,
+		tracer:  otel.Tracer(instrumentationName),
+	}
+}
+
+func (s *tracedStorage) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts PutOptions) (err error) {
+	ctx, span := s.start(ctx, "Put", bucket, key)
+	defer func() { s.end(span, err) }()
+
+	return s.Storage.Put(ctx, bucket, key, body, size, opts)
+}
+
+// Get закрывает спан при открытии объекта: чтение потока остаётся на стороне вызывающего
+func (s *tracedStorage) Get(ctx context.Context, bucket, key string) (_ io.ReadCloser, err error) {
+	ctx, span := s.start(ctx, "Get", bucket, key)
+	defer func() { s.end(span, err) }()
+
+	return s.Storage.Get(ctx, bucket, key)
+}
+
+func (s *tracedStorage) Stat(ctx context.Context, bucket, key string) (_ ObjectInfo, err error) {
+	ctx, span := s.start(ctx, "Stat", bucket, key)
+	defer func() { s.end(span, err) }()
+
+	return s.Storage.Stat(ctx, bucket, key)
+}
+
+func (s *tracedStorage) Delete(ctx context.Context, bucket, key string) (err error) {
+	ctx, span := s.start(ctx, "Delete", bucket, key)
+	defer func() { s.end(span, err) }()
+
+	return s.Storage.Delete(ctx, bucket, key)
+}
+
+func (s *tracedStorage) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) (err error) {
+	ctx, span := s.start(ctx, "Copy", srcBucket, srcKey)
+	span.SetAttributes(
+		attribute.String("docshade.storage.destination_bucket", dstBucket),
+		attribute.String("docshade.storage.destination_key", dstKey),
+	)
+	defer func() { s.end(span, err) }()
+
+	return s.Storage.Copy(ctx, srcBucket, srcKey, dstBucket, dstKey)
+}
+
+func (s *tracedStorage) List(ctx context.Context, bucket, prefix string) (_ []ObjectInfo, err error) {
+	ctx, span := s.start(ctx, "List", bucket, prefix)
+	defer func() { s.end(span, err) }()
+
+	return s.Storage.List(ctx, bucket, prefix)
+}
+
+func (s *tracedStorage) Presign(ctx context.Context, bucket, key string, expiry time.Duration, downloadName string) (_ string, err error) {
+	ctx, span := s.start(ctx, "Presign", bucket, key)
+	defer func() { s.end(span, err) }()
+
+	return s.Storage.Presign(ctx, bucket, key, expiry, downloadName)
+}
+
+func (s *tracedStorage) PresignPut(ctx context.Context, bucket, key string, expiry time.Duration) (_ string, err error) {
+	presigner, ok := s.Storage.(PutPresigner)
+	if !ok {
+		return "", ErrDirectUploadUnsupported
+	}
+
+	ctx, span := s.start(ctx, "PresignPut", bucket, key)
+	defer func() { s.end(span, err) }()
+
+	return presigner.PresignPut(ctx, bucket, key, expiry)
+}
+
+func (s *tracedStorage) CreateMultipart(ctx context.Context, bucket, key string, opts PutOptions) (_ MultipartUpload, err error) {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return MultipartUpload{}, ErrMultipartUnsupported
+	}
+
+	ctx, span := s.start(ctx, "CreateMultipart", bucket, key)
+	defer func() { s.end(span, err) }()
+
+	return uploader.CreateMultipart(ctx, bucket, key, opts)
+}
+
+func (s *tracedStorage) UploadPart(ctx context.Context, upload MultipartUpload, number int, offset int64, body io.Reader, size int64, last bool) (_ Part, err error) {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return Part{}, ErrMultipartUnsupported
+	}
+
+	ctx, span := s.start(ctx, "UploadPart", upload.Bucket, upload.Key)
+	span.SetAttributes(
+		attribute.Int("docshade.storage.part_number", number),
+		attribute.Int64("docshade.storage.part_size", size),
+	)
+	defer func() { s.end(span, err) }()
+
+	return uploader.UploadPart(ctx, upload, number, offset, body, size, last)
+}
+
+func (s *tracedStorage) CompleteMultipart(ctx context.Context, upload MultipartUpload, parts []Part) (err error) {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return ErrMultipartUnsupported
+	}
+
+	ctx, span := s.start(ctx, "CompleteMultipart", upload.Bucket, upload.Key)
+	defer func() { s.end(span, err) }()
+
+	return uploader.CompleteMultipart(ctx, upload, parts)
+}
+
+func (s *tracedStorage) AbortMultipart(ctx context.Context, upload MultipartUpload) (err error) {
+	uploader, ok := s.Storage.(MultipartUploader)
+	if !ok {
+		return ErrMultipartUnsupported
+	}
+
+	ctx, span := s.start(ctx, "AbortMultipart", upload.Bucket, upload.Key)
+	defer func() { s.end(span, err) }()
+
+	return uploader.AbortMultipart(ctx, upload)
+}
+
+// copyWithMetadata пробрасывает смену метаданных драйверу, чтобы ротация ключей работала и с трассировкой
+func (s *tracedStorage) copyWithMetadata(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string, info ObjectInfo, metadata map[string]string) (err error) {
+	copier, ok := s.Storage.(metadataCopier)
+	if !ok {
+		return fmt.Errorf("storage driver does not support metadata updates")
+	}
+
+	ctx, span := s.start(ctx, "CopyWithMetadata", srcBucket, srcKey)
+	defer func() { s.end(span, err) }()
+
+	return copier.copyWithMetadata(ctx, srcBucket, srcKey, dstBucket, dstKey, info, metadata)
+}
+
+func (s *tracedStorage) start(ctx context.Context, operation, bucket, key string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("docshade.storage.driver", s.driver),
+			attribute.String("docshade.storage.bucket", bucket),
+			attribute.String("docshade.storage.key", key),
+		),
+	)
+}
+
+func (s *tracedStorage) end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,178 @@
+// Package tracing распространение трассировок OpenTelemetry через HTTP и RabbitMQ
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/docshade/common/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "gitlab.com/docshade/common/tracing"
+
+// Атрибуты спанов. Имена совпадают с семантическими соглашениями OpenTelemetry
+const (
+	attrHTTPMethod       = attribute.Key("http.request.method")
+	attrHTTPRoute        = attribute.Key("http.route")
+	attrHTTPStatusCode   = attribute.Key("http.response.status_code")
+	attrURLFull          = attribute.Key("url.full")
+	attrMessagingSystem  = attribute.Key("messaging.system")
+	attrMessagingDest    = attribute.Key("messaging.destination.name")
+	attrMessagingRouting = attribute.Key("messaging.rabbitmq.destination.routing_key")
+	attrRequestID        = attribute.Key("docshade.request_id")
+)
+
+// Tracer трассировщик для спанов сервисов
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// EchoMiddleware открывает серверный спан на каждый запрос, продолжая трассировку из заголовков запроса.
+// Спан кладётся в контекст запроса, поэтому обработчики должны передавать дальше request.Context()
+func EchoMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			request := c.Request()
+			ctx := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+			route := c.Path()
+			ctx, span := Tracer().Start(ctx, request.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(attrHTTPMethod.String(request.Method), attrHTTPRoute.String(route)),
+			)
+			defer span.End()
+
+			if requestID, ok := ctx.Value(log.ContextRequestIDKey).(string); ok {
+				span.SetAttributes(attrRequestID.String(requestID))
+			}
+
+			c.SetRequest(request.WithContext(ctx))
+
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil && !c.Response().Committed {
+				status = http.StatusInternalServerError
+				if httpErr, ok := err.(*echo.HTTPError); ok {
+					status = httpErr.Code
+				}
+			}
+			span.SetAttributes(attrHTTPStatusCode.Int(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return err
+		}
+	}
+}
+
+// StartClientSpan открывает спан исходящего HTTP запроса и добавляет в его заголовки контекст трассировки
+func StartClientSpan(request *http.Request) (*http.Request, trace.Span) {
+	ctx, span := Tracer().Start(request.Context(), request.Method+" "+request.URL.Host,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrHTTPMethod.String(request.Method), attrURLFull.String(request.URL.Redacted())),
+	)
+	request = request.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(request.Header))
+
+	return request, span
+}
+
+// EndClientSpan закрывает спан исходящего HTTP запроса с его результатом
+func EndClientSpan(span trace.Span, response *http.Response, err error) {
+	defer span.End()
+
+	if err != nil {
+		RecordError(span, err)
+		return
+	}
+
+	span.SetAttributes(attrHTTPStatusCode.Int(response.StatusCode))
+	if response.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(response.StatusCode))
+	}
+}
+
+// HeadersCarrier заголовки сообщения RabbitMQ как носитель контекста трассировки.
+// amqp.Table приводится к этому типу без копирования
+type HeadersCarrier map[string]interface{}
+
+func (c HeadersCarrier) Get(key string) string {
+	switch v := c[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+func (c HeadersCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c HeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// StartPublishSpan открывает спан публикации сообщения и записывает контекст трассировки в headers
+func StartPublishSpan(ctx context.Context, exchange, routingKey string, headers map[string]interface{}) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(ctx, fmt.Sprintf("%s publish", exchange),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attrMessagingSystem.String("rabbitmq"),
+			attrMessagingDest.String(exchange),
+			attrMessagingRouting.String(routingKey),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, HeadersCarrier(headers))
+
+	return ctx, span
+}
+
+// StartConsumeSpan открывает спан обработки сообщения, продолжая трассировку отправителя из headers
+func StartConsumeSpan(ctx context.Context, queueName string, headers map[string]interface{}) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, HeadersCarrier(headers))
+
+	return Tracer().Start(ctx, fmt.Sprintf("%s process", queueName),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attrMessagingSystem.String("rabbitmq"),
+			attrMessagingDest.String(queueName),
+		),
+	)
+}
+
+// InjectHeaders записывает контекст трассировки в headers сообщения, которое опубликуют позже
+func InjectHeaders(ctx context.Context, headers map[string]interface{}) {
+	otel.GetTextMapPropagator().Inject(ctx, HeadersCarrier(headers))
+}
+
+// ExtractHeaders восстанавливает контекст трассировки, сохранённый InjectHeaders
+func ExtractHeaders(ctx context.Context, headers map[string]interface{}) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, HeadersCarrier(headers))
+}
+
+// RecordError отмечает спан как завершившийся ошибкой
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
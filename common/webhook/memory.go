@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+)
+
+type memoryDelivery struct {
+	Delivery
+	nextAttemptAt time.Time
+}
+
+type memory struct {
+	webhooks core.WebhookConfig
+
+	mu         sync.Mutex
+	nextID     int64
+	deliveries map[int64]*memoryDelivery
+	// sending доставки, которые сейчас отправляет Dispatch
+	sending map[int64]bool
+	wake    chan struct{}
+}
+
+// NewMemoryStore хранилище доставок в памяти процесса, для тестов и локального запуска
+func NewMemoryStore(webhooks core.WebhookConfig) Store {
+	return &memory{
+		webhooks:   webhooks,
+		deliveries: make(map[int64]*memoryDelivery),
+		sending:    make(map[int64]bool),
+		wake:       make(chan struct{}, 1),
+	}
+}
+
+func (m *memory) Init(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Add(ctx context.Context, d Delivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.deliveries {
+		if existing.DocumentID == d.DocumentID && existing.Event == d.Event {
+			return nil
+		}
+	}
+
+	m.nextID++
+	now := time.Now().UTC()
+	d.ID = m.nextID
+	d.Status = StatusPending
+	d.Attempts = 0
+	d.CreatedAt = now
+	d.Log = nil
+	m.deliveries[d.ID] = &memoryDelivery{Delivery: d, nextAttemptAt: now}
+
+	return nil
+}
+
+// Dispatch отправляет без блокировки хранилища: доставки на время отправки помечаются занятыми
+func (m *memory) Dispatch(ctx context.Context, limit int, send SendFunc) (int, error) {
+	due := m.claim(limit)
+
+	for _, d := range due {
+		record, sendErr := attempt(ctx, d, send)
+		status, next := outcome(m.webhooks, d, sendErr, time.Now())
+
+		m.mu.Lock()
+		stored := m.deliveries[d.ID]
+		delete(m.sending, d.ID)
+		if stored == nil {
+			m.mu.Unlock()
+			continue
+		}
+		stored.Status = status
+		stored.Attempts++
+		stored.LastError = record.Error
+		stored.nextAttemptAt = next
+		if status == StatusDelivered {
+			deliveredAt := next
+			stored.DeliveredAt = &deliveredAt
+		}
+		stored.Log = append(stored.Log, record)
+		m.mu.Unlock()
+	}
+
+	return len(due), nil
+}
+
+func (m *memory) claim(limit int) []Delivery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	var due []*memoryDelivery
+	for id, d := range m.deliveries {
+		if d.Status == StatusPending && !m.sending[id] && !d.nextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	result := make([]Delivery, 0, len(due))
+	for _, d := range due {
+		m.sending[d.ID] = true
+		result = append(result, d.Delivery)
+	}
+
+	return result
+}
+
+func (m *memory) List(ctx context.Context, documentID string) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []Delivery
+	for _, d := range m.deliveries {
+		if d.DocumentID == documentID {
+			delivery := d.Delivery
+			delivery.Log = append([]Attempt(nil), d.Log...)
+			result = append(result, delivery)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+func (m *memory) DeleteFinishedBefore(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := 0
+	for id, d := range m.deliveries {
+		if d.Status != StatusPending && d.CreatedAt.Before(before) {
+			delete(m.deliveries, id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (m *memory) Wake() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *memory) Wakeups() <-chan struct{} {
+	return m.wake
+}
+
+func (m *memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memory) Close() error {
+	return nil
+}
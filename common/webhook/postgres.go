@@ -0,0 +1,237 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// createTablesQuery доставки и журнал попыток. Ключ подписи хранится до удаления доставки
+const createTablesQuery = `
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id              BIGSERIAL PRIMARY KEY,
+	document_id     TEXT NOT NULL,
+	event           TEXT NOT NULL,
+	url             TEXT NOT NULL,
+	secret          TEXT NOT NULL,
+	payload         BYTEA NOT NULL,
+	status          TEXT NOT NULL DEFAULT 'pending',
+	attempts        INT NOT NULL DEFAULT 0,
+	last_error      TEXT NOT NULL DEFAULT '',
+	created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	delivered_at    TIMESTAMPTZ,
+	UNIQUE (document_id, event)
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at, id) WHERE status = 'pending';
+CREATE TABLE IF NOT EXISTS webhook_attempts (
+	delivery_id  BIGINT NOT NULL REFERENCES webhook_deliveries (id) ON DELETE CASCADE,
+	attempt      INT NOT NULL,
+	status_code  INT NOT NULL DEFAULT 0,
+	error        TEXT NOT NULL DEFAULT '',
+	duration_ms  BIGINT NOT NULL DEFAULT 0,
+	attempted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (delivery_id, attempt)
+);
+`
+
+// leaseMargin запас аренды сверх таймаута запроса на запись результата
+const leaseMargin = 30 * time.Second
+
+const deliveryColumns = `id, document_id, event, url, secret, payload, status, attempts, last_error, created_at, delivered_at`
+
+type postgres struct {
+	webhooks core.WebhookConfig
+	pool     *pgxpool.Pool
+	wake     chan struct{}
+}
+
+// NewPostgresStore хранилище доставок в Postgres
+func NewPostgresStore(pool *pgxpool.Pool, webhooks core.WebhookConfig) Store {
+	return &postgres{pool: pool, webhooks: webhooks, wake: make(chan struct{}, 1)}
+}
+
+// Init создаёт таблицы доставок, если их ещё нет
+func (p *postgres) Init(ctx context.Context) error {
+	_, err := p.pool.Exec(ctx, createTablesQuery)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook tables: %w", err)
+	}
+
+	return nil
+}
+
+func (p *postgres) Add(ctx context.Context, d Delivery) error {
+	_, err := p.pool.Exec(ctx, `
+		INSERT INTO webhook_deliveries (document_id, event, url, secret, payload)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (document_id, event) DO NOTHING`,
+		d.DocumentID, d.Event, d.URL, d.Secret, d.Payload,
+	)
+
+	return err
+}
+
+// Dispatch забирает доставки по одной и отправляет их вне транзакции: пока идёт запрос,
+// строка не заблокирована, а отложена арендой, поэтому другие экземпляры сервиса её не возьмут.
+// Если экземпляр упадёт, не записав результат, доставку после истечения аренды отправит другой
+func (p *postgres) Dispatch(ctx context.Context, limit int, send SendFunc) (int, error) {
+	attempted := 0
+	for attempted < limit {
+		d, err := p.claim(ctx)
+		if errors.Is(err, pgx.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return attempted, err
+		}
+
+		record, sendErr := attempt(ctx, d, send)
+		status, next := outcome(p.webhooks, d, sendErr, time.Now())
+		attempted++
+
+		if err := p.record(ctx, d, record, status, next); err != nil {
+			return attempted, err
+		}
+	}
+
+	return attempted, nil
+}
+
+// claim откладывает подошедшую доставку на время аренды и возвращает её. Строка блокируется
+// только на время этого запроса
+func (p *postgres) claim(ctx context.Context) (Delivery, error) {
+	rows, err := p.pool.Query(ctx, `
+		UPDATE webhook_deliveries SET next_attempt_at = now() + make_interval(secs => $1)
+		WHERE id = (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns, (p.webhooks.Timeout + leaseMargin).Seconds())
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	return pgx.CollectExactlyOneRow(rows, scanDelivery)
+}
+
+// record сохраняет результат попытки одним запросом. Если аренда истекла и доставку
+// уже отправил другой экземпляр, счётчик попыток не совпадёт и результат не запишется
+func (p *postgres) record(ctx context.Context, d Delivery, record Attempt, status Status, next time.Time) error {
+	var deliveredAt *time.Time
+	if status == StatusDelivered {
+		deliveredAt = &next
+	}
+
+	_, err := p.pool.Exec(context.WithoutCancel(ctx), `
+		WITH updated AS (
+			UPDATE webhook_deliveries
+			SET status = $2, attempts = attempts + 1, last_error = $4, next_attempt_at = $7, delivered_at = $8
+			WHERE id = $1 AND attempts = $3 - 1
+			RETURNING id
+		)
+		INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+		SELECT id, $3, $5, $4, $6, $9 FROM updated`,
+		d.ID, status, record.Number, record.Error, record.StatusCode, record.Duration.Milliseconds(), next, deliveredAt, record.AttemptedAt,
+	)
+
+	return err
+}
+
+func (p *postgres) List(ctx context.Context, documentID string) ([]Delivery, error) {
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE document_id = $1
+		ORDER BY id`, documentID)
+	if err != nil {
+		return nil, err
+	}
+	deliveries, err := pgx.CollectRows(rows, scanDelivery)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range deliveries {
+		rows, err := p.pool.Query(ctx, `
+			SELECT attempt, status_code, error, duration_ms, attempted_at FROM webhook_attempts
+			WHERE delivery_id = $1
+			ORDER BY attempt`, deliveries[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		deliveries[i].Log, err = pgx.CollectRows(rows, scanAttempt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (p *postgres) DeleteFinishedBefore(ctx context.Context, before time.Time) (int, error) {
+	tag, err := p.pool.Exec(ctx, `
+		DELETE FROM webhook_deliveries
+		WHERE status <> 'pending' AND created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (p *postgres) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *postgres) Wakeups() <-chan struct{} {
+	return p.wake
+}
+
+func (p *postgres) Ping(ctx context.Context) error {
+	return p.pool.Ping(ctx)
+}
+
+// Close ничего не закрывает: пул общий, его закрывает тот, кто открыл
+func (p *postgres) Close() error {
+	return nil
+}
+
+func scanDelivery(row pgx.CollectableRow) (Delivery, error) {
+	var d Delivery
+	err := row.Scan(
+		&d.ID,
+		&d.DocumentID,
+		&d.Event,
+		&d.URL,
+		&d.Secret,
+		&d.Payload,
+		&d.Status,
+		&d.Attempts,
+		&d.LastError,
+		&d.CreatedAt,
+		&d.DeliveredAt,
+	)
+
+	return d, err
+}
+
+func scanAttempt(row pgx.CollectableRow) (Attempt, error) {
+	var a Attempt
+	var durationMs int64
+	err := row.Scan(&a.Number, &a.StatusCode, &a.Error, &durationMs, &a.AttemptedAt)
+	a.Duration = time.Duration(durationMs) * time.Millisecond
+
+	return a, err
+}
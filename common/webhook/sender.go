@@ -0,0 +1,129 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+)
+
+// maxResponseBody сколько ответа получателя дочитывать, чтобы соединение вернулось в пул
+const maxResponseBody = 64 << 10
+
+var (
+	// ErrUnexpectedStatus получатель ответил не 2xx
+	ErrUnexpectedStatus = errors.New("webhook receiver returned unexpected status")
+	// ErrForbiddenAddress адрес получателя ведёт во внутреннюю сеть
+	ErrForbiddenAddress = errors.New("webhook receiver address is not allowed")
+)
+
+// reservedPrefixes сети вне публичного интернета, которые не покрывают проверки netip.Addr
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// NAT64 переводит адрес в IPv4, в том числе во внутренний
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Sender отправляет доставки по HTTP
+type Sender struct {
+	client *http.Client
+}
+
+// NewSender отправитель с ограничением времени одного запроса. Адрес получателя задаёт клиент API,
+// поэтому соединения во внутренние сети, на localhost и link-local отклоняются после разрешения имени:
+// проверка имени до запроса не защищает от DNS, который ответит внутренним адресом. Перенаправления
+// не выполняются, получатель должен ответить 2xx по указанному адресу. Прокси из окружения
+// не используется, иначе проверялся бы адрес прокси, а не получателя
+func NewSender(cfg core.WebhookConfig) *Sender {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateNetworks {
+		dialer.Control = checkAddress
+	}
+
+	return &Sender{
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        100,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// checkAddress вызывается для каждого соединения с уже разрешённым адресом ip:port
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addrPort.Addr())
+	}
+
+	return nil
+}
+
+// isPublicAddr адрес в публичном интернете: не loopback, не частная, не link-local и не служебная сеть
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Send подписывает тело доставки ключом клиента и отправляет его POST запросом
+func (s *Sender) Send(ctx context.Context, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "docshade-webhook/1")
+	req.Header.Set(EventHeader, d.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(SignatureHeader, Sign(d.Secret, now, d.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("%w: %d", ErrUnexpectedStatus, resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,69 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{addr: "93.184.216.34", public: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", public: true},
+		{addr: "127.0.0.1"},
+		{addr: "::1"},
+		{addr: "10.1.2.3"},
+		{addr: "172.16.0.10"},
+		{addr: "192.168.1.1"},
+		{addr: "169.254.169.254"},
+		{addr: "fe80::1"},
+		{addr: "fd00::1"},
+		{addr: "0.0.0.0"},
+		{addr: "::"},
+		{addr: "100.64.0.1"},
+		{addr: "224.0.0.1"},
+		{addr: "::ffff:127.0.0.1"},
+		{addr: "::ffff:10.0.0.1"},
+		{addr: "64:ff9b::a00:1"},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("%s: expected public %v, got %v", tt.addr, tt.public, got)
+		}
+	}
+}
+
+func TestSenderRefusesPrivateNetworks(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	// Имя localhost разрешается в loopback, проверка срабатывает уже после разрешения
+	for _, url := range []string{server.URL, "http://localhost:" + server.URL[len("http://127.0.0.1:"):]} {
+		_, err := NewSender(core.WebhookConfig{Timeout: time.Second}).Send(context.Background(), Delivery{URL: url, Payload: []byte("{}")})
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Fatalf("%s: expected %v, got %v", url, ErrForbiddenAddress, err)
+		}
+	}
+	if requests != 0 {
+		t.Fatalf("expected no requests to reach the server, got %d", requests)
+	}
+
+	status, err := NewSender(core.WebhookConfig{Timeout: time.Second, AllowPrivateNetworks: true}).Send(context.Background(), Delivery{URL: server.URL, Payload: []byte("{}")})
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("expected delivery with private networks allowed, got %d: %v", status, err)
+	}
+}
@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SignatureHeader подпись запроса: v1=<hex HMAC-SHA256 от "<timestamp>.<тело>">
+	SignatureHeader = "X-Docshade-Signature"
+	// TimestampHeader время отправки в секундах Unix, входит в подпись и защищает от повтора запроса
+	TimestampHeader = "X-Docshade-Timestamp"
+	// EventHeader тип события
+	EventHeader = "X-Docshade-Event"
+	// DeliveryHeader номер доставки, одинаковый во всех повторах: по нему получатель отбрасывает дубли
+	DeliveryHeader = "X-Docshade-Delivery"
+
+	signatureVersion = "v1="
+)
+
+var (
+	// ErrInvalidSignature подпись отсутствует или не совпадает
+	ErrInvalidSignature = errors.New("webhook signature is invalid")
+	// ErrStaleTimestamp запрос подписан слишком давно или время отправки не разобрать
+	ErrStaleTimestamp = errors.New("webhook timestamp is outside the tolerance")
+)
+
+// Sign подпись тела запроса, отправленного в момент timestamp
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверка подписи на стороне получателя. Запросы, отправленные раньше tolerance, отклоняются
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+	timestamp := time.Unix(unix, 0)
+	if age := time.Since(timestamp); age > tolerance || age < -tolerance {
+		return ErrStaleTimestamp
+	}
+
+	signature := header.Get(SignatureHeader)
+	if !strings.HasPrefix(signature, signatureVersion) {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body))) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,143 @@
+// Package webhook доставка итогов обработки на адреса клиентов API: подписанный JSON,
+// повторы с нарастающей задержкой и журнал попыток
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/metrics"
+)
+
+// Status состояние доставки
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusDelivered Status = "delivered"
+	// StatusFailed все попытки исчерпаны
+	StatusFailed Status = "failed"
+)
+
+var (
+	deliveryAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "webhook",
+		Name:      "attempts_total",
+		Help:      "Number of webhook delivery attempts by outcome: delivered, retry or failed.",
+	}, []string{"outcome"})
+
+	attemptDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "webhook",
+		Name:      "attempt_duration_seconds",
+		Help:      "Time spent on one webhook request, including failed ones.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// Delivery отправка одного события документа на адрес клиента
+type Delivery struct {
+	ID         int64
+	DocumentID string
+	// Event тип события, например document.processed
+	Event  string
+	URL    string
+	Secret string
+	// Payload тело запроса, подписывается как есть
+	Payload     []byte
+	Status      Status
+	Attempts    int
+	LastError   string
+	CreatedAt   time.Time
+	DeliveredAt *time.Time
+	// Log журнал попыток, заполняется только в List
+	Log []Attempt
+}
+
+// Attempt запись журнала доставки
+type Attempt struct {
+	Number int
+	// StatusCode код ответа получателя, 0 если ответа не было
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+	AttemptedAt time.Time
+}
+
+// SendFunc отправляет доставку и возвращает код ответа получателя
+type SendFunc func(ctx context.Context, d Delivery) (int, error)
+
+type Store interface {
+	// Init создать таблицы доставок
+	Init(ctx context.Context) error
+	// Add сохранить доставку. Повторное событие того же документа новую доставку не создаёт,
+	// чтобы перечитанное из очереди сообщение не ушло получателю дважды
+	Add(ctx context.Context, d Delivery) error
+	// Dispatch отправить до limit доставок, время которых подошло. Неудачные откладываются
+	// с нарастающей задержкой, а после последней попытки помечаются failed. Возвращает число попыток
+	Dispatch(ctx context.Context, limit int, send SendFunc) (int, error)
+	// List доставки документа вместе с журналом попыток
+	List(ctx context.Context, documentID string) ([]Delivery, error)
+	// DeleteFinishedBefore удалить завершённые доставки, созданные раньше before, вместе с журналом
+	DeleteFinishedBefore(ctx context.Context, before time.Time) (int, error)
+	// Wake разбудить отправителя, не дожидаясь очередного опроса
+	Wake()
+	// Wakeups канал пробуждений отправителя
+	Wakeups() <-chan struct{}
+	// Ping проверить соединение с базой
+	Ping(ctx context.Context) error
+	// Close освободить ресурсы хранилища. Общий пул соединений с базой закрывает его владелец
+	Close() error
+}
+
+// outcome состояние доставки после попытки и время следующей
+func outcome(cfg core.WebhookConfig, d Delivery, sendErr error, now time.Time) (Status, time.Time) {
+	switch {
+	case sendErr == nil:
+		deliveryAttempts.WithLabelValues(string(StatusDelivered)).Inc()
+		return StatusDelivered, now
+	case d.Attempts+1 >= cfg.MaxAttempts:
+		deliveryAttempts.WithLabelValues(string(StatusFailed)).Inc()
+		return StatusFailed, now
+	default:
+		deliveryAttempts.WithLabelValues("retry").Inc()
+		return StatusPending, now.Add(backoff(cfg, d.Attempts+1))
+	}
+}
+
+// backoff задержка перед следующей попыткой после attempts неудачных
+func backoff(cfg core.WebhookConfig, attempts int) time.Duration {
+	delay := cfg.MinBackoff
+	for i := 1; i < attempts && delay < cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > cfg.MaxBackoff {
+		return cfg.MaxBackoff
+	}
+
+	return delay
+}
+
+// attempt отправляет доставку и записывает попытку для журнала
+func attempt(ctx context.Context, d Delivery, send SendFunc) (Attempt, error) {
+	start := time.Now()
+	statusCode, err := send(ctx, d)
+	duration := time.Since(start)
+	attemptDuration.Observe(duration.Seconds())
+
+	record := Attempt{
+		Number:      d.Attempts + 1,
+		StatusCode:  statusCode,
+		Duration:    duration,
+		AttemptedAt: start,
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	return record, err
+}
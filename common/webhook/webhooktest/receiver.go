@@ -0,0 +1,129 @@
+// Package webhooktest локальный получатель вебхуков для тестов: проверяет подпись
+// и запоминает принятые запросы
+package webhooktest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"gitlab.com/docshade/common/webhook"
+)
+
+// tolerance допустимое расхождение времени подписи
+const tolerance = 5 * time.Minute
+
+// Request принятый запрос с верной подписью
+type Request struct {
+	Event      string
+	DeliveryID string
+	Header     http.Header
+	Body       []byte
+}
+
+// Receiver HTTP сервер на локальном адресе, заменяющий получателя клиента API
+type Receiver struct {
+	// URL адрес, который передаётся как callback_url
+	URL string
+
+	secret   string
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []Request
+	failures int
+	rejected int
+	received chan struct{}
+}
+
+// NewReceiver запускает получатель, который принимает запросы, подписанные secret
+func NewReceiver(secret string) *Receiver {
+	r := &Receiver{
+		secret:   secret,
+		received: make(chan struct{}, 1),
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.handle))
+	r.URL = r.server.URL
+
+	return r
+}
+
+func (r *Receiver) handle(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := webhook.Verify(r.secret, req.Header, body, tolerance); err != nil {
+		r.rejected++
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	r.requests = append(r.requests, Request{
+		Event:      req.Header.Get(webhook.EventHeader),
+		DeliveryID: req.Header.Get(webhook.DeliveryHeader),
+		Header:     req.Header.Clone(),
+		Body:       body,
+	})
+	select {
+	case r.received <- struct{}{}:
+	default:
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// FailNext отвечать 503 на следующие n запросов с верной подписью
+func (r *Receiver) FailNext(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failures = n
+}
+
+// Requests принятые запросы в порядке получения
+func (r *Receiver) Requests() []Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Request(nil), r.requests...)
+}
+
+// Rejected число запросов с неверной подписью
+func (r *Receiver) Rejected() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rejected
+}
+
+// Wait ждёт, пока получатель примет хотя бы n запросов
+func (r *Receiver) Wait(ctx context.Context, n int) ([]Request, error) {
+	for {
+		if requests := r.Requests(); len(requests) >= n {
+			return requests, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return r.Requests(), ctx.Err()
+		case <-r.received:
+		}
+	}
+}
+
+// Close останавливает сервер получателя
+func (r *Receiver) Close() {
+	r.server.Close()
+}
@@ -68,9 +68,11 @@ const UploadForm: React.FC = () => {
         let toastId: number | string | null = null;
         try {
           const response = await uploadPDF(values.file);
-          const { session_id } = response;
+          const { session_id, session_token } = response;
 
-          const socket = new WebSocket(`wss://${config.backendHost}/ws/${session_id}`);
+          const socket = new WebSocket(
+            `wss://${config.backendHost}/ws/${session_id}?token=${encodeURIComponent(session_token)}`
+          );
 
           socket.onopen = () => {
             console.log('WebSocket connection established');
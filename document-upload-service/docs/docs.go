@@ -16,6 +16,44 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/v1/batches": {
+            "post": {
+                "description": "Uploads many documents, or a ZIP archive of them, under one session. Progress of the batch is reported over the session WebSocket with batch.progress events and a final batch.completed event",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Upload a batch of documents",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "URL to POST the processing result of each document to. Form fields must precede the files",
+                        "name": "callback_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key for the HMAC signature of the callback request, required with callback_url",
+                        "name": "callback_secret",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "file",
+                        "description": "Documents to upload, the field may repeat. A ZIP archive is unpacked",
+                        "name": "file",
+                        "in": "formData",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/upload.BatchDtoOut"
+                        }
+                    }
+                }
+            }
+        },
         "/v1/health": {
             "get": {
                 "produces": [
@@ -48,6 +86,18 @@ const docTemplate = `{
                 ],
                 "summary": "Upload a PDF document",
                 "parameters": [
+                    {
+                        "type": "string",
+                        "description": "URL to POST the processing result to. Form fields must precede the file",
+                        "name": "callback_url",
+                        "in": "formData"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Key for the HMAC signature of the callback request, required with callback_url",
+                        "name": "callback_secret",
+                        "in": "formData"
+                    },
                     {
                         "type": "file",
                         "description": "PDF file to upload",
@@ -65,6 +115,268 @@ const docTemplate = `{
                     }
                 }
             }
+        },
+        "/v1/uploads": {
+            "post": {
+                "description": "Starts a tus-style upload of one document sent in chunks. Every chunk except the last must be at least 5 MiB and a multiple of 64 KiB. The document is queued for processing once the last chunk is received. An upload that receives no chunks for the configured TTL is aborted",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create a resumable upload",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Size of the whole document in bytes",
+                        "name": "Upload-Length",
+                        "in": "header",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma separated key and base64 value pairs: filename, callback_url, callback_secret",
+                        "name": "Upload-Metadata",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/upload.ResumableDtoOut"
+                        },
+                        "headers": {
+                            "Location": {
+                                "type": "string",
+                                "description": "URL of the upload for PATCH, HEAD and DELETE requests"
+                            },
+                            "Upload-Expires": {
+                                "type": "string",
+                                "description": "Time the upload is aborted unless a chunk arrives"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/uploads/presign": {
+            "post": {
+                "description": "Returns a presigned URL to PUT the document straight to storage, bypassing the service. After the upload the client calls the complete URL, which verifies the size and the checksum and queues the document for processing",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Presign a direct upload",
+                "parameters": [
+                    {
+                        "description": "Declared document",
+                        "name": "requestBody",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/upload.PresignDtoIn"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/upload.PresignDtoOut"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "501": {
+                        "description": "Storage does not accept direct uploads",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/uploads/{upload_id}": {
+            "delete": {
+                "description": "Aborts an unfinished upload and deletes its stored chunks",
+                "summary": "Terminate a resumable upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "409": {
+                        "description": "A chunk is being uploaded",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    }
+                }
+            },
+            "head": {
+                "description": "Returns in headers how many bytes of the document are stored, the next chunk must start there",
+                "summary": "Get the offset of a resumable upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "headers": {
+                            "Upload-Length": {
+                                "type": "integer",
+                                "description": "Size of the whole document"
+                            },
+                            "Upload-Offset": {
+                                "type": "integer",
+                                "description": "Bytes stored so far"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found"
+                    }
+                }
+            },
+            "patch": {
+                "description": "Appends a chunk at Upload-Offset. A chunk interrupted midway is discarded and must be sent again from the same offset. The last chunk completes the document and queues it for processing",
+                "consumes": [
+                    "application/offset+octet-stream"
+                ],
+                "summary": "Upload a chunk of a resumable upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Offset of the chunk, must equal the current offset of the upload",
+                        "name": "Upload-Offset",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content",
+                        "headers": {
+                            "Upload-Offset": {
+                                "type": "integer",
+                                "description": "Bytes stored after this chunk"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "409": {
+                        "description": "Offset does not match or another chunk is being uploaded",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "413": {
+                        "description": "Request Entity Too Large",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "415": {
+                        "description": "Unsupported Media Type",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/uploads/{upload_id}/complete": {
+            "post": {
+                "description": "Verifies the size and the declared checksum of the document uploaded to the presigned URL, detects its format and queues it for processing. A failed check can be retried after uploading the document again",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Complete a direct upload",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Upload ID",
+                        "name": "upload_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/upload.DtoOut"
+                        }
+                    },
+                    "400": {
+                        "description": "Size, checksum or format check failed",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    },
+                    "409": {
+                        "description": "The document has not been uploaded yet or is being completed",
+                        "schema": {
+                            "$ref": "#/definitions/http.ErrorHttp"
+                        }
+                    }
+                }
+            }
         }
     },
     "definitions": {
@@ -76,6 +388,69 @@ const docTemplate = `{
                 }
             }
         },
+        "http.ErrorHttp": {
+            "type": "object",
+            "properties": {
+                "details": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "errorText": {
+                    "type": "string"
+                }
+            }
+        },
+        "upload.BatchDocumentDto": {
+            "type": "object",
+            "properties": {
+                "document_id": {
+                    "type": "string"
+                },
+                "file_name": {
+                    "type": "string"
+                },
+                "format": {
+                    "type": "string"
+                }
+            }
+        },
+        "upload.BatchDtoOut": {
+            "type": "object",
+            "properties": {
+                "batch_id": {
+                    "type": "string"
+                },
+                "documents": {
+                    "description": "Documents принятые документы, в том числе распакованные из архивов",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/upload.BatchDocumentDto"
+                    }
+                },
+                "message": {
+                    "type": "string"
+                },
+                "rejected": {
+                    "description": "Rejected файлы, не попавшие в пакет, с причиной",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/upload.RejectedFileDto"
+                    }
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "session_token": {
+                    "description": "SessionToken токен для подписки на уведомления сессии, включая batch.progress и batch.completed",
+                    "type": "string"
+                },
+                "session_token_expires_at": {
+                    "type": "string"
+                }
+            }
+        },
         "upload.DtoOut": {
             "type": "object",
             "properties": {
@@ -87,6 +462,111 @@ const docTemplate = `{
                 },
                 "session_id": {
                     "type": "string"
+                },
+                "session_token": {
+                    "type": "string"
+                },
+                "session_token_expires_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "upload.PresignDtoIn": {
+            "type": "object",
+            "properties": {
+                "callback_secret": {
+                    "type": "string"
+                },
+                "callback_url": {
+                    "type": "string"
+                },
+                "file_name": {
+                    "type": "string"
+                },
+                "sha256": {
+                    "description": "SHA256 контрольная сумма документа в hex, необязательна. При завершении документ читается целиком, и указанная сумма сверяется с посчитанной",
+                    "type": "string"
+                },
+                "size": {
+                    "description": "Size размер документа в байтах, при завершении сверяется с загруженным",
+                    "type": "integer"
+                }
+            }
+        },
+        "upload.PresignDtoOut": {
+            "type": "object",
+            "properties": {
+                "complete_url": {
+                    "description": "CompleteURL куда отправить POST после загрузки",
+                    "type": "string"
+                },
+                "document_id": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "session_token": {
+                    "description": "SessionToken токен для подписки на уведомления сессии: /ws/{session_id}?token=...",
+                    "type": "string"
+                },
+                "session_token_expires_at": {
+                    "type": "string"
+                },
+                "upload_id": {
+                    "type": "string"
+                },
+                "upload_method": {
+                    "type": "string"
+                },
+                "upload_url": {
+                    "description": "UploadURL куда загрузить документ запросом UploadMethod",
+                    "type": "string"
+                },
+                "upload_url_expires_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "upload.RejectedFileDto": {
+            "type": "object",
+            "properties": {
+                "file_name": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "upload.ResumableDtoOut": {
+            "type": "object",
+            "properties": {
+                "document_id": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "session_id": {
+                    "type": "string"
+                },
+                "session_token": {
+                    "description": "SessionToken токен для подписки на уведомления сессии: /ws/{session_id}?token=...",
+                    "type": "string"
+                },
+                "session_token_expires_at": {
+                    "type": "string"
+                },
+                "upload_expires_at": {
+                    "description": "UploadExpiresAt загрузка отменяется, если до этого времени не придёт следующая часть",
+                    "type": "string"
+                },
+                "upload_id": {
+                    "type": "string"
                 }
             }
         }
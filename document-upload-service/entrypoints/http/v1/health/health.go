@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"gitlab.com/docshade/common/broker"
 	httpUtils "gitlab.com/docshade/common/http"
 
 	"gitlab.com/docshade/common/core"
@@ -56,6 +57,7 @@ func (h *health) GetRoute() string {
 // @Produce      json
 // @Param requestBody body DtoIn true "Тело запроса"
 // @Success      200
+// @Failure      503 {object} DtoOut "Нет соединения с RabbitMQ"
 // @Router       /v1/health [get]
 func (h *health) Do(ctx echo.Context) error {
 	body := ctx.Request().Body
@@ -70,11 +72,16 @@ func (h *health) Do(ctx echo.Context) error {
 		return httpUtils.ReturnInternalError(ctx, err, "")
 	}
 
+	// Без брокера сервис не может ни принимать, ни отдавать документы
+	if response.RabbitMQ != broker.StateConnected {
+		return ctx.JSON(http.StatusServiceUnavailable, prepareResponse(response))
+	}
+
 	return ctx.JSON(http.StatusOK, prepareResponse(response))
 
 }
 
 func prepareResponse(data rest_service.HealthDtoOut) DtoOut {
 
-	return DtoOut{Message: data.Message}
+	return DtoOut{Message: data.Message, RabbitMQ: string(data.RabbitMQ)}
 }
@@ -7,5 +7,6 @@ type DtoIn struct {
 
 // DtoOut Output data
 type DtoOut struct {
-	Message string `json:"message"`
+	Message  string `json:"message"`
+	RabbitMQ string `json:"rabbitmq"`
 }
@@ -0,0 +1,404 @@
+package upload
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	rest_service "document-upload-service/usecases/upload_service"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/messaging"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	BatchRoute  = "/v1/batches"
+	BatchMethod = httpUtils.PostMethod
+)
+
+// Причины, по которым файл не попал в пакет
+const (
+	reasonUnsupported   = "unsupported format, supported formats: "
+	reasonTooLarge      = "file is too large"
+	reasonFileLimit     = "batch file limit reached"
+	reasonSizeLimit     = "batch size limit reached"
+	reasonNestedArchive = "nested archives are not supported"
+	reasonBadArchive    = "invalid ZIP archive"
+	reasonBadEntry      = "failed to read archive entry"
+)
+
+var (
+	errBatchTooLarge = errors.New("batch is too large")
+	errEmptyBatch    = errors.New("batch has no supported documents")
+)
+
+// zipMagic сигнатура локального заголовка ZIP
+var zipMagic = []byte("PK\x03\x04")
+
+type batchUpload struct {
+	method        httpUtils.Methods
+	route         string
+	providers     providerUpload
+	maxUploadSize int64
+	maxBatchFiles int
+	maxBatchSize  int64
+}
+
+// NewBatchUpload get new object
+func NewBatchUpload(
+	method httpUtils.Methods,
+	route string,
+	providers providerUpload,
+	maxUploadSize int64,
+	maxBatchFiles int,
+	maxBatchSize int64,
+) core.Handler {
+	return &batchUpload{
+		method:        method,
+		route:         route,
+		providers:     providers,
+		maxUploadSize: maxUploadSize,
+		maxBatchFiles: maxBatchFiles,
+		maxBatchSize:  maxBatchSize,
+	}
+}
+
+// GetMethod Get handler method
+func (h *batchUpload) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *batchUpload) GetRoute() string {
+	return h.route
+}
+
+// batch документы одного запроса пакетной загрузки
+type batch struct {
+	service   rest_service.RestService
+	sessionID string
+	id        string
+	callback  *messaging.Callback
+	docs      []rest_service.Document
+	rejected  []RejectedFileDto
+	// extracted сколько байт распаковано из архивов
+	extracted int64
+}
+
+func (b *batch) reject(fileName, reason string) {
+	b.rejected = append(b.rejected, RejectedFileDto{FileName: fileName, Reason: reason})
+}
+
+// @Summary      Upload a batch of documents
+// @Description  Uploads many documents, or a ZIP archive of them, under one session. Progress of the batch is reported over the session WebSocket with batch.progress events and a final batch.completed event
+// @Produce      json
+// @Param        callback_url formData string false "URL to POST the processing result of each document to. Form fields must precede the files"
+// @Param        callback_secret formData string false "Key for the HMAC signature of the callback request, required with callback_url"
+// @Param        file formData file true "Documents to upload, the field may repeat. A ZIP archive is unpacked"
+// @Success      200 {object} BatchDtoOut
+// @Router       /v1/batches [post]
+func (h *batchUpload) Do(ctx echo.Context) error {
+	request := ctx.Request()
+	if request.ContentLength > h.maxBatchSize {
+		return httpUtils.ReturnPayloadTooLargeError(ctx, errBatchTooLarge, "Batch is too large")
+	}
+	request.Body = http.MaxBytesReader(ctx.Response(), request.Body, h.maxBatchSize)
+
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid form")
+	}
+
+	b := &batch{
+		service:   h.providers.GetRestServiceFactory().GetService(),
+		sessionID: uuid.New().String(),
+		id:        uuid.New().String(),
+	}
+	fields := make(map[string]string)
+	filesStarted := false
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if isTooLarge(err) {
+				return httpUtils.ReturnPayloadTooLargeError(ctx, errBatchTooLarge, "Batch is too large")
+			}
+			return httpUtils.ReturnBadRequestError(ctx, err, "Invalid form")
+		}
+
+		if part.FormName() != fileField {
+			// Поля формы учитываются, только пока не начались файлы
+			if part.FileName() == "" && !filesStarted {
+				value, err := readField(part)
+				if err != nil {
+					part.Close()
+					return httpUtils.ReturnBadRequestError(ctx, err, "Invalid form")
+				}
+				fields[part.FormName()] = value
+			}
+			part.Close()
+			continue
+		}
+
+		if !filesStarted {
+			filesStarted = true
+			b.callback, err = callbackFromForm(fields)
+			if err != nil {
+				part.Close()
+				return httpUtils.ReturnBadRequestError(ctx, err, "Invalid callback: callback_url must be an absolute http(s) URL and callback_secret is required")
+			}
+		}
+
+		err = h.addPart(request.Context(), b, part)
+		part.Close()
+		if err != nil {
+			if isTooLarge(err) {
+				return httpUtils.ReturnPayloadTooLargeError(ctx, errBatchTooLarge, "Batch is too large")
+			}
+			return httpUtils.ReturnInternalError(ctx, err, "Failed to process batch")
+		}
+	}
+
+	if !filesStarted {
+		return httpUtils.ReturnBadRequestError(ctx, errMissingFile, "Invalid file")
+	}
+	if len(b.docs) == 0 {
+		details := make([]string, 0, len(b.rejected))
+		for _, rejected := range b.rejected {
+			details = append(details, rejected.FileName+": "+rejected.Reason)
+		}
+		return ctx.JSON(http.StatusBadRequest, httpUtils.ErrorHttp{
+			ErrorText: errEmptyBatch.Error(),
+			Details:   details,
+		})
+	}
+
+	// Пакет регистрируется после сохранения всех файлов, объекты оборвавшейся загрузки
+	// удалит очистка по сроку хранения
+	err = b.service.EnqueueBatch(request.Context(), b.sessionID, b.id, b.docs)
+	if err != nil {
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to process batch")
+	}
+
+	token, expiresAt := b.service.IssueSessionToken(b.sessionID)
+	response := BatchDtoOut{
+		SessionID:             b.sessionID,
+		SessionToken:          token,
+		SessionTokenExpiresAt: expiresAt,
+		BatchID:               b.id,
+		Documents:             make([]BatchDocumentDto, 0, len(b.docs)),
+		Rejected:              b.rejected,
+		Message:               fmt.Sprintf("%d of %d files uploaded successfully", len(b.docs), len(b.docs)+len(b.rejected)),
+	}
+	if response.Rejected == nil {
+		response.Rejected = make([]RejectedFileDto, 0)
+	}
+	for _, doc := range b.docs {
+		response.Documents = append(response.Documents, BatchDocumentDto{
+			DocumentID: doc.DocumentID,
+			FileName:   doc.OriginalFileName,
+			Format:     doc.Format.Name,
+		})
+	}
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// addPart сохраняет файл из формы или распаковывает архив. Ошибка возвращается только для сбоев,
+// после которых продолжать пакет нельзя, неподходящие файлы попадают в rejected
+func (h *batchUpload) addPart(ctx context.Context, b *batch, part *multipart.Part) error {
+	format, document, err := sniff(part)
+	switch {
+	case errors.Is(err, errArchive):
+		return h.addArchive(ctx, b, part.FileName(), document)
+	case errors.Is(err, formats.ErrUnsupported):
+		b.reject(part.FileName(), reasonUnsupported+formats.Names())
+		return nil
+	case err != nil:
+		return err
+	}
+
+	limited := &limitedReader{r: document, remaining: h.maxUploadSize}
+	err = h.store(ctx, b, part.FileName(), format, limited)
+	if err != nil && limited.sourceErr != nil {
+		// Хранилище не обязано сохранять ошибку чтения, а по ней отличается превышение размера запроса
+		return limited.sourceErr
+	}
+
+	return err
+}
+
+// addArchive сохраняет документы из ZIP архива. zip читает каталог с конца файла,
+// поэтому архив сначала копируется во временный файл
+func (h *batchUpload) addArchive(ctx context.Context, b *batch, archiveName string, archive io.Reader) error {
+	tmp, err := os.CreateTemp("", "batch-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, archive)
+	if err != nil {
+		return err
+	}
+
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		b.reject(archiveName, reasonBadArchive)
+		return nil
+	}
+
+	for _, entry := range zr.File {
+		name := path.Base(entry.Name)
+		if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if b.extracted+int64(entry.UncompressedSize64) > h.maxBatchSize {
+			b.reject(name, reasonSizeLimit)
+			continue
+		}
+
+		err := h.addEntry(ctx, b, name, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *batchUpload) addEntry(ctx context.Context, b *batch, name string, entry *zip.File) error {
+	if entry.UncompressedSize64 > uint64(h.maxUploadSize) {
+		b.reject(name, reasonTooLarge)
+		return nil
+	}
+
+	rc, err := entry.Open()
+	if err != nil {
+		b.reject(name, reasonBadEntry)
+		return nil
+	}
+	defer rc.Close()
+
+	format, document, err := sniff(rc)
+	switch {
+	case errors.Is(err, errArchive):
+		b.reject(name, reasonNestedArchive)
+		return nil
+	case errors.Is(err, formats.ErrUnsupported):
+		b.reject(name, reasonUnsupported+formats.Names())
+		return nil
+	case err != nil:
+		b.reject(name, reasonBadEntry)
+		return nil
+	}
+
+	// Размер в заголовке архива может не совпадать с содержимым, поэтому он проверяется и при чтении
+	limited := &limitedReader{r: document, remaining: min(h.maxUploadSize, h.maxBatchSize-b.extracted)}
+	err = h.store(ctx, b, name, format, limited)
+	b.extracted += limited.read
+	if err != nil && limited.sourceErr != nil {
+		b.reject(name, reasonBadEntry)
+		return nil
+	}
+
+	return err
+}
+
+// store сохраняет документ в хранилище. Документ, оказавшийся больше предела, отклоняется
+func (h *batchUpload) store(ctx context.Context, b *batch, fileName string, format formats.Format, document *limitedReader) error {
+	if len(b.docs) >= h.maxBatchFiles {
+		b.reject(fileName, reasonFileLimit)
+		return nil
+	}
+
+	doc := rest_service.Document{
+		SessionID:        b.sessionID,
+		DocumentID:       uuid.New().String(),
+		OriginalFileName: fileName,
+		Format:           format,
+		BatchID:          b.id,
+		Callback:         b.callback,
+	}
+	doc, err := b.service.StoreDocument(ctx, doc, document)
+	if document.exceeded {
+		b.reject(fileName, reasonTooLarge)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	b.docs = append(b.docs, doc)
+
+	return nil
+}
+
+// errArchive поток оказался ZIP архивом, а не документом
+var errArchive = errors.New("zip archive")
+
+// sniff определяет формат документа как formats.Sniff, дополнительно отличая ZIP архивы от DOCX
+func sniff(r io.Reader) (formats.Format, io.Reader, error) {
+	buffered := bufio.NewReaderSize(r, formats.SniffSize)
+
+	head, err := buffered.Peek(formats.SniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return formats.Format{}, nil, err
+	}
+
+	format, err := formats.Detect(head, len(head) < formats.SniffSize)
+	if errors.Is(err, formats.ErrUnsupported) && bytes.HasPrefix(head, zipMagic) {
+		return formats.Format{}, buffered, errArchive
+	}
+	if err != nil {
+		return formats.Format{}, nil, err
+	}
+
+	return format, buffered, nil
+}
+
+// limitedReader возвращает ошибку, если поток длиннее remaining байт. В отличие от io.LimitReader
+// превышение не выглядит как конец файла и не даёт сохранить обрезанный документ
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64
+	exceeded  bool
+	// sourceErr ошибка чтения исходного потока, кроме io.EOF
+	sourceErr error
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		l.exceeded = true
+		return n, errFileTooLarge
+	}
+	if err != nil && err != io.EOF {
+		l.sourceErr = err
+	}
+
+	return n, err
+}
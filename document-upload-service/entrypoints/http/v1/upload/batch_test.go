@@ -0,0 +1,266 @@
+package upload
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	rest_service "document-upload-service/usecases/upload_service"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// fakeRestService сохраняет документы в память, как хранилище читая их целиком
+type fakeRestService struct {
+	rest_service.RestService
+	stored map[string][]byte
+}
+
+func (s *fakeRestService) StoreDocument(ctx context.Context, doc rest_service.Document, file io.Reader) (rest_service.Document, error) {
+	body, err := io.ReadAll(file)
+	if err != nil {
+		return doc, err
+	}
+	s.stored[doc.DocumentID] = body
+
+	return doc, nil
+}
+
+type zipEntry struct {
+	name string
+	body []byte
+}
+
+func zipArchive(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", entry.name, err)
+		}
+		if _, err := w.Write(entry.body); err != nil {
+			t.Fatalf("failed to write %s: %v", entry.name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// understatedArchive архив с одним документом, в заголовке которого указан размер меньше настоящего
+func understatedArchive(t *testing.T, name string, body []byte, declared uint64) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CompressedSize64:   uint64(len(body)),
+		UncompressedSize64: declared,
+	})
+	if err != nil {
+		t.Fatalf("failed to add %s: %v", name, err)
+	}
+	if _, err := w.Write(body); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func pdf(size int) []byte {
+	return append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("a"), size-9)...)
+}
+
+func newTestBatch() (*batch, *fakeRestService) {
+	service := &fakeRestService{stored: make(map[string][]byte)}
+	return &batch{service: service, sessionID: "session-1", id: "batch-1"}, service
+}
+
+func rejectedReasons(b *batch) map[string]string {
+	reasons := make(map[string]string, len(b.rejected))
+	for _, rejected := range b.rejected {
+		reasons[rejected.FileName] = rejected.Reason
+	}
+	return reasons
+}
+
+func TestAddArchive(t *testing.T) {
+	h := &batchUpload{maxUploadSize: 300, maxBatchFiles: 3, maxBatchSize: 700}
+
+	testCases := []struct {
+		name     string
+		archive  []byte
+		stored   []string
+		rejected map[string]string
+	}{
+		{
+			name: "nested paths and hidden entries",
+			archive: zipArchive(t,
+				zipEntry{"docs/", nil},
+				zipEntry{"docs/2024/report.pdf", pdf(50)},
+				zipEntry{".hidden.pdf", pdf(50)},
+				zipEntry{"docs/.DS_Store", []byte("junk")},
+				zipEntry{"__MACOSX/docs/._report.pdf", pdf(50)},
+			),
+			stored:   []string{"report.pdf"},
+			rejected: map[string]string{},
+		},
+		{
+			name: "nested archive and unsupported entry",
+			archive: zipArchive(t,
+				zipEntry{"inner.zip", zipArchive(t, zipEntry{"a.pdf", pdf(20)})},
+				zipEntry{"tool.exe", []byte("MZ\x90\x00")},
+				zipEntry{"a.pdf", pdf(20)},
+			),
+			stored: []string{"a.pdf"},
+			rejected: map[string]string{
+				"inner.zip": reasonNestedArchive,
+				"tool.exe":  reasonUnsupported,
+			},
+		},
+		{
+			name: "file and size limits",
+			archive: zipArchive(t,
+				zipEntry{"big.pdf", pdf(301)},
+				zipEntry{"1.pdf", pdf(300)},
+				zipEntry{"2.pdf", pdf(300)},
+				zipEntry{"3.pdf", pdf(300)},
+				zipEntry{"4.pdf", pdf(10)},
+				zipEntry{"5.pdf", pdf(10)},
+				zipEntry{"6.pdf", pdf(10)},
+			),
+			stored: []string{"1.pdf", "2.pdf", "4.pdf"},
+			rejected: map[string]string{
+				"big.pdf": reasonTooLarge,
+				"3.pdf":   reasonSizeLimit,
+				"5.pdf":   reasonFileLimit,
+				"6.pdf":   reasonFileLimit,
+			},
+		},
+		{
+			name:     "size understated in the header",
+			archive:  understatedArchive(t, "liar.pdf", pdf(400), 20),
+			rejected: map[string]string{"liar.pdf": reasonBadEntry},
+		},
+		{
+			name:     "not an archive",
+			archive:  []byte("PK\x03\x04 broken"),
+			rejected: map[string]string{"batch.zip": reasonBadArchive},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			b, service := newTestBatch()
+			if err := h.addArchive(context.Background(), b, "batch.zip", bytes.NewReader(tc.archive)); err != nil {
+				t.Fatalf("failed to add archive: %v", err)
+			}
+
+			var stored []string
+			for _, doc := range b.docs {
+				stored = append(stored, doc.OriginalFileName)
+			}
+			if strings.Join(stored, ",") != strings.Join(tc.stored, ",") {
+				t.Errorf("stored %v, expected %v", stored, tc.stored)
+			}
+			if len(service.stored) != len(tc.stored) {
+				t.Errorf("expected %d documents in storage, got %d", len(tc.stored), len(service.stored))
+			}
+
+			reasons := rejectedReasons(b)
+			for name, reason := range tc.rejected {
+				if !strings.HasPrefix(reasons[name], reason) {
+					t.Errorf("%s: expected reason %q, got %q", name, reason, reasons[name])
+				}
+			}
+			if len(reasons) != len(tc.rejected) {
+				t.Errorf("rejected %v, expected %v", reasons, tc.rejected)
+			}
+		})
+	}
+}
+
+func TestAddArchive_DocumentIDs(t *testing.T) {
+	h := &batchUpload{maxUploadSize: 100, maxBatchFiles: 10, maxBatchSize: 1000}
+	b, service := newTestBatch()
+
+	archive := zipArchive(t,
+		zipEntry{"a.pdf", pdf(30)},
+		zipEntry{"b/a.pdf", pdf(40)},
+		zipEntry{"c.pdf", pdf(50)},
+	)
+	if err := h.addArchive(context.Background(), b, "batch.zip", bytes.NewReader(archive)); err != nil {
+		t.Fatalf("failed to add archive: %v", err)
+	}
+	if len(b.docs) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(b.docs))
+	}
+
+	// Каждый документ получает свой идентификатор, даже при совпадающих именах, и помнит пакет
+	seen := make(map[string]bool)
+	for i, doc := range b.docs {
+		if doc.DocumentID == "" || seen[doc.DocumentID] {
+			t.Fatalf("document %d has a missing or repeated ID %q", i, doc.DocumentID)
+		}
+		seen[doc.DocumentID] = true
+		if doc.SessionID != "session-1" || doc.BatchID != "batch-1" {
+			t.Errorf("document %s is not bound to the batch: %+v", doc.DocumentID, doc)
+		}
+		if len(service.stored[doc.DocumentID]) != 30+10*i {
+			t.Errorf("document %s has %d bytes in storage", doc.DocumentID, len(service.stored[doc.DocumentID]))
+		}
+	}
+	if b.extracted != 120 {
+		t.Errorf("expected 120 extracted bytes, got %d", b.extracted)
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	sourceErr := errors.New("connection reset")
+
+	testCases := []struct {
+		name      string
+		source    io.Reader
+		limit     int64
+		read      int
+		err       error
+		exceeded  bool
+		sourceErr error
+	}{
+		{name: "shorter than limit", source: strings.NewReader("12345"), limit: 10, read: 5},
+		{name: "exactly the limit", source: strings.NewReader("1234567890"), limit: 10, read: 10},
+		{name: "one byte over", source: strings.NewReader("12345678901"), limit: 10, read: 11, err: errFileTooLarge, exceeded: true},
+		{name: "zero limit", source: strings.NewReader("1"), limit: 0, read: 1, err: errFileTooLarge, exceeded: true},
+		{name: "source error", source: iotest.TimeoutReader(strings.NewReader("12345")), limit: 10, read: 5, err: iotest.ErrTimeout, sourceErr: iotest.ErrTimeout},
+		{name: "source error after data", source: io.MultiReader(strings.NewReader("123"), iotest.ErrReader(sourceErr)), limit: 10, read: 3, err: sourceErr, sourceErr: sourceErr},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			limited := &limitedReader{r: tc.source, remaining: tc.limit}
+			data, err := io.ReadAll(limited)
+
+			if !errors.Is(err, tc.err) && !(tc.err == nil && err == nil) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if limited.exceeded != tc.exceeded || !errors.Is(limited.sourceErr, tc.sourceErr) {
+				t.Fatalf("exceeded %v, source error %v", limited.exceeded, limited.sourceErr)
+			}
+			if len(data) != tc.read || limited.read != int64(tc.read) {
+				t.Fatalf("read %d bytes, counted %d, expected %d", len(data), limited.read, tc.read)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package upload
+
+import (
+	rest_service "document-upload-service/usecases/upload_service"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/resumable"
+	"gitlab.com/docshade/common/storage"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Прямая загрузка в хранилище: сервис выдаёт подписанную ссылку, клиент загружает документ по ней сам
+// и сообщает о завершении, после чего документ проверяется и ставится в очередь
+const (
+	PresignRoute   = "/v1/uploads/presign"
+	PresignMethod  = httpUtils.PostMethod
+	CompleteRoute  = "/v1/uploads/:upload_id/complete"
+	CompleteMethod = httpUtils.PostMethod
+
+	// maxPresignBodySize предел тела запроса ссылки, оно читается в память
+	maxPresignBodySize = 16 << 10
+)
+
+var (
+	errInvalidSize     = errors.New("size must be a positive integer")
+	errInvalidChecksum = errors.New("sha256 must be a hex encoded SHA-256 digest")
+)
+
+type presignUpload struct {
+	method        httpUtils.Methods
+	route         string
+	providers     providerUpload
+	maxUploadSize int64
+}
+
+// NewPresignUpload get new object
+func NewPresignUpload(
+	method httpUtils.Methods,
+	route string,
+	providers providerUpload,
+	maxUploadSize int64,
+) core.Handler {
+	return &presignUpload{
+		method:        method,
+		route:         route,
+		providers:     providers,
+		maxUploadSize: maxUploadSize,
+	}
+}
+
+// GetMethod Get handler method
+func (h *presignUpload) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *presignUpload) GetRoute() string {
+	return h.route
+}
+
+// @Summary      Presign a direct upload
+// @Description  Returns a presigned URL to PUT the document straight to storage, bypassing the service. After the upload the client calls the complete URL, which verifies the size and the checksum and queues the document for processing
+// @Accept       json
+// @Produce      json
+// @Param        requestBody body PresignDtoIn true "Declared document"
+// @Success      201 {object} PresignDtoOut
+// @Failure      400 {object} httpUtils.ErrorHttp
+// @Failure      413 {object} httpUtils.ErrorHttp
+// @Failure      501 {object} httpUtils.ErrorHttp "Storage does not accept direct uploads"
+// @Router       /v1/uploads/presign [post]
+func (h *presignUpload) Do(ctx echo.Context) error {
+	request := ctx.Request()
+	request.Body = http.MaxBytesReader(ctx.Response(), request.Body, maxPresignBodySize)
+
+	var data PresignDtoIn
+	if err := json.NewDecoder(request.Body).Decode(&data); err != nil {
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid request body")
+	}
+	if data.Size <= 0 {
+		return httpUtils.ReturnBadRequestError(ctx, errInvalidSize, "Invalid size")
+	}
+	if data.Size > h.maxUploadSize {
+		return httpUtils.ReturnPayloadTooLargeError(ctx, errFileTooLarge, "File is too large")
+	}
+	checksum := strings.ToLower(data.SHA256)
+	if checksum != "" {
+		if digest, err := hex.DecodeString(checksum); err != nil || len(digest) != 32 {
+			return httpUtils.ReturnBadRequestError(ctx, errInvalidChecksum, "Invalid sha256")
+		}
+	}
+	callback, err := callbackFromForm(map[string]string{
+		callbackURLField:    data.CallbackURL,
+		callbackSecretField: data.CallbackSecret,
+	})
+	if err != nil {
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid callback: callback_url must be an absolute http(s) URL and callback_secret is required")
+	}
+
+	service := h.providers.GetRestServiceFactory().GetService()
+	upload, uploadURL, urlExpiresAt, err := service.PresignUpload(request.Context(), resumable.Upload{
+		ID:         uuid.New().String(),
+		SessionID:  uuid.New().String(),
+		DocumentID: uuid.New().String(),
+		FileName:   data.FileName,
+		Length:     data.Size,
+		Callback:   callback,
+		SHA256:     checksum,
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrDirectUploadUnsupported) {
+			return httpUtils.ReturnNotImplementedError(ctx, err, "Direct uploads are not available, use /v1/upload or /v1/uploads")
+		}
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to presign upload")
+	}
+
+	token, expiresAt := service.IssueSessionToken(upload.SessionID)
+
+	return ctx.JSON(http.StatusCreated, PresignDtoOut{
+		UploadID:              upload.ID,
+		SessionID:             upload.SessionID,
+		SessionToken:          token,
+		SessionTokenExpiresAt: expiresAt,
+		DocumentID:            upload.DocumentID,
+		UploadURL:             uploadURL,
+		UploadMethod:          http.MethodPut,
+		UploadURLExpiresAt:    urlExpiresAt,
+		CompleteURL:           ResumableRoute + "/" + upload.ID + "/complete",
+		Message:               "Upload the document to upload_url, then POST complete_url",
+	})
+}
+
+type completeUpload struct {
+	method    httpUtils.Methods
+	route     string
+	providers providerUpload
+}
+
+// NewCompleteUpload get new object
+func NewCompleteUpload(
+	method httpUtils.Methods,
+	route string,
+	providers providerUpload,
+) core.Handler {
+	return &completeUpload{
+		method:    method,
+		route:     route,
+		providers: providers,
+	}
+}
+
+// GetMethod Get handler method
+func (h *completeUpload) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *completeUpload) GetRoute() string {
+	return h.route
+}
+
+// @Summary      Complete a direct upload
+// @Description  Verifies the size and the declared checksum of the document uploaded to the presigned URL, detects its format and queues it for processing. A failed check can be retried after uploading the document again
+// @Produce      json
+// @Param        upload_id path string true "Upload ID"
+// @Success      200 {object} DtoOut
+// @Failure      400 {object} httpUtils.ErrorHttp "Size, checksum or format check failed"
+// @Failure      404 {object} httpUtils.ErrorHttp
+// @Failure      409 {object} httpUtils.ErrorHttp "The document has not been uploaded yet or is being completed"
+// @Router       /v1/uploads/{upload_id}/complete [post]
+func (h *completeUpload) Do(ctx echo.Context) error {
+	service := h.providers.GetRestServiceFactory().GetService()
+	upload, err := service.CompleteUpload(ctx.Request().Context(), ctx.Param(uploadIDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, resumable.ErrNotFound):
+			return httpUtils.ReturnNotFoundError(ctx, err, "Upload not found or expired")
+		case errors.Is(err, resumable.ErrUploadMode):
+			return httpUtils.ReturnConflictError(ctx, err, "Upload is sent in chunks, not to a presigned URL")
+		case errors.Is(err, resumable.ErrLocked), errors.Is(err, resumable.ErrOffsetMismatch):
+			return httpUtils.ReturnConflictError(ctx, err, "Upload is being completed by another request")
+		case errors.Is(err, storage.ErrNotFound):
+			return httpUtils.ReturnConflictError(ctx, err, "Document has not been uploaded to the presigned URL")
+		case errors.Is(err, rest_service.ErrSizeMismatch):
+			return httpUtils.ReturnBadRequestError(ctx, err, "Uploaded document size does not match the declared size")
+		case errors.Is(err, rest_service.ErrChecksumMismatch):
+			return httpUtils.ReturnBadRequestError(ctx, err, "Uploaded document does not match the declared sha256")
+		case errors.Is(err, formats.ErrUnsupported):
+			return httpUtils.ReturnBadRequestError(ctx, err, "Invalid file format. Supported formats: "+formats.Names())
+		}
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to complete upload")
+	}
+
+	token, expiresAt := service.IssueSessionToken(upload.SessionID)
+
+	return ctx.JSON(http.StatusOK, DtoOut{
+		SessionID:             upload.SessionID,
+		SessionToken:          token,
+		SessionTokenExpiresAt: expiresAt,
+		DocumentID:            upload.DocumentID,
+		Message:               "File uploaded successfully",
+	})
+}
@@ -0,0 +1,379 @@
+package upload
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/resumable"
+	"gitlab.com/docshade/common/storage"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Загрузка документа частями по протоколу tus: POST создаёт загрузку, PATCH дописывает часть
+// с указанного смещения, HEAD возвращает принятое смещение, DELETE отменяет загрузку
+const (
+	ResumableRoute        = "/v1/uploads"
+	ResumableUploadRoute  = "/v1/uploads/:upload_id"
+	CreateUploadMethod    = httpUtils.PostMethod
+	UploadOffsetMethod    = httpUtils.HeadMethod
+	UploadChunkMethod     = httpUtils.PatchMethod
+	TerminateUploadMethod = httpUtils.DeleteMethod
+
+	uploadIDParam = "upload_id"
+	// fileNameMetadata ключ имени файла в Upload-Metadata, принятый у клиентов tus
+	fileNameMetadata = "filename"
+)
+
+var (
+	errInvalidLength   = errors.New("Upload-Length must be a positive integer")
+	errInvalidOffset   = errors.New("Upload-Offset must be a non-negative integer")
+	errInvalidMetadata = errors.New("invalid Upload-Metadata")
+	errMissingLength   = errors.New("Content-Length is required")
+	errChunkTooLarge   = errors.New("chunk is too large")
+	errContentType     = errors.New("Content-Type must be " + httpUtils.OffsetOctetStream)
+)
+
+type createUpload struct {
+	method        httpUtils.Methods
+	route         string
+	providers     providerUpload
+	maxUploadSize int64
+}
+
+// NewCreateUpload get new object
+func NewCreateUpload(
+	method httpUtils.Methods,
+	route string,
+	providers providerUpload,
+	maxUploadSize int64,
+) core.Handler {
+	return &createUpload{
+		method:        method,
+		route:         route,
+		providers:     providers,
+		maxUploadSize: maxUploadSize,
+	}
+}
+
+// GetMethod Get handler method
+func (h *createUpload) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *createUpload) GetRoute() string {
+	return h.route
+}
+
+// @Summary      Create a resumable upload
+// @Description  Starts a tus-style upload of one document sent in chunks. Every chunk except the last must be at least 5 MiB and a multiple of 64 KiB. The document is queued for processing once the last chunk is received. An upload that receives no chunks for the configured TTL is aborted
+// @Produce      json
+// @Param        Upload-Length header int true "Size of the whole document in bytes"
+// @Param        Upload-Metadata header string false "Comma separated key and base64 value pairs: filename, callback_url, callback_secret"
+// @Success      201 {object} ResumableDtoOut
+// @Header       201 {string} Location "URL of the upload for PATCH, HEAD and DELETE requests"
+// @Header       201 {string} Upload-Expires "Time the upload is aborted unless a chunk arrives"
+// @Router       /v1/uploads [post]
+func (h *createUpload) Do(ctx echo.Context) error {
+	setTusHeaders(ctx)
+	request := ctx.Request()
+
+	length, err := strconv.ParseInt(request.Header.Get(httpUtils.UploadLengthHeader), 10, 64)
+	if err != nil || length <= 0 {
+		return httpUtils.ReturnBadRequestError(ctx, errInvalidLength, "Invalid Upload-Length")
+	}
+	if length > h.maxUploadSize {
+		return httpUtils.ReturnPayloadTooLargeError(ctx, errFileTooLarge, "File is too large")
+	}
+
+	metadata, err := parseMetadata(request.Header.Get(httpUtils.UploadMetadataHeader))
+	if err != nil {
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid Upload-Metadata")
+	}
+	callback, err := callbackFromForm(metadata)
+	if err != nil {
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid callback: callback_url must be an absolute http(s) URL and callback_secret is required")
+	}
+
+	service := h.providers.GetRestServiceFactory().GetService()
+	upload, err := service.CreateUpload(request.Context(), resumable.Upload{
+		ID:         uuid.New().String(),
+		SessionID:  uuid.New().String(),
+		DocumentID: uuid.New().String(),
+		FileName:   metadata[fileNameMetadata],
+		Length:     length,
+		Callback:   callback,
+	})
+	if err != nil {
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to create upload")
+	}
+
+	token, expiresAt := service.IssueSessionToken(upload.SessionID)
+	ctx.Response().Header().Set(echo.HeaderLocation, ResumableRoute+"/"+upload.ID)
+	ctx.Response().Header().Set(httpUtils.UploadExpiresHeader, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+
+	return ctx.JSON(http.StatusCreated, ResumableDtoOut{
+		UploadID:              upload.ID,
+		SessionID:             upload.SessionID,
+		SessionToken:          token,
+		SessionTokenExpiresAt: expiresAt,
+		DocumentID:            upload.DocumentID,
+		UploadExpiresAt:       upload.ExpiresAt,
+		Message:               "Upload created",
+	})
+}
+
+type uploadOffset struct {
+	method    httpUtils.Methods
+	route     string
+	providers providerUpload
+}
+
+// NewUploadOffset get new object
+func NewUploadOffset(
+	method httpUtils.Methods,
+	route string,
+	providers providerUpload,
+) core.Handler {
+	return &uploadOffset{
+		method:    method,
+		route:     route,
+		providers: providers,
+	}
+}
+
+// GetMethod Get handler method
+func (h *uploadOffset) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *uploadOffset) GetRoute() string {
+	return h.route
+}
+
+// @Summary      Get the offset of a resumable upload
+// @Description  Returns in headers how many bytes of the document are stored, the next chunk must start there
+// @Param        upload_id path string true "Upload ID"
+// @Success      200
+// @Header       200 {int} Upload-Offset "Bytes stored so far"
+// @Header       200 {int} Upload-Length "Size of the whole document"
+// @Failure      404
+// @Router       /v1/uploads/{upload_id} [head]
+func (h *uploadOffset) Do(ctx echo.Context) error {
+	setTusHeaders(ctx)
+	// Смещение меняется с каждой частью, кешировать ответ нельзя
+	ctx.Response().Header().Set(echo.HeaderCacheControl, "no-store")
+
+	service := h.providers.GetRestServiceFactory().GetService()
+	upload, err := service.GetUpload(ctx.Request().Context(), ctx.Param(uploadIDParam))
+	if err != nil {
+		if errors.Is(err, resumable.ErrNotFound) {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+
+	setUploadHeaders(ctx, upload)
+
+	return ctx.NoContent(http.StatusOK)
+}
+
+type uploadChunk struct {
+	method       httpUtils.Methods
+	route        string
+	providers    providerUpload
+	maxChunkSize int64
+}
+
+// NewUploadChunk get new object
+func NewUploadChunk(
+	method httpUtils.Methods,
+	route string,
+	providers providerUpload,
+	maxChunkSize int64,
+) core.Handler {
+	return &uploadChunk{
+		method:       method,
+		route:        route,
+		providers:    providers,
+		maxChunkSize: maxChunkSize,
+	}
+}
+
+// GetMethod Get handler method
+func (h *uploadChunk) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *uploadChunk) GetRoute() string {
+	return h.route
+}
+
+// @Summary      Upload a chunk of a resumable upload
+// @Description  Appends a chunk at Upload-Offset. A chunk interrupted midway is discarded and must be sent again from the same offset. The last chunk completes the document and queues it for processing
+// @Accept       application/offset+octet-stream
+// @Param        upload_id path string true "Upload ID"
+// @Param        Upload-Offset header int true "Offset of the chunk, must equal the current offset of the upload"
+// @Success      204
+// @Header       204 {int} Upload-Offset "Bytes stored after this chunk"
+// @Failure      400 {object} httpUtils.ErrorHttp
+// @Failure      404 {object} httpUtils.ErrorHttp
+// @Failure      409 {object} httpUtils.ErrorHttp "Offset does not match or another chunk is being uploaded"
+// @Failure      413 {object} httpUtils.ErrorHttp
+// @Failure      415 {object} httpUtils.ErrorHttp
+// @Router       /v1/uploads/{upload_id} [patch]
+func (h *uploadChunk) Do(ctx echo.Context) error {
+	setTusHeaders(ctx)
+	request := ctx.Request()
+
+	mediaType, _, err := mime.ParseMediaType(request.Header.Get(echo.HeaderContentType))
+	if err != nil || mediaType != httpUtils.OffsetOctetStream {
+		return httpUtils.ReturnUnsupportedMediaTypeError(ctx, errContentType, "Invalid Content-Type")
+	}
+	offset, err := strconv.ParseInt(request.Header.Get(httpUtils.UploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		return httpUtils.ReturnBadRequestError(ctx, errInvalidOffset, "Invalid Upload-Offset")
+	}
+	// Размер части нужен хранилищу заранее
+	if request.ContentLength < 0 {
+		return httpUtils.ReturnBadRequestError(ctx, errMissingLength, "Chunked request bodies are not supported")
+	}
+	if request.ContentLength > h.maxChunkSize {
+		return httpUtils.ReturnPayloadTooLargeError(ctx, errChunkTooLarge, fmt.Sprintf("Chunk must not exceed %d bytes", h.maxChunkSize))
+	}
+	request.Body = http.MaxBytesReader(ctx.Response(), request.Body, request.ContentLength)
+
+	service := h.providers.GetRestServiceFactory().GetService()
+	upload, err := service.UploadChunk(request.Context(), ctx.Param(uploadIDParam), offset, request.Body, request.ContentLength)
+	if err != nil {
+		return chunkError(ctx, err)
+	}
+
+	setUploadHeaders(ctx, upload)
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+type terminateUpload struct {
+	method    httpUtils.Methods
+	route     string
+	providers providerUpload
+}
+
+// NewTerminateUpload get new object
+func NewTerminateUpload(
+	method httpUtils.Methods,
+	route string,
+	providers providerUpload,
+) core.Handler {
+	return &terminateUpload{
+		method:    method,
+		route:     route,
+		providers: providers,
+	}
+}
+
+// GetMethod Get handler method
+func (h *terminateUpload) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *terminateUpload) GetRoute() string {
+	return h.route
+}
+
+// @Summary      Terminate a resumable upload
+// @Description  Aborts an unfinished upload and deletes its stored chunks
+// @Param        upload_id path string true "Upload ID"
+// @Success      204
+// @Failure      404 {object} httpUtils.ErrorHttp
+// @Failure      409 {object} httpUtils.ErrorHttp "A chunk is being uploaded"
+// @Router       /v1/uploads/{upload_id} [delete]
+func (h *terminateUpload) Do(ctx echo.Context) error {
+	setTusHeaders(ctx)
+
+	service := h.providers.GetRestServiceFactory().GetService()
+	err := service.TerminateUpload(ctx.Request().Context(), ctx.Param(uploadIDParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, resumable.ErrNotFound):
+			return httpUtils.ReturnNotFoundError(ctx, err, "Upload not found")
+		case errors.Is(err, resumable.ErrLocked), errors.Is(err, resumable.ErrOffsetMismatch):
+			return httpUtils.ReturnConflictError(ctx, err, "A chunk of the upload is being received")
+		}
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to terminate upload")
+	}
+
+	return ctx.NoContent(http.StatusNoContent)
+}
+
+// chunkError ответ на неудачную часть загрузки
+func chunkError(ctx echo.Context, err error) error {
+	switch {
+	case errors.Is(err, resumable.ErrNotFound):
+		return httpUtils.ReturnNotFoundError(ctx, err, "Upload not found or expired")
+	case errors.Is(err, resumable.ErrOffsetMismatch):
+		return httpUtils.ReturnConflictError(ctx, err, "Upload-Offset does not match the upload, query it with HEAD")
+	case errors.Is(err, resumable.ErrLocked):
+		return httpUtils.ReturnConflictError(ctx, err, "Another chunk of the upload is being received")
+	case errors.Is(err, resumable.ErrLengthExceeded):
+		return httpUtils.ReturnBadRequestError(ctx, err, "Chunk exceeds Upload-Length")
+	case errors.Is(err, storage.ErrInvalidPart):
+		return httpUtils.ReturnBadRequestError(ctx, err, fmt.Sprintf("Every chunk except the last must be at least %d bytes and a multiple of %d bytes", storage.MinPartSize, storage.PartAlignment))
+	case errors.Is(err, formats.ErrUnsupported):
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid file format. Supported formats: "+formats.Names())
+	case isTooLarge(err):
+		return httpUtils.ReturnPayloadTooLargeError(ctx, errChunkTooLarge, "Chunk is larger than Content-Length")
+	}
+
+	return httpUtils.ReturnInternalError(ctx, err, "Failed to store chunk")
+}
+
+// setTusHeaders версия протокола обязательна в каждом ответе tus
+func setTusHeaders(ctx echo.Context) {
+	ctx.Response().Header().Set(httpUtils.TusResumableHeader, httpUtils.TusVersion)
+}
+
+func setUploadHeaders(ctx echo.Context, upload resumable.Upload) {
+	header := ctx.Response().Header()
+	header.Set(httpUtils.UploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	header.Set(httpUtils.UploadLengthHeader, strconv.FormatInt(upload.Length, 10))
+	if upload.Offset < upload.Length {
+		header.Set(httpUtils.UploadExpiresHeader, upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseMetadata разбирает Upload-Metadata: пары "ключ значение_base64" через запятую, значение может отсутствовать
+func parseMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errInvalidMetadata
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(value) > maxFieldSize {
+			return nil, fmt.Errorf("%w: %s", errInvalidMetadata, key)
+		}
+		metadata[key] = string(value)
+	}
+
+	return metadata, nil
+}
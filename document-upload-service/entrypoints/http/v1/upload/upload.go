@@ -1,12 +1,18 @@
 package upload
 
 import (
-	"context"
 	rest_service "document-upload-service/usecases/upload_service"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"strings"
 
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
 	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/messaging"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -15,6 +21,19 @@ import (
 const (
 	Route  = "/v1/upload"
 	Method = httpUtils.PostMethod
+
+	fileField           = "file"
+	callbackURLField    = "callback_url"
+	callbackSecretField = "callback_secret"
+
+	// maxFieldSize предел текстовых полей формы, они читаются в память
+	maxFieldSize = 4 << 10
+)
+
+var (
+	errFileTooLarge = errors.New("file is too large")
+	errMissingFile  = errors.New("form field \"file\" is missing")
+	errFieldTooLong = errors.New("form field is too long")
 )
 
 type providerUpload interface {
@@ -22,9 +41,10 @@ type providerUpload interface {
 }
 
 type upload struct {
-	method    httpUtils.Methods
-	route     string
-	providers providerUpload
+	method        httpUtils.Methods
+	route         string
+	providers     providerUpload
+	maxUploadSize int64
 }
 
 // NewUpload get new object
@@ -32,11 +52,13 @@ func NewUpload(
 	method httpUtils.Methods,
 	route string,
 	providers providerUpload,
+	maxUploadSize int64,
 ) core.Handler {
 	return &upload{
-		method:    method,
-		route:     route,
-		providers: providers,
+		method:        method,
+		route:         route,
+		providers:     providers,
+		maxUploadSize: maxUploadSize,
 	}
 }
 
@@ -50,35 +72,47 @@ func (h *upload) GetRoute() string {
 	return h.route
 }
 
-// @Summary      Upload a PDF document
-// @Description  Uploads a PDF document and processes it
+// @Summary      Upload a document
+// @Description  Uploads a PDF, DOCX, TXT, CSV or scanned image document and processes it. The format is detected by content
 // @Produce      json
-// @Param        file formData file true "PDF file to upload"
+// @Param        callback_url formData string false "URL to POST the processing result to. Form fields must precede the file"
+// @Param        callback_secret formData string false "Key for the HMAC signature of the callback request, required with callback_url"
+// @Param        file formData file true "Document to upload"
 // @Success      200 {object} DtoOut
 // @Router       /v1/upload [post]
 func (h *upload) Do(ctx echo.Context) error {
-	// Получение файла из запроса
-	file, err := ctx.FormFile("file")
-	if err != nil {
-		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid file")
+	request := ctx.Request()
+	if request.ContentLength > h.maxUploadSize {
+		return httpUtils.ReturnPayloadTooLargeError(ctx, errFileTooLarge, "File is too large")
 	}
+	// Ограничиваем тело целиком, чтобы размер проверялся и для запросов без Content-Length
+	request.Body = http.MaxBytesReader(ctx.Response(), request.Body, h.maxUploadSize)
 
-	if file.Header.Get("Content-Type") != "application/pdf" {
-		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid file format. Only PDF is allowed.")
+	// Получение файла из запроса без буферизации формы
+	file, fields, err := filePart(request)
+	if err != nil {
+		if isTooLarge(err) {
+			return httpUtils.ReturnPayloadTooLargeError(ctx, errFileTooLarge, "File is too large")
+		}
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid file")
 	}
+	defer file.Close()
 
-	// Открытие файла
-	src, err := file.Open()
+	callback, err := callbackFromForm(fields)
 	if err != nil {
-		return httpUtils.ReturnInternalError(ctx, err, "Failed to open file")
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid callback: callback_url must be an absolute http(s) URL and callback_secret is required")
 	}
-	defer src.Close()
 
-	// Прочтение файла в память
-	fileData := make([]byte, file.Size)
-	_, err = src.Read(fileData)
+	// Формат определяется по содержимому, заголовку клиента не доверяем
+	format, document, err := formats.Sniff(file)
 	if err != nil {
-		return httpUtils.ReturnInternalError(ctx, err, "Failed to read file")
+		if isTooLarge(err) {
+			return httpUtils.ReturnPayloadTooLargeError(ctx, errFileTooLarge, "File is too large")
+		}
+		if errors.Is(err, formats.ErrUnsupported) {
+			return httpUtils.ReturnBadRequestError(ctx, err, "Invalid file format. Supported formats: "+formats.Names())
+		}
+		return httpUtils.ReturnBadRequestError(ctx, err, "Invalid file")
 	}
 
 	// Генерация идентификаторов сессии и документа
@@ -89,15 +123,94 @@ func (h *upload) Do(ctx echo.Context) error {
 	service := h.providers.GetRestServiceFactory().GetService()
 
 	// Загрузка файла в S3 и публикация сообщения в RabbitMQ через сервис
-	err = service.UploadDocument(context.Background(), sessionID, documentID, file.Filename, fileData)
+	err = service.UploadDocument(request.Context(), rest_service.Document{
+		SessionID:        sessionID,
+		DocumentID:       documentID,
+		OriginalFileName: file.FileName(),
+		Format:           format,
+		Callback:         callback,
+	}, document)
 	if err != nil {
+		if isTooLarge(err) {
+			return httpUtils.ReturnPayloadTooLargeError(ctx, errFileTooLarge, "File is too large")
+		}
 		return httpUtils.ReturnInternalError(ctx, err, "Failed to process file")
 	}
 
+	token, expiresAt := service.IssueSessionToken(sessionID)
 	response := DtoOut{
-		SessionID:  sessionID,
-		DocumentID: documentID,
-		Message:    "File uploaded successfully",
+		SessionID:             sessionID,
+		SessionToken:          token,
+		SessionTokenExpiresAt: expiresAt,
+		DocumentID:            documentID,
+		Message:               "File uploaded successfully",
 	}
 	return ctx.JSON(http.StatusOK, response)
 }
+
+// filePart находит в multipart теле запроса поле "file", не читая сам файл.
+// Текстовые поля, идущие до файла, возвращаются вместе с ним
+func filePart(request *http.Request) (*multipart.Part, map[string]string, error) {
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fields := make(map[string]string)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil, errMissingFile
+			}
+			return nil, nil, err
+		}
+		if part.FormName() == fileField {
+			return part, fields, nil
+		}
+
+		if part.FileName() == "" {
+			value, err := readField(part)
+			if err != nil {
+				part.Close()
+				return nil, nil, err
+			}
+			fields[part.FormName()] = value
+		}
+		part.Close()
+	}
+}
+
+// readField читает текстовое поле формы не длиннее maxFieldSize
+func readField(part *multipart.Part) (string, error) {
+	value, err := io.ReadAll(io.LimitReader(part, maxFieldSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(value) > maxFieldSize {
+		return "", fmt.Errorf("%w: %s", errFieldTooLong, part.FormName())
+	}
+
+	return string(value), nil
+}
+
+// callbackFromForm адрес для вебхука с итогом обработки, nil если клиент его не указал
+func callbackFromForm(fields map[string]string) (*messaging.Callback, error) {
+	callbackURL := strings.TrimSpace(fields[callbackURLField])
+	secret := fields[callbackSecretField]
+	if callbackURL == "" && secret == "" {
+		return nil, nil
+	}
+
+	callback := &messaging.Callback{URL: callbackURL, Secret: secret}
+	if err := callback.Validate(); err != nil {
+		return nil, err
+	}
+
+	return callback, nil
+}
+
+func isTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
@@ -1,12 +1,85 @@
 package upload
 
+import "time"
+
 // DtoIn Input data (может остаться пустым, если не требуется дополнительных данных в теле запроса)
 type DtoIn struct {
 }
 
 // DtoOut Output data
 type DtoOut struct {
-	SessionID  string `json:"session_id"`
+	SessionID string `json:"session_id"`
+	// SessionToken токен для подписки на уведомления сессии: /ws/{session_id}?token=...
+	SessionToken          string    `json:"session_token"`
+	SessionTokenExpiresAt time.Time `json:"session_token_expires_at"`
+	DocumentID            string    `json:"document_id"`
+	Message               string    `json:"message"`
+}
+
+// BatchDtoOut ответ пакетной загрузки
+type BatchDtoOut struct {
+	SessionID string `json:"session_id"`
+	// SessionToken токен для подписки на уведомления сессии, включая batch.progress и batch.completed
+	SessionToken          string    `json:"session_token"`
+	SessionTokenExpiresAt time.Time `json:"session_token_expires_at"`
+	BatchID               string    `json:"batch_id"`
+	// Documents принятые документы, в том числе распакованные из архивов
+	Documents []BatchDocumentDto `json:"documents"`
+	// Rejected файлы, не попавшие в пакет, с причиной
+	Rejected []RejectedFileDto `json:"rejected"`
+	Message  string            `json:"message"`
+}
+
+// BatchDocumentDto документ пакета
+type BatchDocumentDto struct {
 	DocumentID string `json:"document_id"`
-	Message    string `json:"message"`
+	FileName   string `json:"file_name"`
+	Format     string `json:"format"`
+}
+
+// RejectedFileDto файл, не попавший в пакет
+type RejectedFileDto struct {
+	FileName string `json:"file_name"`
+	Reason   string `json:"reason"`
+}
+
+// ResumableDtoOut ответ создания загрузки частями
+type ResumableDtoOut struct {
+	UploadID  string `json:"upload_id"`
+	SessionID string `json:"session_id"`
+	// SessionToken токен для подписки на уведомления сессии: /ws/{session_id}?token=...
+	SessionToken          string    `json:"session_token"`
+	SessionTokenExpiresAt time.Time `json:"session_token_expires_at"`
+	DocumentID            string    `json:"document_id"`
+	// UploadExpiresAt загрузка отменяется, если до этого времени не придёт следующая часть
+	UploadExpiresAt time.Time `json:"upload_expires_at"`
+	Message         string    `json:"message"`
+}
+
+// PresignDtoIn документ, который клиент загрузит напрямую
+type PresignDtoIn struct {
+	FileName string `json:"file_name"`
+	// Size размер документа в байтах, при завершении сверяется с загруженным
+	Size int64 `json:"size"`
+	// SHA256 контрольная сумма документа в hex, необязательна. При завершении документ читается целиком, и указанная сумма сверяется с посчитанной
+	SHA256         string `json:"sha256"`
+	CallbackURL    string `json:"callback_url"`
+	CallbackSecret string `json:"callback_secret"`
+}
+
+// PresignDtoOut ссылка для прямой загрузки
+type PresignDtoOut struct {
+	UploadID  string `json:"upload_id"`
+	SessionID string `json:"session_id"`
+	// SessionToken токен для подписки на уведомления сессии: /ws/{session_id}?token=...
+	SessionToken          string    `json:"session_token"`
+	SessionTokenExpiresAt time.Time `json:"session_token_expires_at"`
+	DocumentID            string    `json:"document_id"`
+	// UploadURL куда загрузить документ запросом UploadMethod
+	UploadURL          string    `json:"upload_url"`
+	UploadMethod       string    `json:"upload_method"`
+	UploadURLExpiresAt time.Time `json:"upload_url_expires_at"`
+	// CompleteURL куда отправить POST после загрузки
+	CompleteURL string `json:"complete_url"`
+	Message     string `json:"message"`
 }
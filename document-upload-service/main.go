@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"document-upload-service/entrypoints/http/v1/health"
 	"document-upload-service/entrypoints/http/v1/upload"
 	dataproviders "document-upload-service/providers"
+	"document-upload-service/tasks"
 
 	"gitlab.com/docshade/common/core"
 	"gitlab.com/docshade/common/http/middleware"
@@ -15,7 +17,7 @@ import (
 )
 
 func main() {
-	config := core.NewConfig("test")
+	config := core.NewConfig("document-upload-service")
 	err := config.LoadConfig()
 	if err != nil {
 		logger.Fatalf("Error occurred while loading config: %+v, config: %+v", err, config)
@@ -26,7 +28,7 @@ func main() {
 		logger.Fatalf("%s", err)
 	}
 
-	mw := middleware.NewBaseMiddleware()
+	mw := middleware.NewBaseMiddleware(config.GetAllowedOrigins())
 	service := echo.New()
 
 	microservice := core.NewMicroservice(config, service, mw.GetGlobalMiddlewares())
@@ -34,6 +36,13 @@ func main() {
 
 	addRoutes(config, providers)
 
+	microservice.AddTask("outbox-relay", func(ctx context.Context) error {
+		return tasks.StartOutboxRelay(ctx, providers.GetOutbox(), providers.GetRestServiceFactory().GetService())
+	})
+	microservice.AddTask("resumable-upload-sweeper", func(ctx context.Context) error {
+		return tasks.StartUploadSweeper(ctx, config.GetResumableConfig().SweepInterval, providers.GetRestServiceFactory().GetService())
+	})
+	microservice.AddCloser("providers", providers.Close)
 	microservice.Run()
 }
 
@@ -42,6 +51,13 @@ func addRoutes(
 	providers dataproviders.ExecutorProviders) {
 
 	config.AddHandler(health.NewHealth(health.Method, health.Route, providers)).
-		AddHandler(upload.NewUpload(upload.Method, upload.Route, providers))
+		AddHandler(upload.NewUpload(upload.Method, upload.Route, providers, config.GetMaxUploadSize())).
+		AddHandler(upload.NewBatchUpload(upload.BatchMethod, upload.BatchRoute, providers, config.GetMaxUploadSize(), config.GetMaxBatchFiles(), config.GetMaxBatchSize())).
+		AddHandler(upload.NewCreateUpload(upload.CreateUploadMethod, upload.ResumableRoute, providers, config.GetMaxUploadSize())).
+		AddHandler(upload.NewUploadOffset(upload.UploadOffsetMethod, upload.ResumableUploadRoute, providers)).
+		AddHandler(upload.NewUploadChunk(upload.UploadChunkMethod, upload.ResumableUploadRoute, providers, config.GetResumableConfig().MaxChunkSize)).
+		AddHandler(upload.NewTerminateUpload(upload.TerminateUploadMethod, upload.ResumableUploadRoute, providers)).
+		AddHandler(upload.NewPresignUpload(upload.PresignMethod, upload.PresignRoute, providers, config.GetMaxUploadSize())).
+		AddHandler(upload.NewCompleteUpload(upload.CompleteMethod, upload.CompleteRoute, providers))
 
 }
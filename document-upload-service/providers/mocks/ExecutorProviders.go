@@ -3,8 +3,12 @@
 package mocks
 
 import (
+	context "context"
+
 	mock "github.com/stretchr/testify/mock"
 
+	outbox "gitlab.com/docshade/common/outbox"
+
 	rest_service "document-upload-service/usecases/upload_service"
 )
 
@@ -13,6 +17,44 @@ type ExecutorProviders struct {
 	mock.Mock
 }
 
+// Close provides a mock function with given fields: ctx
+func (_m *ExecutorProviders) Close(ctx context.Context) error {
+	ret := _m.Called(ctx)
+
+	if len(ret) == 0 {
+		panic("no return value specified for Close")
+	}
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context) error); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// GetOutbox provides a mock function with given fields:
+func (_m *ExecutorProviders) GetOutbox() outbox.Store {
+	ret := _m.Called()
+
+	if len(ret) == 0 {
+		panic("no return value specified for GetOutbox")
+	}
+
+	var r0 outbox.Store
+	if rf, ok := ret.Get(0).(func() outbox.Store); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(outbox.Store)
+		}
+	}
+
+	return r0
+}
+
 // GetRestServiceFactory provides a mock function with given fields:
 func (_m *ExecutorProviders) GetRestServiceFactory() rest_service.RestServiceFactory {
 	ret := _m.Called()
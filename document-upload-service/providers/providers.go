@@ -3,34 +3,85 @@ package providers
 import (
 	"context"
 	"document-upload-service/providers/rabbitmq_provider"
-	"document-upload-service/providers/s3_provider"
 	rest_service "document-upload-service/usecases/upload_service"
 	"log"
 
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/database"
+	"gitlab.com/docshade/common/health"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/outbox"
+	"gitlab.com/docshade/common/resumable"
+	"gitlab.com/docshade/common/session"
+	"gitlab.com/docshade/common/storage"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 //go:generate go run github.com/vektra/mockery/v2@v2.42.1 --name=ExecutorProviders
 type ExecutorProviders interface {
 	// GetRestServiceFactory  получить фабрику для работы с логикой пользователя
 	GetRestServiceFactory() rest_service.RestServiceFactory
+	// GetOutbox получить хранилище исходящих сообщений
+	GetOutbox() outbox.Store
+	// Close закрыть соединения провайдеров
+	Close(ctx context.Context) error
 }
 
 type executorProviders struct {
 	restFactory rest_service.RestServiceFactory
 	rabbitmq    rabbitmq_provider.RabbitMQ
-	s3          s3_provider.S3
+	storage     storage.Storage
+	db          *pgxpool.Pool
+	jobs        jobs.Repository
+	outbox      outbox.Store
+	uploads     resumable.Store
 }
 
 func (p *executorProviders) GetRestServiceFactory() rest_service.RestServiceFactory {
 	return p.restFactory
 }
 
+func (p *executorProviders) GetOutbox() outbox.Store {
+	return p.outbox
+}
+
+// Close закрывает соединения в порядке, обратном инициализации
+func (p *executorProviders) Close(ctx context.Context) error {
+	if err := p.uploads.Close(); err != nil {
+		return err
+	}
+
+	if err := p.jobs.Close(); err != nil {
+		return err
+	}
+
+	if err := p.outbox.Close(); err != nil {
+		return err
+	}
+	p.db.Close()
+
+	if err := p.rabbitmq.Close(); err != nil {
+		return err
+	}
+
+	return p.storage.Close()
+}
+
 // NewProviders инициализация провайдеров
 func NewProviders(config core.Config) (ExecutorProviders, error) {
-	s3 := s3_provider.NewS3(config.GetS3Config())
-	if err := s3.InitS3(); err != nil {
-		log.Println("ошибка подключения к s3 ", err)
+	sessions, err := session.NewSigner(config.GetSessionConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := storage.NewBuckets(config.GetS3Config())
+	store, err := storage.New(config.GetS3Config())
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Init(context.Background(), buckets.Incoming); err != nil {
+		log.Println("ошибка подключения к хранилищу ", err)
 		return nil, err
 	}
 
@@ -39,13 +90,6 @@ func NewProviders(config core.Config) (ExecutorProviders, error) {
 		log.Println("ошибка подключения к  rabbitmq", err)
 		return nil, err
 	}
-	err := s3.CreateBucket(context.Background(), "preprocessing")
-	if err != nil {
-		//return nil, err
-		log.Println(err)
-		err = nil
-	}
-
 	// Создание обменника
 	err = rabbitmq.CreateExchange(context.Background(), "document-exchange")
 	if err != nil {
@@ -60,11 +104,46 @@ func NewProviders(config core.Config) (ExecutorProviders, error) {
 		return nil, err
 	}
 
-	restFactory := rest_service.NewRestFactory(rabbitmq, s3)
+	// Хранилища ниже работают с одной базой через общий пул
+	db, err := database.Connect(context.Background(), config.GetPostgresConfig())
+	if err != nil {
+		log.Println("ошибка подключения к postgres", err)
+		return nil, err
+	}
+
+	// Таблица сообщений нужна раньше первой регистрации документа
+	outboxStore := outbox.NewPostgresStore(db)
+	if err := outboxStore.Init(context.Background()); err != nil {
+		log.Println("ошибка подготовки таблиц postgres", err)
+		return nil, err
+	}
+
+	jobsRepository := jobs.NewPostgresRepository(db)
+	if err := jobsRepository.Init(context.Background()); err != nil {
+		log.Println("ошибка подготовки таблиц postgres", err)
+		return nil, err
+	}
+
+	uploads := resumable.NewPostgresStore(db)
+	if err := uploads.Init(context.Background()); err != nil {
+		log.Println("ошибка подготовки таблиц postgres", err)
+		return nil, err
+	}
+
+	// Проверки для /readyz
+	health.Register("s3", store.Ping)
+	health.Register("rabbitmq", rabbitmq.Ping)
+	health.Register("postgres", db.Ping)
+
+	restFactory := rest_service.NewRestFactory(rabbitmq, store, buckets, jobsRepository, outboxStore, sessions, uploads, config.GetResumableConfig())
 
 	return &executorProviders{
-		s3:          s3,
+		storage:     store,
+		db:          db,
 		restFactory: restFactory,
 		rabbitmq:    rabbitmq,
+		jobs:        jobsRepository,
+		outbox:      outboxStore,
+		uploads:     uploads,
 	}, nil
 }
@@ -2,22 +2,23 @@ package rabbitmq_provider
 
 import (
 	"context"
-	"encoding/json"
-	"time"
 
+	"gitlab.com/docshade/common/broker"
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/tracing"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-const (
-	maxRetries = 10
-	retryDelay = 5 * time.Second
-)
-
 type RabbitMQ interface {
 	// InitRabbitMQ инициализация соединения с RabbitMQ
 	InitRabbitMQ() error
+	// Close закрытие соединения с RabbitMQ
+	Close() error
+	// State состояние соединения с RabbitMQ
+	State() broker.State
+	// Ping проверка соединения для /readyz
+	Ping(ctx context.Context) error
 	// PublishMessage публикация сообщения в RabbitMQ
 	PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) error
 	// CreateQueueAndBind создание очереди и привязка её к обменнику
@@ -27,120 +28,86 @@ type RabbitMQ interface {
 }
 
 type rabbitmq struct {
-	cfg core.RabbitMQConfig
-	mq  *amqp.Connection
+	mq *broker.Manager
 }
 
 // NewRabbitMQ создает новый экземпляр RabbitMQ
 func NewRabbitMQ(cfg core.RabbitMQConfig) RabbitMQ {
-	return &rabbitmq{cfg: cfg}
+	return &rabbitmq{mq: broker.NewManager(cfg)}
 }
 
-// InitRabbitMQ инициализирует соединение с RabbitMQ
+// InitRabbitMQ подключается к RabbitMQ; дальше соединение восстанавливает менеджер
 func (r *rabbitmq) InitRabbitMQ() error {
-	var err error
-	for i := 0; i < maxRetries; i++ {
-		r.mq, err = amqp.Dial(r.cfg.URI)
-		if err == nil {
-			break
-		}
-		time.Sleep(retryDelay)
-	}
-	return nil
+	return r.mq.Connect(context.Background())
 }
 
-// PublishMessage публикует сообщение в RabbitMQ
-func (r *rabbitmq) PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) error {
-	ch, err := r.mq.Channel()
-	if err != nil {
-		return err
-	}
-	defer ch.Close()
+// Close закрывает соединение с RabbitMQ
+func (r *rabbitmq) Close() error {
+	return r.mq.Close()
+}
 
-	err = r.CreateExchange(ctx, exchange)
-	if err != nil {
-		return err
-	}
+func (r *rabbitmq) State() broker.State {
+	return r.mq.State()
+}
 
-	err = ch.PublishWithContext(ctx,
-		exchange,   // exchange
-		routingKey, // routing key
-		false,      // mandatory
-		false,      // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        message,
-		})
-	if err != nil {
-		return err
-	}
+func (r *rabbitmq) Ping(ctx context.Context) error {
+	return r.mq.Ping(ctx)
+}
 
-	return nil
+// PublishMessage публикует сообщение в RabbitMQ
+func (r *rabbitmq) PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) (err error) {
+	headers := amqp.Table{}
+	ctx, span := tracing.StartPublishSpan(ctx, exchange, routingKey, headers)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	return r.mq.Publish(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Body:         message,
+	})
 }
 
 // CreateExchange создает обменник
 func (r *rabbitmq) CreateExchange(ctx context.Context, exchange string) error {
-	ch, err := r.mq.Channel()
-	if err != nil {
-		return err
-	}
-	defer ch.Close()
-
-	err = ch.ExchangeDeclare(
-		exchange, // name
-		"direct", // type
-		true,     // durable
-		false,    // auto-deleted
-		false,    // internal
-		false,    // no-wait
-		nil,      // arguments
-	)
-	return err
+	return r.mq.Declare(ctx, func(ch *amqp.Channel) error {
+		return ch.ExchangeDeclare(
+			exchange, // name
+			"direct", // type
+			true,     // durable
+			false,    // auto-deleted
+			false,    // internal
+			false,    // no-wait
+			nil,      // arguments
+		)
+	})
 }
 
-// CreateQueueAndBind создает очередь и привязывает её к обменнику
+// CreateQueueAndBind создает очередь и привязывает её к обменнику. Очередь объявляется без аргументов,
+// как и в queue-service: брокер отклонит объявление существующей очереди с другими аргументами
 func (r *rabbitmq) CreateQueueAndBind(ctx context.Context, queueName, exchange, routingKey string) error {
-	ch, err := r.mq.Channel()
-	if err != nil {
-		return err
-	}
-	defer ch.Close()
-
-	_, err = ch.QueueDeclare(
-		queueName, // name
-		true,      // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
-	if err != nil {
-		return err
-	}
-
-	err = ch.QueueBind(
-		queueName,  // queue name
-		routingKey, // routing key
-		exchange,   // exchange
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Helper function to create the message
-func CreateMessage(sessionID, documentID, s3Path, originalFileName string, metadata map[string]string) ([]byte, error) {
-	message := map[string]interface{}{
-		"session_id":         sessionID,
-		"document_id":        documentID,
-		"s3_path":            s3Path,
-		"original_file_name": originalFileName,
-		"metadata":           metadata,
-	}
+	return r.mq.Declare(ctx, func(ch *amqp.Channel) error {
+		_, err := ch.QueueDeclare(
+			queueName, // name
+			true,      // durable
+			false,     // delete when unused
+			false,     // exclusive
+			false,     // no-wait
+			nil,       // arguments
+		)
+		if err != nil {
+			return err
+		}
 
-	return json.Marshal(message)
+		return ch.QueueBind(
+			queueName,  // queue name
+			routingKey, // routing key
+			exchange,   // exchange
+			false,
+			nil,
+		)
+	})
 }
@@ -0,0 +1,51 @@
+package tasks
+
+import (
+	"context"
+	rest_service "document-upload-service/usecases/upload_service"
+	"log"
+	"time"
+
+	"gitlab.com/docshade/common/outbox"
+)
+
+const (
+	// relayInterval период опроса outbox: подбирает сообщения, отложенные после ошибок брокера
+	relayInterval = 5 * time.Second
+	// relayBatch сколько сообщений публиковать в одной транзакции
+	relayBatch = 100
+)
+
+// StartOutboxRelay публикует сообщения из outbox сразу после регистрации документа
+// и периодически, пока не отменят контекст
+func StartOutboxRelay(ctx context.Context, store outbox.Store, restService rest_service.RestService) error {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+
+	for {
+		relay(ctx, store, restService)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-store.Wakeups():
+		}
+	}
+}
+
+// relay разбирает outbox пачками, пока в нём остаются готовые сообщения
+func relay(ctx context.Context, store outbox.Store, restService rest_service.RestService) {
+	for {
+		published, err := store.Dispatch(ctx, relayBatch, restService.PublishOutboxMessage)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to relay outbox messages: %v", err)
+			}
+			return
+		}
+		if published < relayBatch {
+			return
+		}
+	}
+}
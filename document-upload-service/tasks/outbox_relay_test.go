@@ -0,0 +1,159 @@
+package tasks
+
+import (
+	"context"
+	"document-upload-service/providers/rabbitmq_provider"
+	rest_service "document-upload-service/usecases/upload_service"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/docshade/common/broker"
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/outbox"
+	"gitlab.com/docshade/common/storage"
+)
+
+// fakeBroker подтверждает публикации, кроме тех, для которых задан ответ
+type fakeBroker struct {
+	rabbitmq_provider.RabbitMQ
+
+	mu sync.Mutex
+	// replies ответы брокера на очередные публикации сообщения с таким телом
+	replies map[string][]func(ctx context.Context) error
+	calls   []string
+}
+
+func (b *fakeBroker) PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) error {
+	b.mu.Lock()
+	body := string(message)
+	b.calls = append(b.calls, body)
+	var reply func(ctx context.Context) error
+	if replies := b.replies[body]; len(replies) > 0 {
+		reply, b.replies[body] = replies[0], replies[1:]
+	}
+	b.mu.Unlock()
+
+	if reply == nil {
+		return nil
+	}
+	return reply(ctx)
+}
+
+func (b *fakeBroker) published() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.calls...)
+}
+
+func fail(err error) func(ctx context.Context) error {
+	return func(ctx context.Context) error { return err }
+}
+
+func newRelayTest(t *testing.T, bodies ...string) (outbox.Store, *fakeBroker, rest_service.RestService) {
+	t.Helper()
+
+	store := outbox.NewMemoryStore()
+	for _, body := range bodies {
+		err := store.Add(context.Background(), outbox.Message{Exchange: "document-exchange", RoutingKey: "in-routing-key", Body: []byte(body)})
+		if err != nil {
+			t.Fatalf("failed to add message: %v", err)
+		}
+	}
+
+	mq := &fakeBroker{replies: make(map[string][]func(ctx context.Context) error)}
+	service := rest_service.NewRestService(nil, storage.Buckets{}, mq, nil, store, nil, nil, core.ResumableConfig{})
+
+	return store, mq, service
+}
+
+func countCalls(calls []string, body string) int {
+	n := 0
+	for _, call := range calls {
+		if call == body {
+			n++
+		}
+	}
+	return n
+}
+
+// relayUntil повторяет разбор outbox, пока брокер не получит want публикаций. Неподтверждённые
+// сообщения откладываются минимум на секунду
+func relayUntil(t *testing.T, store outbox.Store, mq *fakeBroker, service rest_service.RestService, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mq.published()) < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d publications, got %v", want, mq.published())
+		}
+		time.Sleep(50 * time.Millisecond)
+		relay(context.Background(), store, service)
+	}
+}
+
+func TestRelay_DeletesOnlyConfirmed(t *testing.T) {
+	store, mq, service := newRelayTest(t, "confirmed", "nacked", "unroutable")
+	mq.replies["nacked"] = append(mq.replies["nacked"], fail(broker.ErrNacked))
+	mq.replies["unroutable"] = append(mq.replies["unroutable"], fail(broker.ErrUnroutable))
+
+	relay(context.Background(), store, service)
+	if calls := mq.published(); len(calls) != 3 {
+		t.Fatalf("expected every message to be published once, got %v", calls)
+	}
+
+	// Подтверждённое сообщение удалено, а неподтверждённые ждут повтора и сразу не публикуются
+	relay(context.Background(), store, service)
+	if calls := mq.published(); len(calls) != 3 {
+		t.Fatalf("unexpected publications before the retry delay: %v", calls)
+	}
+
+	relayUntil(t, store, mq, service, 5)
+	calls := mq.published()
+	if countCalls(calls, "confirmed") != 1 || countCalls(calls, "nacked") != 2 || countCalls(calls, "unroutable") != 2 {
+		t.Fatalf("unexpected publications: %v", calls)
+	}
+
+	// Повтор подтверждён, больше сообщений в outbox нет
+	relay(context.Background(), store, service)
+	if calls := mq.published(); len(calls) != 5 {
+		t.Fatalf("confirmed messages were published again: %v", calls)
+	}
+}
+
+func TestRelay_KeepsMessageUntilConfirm(t *testing.T) {
+	store, mq, service := newRelayTest(t, "slow")
+
+	// Брокер принял сообщение, но подтверждение так и не пришло
+	started := make(chan struct{})
+	release := make(chan struct{})
+	mq.replies["slow"] = append(mq.replies["slow"], func(ctx context.Context) error {
+		close(started)
+		<-release
+		return context.DeadlineExceeded
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		relay(context.Background(), store, service)
+	}()
+	<-started
+
+	// Пока первая публикация ждёт подтверждения, другой ретранслятор сообщение не трогает
+	relay(context.Background(), store, service)
+	if calls := mq.published(); len(calls) != 1 {
+		t.Fatalf("message published while waiting for confirm: %v", calls)
+	}
+
+	close(release)
+	<-done
+
+	// Без подтверждения сообщение осталось в outbox и публикуется снова
+	relayUntil(t, store, mq, service, 2)
+	relay(context.Background(), store, service)
+	if calls := mq.published(); len(calls) != 2 {
+		t.Fatalf("expected exactly one redelivery, got %v", calls)
+	}
+}
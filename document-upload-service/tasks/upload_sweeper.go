@@ -0,0 +1,44 @@
+package tasks
+
+import (
+	"context"
+	rest_service "document-upload-service/usecases/upload_service"
+	"log"
+	"time"
+)
+
+// sweepBatch сколько просроченных загрузок отменять за один проход
+const sweepBatch = 100
+
+// StartUploadSweeper отменяет загрузки частями, следующая часть которых не пришла в срок,
+// и удаляет их части из хранилища, пока не отменят контекст
+func StartUploadSweeper(ctx context.Context, interval time.Duration, restService rest_service.RestService) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sweepUploads(ctx, restService)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweepUploads разбирает просроченные загрузки пачками, пока они не закончатся
+func sweepUploads(ctx context.Context, restService rest_service.RestService) {
+	for {
+		aborted, err := restService.AbortExpiredUploads(ctx, sweepBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to abort expired uploads: %v", err)
+			}
+			return
+		}
+		if aborted < sweepBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package rest_service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/outbox"
+	"gitlab.com/docshade/common/resumable"
+	"gitlab.com/docshade/common/storage"
+)
+
+// fakeOutbox считает пробуждения ретранслятора
+type fakeOutbox struct {
+	outbox.Store
+	wakeups atomic.Int32
+}
+
+func (o *fakeOutbox) Wake() {
+	o.wakeups.Add(1)
+}
+
+// blockingReader сообщает о первом чтении и ждёт разрешения продолжить
+type blockingReader struct {
+	r       io.Reader
+	started chan struct{}
+	release chan struct{}
+	once    bool
+}
+
+func (b *blockingReader) Read(p []byte) (int, error) {
+	if !b.once {
+		b.once = true
+		close(b.started)
+		<-b.release
+	}
+	return b.r.Read(p)
+}
+
+func newChunkService(t *testing.T) (*restService, *fakeOutbox, context.Context) {
+	t.Helper()
+
+	ctx := context.Background()
+	cfg := core.S3Config{Driver: storage.DriverLocal, LocalPath: t.TempDir()}
+	store, err := storage.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	buckets := storage.NewBuckets(cfg)
+	if err := store.Init(ctx, buckets.Incoming, buckets.Processed); err != nil {
+		t.Fatalf("failed to init storage: %v", err)
+	}
+
+	relay := &fakeOutbox{}
+	return &restService{
+		storage:   store,
+		buckets:   buckets,
+		jobs:      jobs.NewMemoryRepository(),
+		outbox:    relay,
+		uploads:   resumable.NewMemoryStore(),
+		uploadCfg: core.ResumableConfig{UploadTTL: time.Hour},
+	}, relay, ctx
+}
+
+// pdfDocument документ из двух частей: первая минимального размера, вторая последняя
+func pdfDocument(t *testing.T) []byte {
+	t.Helper()
+
+	doc := make([]byte, storage.MinPartSize+1000)
+	if _, err := rand.Read(doc); err != nil {
+		t.Fatalf("failed to generate document: %v", err)
+	}
+	copy(doc, "%PDF-1.7\n")
+
+	return doc
+}
+
+func createUpload(t *testing.T, r *restService, ctx context.Context, id string, length int) {
+	t.Helper()
+
+	_, err := r.CreateUpload(ctx, resumable.Upload{
+		ID:         id,
+		SessionID:  "session-1",
+		DocumentID: "doc-" + id,
+		FileName:   "report.pdf",
+		Length:     int64(length),
+	})
+	if err != nil {
+		t.Fatalf("failed to create upload: %v", err)
+	}
+}
+
+func TestUploadChunk_WrongOffset(t *testing.T) {
+	r, _, ctx := newChunkService(t)
+	doc := pdfDocument(t)
+	createUpload(t, r, ctx, "1", len(doc))
+
+	if _, err := r.UploadChunk(ctx, "1", storage.MinPartSize, bytes.NewReader(doc[storage.MinPartSize:]), 1000); !errors.Is(err, resumable.ErrOffsetMismatch) {
+		t.Fatalf("expected offset mismatch before the first chunk, got %v", err)
+	}
+
+	first := doc[:storage.MinPartSize]
+	if _, err := r.UploadChunk(ctx, "1", 0, bytes.NewReader(first), int64(len(first))); err != nil {
+		t.Fatalf("failed to upload first chunk: %v", err)
+	}
+
+	// Повтор уже принятой части отклоняется и не сдвигает загрузку
+	if _, err := r.UploadChunk(ctx, "1", 0, bytes.NewReader(first), int64(len(first))); !errors.Is(err, resumable.ErrOffsetMismatch) {
+		t.Fatalf("expected offset mismatch for a repeated chunk, got %v", err)
+	}
+	upload, err := r.GetUpload(ctx, "1")
+	if err != nil {
+		t.Fatalf("failed to get upload: %v", err)
+	}
+	if upload.Offset != storage.MinPartSize || len(upload.Parts) != 1 {
+		t.Fatalf("unexpected upload state: offset %d, %d parts", upload.Offset, len(upload.Parts))
+	}
+}
+
+func TestUploadChunk_ResumedChecksum(t *testing.T) {
+	r, _, ctx := newChunkService(t)
+	doc := pdfDocument(t)
+	expected := sha256.Sum256(doc)
+
+	// Документ одной частью
+	createUpload(t, r, ctx, "whole", len(doc))
+	whole, err := r.UploadChunk(ctx, "whole", 0, bytes.NewReader(doc), int64(len(doc)))
+	if err != nil {
+		t.Fatalf("failed to upload document: %v", err)
+	}
+
+	// Тот же документ двумя частями, вторую принимает другой экземпляр сервиса
+	createUpload(t, r, ctx, "chunked", len(doc))
+	if _, err := r.UploadChunk(ctx, "chunked", 0, bytes.NewReader(doc[:storage.MinPartSize]), storage.MinPartSize); err != nil {
+		t.Fatalf("failed to upload first chunk: %v", err)
+	}
+	resumed := *r
+	chunked, err := resumed.UploadChunk(ctx, "chunked", storage.MinPartSize, bytes.NewReader(doc[storage.MinPartSize:]), 1000)
+	if err != nil {
+		t.Fatalf("failed to upload last chunk: %v", err)
+	}
+
+	if whole.SHA256 != hex.EncodeToString(expected[:]) || chunked.SHA256 != whole.SHA256 {
+		t.Fatalf("checksums differ: one-shot %s, resumed %s", whole.SHA256, chunked.SHA256)
+	}
+}
+
+func TestUploadChunk_Concurrent(t *testing.T) {
+	r, _, ctx := newChunkService(t)
+	doc := pdfDocument(t)
+	createUpload(t, r, ctx, "1", len(doc))
+
+	first := doc[:storage.MinPartSize]
+	slow := &blockingReader{r: bytes.NewReader(first), started: make(chan struct{}), release: make(chan struct{})}
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.UploadChunk(ctx, "1", 0, slow, int64(len(first)))
+		done <- err
+	}()
+	<-slow.started
+
+	// Пока первая часть принимается, второй запрос с тем же смещением получает отказ
+	if _, err := r.UploadChunk(ctx, "1", 0, bytes.NewReader(first), int64(len(first))); !errors.Is(err, resumable.ErrLocked) {
+		t.Fatalf("expected locked upload, got %v", err)
+	}
+
+	close(slow.release)
+	if err := <-done; err != nil {
+		t.Fatalf("failed to upload first chunk: %v", err)
+	}
+
+	upload, err := r.GetUpload(ctx, "1")
+	if err != nil {
+		t.Fatalf("failed to get upload: %v", err)
+	}
+	if upload.Offset != storage.MinPartSize || len(upload.Parts) != 1 {
+		t.Fatalf("unexpected upload state: offset %d, %d parts", upload.Offset, len(upload.Parts))
+	}
+}
+
+func TestUploadChunk_Enqueue(t *testing.T) {
+	r, relay, ctx := newChunkService(t)
+	doc := pdfDocument(t)
+	createUpload(t, r, ctx, "1", len(doc))
+
+	upload, err := r.UploadChunk(ctx, "1", 0, bytes.NewReader(doc[:storage.MinPartSize]), storage.MinPartSize)
+	if err != nil {
+		t.Fatalf("failed to upload first chunk: %v", err)
+	}
+	if _, err := r.jobs.Get(ctx, upload.DocumentID); !errors.Is(err, jobs.ErrNotFound) {
+		t.Fatalf("document must not be queued before the last chunk, got %v", err)
+	}
+
+	upload, err = r.UploadChunk(ctx, "1", storage.MinPartSize, bytes.NewReader(doc[storage.MinPartSize:]), 1000)
+	if err != nil {
+		t.Fatalf("failed to upload last chunk: %v", err)
+	}
+
+	job, err := r.jobs.Get(ctx, upload.DocumentID)
+	if err != nil {
+		t.Fatalf("document is not registered: %v", err)
+	}
+	if job.Status != jobs.StatusQueued || job.SessionID != "session-1" || job.Format != formats.PDF.Name {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if relay.wakeups.Load() != 1 {
+		t.Fatalf("expected the outbox relay to be woken once, got %d", relay.wakeups.Load())
+	}
+	if _, err := r.GetUpload(ctx, "1"); !errors.Is(err, resumable.ErrNotFound) {
+		t.Fatalf("finished upload must be deleted, got %v", err)
+	}
+
+	// Собранный документ лежит под постоянным ключом вместе с контрольной суммой
+	key := formats.PDF.ObjectKey(upload.DocumentID)
+	info, err := r.storage.Stat(ctx, r.buckets.Incoming, key)
+	if err != nil {
+		t.Fatalf("failed to stat document: %v", err)
+	}
+	if storage.Checksum(info) != upload.SHA256 {
+		t.Fatalf("stored checksum %q, expected %q", storage.Checksum(info), upload.SHA256)
+	}
+	object, err := r.storage.Get(ctx, r.buckets.Incoming, key)
+	if err != nil {
+		t.Fatalf("failed to get document: %v", err)
+	}
+	defer object.Close()
+	stored, err := io.ReadAll(object)
+	if err != nil {
+		t.Fatalf("failed to read document: %v", err)
+	}
+	if !bytes.Equal(stored, doc) {
+		t.Fatalf("stored document differs")
+	}
+}
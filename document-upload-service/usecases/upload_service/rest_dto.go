@@ -1,22 +1,46 @@
 package rest_service
 
-import "context"
+import (
+	"context"
+	"io"
+
+	"gitlab.com/docshade/common/broker"
+	"gitlab.com/docshade/common/formats"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/storage"
+)
 
 type RestServiceRabbitMQ interface {
 	// PublishMessage публикация сообщения в RabbitMQ
 	PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) error
+	// State состояние соединения с RabbitMQ
+	State() broker.State
+}
+
+type RestServiceStorage interface {
+	// Put сохраняет файл в хранилище потоком, size равен -1, если размер заранее неизвестен
+	Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts storage.PutOptions) error
 }
 
-type RestServices3Service interface {
-	// Put загружает файл в S3
-	Put(ctx context.Context, objectName, path string, objectBody []byte, metaData map[string]string) error
-	// IsObjectExist проверяет, существует ли объект в S3
-	IsObjectExist(ctx context.Context, path, objectName string) (bool, error)
+// Document загружаемый документ
+type Document struct {
+	SessionID        string
+	DocumentID       string
+	OriginalFileName string
+	Format           formats.Format
+	// BatchID пакет, в составе которого загружен документ, пустой для одиночной загрузки
+	BatchID string
+	// Callback куда отправить итог обработки, может быть nil
+	Callback *messaging.Callback
+	// SHA256 контрольная сумма сохранённого документа в hex
+	SHA256 string
 }
 
 // HealthDtoOut Output DTO for Health Method
 type HealthDtoOut struct {
 	Message string
+	// RabbitMQ состояние соединения с брокером
+	RabbitMQ broker.State
 }
 
 // HealthDtoIn Input DTO for Health Method
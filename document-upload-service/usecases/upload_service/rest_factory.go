@@ -2,7 +2,13 @@ package rest_service
 
 import (
 	"document-upload-service/providers/rabbitmq_provider"
-	"document-upload-service/providers/s3_provider"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/outbox"
+	"gitlab.com/docshade/common/resumable"
+	"gitlab.com/docshade/common/session"
+	"gitlab.com/docshade/common/storage"
 )
 
 type RestServiceFactory interface {
@@ -11,25 +17,44 @@ type RestServiceFactory interface {
 
 type restServiceFactory struct {
 	rabbitmq rabbitmq_provider.RabbitMQ
-	s3       s3_provider.S3
+	storage  storage.Storage
+	buckets  storage.Buckets
+	jobs     jobs.Repository
+	outbox   outbox.Store
+	sessions *session.Signer
+	uploads  resumable.Store
+	// uploadCfg сроки загрузок частями и прямых загрузок
+	uploadCfg core.ResumableConfig
 }
 
 // NewRestFactory получить новый экземпляр фабрики сервисов
-func NewRestFactory(rabbitmq rabbitmq_provider.RabbitMQ, s3 s3_provider.S3) RestServiceFactory {
+func NewRestFactory(rabbitmq rabbitmq_provider.RabbitMQ, store storage.Storage, buckets storage.Buckets, jobs jobs.Repository, outbox outbox.Store, sessions *session.Signer, uploads resumable.Store, uploadCfg core.ResumableConfig) RestServiceFactory {
 	return &restServiceFactory{
-		rabbitmq: rabbitmq,
-		s3:       s3,
+		rabbitmq:  rabbitmq,
+		storage:   store,
+		buckets:   buckets,
+		jobs:      jobs,
+		outbox:    outbox,
+		sessions:  sessions,
+		uploads:   uploads,
+		uploadCfg: uploadCfg,
 	}
 }
 
 // GetService получить новых экземпляр сервиса
 func (c *restServiceFactory) GetService() RestService {
-	return newRestService(c.rabbitmq, c.s3)
+	return newRestService(c.rabbitmq, c.storage, c.buckets, c.jobs, c.outbox, c.sessions, c.uploads, c.uploadCfg)
 }
 
-func newRestService(rabbitmq rabbitmq_provider.RabbitMQ, s3 s3_provider.S3) RestService {
+func newRestService(rabbitmq rabbitmq_provider.RabbitMQ, store storage.Storage, buckets storage.Buckets, jobs jobs.Repository, outbox outbox.Store, sessions *session.Signer, uploads resumable.Store, uploadCfg core.ResumableConfig) RestService {
 	return &restService{
 		rabbitmq:  rabbitmq,
-		s3Service: s3,
+		storage:   store,
+		buckets:   buckets,
+		jobs:      jobs,
+		outbox:    outbox,
+		sessions:  sessions,
+		uploads:   uploads,
+		uploadCfg: uploadCfg,
 	}
 }
@@ -0,0 +1,15 @@
+package rest_service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/docshade/common/metrics"
+)
+
+var uploadSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "upload",
+	Name:      "document_size_bytes",
+	Help:      "Size of stored uploaded documents, by format.",
+	Buckets:   metrics.SizeBuckets,
+}, []string{"format"})
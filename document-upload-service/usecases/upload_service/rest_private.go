@@ -1 +1,303 @@
 package rest_service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"time"
+
+	"gitlab.com/docshade/common/formats"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/outbox"
+	"gitlab.com/docshade/common/resumable"
+	"gitlab.com/docshade/common/storage"
+	"gitlab.com/docshade/common/tracing"
+)
+
+// queueEntry состояние сохранённого документа и сообщение о его загрузке для outbox
+func (r *restService) queueEntry(ctx context.Context, doc Document) (jobs.Job, outbox.Message, error) {
+	message, err := messaging.Encode(&messaging.DocumentUploaded{
+		SessionID:        doc.SessionID,
+		DocumentID:       doc.DocumentID,
+		Bucket:           r.buckets.Incoming,
+		ObjectKey:        doc.Format.ObjectKey(doc.DocumentID),
+		OriginalFileName: doc.OriginalFileName,
+		Format:           doc.Format.Name,
+		UploadedAt:       time.Now().UTC(),
+		Callback:         doc.Callback,
+		BatchID:          doc.BatchID,
+		SHA256:           doc.SHA256,
+	})
+	if err != nil {
+		return jobs.Job{}, outbox.Message{}, errors.New("failed to create message: " + err.Error())
+	}
+
+	headers := map[string]interface{}{}
+	tracing.InjectHeaders(ctx, headers)
+
+	job := jobs.Job{
+		DocumentID:       doc.DocumentID,
+		SessionID:        doc.SessionID,
+		OriginalFileName: doc.OriginalFileName,
+		Format:           doc.Format.Name,
+		BatchID:          doc.BatchID,
+		Status:           jobs.StatusQueued,
+	}
+
+	return job, outbox.Message{
+		Exchange:   "document-exchange",
+		RoutingKey: "in-routing-key",
+		Body:       message,
+		Headers:    headers,
+	}, nil
+}
+
+// chunkLockTTL сколько загрузка остаётся за запросом, принимающим часть. Блокировку снимает
+// сам запрос, срок нужен только если экземпляр сервиса упал посреди части
+const chunkLockTTL = 15 * time.Minute
+
+// directPrefix префикс промежуточных ключей прямой загрузки в бакете входящих документов
+const directPrefix = "direct/"
+
+// storeChunk загружает часть в хранилище и возвращает загрузку с новым смещением.
+// Формат определяется по первой части, с ней же начинается загрузка объекта в хранилище.
+// Части проходят через SHA-256, и после последней части в загрузке остаётся сумма всего документа
+func (r *restService) storeChunk(ctx context.Context, uploader storage.MultipartUploader, upload resumable.Upload, chunk io.Reader, size int64) (resumable.Upload, error) {
+	if upload.ObjectKey != "" {
+		return upload, resumable.ErrUploadMode
+	}
+	if upload.Offset+size > upload.Length {
+		return upload, resumable.ErrLengthExceeded
+	}
+	last := upload.Offset+size == upload.Length
+	if err := storage.ValidatePart(upload.Offset, size, last); err != nil {
+		return upload, err
+	}
+
+	hash, err := chunkHash(upload)
+	if err != nil {
+		return upload, err
+	}
+	if hash != nil {
+		chunk = io.TeeReader(chunk, hash)
+	}
+
+	created := false
+	if upload.Offset == 0 {
+		format, body, err := formats.Sniff(chunk)
+		if err != nil {
+			return upload, err
+		}
+		chunk = body
+
+		upload.Format = format.Name
+		upload.Parts = nil
+		upload.Multipart, err = uploader.CreateMultipart(ctx, r.buckets.Incoming, format.ObjectKey(upload.DocumentID), storage.PutOptions{ContentType: format.MediaType})
+		if err != nil {
+			return upload, fmt.Errorf("failed to start upload to storage: %w", err)
+		}
+		created = true
+	}
+
+	part, err := uploader.UploadPart(ctx, upload.Multipart, len(upload.Parts)+1, upload.Offset, chunk, size, last)
+	if err != nil {
+		// Загрузку, начатую этим запросом, больше никто не продолжит
+		if created {
+			if abortErr := uploader.AbortMultipart(context.WithoutCancel(ctx), upload.Multipart); abortErr != nil {
+				log.Printf("Failed to abort storage upload of document %s: %v", upload.DocumentID, abortErr)
+			}
+		}
+		return upload, fmt.Errorf("failed to upload chunk to storage: %w", err)
+	}
+
+	upload.Parts = append(upload.Parts, part)
+	upload.Offset += size
+	if hash != nil {
+		upload.HashState, err = hash.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return upload, fmt.Errorf("failed to save upload checksum: %w", err)
+		}
+		if last {
+			upload.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		}
+	}
+	upload.ExpiresAt = time.Now().UTC().Add(r.uploadCfg.UploadTTL)
+
+	return upload, nil
+}
+
+// chunkHash SHA-256 уже принятых частей загрузки. Загрузки, начатые до подсчёта контрольных сумм,
+// продолжаются без неё, для них возвращается nil
+func chunkHash(upload resumable.Upload) (hash.Hash, error) {
+	h := sha256.New()
+	if upload.Offset == 0 {
+		return h, nil
+	}
+	if len(upload.HashState) == 0 {
+		return nil, nil
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(upload.HashState); err != nil {
+		return nil, fmt.Errorf("failed to restore upload checksum: %w", err)
+	}
+
+	return h, nil
+}
+
+// finishUpload собирает документ из частей, ставит его в очередь и удаляет состояние загрузки.
+// Если постановка не удалась, собранный объект удалит очистка по сроку хранения
+func (r *restService) finishUpload(ctx context.Context, uploader storage.MultipartUploader, upload resumable.Upload) error {
+	format, ok := formats.ByName(upload.Format)
+	if !ok {
+		return fmt.Errorf("%w: %s", formats.ErrUnsupported, upload.Format)
+	}
+
+	err := uploader.CompleteMultipart(ctx, upload.Multipart, upload.Parts)
+	if err != nil {
+		return fmt.Errorf("failed to complete upload to storage: %w", err)
+	}
+	// Сумма известна только после последней части, а метаданные задаются при создании загрузки
+	if upload.SHA256 != "" {
+		err = storage.SetChecksum(ctx, r.storage, upload.Multipart.Bucket, upload.Multipart.Key, upload.SHA256)
+		if err != nil {
+			return fmt.Errorf("failed to save document checksum: %w", err)
+		}
+	}
+	uploadSize.WithLabelValues(format.Name).Observe(float64(upload.Length))
+
+	job, msg, err := r.queueEntry(ctx, Document{
+		SessionID:        upload.SessionID,
+		DocumentID:       upload.DocumentID,
+		OriginalFileName: upload.FileName,
+		Format:           format,
+		Callback:         upload.Callback,
+		SHA256:           upload.SHA256,
+	})
+	if err != nil {
+		return err
+	}
+	err = r.jobs.Enqueue(ctx, job, msg)
+	if err != nil {
+		return fmt.Errorf("failed to register document: %w", err)
+	}
+	r.outbox.Wake()
+
+	// Оставшееся состояние уберёт очистка просроченных загрузок, отмена собранной загрузки ничего не удалит
+	if err := r.uploads.Delete(ctx, upload.ID); err != nil {
+		log.Printf("Failed to delete finished upload %s: %v", upload.ID, err)
+	}
+
+	return nil
+}
+
+// directObjectKey промежуточный ключ документа, который клиент загружает напрямую
+func directObjectKey(documentID string) string {
+	return directPrefix + documentID
+}
+
+// finishDirectUpload проверяет документ, загруженный клиентом, переносит его под постоянный ключ,
+// ставит в очередь и удаляет состояние загрузки. Размер сверяется по сведениям хранилища,
+// а для контрольной суммы документ читается целиком
+func (r *restService) finishDirectUpload(ctx context.Context, upload resumable.Upload) (resumable.Upload, error) {
+	info, err := r.storage.Stat(ctx, r.buckets.Incoming, upload.ObjectKey)
+	if err != nil {
+		return upload, fmt.Errorf("failed to find uploaded document: %w", err)
+	}
+	if info.Size != upload.Length {
+		return upload, fmt.Errorf("%w: declared %d bytes, uploaded %d", ErrSizeMismatch, upload.Length, info.Size)
+	}
+
+	format, sum, err := r.verifyDirectUpload(ctx, upload)
+	if err != nil {
+		return upload, err
+	}
+	upload.Format = format.Name
+	upload.SHA256 = sum
+	upload.Offset = info.Size
+
+	key := format.ObjectKey(upload.DocumentID)
+	if err := storage.CopyWithChecksum(ctx, r.storage, r.buckets.Incoming, upload.ObjectKey, r.buckets.Incoming, key, sum); err != nil {
+		return upload, fmt.Errorf("failed to move uploaded document: %w", err)
+	}
+	uploadSize.WithLabelValues(format.Name).Observe(float64(info.Size))
+
+	job, msg, err := r.queueEntry(ctx, Document{
+		SessionID:        upload.SessionID,
+		DocumentID:       upload.DocumentID,
+		OriginalFileName: upload.FileName,
+		Format:           format,
+		Callback:         upload.Callback,
+		SHA256:           sum,
+	})
+	if err != nil {
+		return upload, err
+	}
+	err = r.jobs.Enqueue(ctx, job, msg)
+	if err != nil {
+		return upload, fmt.Errorf("failed to register document: %w", err)
+	}
+	r.outbox.Wake()
+
+	// Промежуточный объект удаляется только после постановки в очередь, чтобы завершение можно было повторить.
+	// Оставшийся объект удалит очистка по сроку хранения
+	if err := r.storage.Delete(ctx, r.buckets.Incoming, upload.ObjectKey); err != nil {
+		log.Printf("Failed to delete staged document %s: %v", upload.ObjectKey, err)
+	}
+	if err := r.uploads.Delete(ctx, upload.ID); err != nil {
+		log.Printf("Failed to delete finished upload %s: %v", upload.ID, err)
+	}
+
+	return upload, nil
+}
+
+// verifyDirectUpload определяет формат загруженного документа и считает его контрольную сумму.
+// Если клиент заявил сумму, она сверяется с посчитанной
+func (r *restService) verifyDirectUpload(ctx context.Context, upload resumable.Upload) (formats.Format, string, error) {
+	object, err := r.storage.Get(ctx, r.buckets.Incoming, upload.ObjectKey)
+	if err != nil {
+		return formats.Format{}, "", fmt.Errorf("failed to read uploaded document: %w", err)
+	}
+	defer object.Close()
+
+	format, body, err := formats.Sniff(object)
+	if err != nil {
+		return formats.Format{}, "", err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return formats.Format{}, "", fmt.Errorf("failed to read uploaded document: %w", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if upload.SHA256 != "" && sum != upload.SHA256 {
+		return formats.Format{}, "", ErrChecksumMismatch
+	}
+
+	return format, sum, nil
+}
+
+// abortUpload отменяет загрузку объекта в хранилище и удаляет состояние загрузки
+func (r *restService) abortUpload(ctx context.Context, upload resumable.Upload) error {
+	if upload.ObjectKey != "" {
+		if err := r.storage.Delete(ctx, r.buckets.Incoming, upload.ObjectKey); err != nil {
+			return fmt.Errorf("failed to delete staged document: %w", err)
+		}
+	}
+	if upload.Multipart.ID != "" {
+		uploader, ok := r.storage.(storage.MultipartUploader)
+		if !ok {
+			return storage.ErrMultipartUnsupported
+		}
+		if err := uploader.AbortMultipart(ctx, upload.Multipart); err != nil {
+			return fmt.Errorf("failed to abort storage upload: %w", err)
+		}
+	}
+
+	return r.uploads.Delete(ctx, upload.ID)
+}
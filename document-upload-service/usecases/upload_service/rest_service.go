@@ -2,61 +2,314 @@ package rest_service
 
 import (
 	"context"
+	"crypto/sha256"
 	"document-upload-service/providers/rabbitmq_provider"
-	"document-upload-service/providers/s3_provider"
-	"encoding/json"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/outbox"
+	"gitlab.com/docshade/common/resumable"
+	"gitlab.com/docshade/common/session"
+	"gitlab.com/docshade/common/storage"
+	"gitlab.com/docshade/common/tracing"
 )
 
 type RestService interface {
 	GetHealth(ctx context.Context, data HealthDtoIn) (HealthDtoOut, error)
-	UploadDocument(ctx context.Context, sessionID, documentID, originalFileName string, fileData []byte) error
+	// UploadDocument сохраняет документ и ставит его в очередь на анонимизацию
+	UploadDocument(ctx context.Context, doc Document, file io.Reader) error
+	// StoreDocument сохраняет документ, не ставя его в очередь. Возвращает документ с контрольной суммой
+	StoreDocument(ctx context.Context, doc Document, file io.Reader) (Document, error)
+	// EnqueueBatch регистрирует пакет сохранённых документов и ставит их в очередь одной транзакцией
+	EnqueueBatch(ctx context.Context, sessionID, batchID string, docs []Document) error
+	// PublishOutboxMessage публикует сообщение из outbox, продолжая трассировку загрузки
+	PublishOutboxMessage(ctx context.Context, msg outbox.Message) error
+	// IssueSessionToken выдаёт токен, с которым клиент подписывается на уведомления сессии
+	IssueSessionToken(sessionID string) (string, time.Time)
+	// CreateUpload начинает загрузку документа частями, upload.Length заявленный размер документа
+	CreateUpload(ctx context.Context, upload resumable.Upload) (resumable.Upload, error)
+	// GetUpload получить состояние загрузки частями
+	GetUpload(ctx context.Context, id string) (resumable.Upload, error)
+	// UploadChunk принимает часть размером size, начинающуюся с offset. После последней части документ
+	// собирается в хранилище и ставится в очередь на анонимизацию
+	UploadChunk(ctx context.Context, id string, offset int64, chunk io.Reader, size int64) (resumable.Upload, error)
+	// TerminateUpload отменить загрузку частями вместе с уже загруженными частями
+	TerminateUpload(ctx context.Context, id string) error
+	// AbortExpiredUploads отменить до limit загрузок, следующая часть которых не пришла в срок
+	AbortExpiredUploads(ctx context.Context, limit int) (int, error)
+	// PresignUpload начинает прямую загрузку: документ размером upload.Length клиент отправляет
+	// в хранилище сам по возвращённой ссылке. Возвращает загрузку, ссылку и срок её действия
+	PresignUpload(ctx context.Context, upload resumable.Upload) (resumable.Upload, string, time.Time, error)
+	// CompleteUpload проверяет размер и контрольную сумму документа, загруженного напрямую,
+	// и ставит его в очередь на анонимизацию
+	CompleteUpload(ctx context.Context, id string) (resumable.Upload, error)
 }
 
+var (
+	// ErrSizeMismatch размер загруженного документа не совпадает с заявленным
+	ErrSizeMismatch = errors.New("uploaded document size does not match the declared size")
+	// ErrChecksumMismatch контрольная сумма загруженного документа не совпадает с заявленной
+	ErrChecksumMismatch = errors.New("uploaded document checksum does not match the declared checksum")
+)
+
 type restService struct {
-	s3Service s3_provider.S3
-	rabbitmq  rabbitmq_provider.RabbitMQ
+	storage  storage.Storage
+	buckets  storage.Buckets
+	rabbitmq rabbitmq_provider.RabbitMQ
+	jobs     jobs.Repository
+	outbox   outbox.Store
+	sessions *session.Signer
+	uploads  resumable.Store
+	// uploadCfg сроки загрузок частями и прямых загрузок
+	uploadCfg core.ResumableConfig
 }
 
 // NewRestService конструктор сервиса работы с файлами
-func NewRestService(s3Service s3_provider.S3, rabbitmq rabbitmq_provider.RabbitMQ) RestService {
+func NewRestService(store storage.Storage, buckets storage.Buckets, rabbitmq rabbitmq_provider.RabbitMQ, jobs jobs.Repository, outbox outbox.Store, sessions *session.Signer, uploads resumable.Store, uploadCfg core.ResumableConfig) RestService {
 	return &restService{
-		s3Service: s3Service,
+		storage:   store,
+		buckets:   buckets,
 		rabbitmq:  rabbitmq,
+		jobs:      jobs,
+		outbox:    outbox,
+		sessions:  sessions,
+		uploads:   uploads,
+		uploadCfg: uploadCfg,
 	}
 }
 
 func (r *restService) GetHealth(ctx context.Context, data HealthDtoIn) (HealthDtoOut, error) {
-	return HealthDtoOut{Message: "hello " + data.Message}, nil
+	return HealthDtoOut{Message: "hello " + data.Message, RabbitMQ: r.rabbitmq.State()}, nil
+}
+
+func (r *restService) UploadDocument(ctx context.Context, doc Document, file io.Reader) error {
+	doc, err := r.StoreDocument(ctx, doc, file)
+	if err != nil {
+		return err
+	}
+
+	// Документ регистрируется вместе с сообщением, публикует его ретранслятор outbox.
+	// Если запись не удалась, загруженный объект удалит очистка по сроку хранения
+	job, msg, err := r.queueEntry(ctx, doc)
+	if err != nil {
+		return err
+	}
+	err = r.jobs.Enqueue(ctx, job, msg)
+	if err != nil {
+		return fmt.Errorf("failed to register document: %w", err)
+	}
+	r.outbox.Wake()
+
+	return nil
+}
+
+// StoreDocument записывает документ в хранилище потоком и считает его контрольную сумму по пути.
+// Сумма становится известна только после записи, поэтому добавляется в метаданные уже сохранённого объекта
+func (r *restService) StoreDocument(ctx context.Context, doc Document, file io.Reader) (Document, error) {
+	hash := sha256.New()
+	var size byteCounter
+	key := doc.Format.ObjectKey(doc.DocumentID)
+
+	err := r.storage.Put(ctx, r.buckets.Incoming, key, io.TeeReader(file, io.MultiWriter(hash, &size)), -1, storage.PutOptions{
+		ContentType: doc.Format.MediaType,
+	})
+	if err != nil {
+		return doc, fmt.Errorf("failed to upload file to storage: %w", err)
+	}
+	doc.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	// Объект без суммы в очередь не попадёт, его удалит очистка по сроку хранения
+	if err := storage.SetChecksum(ctx, r.storage, r.buckets.Incoming, key, doc.SHA256); err != nil {
+		return doc, fmt.Errorf("failed to save document checksum: %w", err)
+	}
+	uploadSize.WithLabelValues(doc.Format.Name).Observe(float64(size))
+
+	return doc, nil
+}
+
+// byteCounter считает записанные в него байты
+type byteCounter int64
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	*c += byteCounter(len(p))
+	return len(p), nil
+}
+
+// EnqueueBatch ставит документы в очередь только после сохранения всех файлов пакета:
+// так число документов известно заранее и обработка не начнётся для пакета, загрузка которого оборвалась
+func (r *restService) EnqueueBatch(ctx context.Context, sessionID, batchID string, docs []Document) error {
+	jobList := make([]jobs.Job, 0, len(docs))
+	messages := make([]outbox.Message, 0, len(docs))
+	for _, doc := range docs {
+		job, msg, err := r.queueEntry(ctx, doc)
+		if err != nil {
+			return err
+		}
+		jobList = append(jobList, job)
+		messages = append(messages, msg)
+	}
+
+	err := r.jobs.EnqueueBatch(ctx, jobs.Batch{ID: batchID, SessionID: sessionID, Total: len(docs)}, jobList, messages)
+	if err != nil {
+		return fmt.Errorf("failed to register batch: %w", err)
+	}
+	r.outbox.Wake()
+
+	return nil
+}
+
+func (r *restService) CreateUpload(ctx context.Context, upload resumable.Upload) (resumable.Upload, error) {
+	upload.CreatedAt = time.Now().UTC()
+	upload.ExpiresAt = upload.CreatedAt.Add(r.uploadCfg.UploadTTL)
+	if err := r.uploads.Create(ctx, upload); err != nil {
+		return resumable.Upload{}, fmt.Errorf("failed to create upload: %w", err)
+	}
+
+	return upload, nil
+}
+
+func (r *restService) GetUpload(ctx context.Context, id string) (resumable.Upload, error) {
+	return r.uploads.Get(ctx, id)
+}
+
+// UploadChunk принимает часть под блокировкой загрузки: параллельный запрос с тем же смещением
+// не перезапишет часть в хранилище. Часть, оборвавшаяся на середине, не сохраняется, и клиент
+// повторяет её целиком с прежнего смещения
+func (r *restService) UploadChunk(ctx context.Context, id string, offset int64, chunk io.Reader, size int64) (resumable.Upload, error) {
+	uploader, ok := r.storage.(storage.MultipartUploader)
+	if !ok {
+		return resumable.Upload{}, storage.ErrMultipartUnsupported
+	}
+
+	upload, token, err := r.uploads.Lock(ctx, id, offset, time.Now().Add(chunkLockTTL))
+	if err != nil {
+		return resumable.Upload{}, err
+	}
+
+	upload, err = r.storeChunk(ctx, uploader, upload, chunk, size)
+	if err == nil {
+		if upload.Offset < upload.Length {
+			return upload, r.uploads.Advance(ctx, upload, token)
+		}
+		err = r.finishUpload(ctx, uploader, upload)
+		if err == nil {
+			return upload, nil
+		}
+	}
+
+	if unlockErr := r.uploads.Unlock(context.WithoutCancel(ctx), id, token); unlockErr != nil {
+		log.Printf("Failed to unlock upload %s: %v", id, unlockErr)
+	}
+
+	return resumable.Upload{}, err
 }
 
-func (r *restService) UploadDocument(ctx context.Context, sessionID, documentID, originalFileName string, fileData []byte) error {
-	// Определяем путь в S3
-	bucket := "preprocessing"
-	objectName := documentID + ".pdf"
+func (r *restService) TerminateUpload(ctx context.Context, id string) error {
+	upload, err := r.uploads.Get(ctx, id)
+	if err != nil {
+		return err
+	}
 
-	// Загрузка файла в S3
-	err := r.s3Service.Put(ctx, objectName, bucket, fileData, nil)
+	upload, token, err := r.uploads.Lock(ctx, id, upload.Offset, time.Now().Add(chunkLockTTL))
 	if err != nil {
-		return errors.New("failed to upload file to S3: " + err.Error())
+		return err
 	}
 
-	// Создание сообщения для RabbitMQ
-	messageBody := map[string]interface{}{
-		"session_id":         sessionID,
-		"document_id":        documentID,
-		"s3_path":            bucket + "/" + objectName + ".pdf",
-		"original_file_name": originalFileName,
+	err = r.abortUpload(ctx, upload)
+	if err != nil {
+		if unlockErr := r.uploads.Unlock(context.WithoutCancel(ctx), id, token); unlockErr != nil {
+			log.Printf("Failed to unlock upload %s: %v", id, unlockErr)
+		}
+		return err
 	}
-	message, err := json.Marshal(messageBody)
+
+	return nil
+}
+
+// AbortExpiredUploads не берёт блокировку: просроченную загрузку уже нельзя продолжить,
+// а загрузки, часть которых ещё принимается, ListExpired не возвращает
+func (r *restService) AbortExpiredUploads(ctx context.Context, limit int) (int, error) {
+	expired, err := r.uploads.ListExpired(ctx, time.Now(), limit)
 	if err != nil {
-		return errors.New("failed to create message: " + err.Error())
+		return 0, err
 	}
 
-	// Публикация сообщения в RabbitMQ
-	err = r.rabbitmq.PublishMessage(ctx, "document-exchange", "in-routing-key", message)
+	for i, upload := range expired {
+		if err := r.abortUpload(ctx, upload); err != nil {
+			return i, err
+		}
+		log.Printf("Aborted expired upload %s of document %s at %d/%d bytes", upload.ID, upload.DocumentID, upload.Offset, upload.Length)
+	}
+
+	return len(expired), nil
+}
+
+// PresignUpload выдаёт ссылку на промежуточный ключ: формат станет известен только после загрузки,
+// и документ переносится под постоянный ключ при завершении
+func (r *restService) PresignUpload(ctx context.Context, upload resumable.Upload) (resumable.Upload, string, time.Time, error) {
+	presigner, ok := r.storage.(storage.PutPresigner)
+	if !ok {
+		return resumable.Upload{}, "", time.Time{}, storage.ErrDirectUploadUnsupported
+	}
+
+	upload.ObjectKey = directObjectKey(upload.DocumentID)
+	uploadURL, err := presigner.PresignPut(ctx, r.buckets.Incoming, upload.ObjectKey, r.uploadCfg.PresignTTL)
+	if err != nil {
+		return resumable.Upload{}, "", time.Time{}, fmt.Errorf("failed to presign upload: %w", err)
+	}
+	urlExpiresAt := time.Now().UTC().Add(r.uploadCfg.PresignTTL)
+
+	upload, err = r.CreateUpload(ctx, upload)
+	if err != nil {
+		return resumable.Upload{}, "", time.Time{}, err
+	}
+
+	return upload, uploadURL, urlExpiresAt, nil
+}
+
+func (r *restService) CompleteUpload(ctx context.Context, id string) (resumable.Upload, error) {
+	upload, err := r.uploads.Get(ctx, id)
+	if err != nil {
+		return resumable.Upload{}, err
+	}
+	if upload.ObjectKey == "" {
+		return resumable.Upload{}, resumable.ErrUploadMode
+	}
+
+	// Блокировка не даёт двум запросам поставить документ в очередь дважды
+	upload, token, err := r.uploads.Lock(ctx, id, upload.Offset, time.Now().Add(chunkLockTTL))
+	if err != nil {
+		return resumable.Upload{}, err
+	}
+
+	upload, err = r.finishDirectUpload(ctx, upload)
+	if err != nil {
+		if unlockErr := r.uploads.Unlock(context.WithoutCancel(ctx), id, token); unlockErr != nil {
+			log.Printf("Failed to unlock upload %s: %v", id, unlockErr)
+		}
+		return resumable.Upload{}, err
+	}
+
+	return upload, nil
+}
+
+func (r *restService) IssueSessionToken(sessionID string) (string, time.Time) {
+	return r.sessions.Issue(sessionID)
+}
+
+func (r *restService) PublishOutboxMessage(ctx context.Context, msg outbox.Message) error {
+	ctx = tracing.ExtractHeaders(ctx, msg.Headers)
+
+	err := r.rabbitmq.PublishMessage(ctx, msg.Exchange, msg.RoutingKey, msg.Body)
 	if err != nil {
-		return errors.New("failed to publish message to RabbitMQ: " + err.Error())
+		log.Printf("Failed to publish outbox message %d (attempt %d): %v", msg.ID, msg.Attempts+1, err)
+		return err
 	}
 
 	return nil
@@ -0,0 +1,92 @@
+package document_status
+
+import (
+	"errors"
+	"net/http"
+	notifi_service "notification-service/usecases/notifi_service"
+
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/jobs"
+
+	"gitlab.com/docshade/common/core"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	Route  = "/v1/documents/:document_id"
+	Method = httpUtils.GetMethod
+)
+
+type providerDocumentStatus interface {
+	GetNotifiServiceFactory() notifi_service.NotifiServiceFactory
+}
+
+type documentStatus struct {
+	method    httpUtils.Methods
+	route     string
+	providers providerDocumentStatus
+}
+
+// NewDocumentStatus get new object
+func NewDocumentStatus(
+	method httpUtils.Methods,
+	route string,
+	providers providerDocumentStatus,
+) core.Handler {
+	return &documentStatus{
+		method:    method,
+		route:     route,
+		providers: providers,
+	}
+}
+
+// GetMethod Get handler method
+func (h *documentStatus) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *documentStatus) GetRoute() string {
+	return h.route
+}
+
+// Do метод, который вызывается при обращении к ручке
+// @Summary      Получить состояние обработки документа
+// @Produce      json
+// @Param        document_id path string true "Идентификатор документа"
+// @Param        token query string true "Токен доступа к сессии"
+// @Success      200 {object} DtoOut
+// @Failure      401 {object} httpUtils.ErrorHttp
+// @Failure      404 {object} httpUtils.ErrorHttp
+// @Router       /v1/documents/{document_id} [get]
+func (h *documentStatus) Do(ctx echo.Context) error {
+	documentID := ctx.Param("document_id")
+
+	service := h.providers.GetNotifiServiceFactory().GetService()
+
+	status, err := service.GetDocumentStatus(ctx.Request().Context(), documentID)
+	if err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return httpUtils.ReturnNotFoundError(ctx, err, "Document not found")
+		}
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to get document status")
+	}
+
+	return ctx.JSON(http.StatusOK, prepareResponse(status))
+}
+
+func prepareResponse(data notifi_service.DocumentStatus) DtoOut {
+	return DtoOut{
+		DocumentID:       data.DocumentID,
+		SessionID:        data.SessionID,
+		OriginalFileName: data.OriginalFileName,
+		Format:           data.Format,
+		Status:           string(data.Status),
+		ErrorReason:      data.ErrorReason,
+		CreatedAt:        data.CreatedAt,
+		UpdatedAt:        data.UpdatedAt,
+		FinishedAt:       data.FinishedAt,
+		DownloadLink:     data.DownloadLink,
+	}
+}
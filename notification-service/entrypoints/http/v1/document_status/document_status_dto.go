@@ -0,0 +1,17 @@
+package document_status
+
+import "time"
+
+// DtoOut Output data
+type DtoOut struct {
+	DocumentID       string     `json:"document_id"`
+	SessionID        string     `json:"session_id"`
+	OriginalFileName string     `json:"original_file_name"`
+	Format           string     `json:"format"`
+	Status           string     `json:"status"`
+	ErrorReason      string     `json:"error_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+	DownloadLink     string     `json:"download_link,omitempty"`
+}
@@ -0,0 +1,87 @@
+package document_status
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	notifi_service "notification-service/usecases/notifi_service"
+	"testing"
+
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/jobs"
+
+	"github.com/labstack/echo/v4"
+)
+
+type fakeService struct {
+	notifi_service.NotifiService
+	status notifi_service.DocumentStatus
+	err    error
+}
+
+func (f *fakeService) GetDocumentStatus(ctx context.Context, documentID string) (notifi_service.DocumentStatus, error) {
+	if f.err != nil {
+		return notifi_service.DocumentStatus{}, f.err
+	}
+	return f.status, nil
+}
+
+type fakeProviders struct {
+	service notifi_service.NotifiService
+}
+
+func (f *fakeProviders) GetNotifiServiceFactory() notifi_service.NotifiServiceFactory {
+	return f
+}
+
+func (f *fakeProviders) GetService() notifi_service.NotifiService {
+	return f.service
+}
+
+func doRequest(t *testing.T, service notifi_service.NotifiService) *httptest.ResponseRecorder {
+	t.Helper()
+
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, "/v1/documents/doc-1", nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	c.SetParamNames("document_id")
+	c.SetParamValues("doc-1")
+
+	handler := NewDocumentStatus(httpUtils.GetMethod, Route, &fakeProviders{service: service})
+	if err := handler.Do(c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return rec
+}
+
+func TestDo_ReturnsStatus(t *testing.T) {
+	rec := doRequest(t, &fakeService{status: notifi_service.DocumentStatus{
+		DocumentID:   "doc-1",
+		SessionID:    "session-1",
+		Status:       jobs.StatusDone,
+		DownloadLink: "http://storage/doc-1.pdf",
+	}})
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var out DtoOut
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if out.Status != string(jobs.StatusDone) || out.DownloadLink == "" {
+		t.Fatalf("unexpected response: %+v", out)
+	}
+}
+
+func TestDo_NotFound(t *testing.T) {
+	rec := doRequest(t, &fakeService{err: jobs.ErrNotFound})
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rec.Code)
+	}
+}
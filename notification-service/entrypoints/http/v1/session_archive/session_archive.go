@@ -0,0 +1,93 @@
+package session_archive
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	notifi_service "notification-service/usecases/notifi_service"
+
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/jobs"
+
+	"gitlab.com/docshade/common/core"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	Route  = "/v1/sessions/:session_id/archive"
+	Method = httpUtils.GetMethod
+
+	contentType = "application/zip"
+)
+
+type providerSessionArchive interface {
+	GetNotifiServiceFactory() notifi_service.NotifiServiceFactory
+}
+
+type sessionArchive struct {
+	method    httpUtils.Methods
+	route     string
+	providers providerSessionArchive
+}
+
+// NewSessionArchive get new object
+func NewSessionArchive(
+	method httpUtils.Methods,
+	route string,
+	providers providerSessionArchive,
+) core.Handler {
+	return &sessionArchive{
+		method:    method,
+		route:     route,
+		providers: providers,
+	}
+}
+
+// GetMethod Get handler method
+func (h *sessionArchive) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *sessionArchive) GetRoute() string {
+	return h.route
+}
+
+// Do метод, который вызывается при обращении к ручке
+// @Summary      Скачать ZIP архив обработанных документов сессии
+// @Description  Архив собирается потоком из хранилища. Последний файл архива manifest.json содержит исходные имена и состояния всех документов сессии
+// @Produce      application/zip
+// @Param        session_id path string true "Идентификатор сессии"
+// @Param        token query string true "Токен доступа к сессии"
+// @Success      200 {file} file
+// @Failure      401 {object} httpUtils.ErrorHttp
+// @Failure      404 {object} httpUtils.ErrorHttp
+// @Router       /v1/sessions/{session_id}/archive [get]
+func (h *sessionArchive) Do(ctx echo.Context) error {
+	sessionID := ctx.Param("session_id")
+
+	service := h.providers.GetNotifiServiceFactory().GetService()
+
+	manifest, err := service.SessionArchive(ctx.Request().Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return httpUtils.ReturnNotFoundError(ctx, err, "Session not found")
+		}
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to prepare session archive")
+	}
+
+	response := ctx.Response()
+	response.Header().Set(echo.HeaderContentType, contentType)
+	response.Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": "session-" + sessionID + ".zip"}))
+	response.WriteHeader(http.StatusOK)
+
+	// Заголовки уже отправлены, поэтому при сбое клиент получит оборванный архив без оглавления
+	err = service.WriteSessionArchive(ctx.Request().Context(), manifest, response)
+	if err != nil {
+		log.Printf("Failed to stream archive of session %s: %v", sessionID, err)
+	}
+
+	return err
+}
@@ -0,0 +1,96 @@
+package session_documents
+
+import (
+	"errors"
+	"net/http"
+	notifi_service "notification-service/usecases/notifi_service"
+
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/jobs"
+
+	"gitlab.com/docshade/common/core"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	Route  = "/v1/sessions/:session_id/documents"
+	Method = httpUtils.GetMethod
+)
+
+type providerSessionDocuments interface {
+	GetNotifiServiceFactory() notifi_service.NotifiServiceFactory
+}
+
+type sessionDocuments struct {
+	method    httpUtils.Methods
+	route     string
+	providers providerSessionDocuments
+}
+
+// NewSessionDocuments get new object
+func NewSessionDocuments(
+	method httpUtils.Methods,
+	route string,
+	providers providerSessionDocuments,
+) core.Handler {
+	return &sessionDocuments{
+		method:    method,
+		route:     route,
+		providers: providers,
+	}
+}
+
+// GetMethod Get handler method
+func (h *sessionDocuments) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *sessionDocuments) GetRoute() string {
+	return h.route
+}
+
+// Do метод, который вызывается при обращении к ручке
+// @Summary      Получить состояния всех документов сессии
+// @Produce      json
+// @Param        session_id path string true "Идентификатор сессии"
+// @Param        token query string true "Токен доступа к сессии"
+// @Success      200 {object} DtoOut
+// @Failure      401 {object} httpUtils.ErrorHttp
+// @Failure      404 {object} httpUtils.ErrorHttp
+// @Router       /v1/sessions/{session_id}/documents [get]
+func (h *sessionDocuments) Do(ctx echo.Context) error {
+	sessionID := ctx.Param("session_id")
+
+	service := h.providers.GetNotifiServiceFactory().GetService()
+
+	documents, err := service.ListSessionDocuments(ctx.Request().Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return httpUtils.ReturnNotFoundError(ctx, err, "Session not found")
+		}
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to get session documents")
+	}
+
+	return ctx.JSON(http.StatusOK, prepareResponse(sessionID, documents))
+}
+
+func prepareResponse(sessionID string, data []notifi_service.DocumentStatus) DtoOut {
+	documents := make([]DocumentDto, 0, len(data))
+	for _, document := range data {
+		documents = append(documents, DocumentDto{
+			DocumentID:       document.DocumentID,
+			OriginalFileName: document.OriginalFileName,
+			Format:           document.Format,
+			Status:           string(document.Status),
+			ErrorReason:      document.ErrorReason,
+			CreatedAt:        document.CreatedAt,
+			UpdatedAt:        document.UpdatedAt,
+			FinishedAt:       document.FinishedAt,
+			DownloadLink:     document.DownloadLink,
+		})
+	}
+
+	return DtoOut{SessionID: sessionID, Documents: documents}
+}
@@ -0,0 +1,108 @@
+package webhook_deliveries
+
+import (
+	"errors"
+	"net/http"
+	notifi_service "notification-service/usecases/notifi_service"
+
+	httpUtils "gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/webhook"
+
+	"gitlab.com/docshade/common/core"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	Route  = "/v1/documents/:document_id/webhooks"
+	Method = httpUtils.GetMethod
+)
+
+var errNoDeliveries = errors.New("no webhook deliveries for document")
+
+type providerWebhookDeliveries interface {
+	GetNotifiServiceFactory() notifi_service.NotifiServiceFactory
+}
+
+type webhookDeliveries struct {
+	method    httpUtils.Methods
+	route     string
+	providers providerWebhookDeliveries
+}
+
+// NewWebhookDeliveries get new object
+func NewWebhookDeliveries(
+	method httpUtils.Methods,
+	route string,
+	providers providerWebhookDeliveries,
+) core.Handler {
+	return &webhookDeliveries{
+		method:    method,
+		route:     route,
+		providers: providers,
+	}
+}
+
+// GetMethod Get handler method
+func (h *webhookDeliveries) GetMethod() httpUtils.Methods {
+	return h.method
+}
+
+// GetRoute Get handler route
+func (h *webhookDeliveries) GetRoute() string {
+	return h.route
+}
+
+// Do метод, который вызывается при обращении к ручке
+// @Summary      Получить журнал доставки вебхуков документа
+// @Produce      json
+// @Param        document_id path string true "Идентификатор документа"
+// @Param        token query string true "Токен доступа к сессии"
+// @Success      200 {array} DtoOut
+// @Failure      401 {object} httpUtils.ErrorHttp
+// @Failure      404 {object} httpUtils.ErrorHttp
+// @Router       /v1/documents/{document_id}/webhooks [get]
+func (h *webhookDeliveries) Do(ctx echo.Context) error {
+	documentID := ctx.Param("document_id")
+
+	service := h.providers.GetNotifiServiceFactory().GetService()
+
+	deliveries, err := service.ListWebhookDeliveries(ctx.Request().Context(), documentID)
+	if err != nil {
+		return httpUtils.ReturnInternalError(ctx, err, "Failed to get webhook deliveries")
+	}
+	if len(deliveries) == 0 {
+		return httpUtils.ReturnNotFoundError(ctx, errNoDeliveries, "Webhook deliveries not found")
+	}
+
+	response := make([]DtoOut, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, prepareResponse(delivery))
+	}
+
+	return ctx.JSON(http.StatusOK, response)
+}
+
+// prepareResponse ключ подписи и тело запроса в ответ не попадают
+func prepareResponse(data webhook.Delivery) DtoOut {
+	attempts := make([]AttemptDto, 0, len(data.Log))
+	for _, attempt := range data.Log {
+		attempts = append(attempts, AttemptDto{
+			Number:      attempt.Number,
+			StatusCode:  attempt.StatusCode,
+			Error:       attempt.Error,
+			DurationMs:  attempt.Duration.Milliseconds(),
+			AttemptedAt: attempt.AttemptedAt,
+		})
+	}
+
+	return DtoOut{
+		ID:          data.ID,
+		Event:       data.Event,
+		URL:         data.URL,
+		Status:      string(data.Status),
+		Attempts:    attempts,
+		CreatedAt:   data.CreatedAt,
+		DeliveredAt: data.DeliveredAt,
+	}
+}
@@ -0,0 +1,24 @@
+package webhook_deliveries
+
+import "time"
+
+// DtoOut Output data
+type DtoOut struct {
+	ID          int64        `json:"id"`
+	Event       string       `json:"event"`
+	URL         string       `json:"url"`
+	Status      string       `json:"status"`
+	Attempts    []AttemptDto `json:"attempts"`
+	CreatedAt   time.Time    `json:"created_at"`
+	DeliveredAt *time.Time   `json:"delivered_at,omitempty"`
+}
+
+// AttemptDto одна попытка доставки
+type AttemptDto struct {
+	Number int `json:"number"`
+	// StatusCode код ответа получателя, 0 если ответа не было
+	StatusCode  int       `json:"status_code"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
@@ -2,24 +2,27 @@ package main
 
 import (
 	"context"
+	"notification-service/entrypoints/http/v1/document_status"
 	"notification-service/entrypoints/http/v1/notifi_health"
+	"notification-service/entrypoints/http/v1/session_archive"
+	"notification-service/entrypoints/http/v1/session_documents"
+	"notification-service/entrypoints/http/v1/webhook_deliveries"
 	dataproviders "notification-service/providers"
 	"notification-service/tasks"
-	"os"
-	"os/signal"
-	"syscall"
 
 	logger "gitlab.com/docshade/common/log"
 
 	"gitlab.com/docshade/common/core"
 	"gitlab.com/docshade/common/http"
 	"gitlab.com/docshade/common/http/middleware"
+	"gitlab.com/docshade/common/storage"
+	"gitlab.com/docshade/common/webhook"
 
 	"github.com/labstack/echo/v4"
 )
 
 func main() {
-	config := core.NewConfig("test")
+	config := core.NewConfig("notification-service")
 	err := config.LoadConfig()
 	if err != nil {
 		logger.Fatalf("Error occurred while loading config: %+v, config: %+v", err, config)
@@ -29,35 +32,71 @@ func main() {
 		logger.Fatalf("%s", err)
 	}
 
-	mw := middleware.NewBaseMiddleware()
+	mw := middleware.NewBaseMiddleware(config.GetAllowedOrigins())
 	service := echo.New()
-	wsServer := http.NewWebSocketServer()
+	ws := config.GetWebSocketConfig()
+	hub := http.NewNotificationHub(providers.GetBackplane(), providers.GetSessionSigner(), http.NotificationOptions{
+		AllowedOrigins:  config.GetAllowedOrigins(),
+		PingInterval:    ws.PingInterval,
+		PongTimeout:     ws.PongTimeout,
+		WriteTimeout:    ws.WriteTimeout,
+		SendBuffer:      ws.SendBuffer,
+		LongPollTimeout: ws.LongPollTimeout,
+	})
 
 	microservice := core.NewMicroservice(config, service, mw.GetGlobalMiddlewares())
 	logger.InitLog(config.GetLogConfig())
 
-	addRoutes(config, providers, service, wsServer)
-
-	// Start the microservice
-	go func() {
-		microservice.Run()
-	}()
-
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+	addRoutes(config, providers, service, hub)
 
 	notifi_service := providers.GetNotifiServiceFactory().GetService()
 
-	go tasks.StartQueueListener(ctx, notifi_service, wsServer, 10)
+	// Клиенты уведомлений отключаются только после того, как пул разошлёт уже принятые уведомления
+	microservice.
+		AddTask("queue-listener", func(ctx context.Context) error {
+			return tasks.StartQueueListener(ctx, notifi_service, hub, 10)
+		}).
+		AddTask("notification-backplane", hub.Run).
+		AddTask("webhook-dispatcher", func(ctx context.Context) error {
+			sender := webhook.NewSender(config.GetWebhookConfig())
+			return tasks.StartWebhookDispatcher(ctx, providers.GetWebhooks(), sender.Send)
+		}).
+		AddTask("retention-sweeper", func(ctx context.Context) error {
+			return tasks.StartRetentionSweeper(ctx, notifi_service, config.GetRetentionConfig(), storage.NewBuckets(config.GetS3Config()))
+		}).
+		AddCloser("notifications", hub.Close).
+		AddCloser("providers", providers.Close)
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	if rotator, ok := providers.GetStorage().(storage.KeyRotator); ok {
+		buckets := storage.NewBuckets(config.GetS3Config())
+		microservice.AddTask("key-rotation", func(ctx context.Context) error {
+			return tasks.RotateStorageKeys(ctx, rotator, buckets)
+		})
+	}
 
-	cancel()
+	microservice.Run()
 }
 
-func addRoutes(config core.Config, providers dataproviders.ExecutorProviders, e *echo.Echo, wsServer *http.WebSocketServer) {
-	config.AddHandler(notifi_health.NewHealth(notifi_health.Method, notifi_health.Route, providers))
-	http.RegisterWebSocketRoutes(e, wsServer)
+func addRoutes(config core.Config, providers dataproviders.ExecutorProviders, e *echo.Echo, hub *http.NotificationHub) {
+	// Ручки сессий и документов отдают ссылки на результаты, поэтому требуют токен сессии, как и уведомления
+	service := providers.GetNotifiServiceFactory().GetService()
+	sessionToken := http.RequireSessionToken(providers.GetSessionSigner(), http.SessionFromParam("session_id"))
+	documentToken := http.RequireSessionToken(providers.GetSessionSigner(), func(c echo.Context) (string, error) {
+		return service.DocumentSession(c.Request().Context(), c.Param("document_id"))
+	})
+
+	config.AddHandler(notifi_health.NewHealth(notifi_health.Method, notifi_health.Route, providers)).
+		AddHandler(core.WithMiddlewares(document_status.NewDocumentStatus(document_status.Method, document_status.Route, providers), documentToken)).
+		AddHandler(core.WithMiddlewares(session_documents.NewSessionDocuments(session_documents.Method, session_documents.Route, providers), sessionToken)).
+		AddHandler(core.WithMiddlewares(session_archive.NewSessionArchive(session_archive.Method, session_archive.Route, providers), sessionToken)).
+		AddHandler(core.WithMiddlewares(webhook_deliveries.NewWebhookDeliveries(webhook_deliveries.Method, webhook_deliveries.Route, providers), documentToken))
+	// Ссылки на локальные и зашифрованные документы обслуживает сам сервис
+	if storage.ProxiesDownloads(config.GetS3Config()) {
+		config.AddHandler(storage.NewDownloadHandler(providers.GetStorage(), config.GetS3Config()))
+	}
+	http.RegisterNotificationRoutes(e,
+		http.NewWebSocketTransport(hub),
+		http.NewSSETransport(hub),
+		http.NewLongPollTransport(hub),
+	)
 }
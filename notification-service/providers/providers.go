@@ -3,32 +3,103 @@ package providers
 import (
 	"context"
 	"log"
+	"net"
 	"notification-service/providers/rabbitmq_provider"
-	"notification-service/providers/s3_provider"
 	notifi_service "notification-service/usecases/notifi_service"
 
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
+	"gitlab.com/docshade/common/backplane"
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/database"
+	"gitlab.com/docshade/common/health"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/session"
+	"gitlab.com/docshade/common/storage"
+	"gitlab.com/docshade/common/webhook"
 )
 
 type ExecutorProviders interface {
 	GetNotifiServiceFactory() notifi_service.NotifiServiceFactory
+	// GetStorage получить хранилище документов
+	GetStorage() storage.Storage
+	// GetBackplane получить доставку сообщений WebSocket между репликами
+	GetBackplane() backplane.Backplane
+	// GetSessionSigner получить проверку токенов доступа к сессиям
+	GetSessionSigner() *session.Signer
+	// GetWebhooks получить очередь и журнал доставок вебхуков
+	GetWebhooks() webhook.Store
+	// Close закрыть соединения провайдеров
+	Close(ctx context.Context) error
 }
 
 type executorProviders struct {
 	notifiFactory notifi_service.NotifiServiceFactory
 	rabbitmq      rabbitmq_provider.RabbitMQ
-	s3            s3_provider.S3
+	storage       storage.Storage
+	db            *pgxpool.Pool
+	jobs          jobs.Repository
+	backplane     backplane.Backplane
+	sessions      *session.Signer
+	webhooks      webhook.Store
 }
 
 func (p *executorProviders) GetNotifiServiceFactory() notifi_service.NotifiServiceFactory {
 	return p.notifiFactory
 }
 
+func (p *executorProviders) GetStorage() storage.Storage {
+	return p.storage
+}
+
+func (p *executorProviders) GetBackplane() backplane.Backplane {
+	return p.backplane
+}
+
+func (p *executorProviders) GetSessionSigner() *session.Signer {
+	return p.sessions
+}
+
+func (p *executorProviders) GetWebhooks() webhook.Store {
+	return p.webhooks
+}
+
+// Close закрывает соединения в порядке, обратном инициализации
+func (p *executorProviders) Close(ctx context.Context) error {
+	if err := p.backplane.Close(); err != nil {
+		return err
+	}
+
+	if err := p.webhooks.Close(); err != nil {
+		return err
+	}
+
+	if err := p.jobs.Close(); err != nil {
+		return err
+	}
+	p.db.Close()
+
+	if err := p.rabbitmq.Close(); err != nil {
+		return err
+	}
+
+	return p.storage.Close()
+}
+
 // NewProviders инициализация провайдеров
 func NewProviders(config core.Config) (ExecutorProviders, error) {
-	s3 := s3_provider.NewS3(config.GetS3Config())
-	if err := s3.InitS3(); err != nil {
-		log.Println("ошибка подключения к s3 ", err)
+	sessions, err := session.NewSigner(config.GetSessionConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	buckets := storage.NewBuckets(config.GetS3Config())
+	store, err := storage.New(config.GetS3Config())
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Init(context.Background(), buckets.Incoming, buckets.Processed); err != nil {
+		log.Println("ошибка подключения к хранилищу ", err)
 		return nil, err
 	}
 
@@ -38,17 +109,75 @@ func NewProviders(config core.Config) (ExecutorProviders, error) {
 		return nil, err
 	}
 	//and here
-	err := rabbitmq.BindQueue(context.Background(), "out_queue", "document-exchange", "out-routing-key")
+	err = rabbitmq.BindQueue(context.Background(), "out_queue", "document-exchange", "out-routing-key")
 	if err != nil {
 		log.Println("ошибка подключения к  CreateQueueAndBind", err)
 		return nil, err
 	}
 
-	notifiFactory := notifi_service.NewNotifiFactory(rabbitmq, s3)
+	// Состояния документов и доставки вебхуков хранятся в одной базе и работают через общий пул
+	db, err := database.Connect(context.Background(), config.GetPostgresConfig())
+	if err != nil {
+		log.Println("ошибка подключения к postgres", err)
+		return nil, err
+	}
+
+	jobsRepository := jobs.NewPostgresRepository(db)
+	if err := jobsRepository.Init(context.Background()); err != nil {
+		log.Println("ошибка подготовки таблиц postgres", err)
+		return nil, err
+	}
+
+	webhooks := webhook.NewPostgresStore(db, config.GetWebhookConfig())
+	if err := webhooks.Init(context.Background()); err != nil {
+		log.Println("ошибка подготовки таблиц postgres", err)
+		return nil, err
+	}
+
+	bp := newBackplane(config)
+	if err := bp.Ping(context.Background()); err != nil {
+		log.Println("ошибка подключения к redis", err)
+		return nil, err
+	}
+
+	// Проверки для /readyz
+	health.Register("s3", store.Ping)
+	health.Register("rabbitmq", rabbitmq.Ping)
+	health.Register("postgres", db.Ping)
+	if config.GetRedisConfig().Host != "" {
+		health.Register("redis", bp.Ping)
+	}
+
+	notifiFactory := notifi_service.NewNotifiFactory(rabbitmq, store, buckets, jobsRepository, webhooks)
 
 	return &executorProviders{
-		s3:            s3,
+		storage:       store,
+		db:            db,
 		notifiFactory: notifiFactory,
 		rabbitmq:      rabbitmq,
+		jobs:          jobsRepository,
+		backplane:     bp,
+		sessions:      sessions,
+		webhooks:      webhooks,
 	}, nil
 }
+
+// newBackplane доставка WebSocket через Redis. Без настроенного Redis сообщения хранятся в памяти процесса,
+// и клиент получит только уведомления, обработанные той же репликой
+func newBackplane(config core.Config) backplane.Backplane {
+	wsConfig := config.GetWebSocketConfig()
+	opts := backplane.Options{PendingTTL: wsConfig.PendingTTL, MaxPending: wsConfig.MaxPending}
+
+	redisConfig := config.GetRedisConfig()
+	if redisConfig.Host == "" {
+		return backplane.NewMemory(opts)
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     net.JoinHostPort(redisConfig.Host, redisConfig.Port),
+		Password: redisConfig.Password,
+		DB:       redisConfig.DB,
+	})
+
+	return backplane.NewRedis(client, opts)
+}
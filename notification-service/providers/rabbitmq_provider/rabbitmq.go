@@ -2,11 +2,13 @@ package rabbitmq_provider
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"time"
 
+	"gitlab.com/docshade/common/broker"
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/tracing"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
@@ -14,52 +16,67 @@ import (
 const (
 	maxRetries = 11
 	retryDelay = 5 * time.Second
+
+	consumerTag = "notification-service"
+	// prefetchCount сколько неподтверждённых сообщений брокер отдаёт сервису
+	prefetchCount = 10
+	// redeliveryDelay пауза перед возвратом необработанного сообщения в очередь, чтобы пережидать
+	// недоступность базы, а не возвращать сообщение в цикле
+	redeliveryDelay = time.Second
 )
 
 type RabbitMQ interface {
 	InitRabbitMQ() error
-	ConsumeMessages(ctx context.Context, queueName string, handler func(DocumentMessage) error) error
+	Close() error
+	// State состояние соединения с RabbitMQ
+	State() broker.State
+	// Ping проверка соединения для /readyz
+	Ping(ctx context.Context) error
+	ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, messaging.DocumentProcessed) error) error
 	BindQueue(ctx context.Context, queueName, exchange, routingKey string) error
 }
 
 type rabbitmq struct {
-	cfg core.RabbitMQConfig
-	mq  *amqp.Connection
+	mq *broker.Manager
 }
 
 func InitRabbitMQ(cfg core.RabbitMQConfig) RabbitMQ {
-	return &rabbitmq{cfg: cfg}
+	return &rabbitmq{mq: broker.NewManager(cfg)}
 }
 
+// InitRabbitMQ подключается к RabbitMQ; дальше соединение восстанавливает менеджер
 func (r *rabbitmq) InitRabbitMQ() error {
-	var err error
-	for i := 0; i < maxRetries; i++ {
-		r.mq, err = amqp.Dial(r.cfg.URI)
-		if err == nil {
-			break
-		}
-		time.Sleep(retryDelay)
-	}
-	return nil
+	return r.mq.Connect(context.Background())
+}
+
+// Close закрывает соединение с RabbitMQ
+func (r *rabbitmq) Close() error {
+	return r.mq.Close()
+}
+
+func (r *rabbitmq) State() broker.State {
+	return r.mq.State()
+}
+
+func (r *rabbitmq) Ping(ctx context.Context) error {
+	return r.mq.Ping(ctx)
 }
 
+// BindQueue привязывает очередь к обменнику. Очередь объявляет queue-service,
+// поэтому при старте её может ещё не быть, и привязка повторяется
 func (r *rabbitmq) BindQueue(ctx context.Context, queueName, exchange, routingKey string) error {
 	var err error
 	for i := 0; i < maxRetries; i++ {
-		ch, err := r.mq.Channel()
-		if err == nil {
-			defer ch.Close()
-			err = ch.QueueBind(
+		err = r.mq.Declare(ctx, func(ch *amqp.Channel) error {
+			return ch.QueueBind(
 				queueName,
 				routingKey,
 				exchange,
 				false, // noWait
 				nil,   // args
 			)
-			if err != nil {
-				ch.Close()
-				continue
-			}
+		})
+		if err == nil {
 			return nil
 		}
 		time.Sleep(retryDelay)
@@ -67,46 +84,49 @@ func (r *rabbitmq) BindQueue(ctx context.Context, queueName, exchange, routingKe
 	return err
 }
 
-func (r *rabbitmq) ConsumeMessages(ctx context.Context, queueName string, handler func(DocumentMessage) error) error {
+// ConsumeMessages читает очередь до отмены ctx, переживая переподключения к брокеру. Сообщение
+// подтверждается, только если handler его обработал, иначе возвращается в очередь
+func (r *rabbitmq) ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, messaging.DocumentProcessed) error) error {
+	return r.mq.Consume(ctx, broker.ConsumeOptions{
+		Queue:    queueName,
+		Tag:      consumerTag,
+		Prefetch: prefetchCount,
+	}, func(ctx context.Context, ch *amqp.Channel, d amqp.Delivery) {
+		handleDelivery(ctx, queueName, d, handler)
+	})
+}
+
+// handleDelivery обрабатывает сообщение в спане, продолжающем трассировку отправителя
+func handleDelivery(ctx context.Context, queueName string, d amqp.Delivery, handler func(context.Context, messaging.DocumentProcessed) error) {
+	ctx, span := tracing.StartConsumeSpan(ctx, queueName, d.Headers)
+	defer span.End()
 
-	//Todo error
-	ch, err := r.mq.Channel()
-	if err != nil {
-		return err
-	}
-	defer ch.Close()
-
-	msgs, err := ch.Consume(
-		queueName,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
+	msg, err := messaging.DecodeDocumentProcessed(d.Body)
 	if err != nil {
-		return err
+		tracing.RecordError(span, err)
+		// Повторная доставка не исправит сообщение, которое не удалось разобрать
+		log.Printf("Failed to decode message, dropping it: %v", err)
+		if err := d.Reject(false); err != nil {
+			log.Printf("Failed to reject message: %v", err)
+		}
+		return
 	}
 
-	go func() {
-		for d := range msgs {
-			var msg DocumentMessage
-			err := json.Unmarshal(d.Body, &msg)
-			if err != nil {
-				log.Printf("Failed to unmarshal message: %v", err)
-				continue
-			}
-
-			err = handler(msg)
-			if err != nil {
-				log.Printf("Failed to process message: %v", err)
-			}
+	err = handler(ctx, msg)
+	tracing.RecordError(span, err)
+	if err != nil {
+		log.Printf("Failed to process message for document %s, requeueing it: %v", msg.DocumentID, err)
+		select {
+		case <-time.After(redeliveryDelay):
+		case <-ctx.Done():
 		}
-	}()
-
-	log.Printf("Waiting for messages. To exit press CTRL+C")
-	<-ctx.Done()
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("Failed to requeue message for document %s: %v", msg.DocumentID, err)
+		}
+		return
+	}
 
-	return nil
+	if err := d.Ack(false); err != nil {
+		log.Printf("Failed to ack message for document %s: %v", msg.DocumentID, err)
+	}
 }
@@ -1 +0,0 @@
-package s3_provider
@@ -0,0 +1,26 @@
+package tasks
+
+import (
+	"context"
+	"log"
+
+	"gitlab.com/docshade/common/storage"
+)
+
+// RotateStorageKeys перешифровывает ключи данных документов активным мастер-ключом.
+// Проход выполняется один раз при старте, после чего задача ждёт остановки сервиса;
+// ошибка ротации не должна останавливать доставку уведомлений, поэтому она только логируется
+func RotateStorageKeys(ctx context.Context, rotator storage.KeyRotator, buckets storage.Buckets) error {
+	for _, bucket := range []string{buckets.Incoming, buckets.Processed} {
+		rotated, err := rotator.RotateKeys(ctx, bucket)
+		if err != nil {
+			log.Printf("Failed to rotate data keys in %s after %d objects: %v", bucket, rotated, err)
+			continue
+		}
+		log.Printf("Rotated data keys of %d objects in %s", rotated, bucket)
+	}
+
+	<-ctx.Done()
+
+	return nil
+}
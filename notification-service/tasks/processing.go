@@ -2,24 +2,33 @@ package tasks
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"notification-service/usecases/notifi_service"
 
 	"gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/messaging"
 )
 
-func StartQueueListener(ctx context.Context, notifiService notifi_service.NotifiService, wsServer *http.WebSocketServer, maxWorkers int) {
-	pool := NewWorkerPool(notifiService, wsServer, maxWorkers)
+// StartQueueListener читает очередь уведомлений до отмены контекста,
+// после чего дожидается, пока пул разошлёт уже принятые сообщения.
+// Вебхук ставится в очередь до подтверждения сообщения: если это не удалось, сообщение вернётся
+// в очередь. Клиентам сессии уведомление рассылает пул, уже после подтверждения
+func StartQueueListener(ctx context.Context, notifiService notifi_service.NotifiService, hub *http.NotificationHub, maxWorkers int) error {
+	pool := NewWorkerPool(notifiService, hub, maxWorkers)
+	defer pool.Wait()
 
-	err := notifiService.ConsumeMessages(ctx, "out_queue", func(ctx context.Context, msg notifi_service.DocumentMessage) error {
+	err := notifiService.ConsumeMessages(ctx, "out_queue", func(ctx context.Context, msg messaging.DocumentProcessed) error {
 		log.Printf("Message received for session %s", msg.SessionID)
-		pool.AddJob(msg)
+		if err := notifiService.ProcessDocumentMessage(ctx, msg); err != nil {
+			return err
+		}
+		pool.AddJob(ctx, msg)
 		return nil
 	})
 	if err != nil {
-		log.Fatalf("Failed to start queue listener: %v", err)
+		return fmt.Errorf("queue listener: %w", err)
 	}
 
-	<-ctx.Done()
-	pool.Wait()
+	return nil
 }
@@ -0,0 +1,59 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"notification-service/usecases/notifi_service"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/storage"
+)
+
+// StartRetentionSweeper удаляет документы и состояния с истёкшим сроком хранения:
+// первый проход выполняется сразу при старте, следующие с периодом из конфигурации
+func StartRetentionSweeper(ctx context.Context, notifiService notifi_service.NotifiService, retention core.RetentionConfig, buckets storage.Buckets) error {
+	ticker := time.NewTicker(retention.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		sweep(ctx, notifiService, retention, buckets)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep ошибки одного прохода только логируются, следующий проход повторит удаление
+func sweep(ctx context.Context, notifiService notifi_service.NotifiService, retention core.RetentionConfig, buckets storage.Buckets) {
+	policies := []struct {
+		bucket string
+		ttl    time.Duration
+	}{
+		{bucket: buckets.Incoming, ttl: retention.IncomingTTL},
+		{bucket: buckets.Processed, ttl: retention.ProcessedTTL},
+	}
+
+	for _, policy := range policies {
+		purged, err := notifiService.PurgeExpiredDocuments(ctx, policy.bucket, policy.ttl)
+		if err != nil {
+			log.Printf("Retention sweep of %s failed after %d documents: %v", policy.bucket, purged, err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Retention sweep purged %d documents from %s", purged, policy.bucket)
+		}
+	}
+
+	purged, err := notifiService.PurgeFinishedJobs(ctx, retention.ProcessedTTL)
+	if err != nil {
+		log.Printf("Retention sweep of job records failed: %v", err)
+		return
+	}
+	if purged > 0 {
+		log.Printf("Retention sweep purged %d job records", purged)
+	}
+}
@@ -0,0 +1,50 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gitlab.com/docshade/common/webhook"
+)
+
+const (
+	// dispatchInterval период опроса доставок: подбирает отложенные после неудачных попыток
+	dispatchInterval = 5 * time.Second
+	// dispatchBatch сколько доставок отправлять за один проход
+	dispatchBatch = 20
+)
+
+// StartWebhookDispatcher отправляет вебхуки сразу после постановки в очередь
+// и периодически, пока не отменят контекст
+func StartWebhookDispatcher(ctx context.Context, store webhook.Store, send webhook.SendFunc) error {
+	ticker := time.NewTicker(dispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		dispatch(ctx, store, send)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-store.Wakeups():
+		}
+	}
+}
+
+// dispatch разбирает доставки пачками, пока остаются те, время которых подошло
+func dispatch(ctx context.Context, store webhook.Store, send webhook.SendFunc) {
+	for {
+		attempted, err := store.Dispatch(ctx, dispatchBatch, send)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Failed to dispatch webhooks: %v", err)
+			}
+			return
+		}
+		if attempted < dispatchBatch {
+			return
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/webhook"
+	"gitlab.com/docshade/common/webhook/webhooktest"
+)
+
+const testSecret = "test-secret"
+
+func newTestStore(maxAttempts int) webhook.Store {
+	return webhook.NewMemoryStore(core.WebhookConfig{
+		Timeout:     time.Second,
+		MaxAttempts: maxAttempts,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	})
+}
+
+func addDelivery(t *testing.T, store webhook.Store, url, secret string) {
+	t.Helper()
+
+	err := store.Add(context.Background(), webhook.Delivery{
+		DocumentID: "doc-1",
+		Event:      "document.processed",
+		URL:        url,
+		Secret:     secret,
+		Payload:    []byte(`{"document_id":"doc-1","status":"ok"}`),
+	})
+	if err != nil {
+		t.Fatalf("failed to add delivery: %v", err)
+	}
+}
+
+func TestDispatch_RetriesUntilDelivered(t *testing.T) {
+	receiver := webhooktest.NewReceiver(testSecret)
+	defer receiver.Close()
+	receiver.FailNext(2)
+
+	store := newTestStore(5)
+	addDelivery(t, store, receiver.URL, testSecret)
+	// Повтор того же события не создаёт вторую доставку
+	addDelivery(t, store, receiver.URL, testSecret)
+
+	sender := webhook.NewSender(core.WebhookConfig{Timeout: time.Second, AllowPrivateNetworks: true})
+	for i := 0; i < 3; i++ {
+		dispatch(context.Background(), store, sender.Send)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	requests := receiver.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 accepted request, got %d", len(requests))
+	}
+	if requests[0].Event != "document.processed" || string(requests[0].Body) != `{"document_id":"doc-1","status":"ok"}` {
+		t.Fatalf("unexpected request: %+v", requests[0])
+	}
+
+	deliveries, _ := store.List(context.Background(), "doc-1")
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(deliveries))
+	}
+	delivery := deliveries[0]
+	if delivery.Status != webhook.StatusDelivered || delivery.Attempts != 3 || len(delivery.Log) != 3 {
+		t.Fatalf("unexpected delivery: %+v", delivery)
+	}
+	if delivery.Log[0].StatusCode != 503 || delivery.Log[2].StatusCode != 204 {
+		t.Fatalf("unexpected attempt log: %+v", delivery.Log)
+	}
+}
+
+func TestDispatch_FailsAfterMaxAttempts(t *testing.T) {
+	receiver := webhooktest.NewReceiver(testSecret)
+	defer receiver.Close()
+
+	// Подпись чужим ключом получатель отклоняет
+	store := newTestStore(2)
+	addDelivery(t, store, receiver.URL, "wrong-secret")
+
+	sender := webhook.NewSender(core.WebhookConfig{Timeout: time.Second, AllowPrivateNetworks: true})
+	for i := 0; i < 3; i++ {
+		dispatch(context.Background(), store, sender.Send)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if receiver.Rejected() != 2 || len(receiver.Requests()) != 0 {
+		t.Fatalf("expected 2 rejected requests, got %d rejected and %d accepted", receiver.Rejected(), len(receiver.Requests()))
+	}
+
+	deliveries, _ := store.List(context.Background(), "doc-1")
+	if deliveries[0].Status != webhook.StatusFailed || deliveries[0].Attempts != 2 {
+		t.Fatalf("unexpected delivery: %+v", deliveries[0])
+	}
+}
@@ -8,94 +8,180 @@ import (
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"gitlab.com/docshade/common/http"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/metrics"
+	"gitlab.com/docshade/common/tracing"
 )
 
+const presignTimeout = 5 * time.Second
+
+// Загрузку пула считаем как busy / max
+var (
+	workersMax = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "notification_workers",
+		Name:      "max",
+		Help:      "Maximum number of notification workers.",
+	})
+
+	workersStarted = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "notification_workers",
+		Name:      "started",
+		Help:      "Number of running notification worker goroutines.",
+	})
+
+	workersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "notification_workers",
+		Name:      "busy",
+		Help:      "Number of notification workers processing a message.",
+	})
+
+	jobDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "notification_workers",
+		Name:      "job_duration_seconds",
+		Help:      "Time spent by a worker on one processed-document message.",
+		Buckets:   prometheus.DefBuckets,
+	})
+)
+
+// job сообщение вместе с контекстом, в котором его получили
+type job struct {
+	ctx context.Context
+	msg messaging.DocumentProcessed
+}
+
 type WorkerPool struct {
 	notifiService notifi_service.NotifiService
-	wsServer      *http.WebSocketServer
-	jobs          chan notifi_service.DocumentMessage
+	hub           *http.NotificationHub
+	jobs          chan job
 	wg            sync.WaitGroup
 	mu            sync.Mutex
 	activeWorkers int
 	maxWorkers    int
 }
 
-func NewWorkerPool(notifiService notifi_service.NotifiService, wsServer *http.WebSocketServer, maxWorkers int) *WorkerPool {
+func NewWorkerPool(notifiService notifi_service.NotifiService, hub *http.NotificationHub, maxWorkers int) *WorkerPool {
 	pool := &WorkerPool{
 		notifiService: notifiService,
-		wsServer:      wsServer,
-		jobs:          make(chan notifi_service.DocumentMessage),
+		hub:           hub,
+		jobs:          make(chan job),
 		maxWorkers:    maxWorkers,
 	}
+	workersMax.Set(float64(maxWorkers))
 
 	return pool
 }
 
-func (p *WorkerPool) worker(ctx context.Context) {
+// worker обрабатывает задания, пока канал заданий не будет закрыт в Wait
+func (p *WorkerPool) worker() {
 	defer func() {
 		p.mu.Lock()
 		p.activeWorkers--
+		workersStarted.Dec()
 		p.mu.Unlock()
 		p.wg.Done()
 	}()
 
-	for {
-		select {
-		case msg := <-p.jobs:
-			err := p.notifiService.ProcessDocumentMessage(ctx, msg)
-			if err != nil {
-				log.Printf("Failed to process message: %v", err)
-				continue
-			}
-
-			// Используйте отдельный контекст для генерации временной ссылки
-			genCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-
-			downloadLink, err := p.notifiService.GeneratePresignedURL(genCtx, msg.DocumentID+".pdf", 15*time.Minute)
-			if err != nil {
-				log.Printf("Failed to generate presigned URL: %v", err)
-				continue
-			}
-
-			// Отправка уведомления клиенту через WebSocket
-			notification := map[string]interface{}{
-				"session_id":        msg.SessionID,
-				"status":            msg.Status,
-				"download_link":     downloadLink,
-				"original_filename": msg.OriginalFileName,
-			}
-			if msg.Status != "ok" {
-				notification["status"] = msg.Status
-			}
-			notificationBytes, _ := json.Marshal(notification)
-			log.Printf("Sending message to session %s: %s", msg.SessionID, string(notificationBytes))
-			p.wsServer.SendMessageToClient(msg.SessionID, notificationBytes)
-		case <-ctx.Done():
-			log.Printf("Worker timed out and is shutting down")
+	for item := range p.jobs {
+		p.process(item.ctx, item.msg)
+	}
+}
+
+func (p *WorkerPool) process(ctx context.Context, msg messaging.DocumentProcessed) {
+	workersBusy.Inc()
+	defer workersBusy.Dec()
+	defer prometheus.NewTimer(jobDuration).ObserveDuration()
+
+	ctx, span := tracing.Tracer().Start(ctx, "notify session")
+	defer span.End()
+
+	var downloadLink string
+	var err error
+	if msg.Status == messaging.StatusOK {
+		// Генерации временной ссылки отводится отдельный таймаут
+		genCtx, cancel := context.WithTimeout(ctx, presignTimeout)
+		defer cancel()
+
+		downloadLink, err = p.notifiService.GeneratePresignedURL(genCtx, msg.ObjectKey, notifi_service.DownloadLinkExpiry)
+		if err != nil {
+			tracing.RecordError(span, err)
+			log.Printf("Failed to generate presigned URL: %v", err)
 			return
 		}
 	}
+
+	// Отправка уведомления клиентам сессии
+	notification := map[string]interface{}{
+		"session_id":        msg.SessionID,
+		"status":            msg.Status,
+		"download_link":     downloadLink,
+		"original_filename": msg.OriginalFileName,
+	}
+	if msg.BatchID != "" {
+		notification["batch_id"] = msg.BatchID
+	}
+	if msg.SHA256 != "" {
+		notification["sha256"] = msg.SHA256
+	}
+	// Причину отказа проверки клиент может показать пользователю, причину сбоя обработки сервис не раскрывает
+	if msg.Status == messaging.StatusRejected {
+		notification["error"] = msg.Error
+	}
+	p.send(ctx, msg.SessionID, notification)
+
+	if msg.BatchID != "" {
+		p.trackBatch(ctx, msg.BatchID)
+	}
 }
 
-func (p *WorkerPool) AddJob(msg notifi_service.DocumentMessage) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// trackBatch сообщает сессии ход обработки пакета, а после последнего документа его итог
+func (p *WorkerPool) trackBatch(ctx context.Context, batchID string) {
+	progress, completed, err := p.notifiService.TrackBatch(ctx, batchID)
+	if err != nil {
+		log.Printf("Failed to track batch %s: %v", batchID, err)
+		return
+	}
+
+	p.send(ctx, progress.SessionID, progress)
+	if completed {
+		progress.Event = notifi_service.BatchCompletedEvent
+		p.send(ctx, progress.SessionID, progress)
+	}
+}
+
+func (p *WorkerPool) send(ctx context.Context, sessionID string, notification interface{}) {
+	notificationBytes, _ := json.Marshal(notification)
+	log.Printf("Sending message to session %s: %s", sessionID, string(notificationBytes))
+	if err := p.hub.SendMessageToClient(ctx, sessionID, notificationBytes); err != nil {
+		log.Printf("Failed to send message to session %s: %v", sessionID, err)
+	}
+}
 
+// AddJob передаёт сообщение свободному работнику. ctx несёт трассировку сообщения
+// и не должен отменяться вместе с чтением очереди
+func (p *WorkerPool) AddJob(ctx context.Context, msg messaging.DocumentProcessed) {
+	p.mu.Lock()
 	// Запуск новой горутины, если текущих горутин недостаточно
 	if p.activeWorkers < p.maxWorkers {
 		p.wg.Add(1)
-		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
-		defer cancel()
-		go p.worker(ctx)
+		go p.worker()
 		p.activeWorkers++
+		workersStarted.Inc()
 		log.Printf("Started new worker, active workers: %d", p.activeWorkers)
 	}
-	p.jobs <- msg
+	p.mu.Unlock()
+
+	p.jobs <- job{ctx: ctx, msg: msg}
 	log.Printf("Job added for session %s", msg.SessionID)
 }
 
+// Wait перестаёт принимать задания и дожидается обработки уже принятых
 func (p *WorkerPool) Wait() {
 	close(p.jobs)
 	p.wg.Wait()
@@ -0,0 +1,120 @@
+package notifi_service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/storage"
+)
+
+func newArchiveService(t *testing.T) (*notifiService, context.Context) {
+	t.Helper()
+
+	ctx := context.Background()
+	cfg := core.S3Config{Driver: storage.DriverLocal, LocalPath: t.TempDir()}
+	store, err := storage.New(cfg)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	buckets := storage.NewBuckets(cfg)
+	if err := store.Init(ctx, buckets.Incoming, buckets.Processed); err != nil {
+		t.Fatalf("failed to init storage: %v", err)
+	}
+
+	return &notifiService{storage: store, buckets: buckets, jobs: jobs.NewMemoryRepository()}, ctx
+}
+
+func addJob(t *testing.T, r *notifiService, ctx context.Context, job jobs.Job, body string) {
+	t.Helper()
+
+	job.SessionID = "session-1"
+	if err := r.jobs.Create(ctx, job); err != nil {
+		t.Fatalf("failed to create job: %v", err)
+	}
+	if body == "" {
+		return
+	}
+
+	format, _ := formats.ByName(job.Format)
+	err := r.storage.Put(ctx, r.buckets.Processed, format.ObjectKey(job.DocumentID), strings.NewReader(body), int64(len(body)), storage.PutOptions{ContentType: format.MediaType})
+	if err != nil {
+		t.Fatalf("failed to store document: %v", err)
+	}
+}
+
+func TestWriteSessionArchive(t *testing.T) {
+	r, ctx := newArchiveService(t)
+	addJob(t, r, ctx, jobs.Job{DocumentID: "doc-1", OriginalFileName: "report.pdf", Format: "pdf", Status: jobs.StatusDone}, "%PDF-1.7 one")
+	addJob(t, r, ctx, jobs.Job{DocumentID: "doc-2", OriginalFileName: `C:\scans\report.pdf`, Format: "pdf", Status: jobs.StatusDone}, "%PDF-1.7 two")
+	addJob(t, r, ctx, jobs.Job{DocumentID: "doc-3", OriginalFileName: "notes.txt", Format: "txt", Status: jobs.StatusFailed, ErrorReason: "boom"}, "")
+	// Результат удалён из хранилища раньше, чем архив был собран
+	addJob(t, r, ctx, jobs.Job{DocumentID: "doc-4", OriginalFileName: "gone.csv", Format: "csv", Status: jobs.StatusDone}, "")
+
+	manifest, err := r.SessionArchive(ctx, "session-1")
+	if err != nil {
+		t.Fatalf("failed to prepare archive: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteSessionArchive(ctx, manifest, &buf); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(body)
+	}
+
+	// Порядок документов с одинаковым временем загрузки не определён, поэтому проверяются только имена
+	pdfs := files["report.pdf"] + "|" + files["report (2).pdf"]
+	if len(files) != 3 || (pdfs != "%PDF-1.7 one|%PDF-1.7 two" && pdfs != "%PDF-1.7 two|%PDF-1.7 one") {
+		t.Fatalf("unexpected archive files: %v", files)
+	}
+
+	var got ArchiveManifest
+	if err := json.Unmarshal([]byte(files[ArchiveManifestName]), &got); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if len(got.Documents) != 4 {
+		t.Fatalf("expected 4 documents in manifest, got %d", len(got.Documents))
+	}
+	for _, document := range got.Documents {
+		switch document.DocumentID {
+		case "doc-3":
+			if document.FileName != "" || document.Status != string(jobs.StatusFailed) || document.ErrorReason != "boom" {
+				t.Fatalf("unexpected failed document: %+v", document)
+			}
+		case "doc-4":
+			if document.FileName != "" {
+				t.Fatalf("missing document must not have a file name: %+v", document)
+			}
+		}
+	}
+}
+
+func TestSessionArchive_NotFound(t *testing.T) {
+	r, ctx := newArchiveService(t)
+
+	_, err := r.SessionArchive(ctx, "unknown")
+	if err != jobs.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
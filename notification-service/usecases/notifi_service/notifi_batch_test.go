@@ -0,0 +1,81 @@
+package notifi_service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"gitlab.com/docshade/common/jobs"
+)
+
+func TestTrackBatch_CompletesOnce(t *testing.T) {
+	ctx := context.Background()
+	r := &notifiService{jobs: jobs.NewMemoryRepository()}
+
+	batch := jobs.Batch{ID: "batch-1", SessionID: "session-1", Total: 3}
+	batchJobs := []jobs.Job{
+		{DocumentID: "doc-1", SessionID: "session-1", BatchID: "batch-1", Status: jobs.StatusQueued},
+		{DocumentID: "doc-2", SessionID: "session-1", BatchID: "batch-1", Status: jobs.StatusQueued},
+		{DocumentID: "doc-3", SessionID: "session-1", BatchID: "batch-1", Status: jobs.StatusQueued},
+	}
+	if err := r.jobs.EnqueueBatch(ctx, batch, batchJobs, nil); err != nil {
+		t.Fatalf("failed to create batch: %v", err)
+	}
+
+	// Пока обработаны не все документы, пакет не завершается
+	for _, finished := range []struct {
+		documentID string
+		status     jobs.Status
+	}{
+		{"doc-1", jobs.StatusDone},
+		{"doc-2", jobs.StatusFailed},
+	} {
+		if err := r.jobs.SetStatus(ctx, finished.documentID, finished.status, ""); err != nil {
+			t.Fatalf("failed to set status: %v", err)
+		}
+		event, completed, err := r.TrackBatch(ctx, "batch-1")
+		if err != nil {
+			t.Fatalf("failed to track batch: %v", err)
+		}
+		if completed {
+			t.Fatalf("batch completed after %s", finished.documentID)
+		}
+		if event.Event != BatchProgressEvent || event.SessionID != "session-1" || event.Total != 3 {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	}
+
+	if err := r.jobs.SetStatus(ctx, "doc-3", jobs.StatusDone, ""); err != nil {
+		t.Fatalf("failed to set status: %v", err)
+	}
+
+	// Последний документ могут отметить несколько обработчиков одновременно, завершение достаётся одному
+	var wg sync.WaitGroup
+	var completions atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			event, completed, err := r.TrackBatch(ctx, "batch-1")
+			if err != nil {
+				t.Errorf("failed to track batch: %v", err)
+				return
+			}
+			if event.Done != 2 || event.Failed != 1 {
+				t.Errorf("unexpected progress %+v", event)
+			}
+			if completed {
+				completions.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if completions.Load() != 1 {
+		t.Fatalf("expected the batch to complete exactly once, got %d", completions.Load())
+	}
+	if _, completed, err := r.TrackBatch(ctx, "batch-1"); err != nil || completed {
+		t.Fatalf("completed batch reported again: %v, %v", completed, err)
+	}
+}
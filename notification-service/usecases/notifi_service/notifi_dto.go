@@ -1,34 +1,104 @@
 package notifi_service
 
-import "context"
+import (
+	"context"
+	"io"
+	"time"
+
+	"gitlab.com/docshade/common/broker"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/messaging"
+)
 
 type NotifiServiceRabbitMQ interface {
 	CreateQueueAndBind(ctx context.Context, queueName, exchange, routingKey string) error
-	ConsumeMessages(ctx context.Context, queueName string, handler func(DocumentMessage) error) error
+	ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, messaging.DocumentProcessed) error) error
 	BindQueue(ctx context.Context, queueName, exchange, routingKey string) error
+	State() broker.State
 }
 
-type NotifiServices3Service interface {
-	Put(ctx context.Context, objectName, path string, objectBody []byte, metaData map[string]string) error
-	IsObjectExist(ctx context.Context, path, objectName string) (bool, error)
-	Remove(ctx context.Context, objectName, path string) error
-	Move(ctx context.Context, objectName, srcPath, destPath, newDirName string) (string, error)
+type NotifiServiceStorage interface {
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	Presign(ctx context.Context, bucket, key string, expiry time.Duration, downloadName string) (string, error)
 }
 
 // HealthDtoOut Output DTO for Health Method
 type HealthDtoOut struct {
 	Message string
+	// RabbitMQ состояние соединения с брокером
+	RabbitMQ broker.State
+}
+
+// HealthDtoIn Input DTO for Health Method
+type HealthDtoIn struct {
+	Message string
+}
+
+// DocumentStatus состояние обработки документа для клиента
+type DocumentStatus struct {
+	DocumentID       string
+	SessionID        string
+	OriginalFileName string
+	Format           string
+	Status           jobs.Status
+	ErrorReason      string
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	FinishedAt       *time.Time
+	// DownloadLink заполняется только для обработанных документов
+	DownloadLink string
 }
 
-type DocumentMessage struct {
+// События пакета в уведомлениях сессии
+const (
+	// BatchProgressEvent отправляется после каждого завершённого документа пакета
+	BatchProgressEvent = "batch.progress"
+	// BatchCompletedEvent отправляется один раз, когда все документы пакета обработаны или завершились ошибкой
+	BatchCompletedEvent = "batch.completed"
+)
+
+// BatchEvent уведомление сессии о ходе обработки пакета
+type BatchEvent struct {
+	Event     string `json:"event"`
+	SessionID string `json:"session_id"`
+	BatchID   string `json:"batch_id"`
+	Total     int    `json:"total"`
+	Done      int    `json:"done"`
+	Failed    int    `json:"failed"`
+}
+
+// ArchiveManifest оглавление архива сессии, кладётся в архив последним файлом
+type ArchiveManifest struct {
+	SessionID string            `json:"session_id"`
+	CreatedAt time.Time         `json:"created_at"`
+	Documents []ArchiveDocument `json:"documents"`
+}
+
+// ArchiveDocument документ сессии в оглавлении архива
+type ArchiveDocument struct {
 	DocumentID       string `json:"document_id"`
 	OriginalFileName string `json:"original_file_name"`
-	S3Path           string `json:"s3_path"`
-	SessionID        string `json:"session_id"`
+	Format           string `json:"format"`
 	Status           string `json:"status"`
+	ErrorReason      string `json:"error_reason,omitempty"`
+	// FileName путь документа в архиве, пустой, если документ в архив не вошёл
+	FileName string `json:"file_name,omitempty"`
 }
 
-// HealthDtoIn Input DTO for Health Method
-type HealthDtoIn struct {
-	Message string
+// WebhookPayload тело вебхука с итогом обработки документа
+type WebhookPayload struct {
+	Event            messaging.EventType        `json:"event"`
+	SessionID        string                     `json:"session_id"`
+	DocumentID       string                     `json:"document_id"`
+	OriginalFileName string                     `json:"original_file_name"`
+	Format           string                     `json:"format"`
+	Status           messaging.ProcessingStatus `json:"status"`
+	// DownloadLink ссылка на результат, действует до DownloadLinkExpiresAt.
+	// Свежую ссылку возвращает GET /v1/documents/{document_id}
+	DownloadLink          string     `json:"download_link,omitempty"`
+	DownloadLinkExpiresAt *time.Time `json:"download_link_expires_at,omitempty"`
+	// SHA256 контрольная сумма анонимизированного документа, по ней клиент проверяет скачанный файл
+	SHA256      string    `json:"sha256,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	ProcessedAt time.Time `json:"processed_at"`
 }
@@ -2,7 +2,10 @@ package notifi_service
 
 import (
 	"notification-service/providers/rabbitmq_provider"
-	"notification-service/providers/s3_provider"
+
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/storage"
+	"gitlab.com/docshade/common/webhook"
 )
 
 type NotifiServiceFactory interface {
@@ -11,23 +14,32 @@ type NotifiServiceFactory interface {
 
 type notifiServiceFactory struct {
 	rabbitmq rabbitmq_provider.RabbitMQ
-	s3       s3_provider.S3
+	storage  storage.Storage
+	buckets  storage.Buckets
+	jobs     jobs.Repository
+	webhooks webhook.Store
 }
 
-func NewNotifiFactory(rabbitmq rabbitmq_provider.RabbitMQ, s3 s3_provider.S3) NotifiServiceFactory {
+func NewNotifiFactory(rabbitmq rabbitmq_provider.RabbitMQ, store storage.Storage, buckets storage.Buckets, jobs jobs.Repository, webhooks webhook.Store) NotifiServiceFactory {
 	return &notifiServiceFactory{
 		rabbitmq: rabbitmq,
-		s3:       s3,
+		storage:  store,
+		buckets:  buckets,
+		jobs:     jobs,
+		webhooks: webhooks,
 	}
 }
 
 func (c *notifiServiceFactory) GetService() NotifiService {
-	return newNotifiService(c.rabbitmq, c.s3)
+	return newNotifiService(c.rabbitmq, c.storage, c.buckets, c.jobs, c.webhooks)
 }
 
-func newNotifiService(rabbitmq rabbitmq_provider.RabbitMQ, s3 s3_provider.S3) NotifiService {
+func newNotifiService(rabbitmq rabbitmq_provider.RabbitMQ, store storage.Storage, buckets storage.Buckets, jobs jobs.Repository, webhooks webhook.Store) NotifiService {
 	return &notifiService{
-		rabbitmq:  rabbitmq,
-		s3Service: s3,
+		rabbitmq: rabbitmq,
+		storage:  store,
+		buckets:  buckets,
+		jobs:     jobs,
+		webhooks: webhooks,
 	}
 }
@@ -1 +1,175 @@
 package notifi_service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/docshade/common/formats"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/storage"
+	"gitlab.com/docshade/common/webhook"
+)
+
+// documentStatus дополняет состояние обработанного документа свежей ссылкой на скачивание
+func (r *notifiService) documentStatus(ctx context.Context, job jobs.Job) (DocumentStatus, error) {
+	status := DocumentStatus{
+		DocumentID:       job.DocumentID,
+		SessionID:        job.SessionID,
+		OriginalFileName: job.OriginalFileName,
+		Format:           job.Format,
+		Status:           job.Status,
+		ErrorReason:      job.ErrorReason,
+		CreatedAt:        job.CreatedAt,
+		UpdatedAt:        job.UpdatedAt,
+		FinishedAt:       job.FinishedAt,
+	}
+
+	if job.Status == jobs.StatusDone {
+		format, ok := formats.ByName(job.Format)
+		if !ok {
+			format = formats.Default
+		}
+
+		link, err := r.GeneratePresignedURL(ctx, format.ObjectKey(job.DocumentID), DownloadLinkExpiry)
+		if err != nil {
+			return DocumentStatus{}, fmt.Errorf("failed to generate download link: %w", err)
+		}
+		status.DownloadLink = link
+	}
+
+	return status, nil
+}
+
+// enqueueWebhook сохраняет доставку итога обработки на адрес клиента, отправит её диспетчер вебхуков
+func (r *notifiService) enqueueWebhook(ctx context.Context, msg messaging.DocumentProcessed) error {
+	payload := WebhookPayload{
+		Event:            messaging.DocumentProcessedType,
+		SessionID:        msg.SessionID,
+		DocumentID:       msg.DocumentID,
+		OriginalFileName: msg.OriginalFileName,
+		Format:           msg.Format,
+		Status:           msg.Status,
+		Error:            msg.Error,
+		ProcessedAt:      msg.ProcessedAt,
+	}
+	if msg.Status == messaging.StatusOK {
+		link, err := r.GeneratePresignedURL(ctx, msg.ObjectKey, DownloadLinkExpiry)
+		if err != nil {
+			return fmt.Errorf("failed to generate download link: %w", err)
+		}
+		expiresAt := time.Now().Add(DownloadLinkExpiry).UTC()
+		payload.DownloadLink = link
+		payload.DownloadLinkExpiresAt = &expiresAt
+		payload.SHA256 = msg.SHA256
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = r.webhooks.Add(ctx, webhook.Delivery{
+		DocumentID: msg.DocumentID,
+		Event:      string(messaging.DocumentProcessedType),
+		URL:        msg.Callback.URL,
+		Secret:     msg.Callback.Secret,
+		Payload:    body,
+	})
+	if err != nil {
+		return err
+	}
+	r.webhooks.Wake()
+
+	return nil
+}
+
+// archiveFileName имя документа в архиве: исходное имя без каталогов с расширением формата.
+// Повторяющиеся имена получают номер, names хранит уже занятые
+func archiveFileName(job jobs.Job, names map[string]bool) string {
+	format, ok := formats.ByName(job.Format)
+	if !ok {
+		format = formats.Default
+	}
+
+	base := path.Base(strings.ReplaceAll(job.OriginalFileName, "\\", "/"))
+	base = strings.TrimSuffix(base, path.Ext(base))
+	if base == "" || base == "." || base == "/" {
+		base = job.DocumentID
+	}
+
+	name := base + format.Extension
+	for i := 2; names[name] || name == ArchiveManifestName; i++ {
+		name = base + " (" + strconv.Itoa(i) + ")" + format.Extension
+	}
+	names[name] = true
+
+	return name
+}
+
+// writeArchiveEntry копирует обработанный документ из хранилища в архив. Возвращает false,
+// если документа в хранилище уже нет, например его удалила очистка по сроку хранения
+func (r *notifiService) writeArchiveEntry(ctx context.Context, zw *zip.Writer, document ArchiveDocument) (bool, error) {
+	format, ok := formats.ByName(document.Format)
+	if !ok {
+		format = formats.Default
+	}
+
+	object, err := r.storage.Get(ctx, r.buckets.Processed, format.ObjectKey(document.DocumentID))
+	if errors.Is(err, storage.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer object.Close()
+
+	// Сжимаются только текстовые форматы, остальные уже сжаты
+	method := zip.Store
+	if strings.HasPrefix(format.MediaType, "text/") {
+		method = zip.Deflate
+	}
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     document.FileName,
+		Method:   method,
+		Modified: time.Now().UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	_, err = io.Copy(entry, object)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// purgeDocument удаляет объект и состояние документа и пишет аудиторскую запись об удалении
+func (r *notifiService) purgeDocument(ctx context.Context, object storage.ObjectInfo, ttl time.Duration) error {
+	err := r.storage.Delete(ctx, object.Bucket, object.Key)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", object.Bucket, object.Key, err)
+	}
+
+	documentID := strings.TrimSuffix(path.Base(object.Key), path.Ext(object.Key))
+	err = r.jobs.Delete(ctx, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete job record of %s: %w", documentID, err)
+	}
+
+	log.Printf("audit: purged document document_id=%s bucket=%s key=%s size=%d last_modified=%s ttl=%s",
+		documentID, object.Bucket, object.Key, object.Size, object.LastModified.UTC().Format(time.RFC3339), ttl)
+
+	return nil
+}
@@ -1,85 +1,294 @@
 package notifi_service
 
 import (
+	"archive/zip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"notification-service/providers/rabbitmq_provider"
-	"notification-service/providers/s3_provider"
 	"time"
+
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/storage"
+	"gitlab.com/docshade/common/webhook"
 )
 
+// DownloadLinkExpiry время жизни ссылки на скачивание обработанного документа
+const DownloadLinkExpiry = 15 * time.Minute
+
+// ArchiveManifestName имя оглавления в архиве сессии
+const ArchiveManifestName = "manifest.json"
+
 type NotifiService interface {
 	GetHealth(ctx context.Context, data HealthDtoIn) (HealthDtoOut, error)
-	ProcessDocumentMessage(ctx context.Context, msg DocumentMessage) error
-	ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, DocumentMessage) error) error
+	ProcessDocumentMessage(ctx context.Context, msg messaging.DocumentProcessed) error
+	ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, messaging.DocumentProcessed) error) error
 	GeneratePresignedURL(ctx context.Context, objectName string, expiry time.Duration) (string, error)
-	GetFileData(ctx context.Context, documentID string) ([]byte, error)
+	GetFileData(ctx context.Context, documentID string) (io.ReadCloser, error)
+	// GetDocumentStatus получить состояние обработки документа со свежей ссылкой на результат
+	GetDocumentStatus(ctx context.Context, documentID string) (DocumentStatus, error)
+	// DocumentSession получить сессию, к которой относится документ, пустую, если документа нет
+	DocumentSession(ctx context.Context, documentID string) (string, error)
+	// ListSessionDocuments получить состояния всех документов сессии
+	ListSessionDocuments(ctx context.Context, sessionID string) ([]DocumentStatus, error)
+	// PurgeExpiredDocuments удалить документы, пролежавшие в бакете дольше ttl, вместе с их состояниями
+	PurgeExpiredDocuments(ctx context.Context, bucket string, ttl time.Duration) (int, error)
+	// PurgeFinishedJobs удалить состояния документов, обработка которых завершилась больше ttl назад,
+	// вместе с завершёнными доставками вебхуков
+	PurgeFinishedJobs(ctx context.Context, ttl time.Duration) (int, error)
+	// ListWebhookDeliveries получить доставки вебхуков документа с журналом попыток
+	ListWebhookDeliveries(ctx context.Context, documentID string) ([]webhook.Delivery, error)
+	// SessionArchive получить оглавление архива сессии: обработанные документы получают имена файлов в архиве
+	SessionArchive(ctx context.Context, sessionID string) (ArchiveManifest, error)
+	// WriteSessionArchive записать в w ZIP архив потоком, читая документы из хранилища по одному.
+	// Документы, удалённые из хранилища к этому моменту, остаются в оглавлении без имени файла
+	WriteSessionArchive(ctx context.Context, manifest ArchiveManifest, w io.Writer) error
+	// TrackBatch получить ход обработки пакета. completed равен true для единственного вызова,
+	// заставшего обработку всех документов пакета завершённой
+	TrackBatch(ctx context.Context, batchID string) (progress BatchEvent, completed bool, err error)
 }
 
 type notifiService struct {
-	s3Service s3_provider.S3
-	rabbitmq  rabbitmq_provider.RabbitMQ
+	storage  storage.Storage
+	buckets  storage.Buckets
+	rabbitmq rabbitmq_provider.RabbitMQ
+	jobs     jobs.Repository
+	webhooks webhook.Store
 }
 
-func NewNotifiService(s3Service s3_provider.S3, rabbitmq rabbitmq_provider.RabbitMQ) NotifiService {
+func NewNotifiService(store storage.Storage, buckets storage.Buckets, rabbitmq rabbitmq_provider.RabbitMQ, jobs jobs.Repository, webhooks webhook.Store) NotifiService {
 	return &notifiService{
-		s3Service: s3Service,
-		rabbitmq:  rabbitmq,
+		storage:  store,
+		buckets:  buckets,
+		rabbitmq: rabbitmq,
+		jobs:     jobs,
+		webhooks: webhooks,
 	}
 }
 
-func (r *notifiService) GetFileData(ctx context.Context, documentID string) ([]byte, error) {
-	return r.s3Service.Get(ctx, documentID)
+func (r *notifiService) GetFileData(ctx context.Context, documentID string) (io.ReadCloser, error) {
+	return r.storage.Get(ctx, r.buckets.Processed, documentID)
 }
 
 func (r *notifiService) GeneratePresignedURL(ctx context.Context, objectName string, expiry time.Duration) (string, error) {
-	return r.s3Service.GeneratePresignedURL(ctx, objectName, expiry)
+	return r.storage.Presign(ctx, r.buckets.Processed, objectName, expiry, objectName)
 }
 
-func (r *notifiService) GetHealth(ctx context.Context, data HealthDtoIn) (HealthDtoOut, error) {
-	return HealthDtoOut{Message: "hello " + data.Message}, nil
+func (r *notifiService) GetDocumentStatus(ctx context.Context, documentID string) (DocumentStatus, error) {
+	job, err := r.jobs.Get(ctx, documentID)
+	if err != nil {
+		return DocumentStatus{}, err
+	}
+
+	return r.documentStatus(ctx, job)
+}
+
+func (r *notifiService) DocumentSession(ctx context.Context, documentID string) (string, error) {
+	job, err := r.jobs.Get(ctx, documentID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return job.SessionID, nil
+}
+
+func (r *notifiService) ListSessionDocuments(ctx context.Context, sessionID string) ([]DocumentStatus, error) {
+	jobList, err := r.jobs.ListBySession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobList) == 0 {
+		return nil, jobs.ErrNotFound
+	}
+
+	result := make([]DocumentStatus, 0, len(jobList))
+	for _, job := range jobList {
+		status, err := r.documentStatus(ctx, job)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, status)
+	}
+
+	return result, nil
 }
 
-func (r *notifiService) ProcessDocumentMessage(ctx context.Context, msg DocumentMessage) error {
-	var notificationMessage map[string]interface{}
+func (r *notifiService) PurgeExpiredDocuments(ctx context.Context, bucket string, ttl time.Duration) (int, error) {
+	objects, err := r.storage.List(ctx, bucket, "")
+	if err != nil {
+		return 0, err
+	}
 
-	if msg.Status == "ok" {
-		// Генерация ссылки для скачивания файла
-		downloadLink := fmt.Sprintf("http://localhost:9000/%s", msg.S3Path)
-		notificationMessage = map[string]interface{}{
-			"session_id":    msg.SessionID,
-			"status":        "ok",
-			"download_link": downloadLink,
+	deadline := time.Now().Add(-ttl)
+	purged := 0
+	for _, object := range objects {
+		if !object.LastModified.Before(deadline) {
+			continue
 		}
-	} else {
-		// Сообщение об ошибке
-		notificationMessage = map[string]interface{}{
-			"session_id": msg.SessionID,
-			"status":     "error",
+
+		err := r.purgeDocument(ctx, object, ttl)
+		if err != nil {
+			return purged, err
 		}
+		purged++
 	}
 
-	messageBytes, err := json.Marshal(notificationMessage)
+	return purged, nil
+}
+
+func (r *notifiService) PurgeFinishedJobs(ctx context.Context, ttl time.Duration) (int, error) {
+	before := time.Now().Add(-ttl)
+	documentIDs, err := r.jobs.DeleteFinishedBefore(ctx, before)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	// Вместе с доставками удаляются ключи подписи клиентов
+	deliveries, err := r.webhooks.DeleteFinishedBefore(ctx, before)
+	if err != nil {
+		return len(documentIDs), err
+	}
+	if deliveries > 0 {
+		log.Printf("audit: purged %d webhook deliveries ttl=%s", deliveries, ttl)
 	}
 
-	log.Println(messageBytes, notificationMessage)
+	for _, documentID := range documentIDs {
+		log.Printf("audit: purged job record document_id=%s ttl=%s", documentID, ttl)
+	}
+
+	return len(documentIDs), nil
+}
+
+func (r *notifiService) GetHealth(ctx context.Context, data HealthDtoIn) (HealthDtoOut, error) {
+	return HealthDtoOut{Message: "hello " + data.Message, RabbitMQ: r.rabbitmq.State()}, nil
+}
+
+// ProcessDocumentMessage фиксирует итог обработки документа перед отправкой уведомления клиенту.
+// Если клиент API указал callback, итог ставится в очередь вебхуков. Ошибка постановки
+// возвращается, чтобы сообщение было доставлено повторно и вебхук не потерялся
+func (r *notifiService) ProcessDocumentMessage(ctx context.Context, msg messaging.DocumentProcessed) error {
+	switch msg.Status {
+	case messaging.StatusError:
+		log.Printf("Document %s of session %s failed: %s", msg.DocumentID, msg.SessionID, msg.Error)
+	case messaging.StatusRejected:
+		log.Printf("Document %s of session %s rejected: %s", msg.DocumentID, msg.SessionID, msg.Error)
+	default:
+		log.Printf("Document %s of session %s processed: %s/%s", msg.DocumentID, msg.SessionID, msg.Bucket, msg.ObjectKey)
+	}
+
+	// Доставка сохраняется один раз на документ, поэтому повтор сообщения после ошибки её не продублирует
+	if msg.Callback != nil {
+		if err := r.enqueueWebhook(ctx, msg); err != nil {
+			return fmt.Errorf("failed to queue webhook for document %s: %w", msg.DocumentID, err)
+		}
+	}
 
 	return nil
 }
 
-func (r *notifiService) ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, DocumentMessage) error) error {
-	return r.rabbitmq.ConsumeMessages(ctx, queueName, func(msg rabbitmq_provider.DocumentMessage) error {
-		documentMsg := DocumentMessage{
-			DocumentID:       msg.DocumentID,
-			OriginalFileName: msg.OriginalFileName,
-			S3Path:           msg.S3Path,
-			SessionID:        msg.SessionID,
-			Status:           msg.Status,
+func (r *notifiService) SessionArchive(ctx context.Context, sessionID string) (ArchiveManifest, error) {
+	jobList, err := r.jobs.ListBySession(ctx, sessionID)
+	if err != nil {
+		return ArchiveManifest{}, err
+	}
+	if len(jobList) == 0 {
+		return ArchiveManifest{}, jobs.ErrNotFound
+	}
+
+	manifest := ArchiveManifest{
+		SessionID: sessionID,
+		Documents: make([]ArchiveDocument, 0, len(jobList)),
+	}
+	names := make(map[string]bool)
+	for _, job := range jobList {
+		document := ArchiveDocument{
+			DocumentID:       job.DocumentID,
+			OriginalFileName: job.OriginalFileName,
+			Format:           job.Format,
+			Status:           string(job.Status),
+			ErrorReason:      job.ErrorReason,
+		}
+		if job.Status == jobs.StatusDone {
+			document.FileName = archiveFileName(job, names)
+		}
+		manifest.Documents = append(manifest.Documents, document)
+	}
+
+	return manifest, nil
+}
+
+func (r *notifiService) WriteSessionArchive(ctx context.Context, manifest ArchiveManifest, w io.Writer) error {
+	zw := zip.NewWriter(w)
+
+	for i := range manifest.Documents {
+		document := &manifest.Documents[i]
+		if document.FileName == "" {
+			continue
 		}
-		return handler(ctx, documentMsg)
+
+		written, err := r.writeArchiveEntry(ctx, zw, *document)
+		if err != nil {
+			return fmt.Errorf("failed to add document %s to archive: %w", document.DocumentID, err)
+		}
+		if !written {
+			document.FileName = ""
+		}
+	}
+
+	manifest.CreatedAt = time.Now().UTC()
+	entry, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     ArchiveManifestName,
+		Method:   zip.Deflate,
+		Modified: manifest.CreatedAt,
+	})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func (r *notifiService) TrackBatch(ctx context.Context, batchID string) (BatchEvent, bool, error) {
+	completed, err := r.jobs.CompleteBatch(ctx, batchID)
+	if err != nil {
+		return BatchEvent{}, false, fmt.Errorf("failed to complete batch: %w", err)
+	}
+
+	progress, err := r.jobs.GetBatch(ctx, batchID)
+	if err != nil {
+		return BatchEvent{}, false, fmt.Errorf("failed to get batch: %w", err)
+	}
+
+	return BatchEvent{
+		Event:     BatchProgressEvent,
+		SessionID: progress.SessionID,
+		BatchID:   progress.ID,
+		Total:     progress.Total,
+		Done:      progress.Done,
+		Failed:    progress.Failed,
+	}, completed, nil
+}
+
+func (r *notifiService) ListWebhookDeliveries(ctx context.Context, documentID string) ([]webhook.Delivery, error) {
+	return r.webhooks.List(ctx, documentID)
+}
+
+func (r *notifiService) ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, messaging.DocumentProcessed) error) error {
+	// Остановка чтения очереди не должна прерывать обработку уже полученного сообщения,
+	// а контекст сообщения несёт его трассировку
+	return r.rabbitmq.ConsumeMessages(ctx, queueName, func(msgCtx context.Context, msg messaging.DocumentProcessed) error {
+		return handler(context.WithoutCancel(msgCtx), msg)
 	})
 }
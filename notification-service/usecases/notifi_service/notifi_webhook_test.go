@@ -0,0 +1,45 @@
+package notifi_service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/webhook"
+)
+
+// failingStore хранилище вебхуков, недоступное для записи
+type failingStore struct {
+	webhook.Store
+	added int
+}
+
+func (s *failingStore) Add(ctx context.Context, d webhook.Delivery) error {
+	s.added++
+	return errors.New("database is unavailable")
+}
+
+func TestProcessDocumentMessage_WebhookNotQueued(t *testing.T) {
+	store := &failingStore{}
+	r := &notifiService{webhooks: store}
+
+	msg := messaging.DocumentProcessed{
+		SessionID:  "session-1",
+		DocumentID: "doc-1",
+		Status:     messaging.StatusRejected,
+		Error:      "unsupported format",
+		Callback:   &messaging.Callback{URL: "https://example.com/hook"},
+	}
+	if err := r.ProcessDocumentMessage(context.Background(), msg); err == nil {
+		t.Fatal("expected an error so that the message is redelivered")
+	}
+	if store.added != 1 {
+		t.Fatalf("expected one attempt to queue the webhook, got %d", store.added)
+	}
+
+	msg.Callback = nil
+	if err := r.ProcessDocumentMessage(context.Background(), msg); err != nil {
+		t.Fatalf("message without callback must not fail: %v", err)
+	}
+}
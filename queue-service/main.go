@@ -2,12 +2,9 @@ package main
 
 import (
 	"context"
-	"os"
-	"os/signal"
 	"queue-service/entrypoints/http/v1/queue_health"
 	dataproviders "queue-service/providers"
 	"queue-service/tasks"
-	"syscall"
 
 	"gitlab.com/docshade/common/core"
 	"gitlab.com/docshade/common/http/middleware"
@@ -17,7 +14,7 @@ import (
 )
 
 func main() {
-	config := core.NewConfig("test")
+	config := core.NewConfig("queue-service")
 	err := config.LoadConfig()
 	if err != nil {
 		logger.Fatalf("Error occurred while loading config: %+v, config: %+v", err, config)
@@ -27,7 +24,7 @@ func main() {
 		logger.Fatalf("%s", err)
 	}
 
-	mw := middleware.NewBaseMiddleware()
+	mw := middleware.NewBaseMiddleware(config.GetAllowedOrigins())
 	service := echo.New()
 
 	microservice := core.NewMicroservice(config, service, mw.GetGlobalMiddlewares())
@@ -35,25 +32,18 @@ func main() {
 
 	addRoutes(config, providers)
 
-	// Start the microservice
-	go func() {
-		microservice.Run()
-	}()
-
-	// Start the queue listener task
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
 	queue_service := providers.GetQueueServiceFactory().GetService()
 
-	go tasks.StartQueueListener(ctx, queue_service)
-
-	// Wait for interrupt signal to gracefully shutdown the service
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	microservice.
+		AddTask("queue-listener", func(ctx context.Context) error {
+			return tasks.StartQueueListener(ctx, queue_service)
+		}).
+		AddTask("queue-metrics", func(ctx context.Context) error {
+			return tasks.StartQueueMetrics(ctx, queue_service)
+		}).
+		AddCloser("providers", providers.Close)
 
-	cancel()
+	microservice.Run()
 }
 
 func addRoutes(config core.Config, providers dataproviders.ExecutorProviders) {
@@ -2,35 +2,72 @@ package providers
 
 import (
 	"context"
+	"errors"
 	"log"
 	anonymizer_provider "queue-service/providers/py-anonymizer_provider"
 	"queue-service/providers/rabbitmq_provider"
-	"queue-service/providers/s3_provider"
+	"queue-service/providers/scanner_provider"
 	queue_service "queue-service/usecases/queue_service"
 
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/database"
+	"gitlab.com/docshade/common/health"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/storage"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type ExecutorProviders interface {
 	GetQueueServiceFactory() queue_service.QueueServiceFactory
+	// Close закрыть соединения провайдеров
+	Close(ctx context.Context) error
 }
 
 type executorProviders struct {
 	queueFactory queue_service.QueueServiceFactory
 	rabbitmq     rabbitmq_provider.RabbitMQ
-	s3           s3_provider.S3
+	storage      storage.Storage
 	anonymizer   anonymizer_provider.Anonymizer
+	db           *pgxpool.Pool
+	jobs         jobs.Repository
 }
 
 func (p *executorProviders) GetQueueServiceFactory() queue_service.QueueServiceFactory {
 	return p.queueFactory
 }
 
+// Close закрывает соединения в порядке, обратном инициализации
+func (p *executorProviders) Close(ctx context.Context) error {
+	if err := p.jobs.Close(); err != nil {
+		return err
+	}
+	p.db.Close()
+
+	if err := p.rabbitmq.Close(); err != nil {
+		return err
+	}
+
+	return p.storage.Close()
+}
+
 // NewProviders инициализация провайдеров
 func NewProviders(config core.Config) (ExecutorProviders, error) {
-	s3 := s3_provider.NewS3(config.GetS3Config())
-	if err := s3.InitS3(); err != nil {
-		log.Println("ошибка подключения к s3 ", err)
+	// Без адреса clamd документы ушли бы анонимайзеру непроверенными, отключить антивирус можно только явно
+	scanCfg := config.GetScanConfig()
+	if *scanCfg.ClamAVEnabled && scanCfg.ClamdAddress == "" {
+		err := errors.New("scan_clamd_address is required unless scan_clamav_enabled is false")
+		log.Println("ошибка настройки антивируса", err)
+		return nil, err
+	}
+
+	buckets := storage.NewBuckets(config.GetS3Config())
+	store, err := storage.New(config.GetS3Config())
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Init(context.Background(), buckets.Incoming, buckets.Processed, buckets.Quarantine); err != nil {
+		log.Println("ошибка подключения к хранилищу ", err)
 		return nil, err
 	}
 
@@ -40,15 +77,21 @@ func NewProviders(config core.Config) (ExecutorProviders, error) {
 		return nil, err
 	}
 
-	err := s3.CreateBucket(context.Background(), "postprocessing")
+	anonymizer := anonymizer_provider.NewAnonymizer(config.GetAnonymizerConfig())
+	if err := anonymizer.InitAnonymizer(); err != nil {
+		return nil, err
+	}
+
+	err = rabbitmq.CreateExchange(context.Background(), "document-exchange")
 	if err != nil {
-		//return nil, err
-		log.Println(err)
-		err = nil
+		log.Println("ошибка подключения к  CreateExchange", err)
+		return nil, err
 	}
 
-	anonymizer := anonymizer_provider.NewAnonymizer(config.GetAnonymizerConfig())
-	if err := anonymizer.InitAnonymizer(); err != nil {
+	// Входящую очередь объявляем и здесь: сервис её потребляет и отвечает за её dead-letter очередь
+	err = rabbitmq.CreateQueueAndBind(context.Background(), "in_queue", "document-exchange", "in-routing-key")
+	if err != nil {
+		log.Println("ошибка подключения к  CreateQueueAndBind", err)
 		return nil, err
 	}
 
@@ -58,12 +101,42 @@ func NewProviders(config core.Config) (ExecutorProviders, error) {
 		return nil, err
 	}
 
-	queueFactory := queue_service.NewQueueFactory(rabbitmq, s3, anonymizer)
+	db, err := database.Connect(context.Background(), config.GetPostgresConfig())
+	if err != nil {
+		log.Println("ошибка подключения к postgres", err)
+		return nil, err
+	}
+
+	jobsRepository := jobs.NewPostgresRepository(db)
+	if err := jobsRepository.Init(context.Background()); err != nil {
+		log.Println("ошибка подготовки таблиц postgres", err)
+		return nil, err
+	}
+
+	// Проверки для /readyz
+	health.Register("s3", store.Ping)
+	health.Register("rabbitmq", rabbitmq.Ping)
+	health.Register("postgres", db.Ping)
+	health.Register("anonymizer", anonymizer.Ping)
+
+	// Разбор структуры PDF дешевле антивируса и идёт первым
+	scanners := []scanner_provider.Scanner{scanner_provider.NewPDFValidator(scanCfg)}
+	if *scanCfg.ClamAVEnabled {
+		clamav := scanner_provider.NewClamAV(scanCfg)
+		scanners = append(scanners, clamav)
+		health.Register("clamav", clamav.Ping)
+	} else {
+		log.Println("ВНИМАНИЕ: антивирус отключён настройкой scan_clamav_enabled, документы не проверяются на вредоносное содержимое")
+	}
+
+	queueFactory := queue_service.NewQueueFactory(rabbitmq, store, buckets, anonymizer, scanners, jobsRepository)
 
 	return &executorProviders{
-		s3:           s3,
+		storage:      store,
 		queueFactory: queueFactory,
 		rabbitmq:     rabbitmq,
 		anonymizer:   anonymizer,
+		db:           db,
+		jobs:         jobsRepository,
 	}, nil
 }
@@ -9,3 +9,9 @@ type AnonymizeDocumentRequest struct {
 type AnonymizeDocumentResponse struct {
 	AnonymizedDocument []byte `json:"anonymized_document"`
 }
+
+// healthPath путь проверки состояния анонимайзера относительно адреса анонимизации
+const healthPath = "health"
+
+// maxErrorBodySize сколько байт ответа с ошибкой попадает в текст ошибки
+const maxErrorBodySize = 4 << 10
@@ -1,28 +1,36 @@
 package anonymizer_provider
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
+	"net/url"
 
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/tracing"
 )
 
 type Anonymizer interface {
 	InitAnonymizer() error
-	AnonymizeDocument(document []byte, filename string) ([]byte, error)
+	// Ping проверить, что анонимайзер отвечает на /health
+	Ping(ctx context.Context) error
+	// AnonymizeDocument отправляет документ в анонимайзер потоком и возвращает поток с результатом,
+	// который нужно закрыть после чтения
+	AnonymizeDocument(ctx context.Context, document io.Reader, filename, contentType string) (io.ReadCloser, error)
 }
 
 type anonymizer struct {
-	cfg core.AnonymizerConfig
+	cfg    core.AnonymizerConfig
+	client *http.Client
 }
 
 func NewAnonymizer(cfg core.AnonymizerConfig) Anonymizer {
 	return &anonymizer{
-		cfg: cfg,
+		cfg:    cfg,
+		client: &http.Client{},
 	}
 }
 
@@ -30,65 +38,89 @@ func (a *anonymizer) InitAnonymizer() error {
 	return nil
 }
 
-func (a *anonymizer) AnonymizeDocument(document []byte, filename string) ([]byte, error) {
-	url := a.cfg.URI
-
-	var b bytes.Buffer
-	w := multipart.NewWriter(&b)
-
-	// Создание поля формы для файла
-	fw, err := w.CreateFormFile("file", filename)
+// Ping обращается к /health рядом с адресом анонимизации: http://host/anonymize -> http://host/health
+func (a *anonymizer) Ping(ctx context.Context) error {
+	base, err := url.Parse(a.cfg.URI)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create form file: %v", err)
+		return fmt.Errorf("invalid anonymizer url: %v", err)
 	}
+	healthURL := base.ResolveReference(&url.URL{Path: healthPath})
 
-	// Установка правильного Content-Type для файла
-	h := make(textproto.MIMEHeader)
-	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
-	h.Set("Content-Type", "application/pdf")
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
 
-	fw, err = w.CreatePart(h)
+	response, err := a.client.Do(request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create form part: %v", err)
+		return err
 	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, maxErrorBodySize))
 
-	// Запись содержимого файла в поле формы
-	if _, err = io.Copy(fw, bytes.NewReader(document)); err != nil {
-		return nil, fmt.Errorf("failed to copy document to form file: %v", err)
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("received non-200 response: %d", response.StatusCode)
 	}
 
-	// Завершение записи multipart/form-data
-	w.Close()
+	return nil
+}
+
+func (a *anonymizer) AnonymizeDocument(ctx context.Context, document io.Reader, filename, contentType string) (io.ReadCloser, error) {
+	url := a.cfg.URI
+
+	// Тело multipart/form-data пишется в трубу параллельно с отправкой запроса,
+	// поэтому документ целиком в памяти не держится
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
 
-	request, err := http.NewRequest("POST", url, &b)
+	go func() {
+		pw.CloseWithError(writeDocumentForm(w, document, filename, contentType))
+	}()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
 	if err != nil {
+		pr.CloseWithError(err)
 		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	// Установка заголовков
 	request.Header.Set("Content-Type", w.FormDataContentType())
 
-	// Логирование заголовков запроса и тела запроса для отладки
-	// fmt.Printf("Request headers: %v\n", request.Header)
-	// fmt.Printf("Request body: %s\n", b.String())
-
-	client := &http.Client{}
-	response, err := client.Do(request)
+	// Спан закрывается с получением ответа: результат дальше читается потоком вызывающим
+	request, span := tracing.StartClientSpan(request)
+	response, err := a.client.Do(request)
+	tracing.EndClientSpan(span, response, err)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %v", err)
 	}
-	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(response.Body)
+		defer response.Body.Close()
+		bodyBytes, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
 		bodyString := string(bodyBytes)
 		return nil, fmt.Errorf("received non-200 response: %d, body: %s", response.StatusCode, bodyString)
 	}
 
-	responseBody, err := io.ReadAll(response.Body)
+	return response.Body, nil
+}
+
+// writeDocumentForm записывает документ единственным полем "file" формы
+func writeDocumentForm(w *multipart.Writer, document io.Reader, filename, contentType string) error {
+	// Установка правильного Content-Type для файла
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	h.Set("Content-Type", contentType)
+
+	fw, err := w.CreatePart(h)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %v", err)
+		return fmt.Errorf("failed to create form part: %v", err)
 	}
 
-	return responseBody, nil
+	// Запись содержимого файла в поле формы
+	if _, err = io.Copy(fw, document); err != nil {
+		return fmt.Errorf("failed to copy document to form file: %v", err)
+	}
+
+	// Завершение записи multipart/form-data
+	return w.Close()
 }
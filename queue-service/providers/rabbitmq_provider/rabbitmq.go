@@ -2,186 +2,324 @@ package rabbitmq_provider
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"log"
+	"strconv"
 	"time"
 
+	"gitlab.com/docshade/common/broker"
 	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/tracing"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 const (
-	maxRetries = 10
-	retryDelay = 5 * time.Second
+	consumerTag   = "queue-service"
+	prefetchCount = 1
+
+	// RetryCountHeader заголовок с количеством повторных попыток обработки сообщения
+	RetryCountHeader          = "x-retry-count"
+	defaultMaxDeliveryRetries = 3
+	defaultRetryMinBackoff    = 5 * time.Second
+	defaultRetryMaxBackoff    = 5 * time.Minute
+	retryPublishTimeout       = 5 * time.Second
 )
 
 type RabbitMQ interface {
 	InitRabbitMQ() error
+	Close() error
+	// State состояние соединения с RabbitMQ
+	State() broker.State
+	// Ping проверка соединения для /readyz
+	Ping(ctx context.Context) error
 	PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) error
 	CreateQueueAndBind(ctx context.Context, queueName, exchange, routingKey string) error
 	CreateExchange(ctx context.Context, exchange string) error
-	ConsumeMessages(ctx context.Context, queueName string, handler func(DocumentMessage) error) error
+	ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, DocumentMessage) error) error
+	QueueDepth(ctx context.Context, queueName string) (int, error)
 }
 
 type rabbitmq struct {
 	cfg core.RabbitMQConfig
-	mq  *amqp.Connection
+	mq  *broker.Manager
+	// publish публикует с подтверждением брокера, в тестах подменяется
+	publish func(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error
 }
 
 func InitRabbitMQ(cfg core.RabbitMQConfig) RabbitMQ {
-	return &rabbitmq{cfg: cfg}
+	mq := broker.NewManager(cfg)
+	return &rabbitmq{cfg: cfg, mq: mq, publish: mq.Publish}
 }
 
+// InitRabbitMQ подключается к RabbitMQ; дальше соединение восстанавливает менеджер
 func (r *rabbitmq) InitRabbitMQ() error {
-	var err error
-	for i := 0; i < maxRetries; i++ {
-		r.mq, err = amqp.Dial(r.cfg.URI)
-		if err == nil {
-			break
+	return r.mq.Connect(context.Background())
+}
+
+// Close закрывает соединение с RabbitMQ
+func (r *rabbitmq) Close() error {
+	return r.mq.Close()
+}
+
+func (r *rabbitmq) State() broker.State {
+	return r.mq.State()
+}
+
+func (r *rabbitmq) Ping(ctx context.Context) error {
+	return r.mq.Ping(ctx)
+}
+
+func (r *rabbitmq) PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) (err error) {
+	headers := amqp.Table{}
+	ctx, span := tracing.StartPublishSpan(ctx, exchange, routingKey, headers)
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	return r.mq.Publish(ctx, exchange, routingKey, amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Headers:      headers,
+		Body:         message,
+	})
+}
+
+func (r *rabbitmq) CreateExchange(ctx context.Context, exchange string) error {
+	return r.mq.Declare(ctx, func(ch *amqp.Channel) error {
+		return ch.ExchangeDeclare(
+			exchange,
+			"direct",
+			true,
+			false,
+			false,
+			false,
+			nil,
+		)
+	})
+}
+
+// CreateQueueAndBind создаёт очередь с dead-letter очередью и очередями отложенных повторов
+// и привязывает её к обменнику. Сама очередь объявляется без аргументов, как и до появления повторов:
+// RabbitMQ не даёт сменить аргументы существующей очереди, поэтому в очереди повторов и в <queueName>.dlq
+// сообщения публикует потребитель
+func (r *rabbitmq) CreateQueueAndBind(ctx context.Context, queueName, exchange, routingKey string) error {
+	return r.mq.Declare(ctx, func(ch *amqp.Channel) error {
+		err := declareQueue(ch, DeadLetterQueue(queueName), nil)
+		if err != nil {
+			return err
 		}
-		time.Sleep(retryDelay)
-	}
-	return nil
+
+		err = r.declareRetryQueues(ch, queueName)
+		if err != nil {
+			return err
+		}
+
+		err = declareQueue(ch, queueName, nil)
+		if err != nil {
+			return err
+		}
+
+		return ch.QueueBind(
+			queueName,
+			routingKey,
+			exchange,
+			false, // noWait
+			nil,   // args
+		)
+	})
 }
 
-func (r *rabbitmq) PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) error {
+func declareQueue(ch *amqp.Channel, queueName string, args amqp.Table) error {
+	_, err := ch.QueueDeclare(
+		queueName,
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		args,
+	)
+
+	return err
+}
+
+// QueueDepth количество сообщений, ожидающих доставки потребителю
+func (r *rabbitmq) QueueDepth(ctx context.Context, queueName string) (int, error) {
 	ch, err := r.mq.Channel()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer ch.Close()
 
-	err = r.CreateExchange(ctx, exchange)
+	queue, err := ch.QueueDeclarePassive(
+		queueName,
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		nil,   // args
+	)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	err = ch.PublishWithContext(ctx,
-		exchange,
-		routingKey,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        message,
+	return queue.Messages, nil
+}
+
+// DeadLetterQueue имя очереди, в которой паркуются необработанные сообщения
+func DeadLetterQueue(queueName string) string {
+	return queueName + ".dlq"
+}
+
+// RetryQueue имя очереди, в которой сообщение выжидает задержку перед повторной попыткой retry.
+// У каждой попытки своя очередь: срок жизни сообщений в ней одинаковый, и сообщение с долгой
+// задержкой не задерживает в голове очереди сообщения с короткой
+func RetryQueue(queueName string, retry int) string {
+	return fmt.Sprintf("%s.retry.%d", queueName, retry)
+}
+
+// declareRetryQueues создаёт очереди отложенных повторов без потребителей. Истёкшее сообщение
+// возвращается через обменник по умолчанию в исходную очередь
+func (r *rabbitmq) declareRetryQueues(ch *amqp.Channel, queueName string) error {
+	for retry := 1; retry <= r.maxRetries(); retry++ {
+		err := declareQueue(ch, RetryQueue(queueName, retry), amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": queueName,
 		})
-	if err != nil {
-		return err
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (r *rabbitmq) CreateExchange(ctx context.Context, exchange string) error {
-	ch, err := r.mq.Channel()
+// ConsumeMessages читает очередь с ручным подтверждением, переживая переподключения к брокеру.
+// Сообщение, которое не удалось обработать, выжидает в очереди повторов нарастающую задержку
+// и возвращается в исходную очередь с увеличенным счётчиком попыток в заголовке, а после
+// исчерпания попыток уходит в dead-letter очередь
+func (r *rabbitmq) ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, DocumentMessage) error) error {
+	return r.mq.Consume(ctx, broker.ConsumeOptions{
+		Queue:    queueName,
+		Tag:      consumerTag,
+		Prefetch: prefetchCount,
+	}, func(ctx context.Context, _ *amqp.Channel, d amqp.Delivery) {
+		r.handleDelivery(ctx, queueName, d, handler)
+	})
+}
+
+// handleDelivery обрабатывает сообщение в спане, продолжающем трассировку отправителя
+func (r *rabbitmq) handleDelivery(ctx context.Context, queueName string, d amqp.Delivery, handler func(context.Context, DocumentMessage) error) {
+	ctx, span := tracing.StartConsumeSpan(ctx, queueName, d.Headers)
+	defer span.End()
+
+	event, err := messaging.DecodeDocumentUploaded(d.Body)
 	if err != nil {
-		return err
+		tracing.RecordError(span, err)
+		// Повторная попытка не поможет ни устаревшему потребителю, ни некорректному сообщению
+		log.Printf("Failed to decode message, dead-lettering it: %v", err)
+		r.forward(d, DeadLetterQueue(queueName), d.Headers, "", "message")
+		return
 	}
-	defer ch.Close()
+	msg := DocumentMessage{DocumentUploaded: event}
 
-	err = ch.ExchangeDeclare(
-		exchange,
-		"direct",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	return err
-}
+	retries := RetryCount(d.Headers)
+	msg.FinalAttempt = retries >= r.maxRetries()
 
-func (r *rabbitmq) CreateQueueAndBind(ctx context.Context, queueName, exchange, routingKey string) error {
-	var err error
-	var ch *amqp.Channel
-	for i := 0; i < maxRetries; i++ {
-		ch, err = r.mq.Channel()
-		if err == nil {
-			defer ch.Close()
-			_, err = ch.QueueDeclare(
-				queueName,
-				true,  // durable
-				false, // autoDelete
-				false, // exclusive
-				false, // noWait
-				nil,   // args
-			)
-			if err != nil {
-				ch.Close()
-				continue
-			}
-
-			err = ch.QueueBind(
-				queueName,
-				routingKey,
-				exchange,
-				false, // noWait
-				nil,   // args
-			)
-			if err != nil {
-				ch.Close()
-				continue
-			}
-
-			return nil
+	err = handler(ctx, msg)
+	tracing.RecordError(span, err)
+	if err == nil {
+		if err := d.Ack(false); err != nil {
+			log.Printf("Failed to ack message for document %s: %v", msg.DocumentID, err)
 		}
-		time.Sleep(retryDelay)
+		return
 	}
-	return err
-}
 
-func (r *rabbitmq) ConsumeMessages(ctx context.Context, queueName string, handler func(DocumentMessage) error) error {
-	ch, err := r.mq.Channel()
-	if err != nil {
-		return err
+	if msg.FinalAttempt {
+		log.Printf("Failed to process document %s after %d retries, dead-lettering it: %v", msg.DocumentID, retries, err)
+		r.forward(d, DeadLetterQueue(queueName), d.Headers, "", "document "+msg.DocumentID)
+		return
 	}
-	defer ch.Close()
 
-	msgs, err := ch.Consume(
-		queueName,
-		"",
-		true,
-		false,
-		false,
-		false,
-		nil,
-	)
-	if err != nil {
-		return err
+	delay := r.retryBackoff(retries + 1)
+	log.Printf("Failed to process document %s (retry %d of %d in %s): %v", msg.DocumentID, retries+1, r.maxRetries(), delay, err)
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
 	}
+	headers[RetryCountHeader] = int32(retries + 1)
+	r.forward(d, RetryQueue(queueName, retries+1), headers, strconv.FormatInt(delay.Milliseconds(), 10), "document "+msg.DocumentID)
+}
+
+// forward публикует копию сообщения в очередь queueName через обменник по умолчанию и подтверждает
+// исходное сообщение только после подтверждения брокера. Если публикация не удалась, сообщение
+// возвращается в исходную очередь, чтобы не потеряться
+func (r *rabbitmq) forward(d amqp.Delivery, queueName string, headers amqp.Table, expiration, subject string) {
+	ctx, cancel := context.WithTimeout(context.Background(), retryPublishTimeout)
+	defer cancel()
 
-	go func() {
-		for d := range msgs {
-			var msg DocumentMessage
-			err := json.Unmarshal(d.Body, &msg)
-			if err != nil {
-				log.Printf("Failed to unmarshal message: %v", err)
-				continue
-			}
-
-			err = handler(msg)
-			if err != nil {
-				log.Printf("Failed to process message: %v", err)
-			}
+	err := r.publish(ctx, "", queueName, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Expiration:   expiration,
+		Body:         d.Body,
+	})
+	if err != nil {
+		log.Printf("Failed to move %s to %s, requeueing it: %v", subject, queueName, err)
+		if err := d.Nack(false, true); err != nil {
+			log.Printf("Failed to requeue %s: %v", subject, err)
 		}
-	}()
+		return
+	}
 
-	log.Printf("Waiting for messages. To exit press CTRL+C")
-	<-ctx.Done()
+	if err := d.Ack(false); err != nil {
+		log.Printf("Failed to ack %s moved to %s: %v", subject, queueName, err)
+	}
+}
 
-	return nil
+func (r *rabbitmq) maxRetries() int {
+	if r.cfg.MaxRetries <= 0 {
+		return defaultMaxDeliveryRetries
+	}
+
+	return r.cfg.MaxRetries
 }
 
-// Helper function to create the message
-func CreateMessage(sessionID, documentID, s3Path, originalFileName string, metadata map[string]string) ([]byte, error) {
-	message := map[string]interface{}{
-		"session_id":         sessionID,
-		"document_id":        documentID,
-		"s3_path":            s3Path,
-		"original_file_name": originalFileName,
-		"metadata":           metadata,
+// retryBackoff задержка перед повторной попыткой retry: удваивается с каждой попыткой,
+// чтобы повторы пережидали сбой хранилища или анонимайзера, а не сгорали за миллисекунды
+func (r *rabbitmq) retryBackoff(retry int) time.Duration {
+	minBackoff, maxBackoff := r.cfg.RetryMinBackoff, r.cfg.RetryMaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = defaultRetryMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultRetryMaxBackoff
 	}
 
-	return json.Marshal(message)
+	delay := minBackoff
+	for i := 1; i < retry && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+
+	return delay
+}
+
+// RetryCount количество уже выполненных повторных попыток обработки сообщения
+func RetryCount(headers amqp.Table) int {
+	switch v := headers[RetryCountHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
 }
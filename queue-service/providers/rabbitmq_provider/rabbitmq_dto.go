@@ -1,8 +1,10 @@
 package rabbitmq_provider
 
+import "gitlab.com/docshade/common/messaging"
+
+// DocumentMessage событие о загрузке документа вместе со сведениями о доставке
 type DocumentMessage struct {
-	DocumentID       string `json:"document_id"`
-	OriginalFileName string `json:"original_file_name"`
-	S3Path           string `json:"s3_path"`
-	SessionID        string `json:"session_id"`
+	messaging.DocumentUploaded
+	// FinalAttempt последняя попытка обработки, при ошибке сообщение уйдёт в dead-letter очередь
+	FinalAttempt bool
 }
@@ -0,0 +1,139 @@
+package rabbitmq_provider
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gitlab.com/docshade/common/broker"
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/messaging"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	r := &rabbitmq{cfg: core.RabbitMQConfig{RetryMinBackoff: time.Second, RetryMaxBackoff: 5 * time.Second}}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if got := r.retryBackoff(i + 1); got != delay {
+			t.Fatalf("retry %d: expected %s, got %s", i+1, delay, got)
+		}
+	}
+
+	if got := (&rabbitmq{}).retryBackoff(1); got != defaultRetryMinBackoff {
+		t.Fatalf("expected default backoff %s, got %s", defaultRetryMinBackoff, got)
+	}
+}
+
+// fakeAcknowledger запоминает, как потребитель завершил сообщение
+type fakeAcknowledger struct {
+	acked, nacked, requeued bool
+}
+
+func (a *fakeAcknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+
+func (a *fakeAcknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type published struct {
+	exchange, routingKey string
+	msg                  amqp.Publishing
+}
+
+func TestHandleDeliveryRouting(t *testing.T) {
+	body, err := messaging.Encode(&messaging.DocumentUploaded{
+		SessionID:  "session",
+		DocumentID: "document",
+		Bucket:     "preprocessing",
+		ObjectKey:  "document.pdf",
+	})
+	if err != nil {
+		t.Fatalf("failed to encode message: %v", err)
+	}
+	failed := errors.New("anonymizer is unavailable")
+
+	tests := []struct {
+		name       string
+		body       []byte
+		retries    int32
+		handlerErr error
+		publishErr error
+		routingKey string
+		expiration string
+		retryCount int32
+		acked      bool
+		requeued   bool
+	}{
+		{name: "processed", body: body, acked: true},
+		{name: "first failure", body: body, handlerErr: failed, routingKey: "in_queue.retry.1", expiration: "1000", retryCount: 1, acked: true},
+		{name: "second failure", body: body, retries: 1, handlerErr: failed, routingKey: "in_queue.retry.2", expiration: "2000", retryCount: 2, acked: true},
+		{name: "final failure", body: body, retries: 3, handlerErr: failed, routingKey: "in_queue.dlq", retryCount: 3, acked: true},
+		{name: "undecodable message", body: []byte("document"), routingKey: "in_queue.dlq", acked: true},
+		{name: "retry not confirmed", body: body, handlerErr: failed, publishErr: broker.ErrNacked, routingKey: "in_queue.retry.1", expiration: "1000", retryCount: 1, requeued: true},
+		{name: "dead letter not confirmed", body: body, retries: 3, handlerErr: failed, publishErr: broker.ErrNacked, routingKey: "in_queue.dlq", retryCount: 3, requeued: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var publishes []published
+			r := &rabbitmq{
+				cfg: core.RabbitMQConfig{MaxRetries: 3, RetryMinBackoff: time.Second, RetryMaxBackoff: time.Minute},
+				publish: func(ctx context.Context, exchange, routingKey string, msg amqp.Publishing) error {
+					publishes = append(publishes, published{exchange: exchange, routingKey: routingKey, msg: msg})
+					return tt.publishErr
+				},
+			}
+
+			ack := &fakeAcknowledger{}
+			headers := amqp.Table{}
+			if tt.retries > 0 {
+				headers[RetryCountHeader] = tt.retries
+			}
+			d := amqp.Delivery{Acknowledger: ack, DeliveryTag: 1, Headers: headers, Body: tt.body}
+
+			r.handleDelivery(context.Background(), "in_queue", d, func(ctx context.Context, msg DocumentMessage) error {
+				if msg.FinalAttempt != (tt.retries >= 3) {
+					t.Fatalf("unexpected final attempt flag %v", msg.FinalAttempt)
+				}
+				return tt.handlerErr
+			})
+
+			if tt.routingKey == "" {
+				if len(publishes) != 0 {
+					t.Fatalf("expected no publishes, got %+v", publishes)
+				}
+			} else {
+				if len(publishes) != 1 {
+					t.Fatalf("expected one publish, got %d", len(publishes))
+				}
+				p := publishes[0]
+				if p.exchange != "" || p.routingKey != tt.routingKey || p.msg.Expiration != tt.expiration || string(p.msg.Body) != string(tt.body) {
+					t.Fatalf("unexpected publish to %q %q with expiration %q", p.exchange, p.routingKey, p.msg.Expiration)
+				}
+				if got := RetryCount(p.msg.Headers); got != int(tt.retryCount) {
+					t.Fatalf("expected retry count %d, got %d", tt.retryCount, got)
+				}
+				if p.msg.DeliveryMode != amqp.Persistent {
+					t.Fatalf("expected persistent message")
+				}
+			}
+
+			// Исходное сообщение подтверждается только после подтверждения публикации, иначе возвращается в очередь
+			if ack.acked != tt.acked || ack.requeued != tt.requeued || (tt.requeued && !ack.nacked) {
+				t.Fatalf("expected acked %v requeued %v, got %+v", tt.acked, tt.requeued, ack)
+			}
+		})
+	}
+}
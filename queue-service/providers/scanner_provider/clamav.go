@@ -0,0 +1,184 @@
+package scanner_provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+)
+
+// Команды clamd с префиксом z: ответ завершается нулевым байтом
+const (
+	clamdInstream = "zINSTREAM\x00"
+	clamdPing     = "zPING\x00"
+
+	// clamdChunkSize размер блока INSTREAM, clamd принимает поток блоками с длиной впереди
+	clamdChunkSize = 64 << 10
+	// maxClamdReplySize предел ответа clamd, в нём только имя сигнатуры или ошибка
+	maxClamdReplySize = 4 << 10
+	// clamdPingTimeout предельное время ответа на PING для /readyz
+	clamdPingTimeout = 5 * time.Second
+)
+
+// ClamAV антивирусная проверка через clamd
+type ClamAV interface {
+	Scanner
+	// Ping проверить, что clamd отвечает на PING
+	Ping(ctx context.Context) error
+}
+
+type clamav struct {
+	network string
+	address string
+	timeout time.Duration
+	dialer  net.Dialer
+}
+
+// NewClamAV клиент clamd по адресу из конфигурации: путь к unix сокету или host:port
+func NewClamAV(cfg core.ScanConfig) ClamAV {
+	network, address := "tcp", cfg.ClamdAddress
+	if rest, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", rest
+	} else if filepath.IsAbs(address) {
+		network = "unix"
+	}
+
+	return &clamav{
+		network: network,
+		address: address,
+		timeout: cfg.ClamdTimeout,
+	}
+}
+
+func (c *clamav) Name() string {
+	return "clamav"
+}
+
+// Scan отправляет документ командой INSTREAM. clamd может оборвать приём, например превысив
+// StreamMaxLength, поэтому после ошибки записи ответ всё равно читается
+func (c *clamav) Scan(ctx context.Context, document io.Reader, format formats.Format) error {
+	conn, err := c.dial(ctx, c.timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	writeErr := writeInstream(conn, document)
+	reply, err := readClamdReply(conn)
+	if err != nil {
+		if writeErr != nil {
+			return fmt.Errorf("failed to send document to clamd: %w", writeErr)
+		}
+		return fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+
+	// Ответ вида "stream: OK", "stream: <сигнатура> FOUND" или "<причина> ERROR"
+	result := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return &Rejection{Scanner: c.Name(), Reason: "malware detected: " + strings.TrimSuffix(result, " FOUND")}
+	case strings.Contains(result, "size limit exceeded"):
+		// Повтор упрётся в тот же StreamMaxLength, а пропускать непроверенный документ нельзя
+		return &Rejection{Scanner: c.Name(), Reason: "document exceeds antivirus size limit"}
+	default:
+		return fmt.Errorf("clamd error: %s", reply)
+	}
+}
+
+func (c *clamav) Ping(ctx context.Context) error {
+	conn, err := c.dial(ctx, clamdPingTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := io.WriteString(conn, clamdPing); err != nil {
+		return err
+	}
+	reply, err := readClamdReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply: %q", reply)
+	}
+
+	return nil
+}
+
+// dial подключается к clamd. Весь обмен ограничен timeout и сроком контекста
+func (c *clamav) dial(ctx context.Context, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// writeInstream пишет команду INSTREAM и документ блоками, каждый с длиной в 4 байта big-endian.
+// Блок нулевой длины завершает поток
+func writeInstream(w io.Writer, document io.Reader) error {
+	bw := bufio.NewWriterSize(w, clamdChunkSize+4)
+	if _, err := bw.WriteString(clamdInstream); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, clamdChunkSize)
+	var length [4]byte
+	for {
+		n, err := io.ReadFull(document, chunk)
+		if n > 0 {
+			binary.BigEndian.PutUint32(length[:], uint32(n))
+			bw.Write(length[:])
+			if _, err := bw.Write(chunk[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	binary.BigEndian.PutUint32(length[:], 0)
+	bw.Write(length[:])
+
+	return bw.Flush()
+}
+
+// readClamdReply читает ответ до нулевого байта или закрытия соединения
+func readClamdReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(io.LimitReader(r, maxClamdReplySize)).ReadBytes(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	reply = bytes.TrimSuffix(reply, []byte{0})
+	if len(reply) == 0 {
+		return "", errors.New("empty clamd reply")
+	}
+
+	return strings.TrimSpace(string(reply)), nil
+}
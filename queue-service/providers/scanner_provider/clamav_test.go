@@ -0,0 +1,146 @@
+package scanner_provider
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+)
+
+// fakeClamd отвечает на PING и INSTREAM как clamd: документ с EICAR считается заражённым,
+// а документ длиннее maxStream отклоняется ошибкой
+func fakeClamd(t *testing.T, maxStream int) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn, maxStream)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveClamd(conn net.Conn, maxStream int) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	command, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	if command == clamdPing {
+		io.WriteString(conn, "PONG\x00")
+		return
+	}
+
+	var stream bytes.Buffer
+	for {
+		var length uint32
+		if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+			return
+		}
+		if length == 0 {
+			break
+		}
+		if stream.Len()+int(length) > maxStream {
+			io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+			return
+		}
+		if _, err := io.CopyN(&stream, r, int64(length)); err != nil {
+			return
+		}
+	}
+
+	if strings.Contains(stream.String(), "BROKEN") {
+		io.WriteString(conn, "Can't allocate memory ERROR\x00")
+		return
+	}
+	if strings.Contains(stream.String(), "EICAR-STANDARD-ANTIVIRUS-TEST-FILE") {
+		io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+		return
+	}
+	io.WriteString(conn, "stream: OK\x00")
+}
+
+func TestClamAV(t *testing.T) {
+	clamav := NewClamAV(core.ScanConfig{ClamdAddress: fakeClamd(t, 1<<20), ClamdTimeout: 5 * time.Second})
+	ctx := context.Background()
+
+	if err := clamav.Ping(ctx); err != nil {
+		t.Fatalf("ping failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		document []byte
+		reason   string
+		fails    bool
+	}{
+		{name: "clean", document: bytes.Repeat([]byte("%PDF-1.7 clean "), 10000)},
+		{name: "empty", document: nil},
+		{
+			name:     "infected",
+			document: []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`),
+			reason:   "malware detected: Eicar-Test-Signature",
+		},
+		{name: "too large", document: make([]byte, 2<<20), reason: "document exceeds antivirus size limit"},
+		{name: "clamd error", document: []byte("%PDF-1.7 BROKEN"), fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := clamav.Scan(ctx, bytes.NewReader(tt.document), formats.PDF)
+
+			var rejection *Rejection
+			switch {
+			case tt.reason != "":
+				if !errors.As(err, &rejection) || rejection.Scanner != "clamav" || rejection.Reason != tt.reason {
+					t.Fatalf("expected rejection %q, got %v", tt.reason, err)
+				}
+			case tt.fails:
+				if err == nil || errors.Is(err, ErrRejected) {
+					t.Fatalf("expected scan error, got %v", err)
+				}
+			default:
+				if err != nil {
+					t.Fatalf("expected clean document, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestClamAVUnavailable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	clamav := NewClamAV(core.ScanConfig{ClamdAddress: address, ClamdTimeout: time.Second})
+	err = clamav.Scan(context.Background(), strings.NewReader("%PDF-1.7"), formats.PDF)
+	if err == nil || errors.Is(err, ErrRejected) {
+		t.Fatalf("expected connection error, got %v", err)
+	}
+}
@@ -0,0 +1,641 @@
+package scanner_provider
+
+import (
+	"bufio"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+)
+
+// Имена PDF, по которым документ отклоняется. Имя проверяется и в словарях самого файла,
+// и в распакованных объектных потоках, где генераторы прячут словари
+var forbiddenNames = map[string]string{
+	"Encrypt":       "encrypted PDF",
+	"JavaScript":    "JavaScript action",
+	"JS":            "JavaScript action",
+	"EmbeddedFile":  "embedded file",
+	"EmbeddedFiles": "embedded file",
+	"EF":            "embedded file",
+}
+
+const (
+	// ratioFloor сжатие потока сверяется с пределом только после стольких распакованных байт:
+	// небольшие потоки из одного цвета законно сжимаются в сотни раз
+	ratioFloor = 64 << 20
+	// maxTokenSize предел имени или ключевого слова, остаток длинного токена пропускается
+	maxTokenSize = 256
+	// maxDepth предел вложенности словарей и массивов
+	maxDepth = 64
+)
+
+var endstream = []byte("endstream")
+
+type pdfValidator struct {
+	maxDecoded int64
+	maxRatio   int64
+}
+
+// NewPDFValidator структурная проверка PDF: отклоняет зашифрованные документы, JavaScript,
+// вложенные файлы и потоки, распаковка которых похожа на zip-бомбу
+func NewPDFValidator(cfg core.ScanConfig) Scanner {
+	return &pdfValidator{
+		maxDecoded: cfg.PDFMaxDecodedSize,
+		maxRatio:   cfg.PDFMaxCompressionRatio,
+	}
+}
+
+func (v *pdfValidator) Name() string {
+	return "pdf"
+}
+
+// Scan читает документ один раз последовательно, не строя дерево объектов: таблицу ссылок
+// повреждённого или намеренно запутанного файла можно подделать, а словари всё равно лежат в нём.
+// Распаковываются только потоки FlateDecode, остальные пропускаются до endstream
+func (v *pdfValidator) Scan(ctx context.Context, document io.Reader, format formats.Format) error {
+	if format.Name != formats.PDF.Name {
+		return nil
+	}
+
+	scan := &pdfScan{
+		ctx:       ctx,
+		validator: v,
+		lex:       newPDFLexer(bufio.NewReader(document), v.Name()),
+	}
+
+	return scan.run()
+}
+
+// pdfScan состояние проверки одного документа
+type pdfScan struct {
+	ctx       context.Context
+	validator *pdfValidator
+	lex       *pdfLexer
+	// decoded сколько байт распаковано из всех потоков документа
+	decoded int64
+	// readErr ошибка чтения самого документа, в отличие от ошибок распаковки она не игнорируется
+	readErr error
+}
+
+func (s *pdfScan) run() error {
+	var last pdfDict
+	for {
+		tok, err := s.lex.next()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case tok.kind == tokenEOF:
+			return nil
+		case tok.kind == tokenDictStart:
+			last, err = s.lex.parseDict(0)
+			if err != nil {
+				return err
+			}
+			continue
+		case tok.kind == tokenKeyword && tok.value == "stream":
+			// Данные потока без словаря тоже не разбираются как токены, чтобы не найти имён в двоичных данных
+			if err := s.ctx.Err(); err != nil {
+				return err
+			}
+			if err := s.stream(last); err != nil {
+				return err
+			}
+		}
+		last = nil
+	}
+}
+
+// stream проверяет данные потока со словарём dict и пропускает их до endstream.
+// Если длина в словаре задана ссылкой, конец потока ищется по endstream, а поток
+// FlateDecode сам сообщает, где закончился
+func (s *pdfScan) stream(dict pdfDict) error {
+	s.lex.skipEOL()
+
+	var data byteReader = s.lex.r
+	length, hasLength := dict["Length"].(int64)
+	var limited *io.LimitedReader
+	if hasLength && length >= 0 {
+		limited = &io.LimitedReader{R: s.lex.r, N: length}
+		data = bufio.NewReader(limited)
+	}
+
+	if layers := flateLayers(dict["Filter"]); layers > 0 {
+		objStm := dict["Type"] == pdfName("ObjStm")
+		if err := s.inflate(data, layers, objStm); err != nil {
+			return err
+		}
+	}
+
+	if limited != nil {
+		if _, err := io.Copy(io.Discard, limited); err != nil {
+			return err
+		}
+	}
+
+	err := skipPast(s.lex.r, endstream)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+// inflate распаковывает layers слоёв FlateDecode, считая распакованные байты. Содержимое
+// объектного потока разбирается как сам документ. Повреждённый поток не повод отклонять
+// документ: он пропускается, а отказ остаётся за анонимайзером
+func (s *pdfScan) inflate(data byteReader, layers int, objStm bool) error {
+	encoded := &countingByteReader{r: data, scan: s}
+	var r io.Reader = encoded
+	for i := 0; i < layers; i++ {
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return s.readErr
+		}
+		defer zr.Close()
+		r = zr
+	}
+	decoded := &decodeLimiter{r: r, scan: s, encoded: encoded}
+
+	var err error
+	if objStm {
+		err = newPDFLexer(bufio.NewReader(decoded), s.lex.scanner).drain()
+	} else {
+		_, err = io.Copy(io.Discard, decoded)
+	}
+
+	var rejection *Rejection
+	switch {
+	case errors.As(err, &rejection):
+		return err
+	case s.readErr != nil:
+		return s.readErr
+	default:
+		return nil
+	}
+}
+
+// flateLayers сколько фильтров FlateDecode стоит в начале цепочки фильтров потока
+func flateLayers(filter pdfObject) int {
+	var filters []pdfObject
+	switch f := filter.(type) {
+	case pdfName:
+		filters = []pdfObject{f}
+	case []pdfObject:
+		filters = f
+	}
+
+	layers := 0
+	for _, f := range filters {
+		if f != pdfName("FlateDecode") && f != pdfName("Fl") {
+			break
+		}
+		layers++
+	}
+
+	return layers
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// countingByteReader считает сжатые байты потока. Он же io.ByteReader, чтобы zlib
+// не читал дальше конца потока
+type countingByteReader struct {
+	r    byteReader
+	n    int64
+	scan *pdfScan
+}
+
+func (c *countingByteReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.scan.noteReadErr(err)
+
+	return n, err
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	c.scan.noteReadErr(err)
+
+	return b, err
+}
+
+func (s *pdfScan) noteReadErr(err error) {
+	if err != nil && !errors.Is(err, io.EOF) && s.readErr == nil {
+		s.readErr = err
+	}
+}
+
+// decodeLimiter прерывает распаковку, когда она выходит за предел документа или сжатие
+// потока больше допустимого
+type decodeLimiter struct {
+	r       io.Reader
+	n       int64
+	scan    *pdfScan
+	encoded *countingByteReader
+}
+
+func (d *decodeLimiter) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	d.scan.decoded += int64(n)
+
+	v := d.scan.validator
+	if d.scan.decoded > v.maxDecoded {
+		return n, d.scan.lex.reject(fmt.Sprintf("decompressed streams exceed %d bytes", v.maxDecoded))
+	}
+	if d.n > ratioFloor && d.n > d.encoded.n*v.maxRatio {
+		return n, d.scan.lex.reject(fmt.Sprintf("stream compression ratio exceeds %d", v.maxRatio))
+	}
+
+	return n, err
+}
+
+// skipPast читает r до конца первого вхождения pattern
+func skipPast(r io.ByteReader, pattern []byte) error {
+	// Префикс-функция: на сколько символов pattern совпадение остаётся после несовпавшего байта
+	fallback := make([]int, len(pattern))
+	for i, k := 1, 0; i < len(pattern); i++ {
+		for k > 0 && pattern[i] != pattern[k] {
+			k = fallback[k-1]
+		}
+		if pattern[i] == pattern[k] {
+			k++
+		}
+		fallback[i] = k
+	}
+
+	matched := 0
+	for matched < len(pattern) {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		for matched > 0 && c != pattern[matched] {
+			matched = fallback[matched-1]
+		}
+		if c == pattern[matched] {
+			matched++
+		}
+	}
+
+	return nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenName
+	tokenKeyword
+	tokenString
+	tokenDictStart
+	tokenDictEnd
+	tokenArrayStart
+	tokenArrayEnd
+)
+
+type pdfToken struct {
+	kind  tokenKind
+	value string
+}
+
+// pdfObject значение PDF: для проверки нужны только числа, имена, массивы и словари,
+// остальное сводится к ключевым словам и строкам без содержимого
+type pdfObject interface{}
+
+type pdfName string
+
+type pdfDict map[string]pdfObject
+
+type pdfRef struct{}
+
+// pdfLexer разбирает PDF на токены. Содержимое строк и комментариев пропускается,
+// а каждое имя сверяется с forbiddenNames
+type pdfLexer struct {
+	r       *bufio.Reader
+	scanner string
+	// pending токены, возвращённые после заглядывания вперёд
+	pending []pdfToken
+}
+
+func newPDFLexer(r *bufio.Reader, scanner string) *pdfLexer {
+	return &pdfLexer{r: r, scanner: scanner}
+}
+
+func (l *pdfLexer) reject(reason string) error {
+	return &Rejection{Scanner: l.scanner, Reason: reason}
+}
+
+// drain читает токены до конца, проверяя имена
+func (l *pdfLexer) drain() error {
+	for {
+		tok, err := l.next()
+		if err != nil || tok.kind == tokenEOF {
+			return err
+		}
+	}
+}
+
+func (l *pdfLexer) unread(tok pdfToken) {
+	l.pending = append(l.pending, tok)
+}
+
+func (l *pdfLexer) next() (pdfToken, error) {
+	if n := len(l.pending); n > 0 {
+		tok := l.pending[n-1]
+		l.pending = l.pending[:n-1]
+		return tok, nil
+	}
+
+	for {
+		c, err := l.r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return pdfToken{kind: tokenEOF}, nil
+		}
+		if err != nil {
+			return pdfToken{}, err
+		}
+
+		switch {
+		case isSpace(c), c == ')', c == '{', c == '}':
+			continue
+		case c == '%':
+			if err := l.skipComment(); err != nil {
+				return pdfToken{}, err
+			}
+		case c == '/':
+			name, err := l.readName()
+			if err != nil {
+				return pdfToken{}, err
+			}
+			if reason, ok := forbiddenNames[name]; ok {
+				return pdfToken{}, l.reject(reason)
+			}
+			return pdfToken{kind: tokenName, value: name}, nil
+		case c == '(':
+			return pdfToken{kind: tokenString}, l.skipLiteralString()
+		case c == '<':
+			if l.peekByte() == '<' {
+				l.r.ReadByte()
+				return pdfToken{kind: tokenDictStart}, nil
+			}
+			return pdfToken{kind: tokenString}, l.skipHexString()
+		case c == '>':
+			if l.peekByte() == '>' {
+				l.r.ReadByte()
+				return pdfToken{kind: tokenDictEnd}, nil
+			}
+		case c == '[':
+			return pdfToken{kind: tokenArrayStart}, nil
+		case c == ']':
+			return pdfToken{kind: tokenArrayEnd}, nil
+		default:
+			l.r.UnreadByte()
+			keyword, err := l.readRegular()
+			return pdfToken{kind: tokenKeyword, value: keyword}, err
+		}
+	}
+}
+
+// parseDict разбирает словарь после "<<". Ключи без значения и лишние токены
+// повреждённого файла пропускаются
+func (l *pdfLexer) parseDict(depth int) (pdfDict, error) {
+	dict := pdfDict{}
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.kind {
+		case tokenEOF, tokenDictEnd:
+			return dict, nil
+		case tokenName:
+			value, err := l.parseValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			dict[tok.value] = value
+		}
+	}
+}
+
+func (l *pdfLexer) parseArray(depth int) ([]pdfObject, error) {
+	var array []pdfObject
+	for {
+		tok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if tok.kind == tokenEOF || tok.kind == tokenArrayEnd {
+			return array, nil
+		}
+		l.unread(tok)
+		value, err := l.parseValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, value)
+	}
+}
+
+func (l *pdfLexer) parseValue(depth int) (pdfObject, error) {
+	if depth > maxDepth {
+		return nil, l.reject("objects are nested too deeply")
+	}
+
+	tok, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok.kind {
+	case tokenName:
+		return pdfName(tok.value), nil
+	case tokenDictStart:
+		return l.parseDict(depth)
+	case tokenArrayStart:
+		return l.parseArray(depth)
+	case tokenKeyword:
+		number, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return tok.value, nil
+		}
+		return l.parseReference(number)
+	case tokenDictEnd, tokenArrayEnd:
+		// Значение пропущено, конец словаря или массива достанется вызывающему
+		l.unread(tok)
+		return nil, nil
+	default:
+		return nil, nil
+	}
+}
+
+// parseReference отличает ссылку "N G R" от числа N
+func (l *pdfLexer) parseReference(number int64) (pdfObject, error) {
+	generation, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := strconv.ParseInt(generation.value, 10, 64); generation.kind != tokenKeyword || err != nil {
+		l.unread(generation)
+		return number, nil
+	}
+
+	r, err := l.next()
+	if err != nil {
+		return nil, err
+	}
+	if r.kind == tokenKeyword && r.value == "R" {
+		return pdfRef{}, nil
+	}
+	l.unread(r)
+	l.unread(generation)
+
+	return number, nil
+}
+
+// skipEOL пропускает конец строки после ключевого слова stream: CRLF или LF
+func (l *pdfLexer) skipEOL() {
+	switch l.peekByte() {
+	case '\r':
+		l.r.ReadByte()
+		if l.peekByte() == '\n' {
+			l.r.ReadByte()
+		}
+	case '\n':
+		l.r.ReadByte()
+	}
+}
+
+func (l *pdfLexer) peekByte() byte {
+	b, err := l.r.Peek(1)
+	if err != nil {
+		return 0
+	}
+
+	return b[0]
+}
+
+func (l *pdfLexer) skipComment() error {
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return ignoreEOF(err)
+		}
+		if c == '\r' || c == '\n' {
+			return nil
+		}
+	}
+}
+
+// readName читает имя, раскрывая экранирование #xx: /J#61vaScript то же, что /JavaScript
+func (l *pdfLexer) readName() (string, error) {
+	var name []byte
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return string(name), ignoreEOF(err)
+		}
+		if isSpace(c) || isDelimiter(c) {
+			l.r.UnreadByte()
+			return string(name), nil
+		}
+		if c == '#' {
+			if hex, err := l.r.Peek(2); err == nil {
+				if value, err := strconv.ParseUint(string(hex), 16, 8); err == nil {
+					l.r.Discard(2)
+					c = byte(value)
+				}
+			}
+		}
+		if len(name) < maxTokenSize {
+			name = append(name, c)
+		}
+	}
+}
+
+func (l *pdfLexer) readRegular() (string, error) {
+	var token []byte
+	for {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return string(token), ignoreEOF(err)
+		}
+		if isSpace(c) || isDelimiter(c) {
+			l.r.UnreadByte()
+			return string(token), nil
+		}
+		if len(token) < maxTokenSize {
+			token = append(token, c)
+		}
+	}
+}
+
+// skipLiteralString пропускает строку в скобках: скобки внутри могут быть вложенными или экранированными
+func (l *pdfLexer) skipLiteralString() error {
+	depth := 1
+	for depth > 0 {
+		c, err := l.r.ReadByte()
+		if err != nil {
+			return ignoreEOF(err)
+		}
+		switch c {
+		case '\\':
+			if _, err := l.r.ReadByte(); err != nil {
+				return ignoreEOF(err)
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+	}
+
+	return nil
+}
+
+func (l *pdfLexer) skipHexString() error {
+	_, err := l.r.ReadBytes('>')
+
+	return ignoreEOF(err)
+}
+
+func ignoreEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+
+	return false
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+
+	return false
+}
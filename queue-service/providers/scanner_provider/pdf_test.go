@@ -0,0 +1,160 @@
+package scanner_provider
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gitlab.com/docshade/common/core"
+	"gitlab.com/docshade/common/formats"
+)
+
+func deflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	w.Close()
+
+	return buf.Bytes()
+}
+
+// pdfStream объект потока, length пустая строка означает длину ссылкой
+func pdfStream(dict string, data []byte, length string) string {
+	if length == "" {
+		length = fmt.Sprint(len(data))
+	}
+
+	return fmt.Sprintf("4 0 obj\n<< %s /Length %s >>\nstream\n%s\nendstream\nendobj\n", dict, length, data)
+}
+
+func pdfDocument(objects ...string) []byte {
+	return []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n" +
+		"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+		"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n" +
+		"3 0 obj\n<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R >>\nendobj\n" +
+		strings.Join(objects, "") +
+		"trailer\n<< /Root 1 0 R /Size 5 >>\nstartxref\n0\n%%EOF\n")
+}
+
+func TestPDFValidator(t *testing.T) {
+	content := deflate(t, []byte("BT /F1 12 Tf (Hello) Tj ET"))
+	objStm := deflate(t, []byte("5 0 6 40 << /S /JavaScript /JS (app.alert(1)) >> << /Type /Action >>"))
+	// Двоичные данные потока не разбираются, даже если в них встречаются запрещённые имена
+	binary := []byte("\x00\x01/JS (unbalanced /EmbeddedFile")
+
+	tests := []struct {
+		name     string
+		document []byte
+		format   formats.Format
+		reason   string
+	}{
+		{name: "clean", document: pdfDocument(pdfStream("/Filter /FlateDecode", content, ""))},
+		{name: "clean with indirect length", document: pdfDocument(pdfStream("/Filter /FlateDecode", content, "7 0 R"))},
+		{name: "binary stream", document: pdfDocument(pdfStream("/Subtype /Image", binary, ""))},
+		{name: "binary stream with indirect length", document: pdfDocument(pdfStream("/Subtype /Image", binary, "7 0 R"))},
+		{name: "names in strings", document: pdfDocument("5 0 obj\n<< /Title (/JavaScript) /Subject <2F4A53> >>\nendobj\n")},
+		{name: "not a pdf", document: []byte("/JavaScript"), format: formats.TXT},
+		{
+			name:     "encrypted",
+			document: bytes.Replace(pdfDocument(), []byte("/Size 5"), []byte("/Size 5 /Encrypt 9 0 R"), 1),
+			reason:   "encrypted PDF",
+		},
+		{
+			name:     "javascript action",
+			document: pdfDocument("5 0 obj\n<< /Type /Action /S /JavaScript /JS (app.alert(1)) >>\nendobj\n"),
+			reason:   "JavaScript action",
+		},
+		{
+			name:     "escaped name",
+			document: pdfDocument("5 0 obj\n<< /OpenAction << /S /J#61vaScript >> >>\nendobj\n"),
+			reason:   "JavaScript action",
+		},
+		{
+			name:     "javascript in object stream",
+			document: pdfDocument(pdfStream("/Type /ObjStm /N 2 /First 9 /Filter /FlateDecode", objStm, "7 0 R")),
+			reason:   "JavaScript action",
+		},
+		{
+			name:     "embedded file",
+			document: pdfDocument("5 0 obj\n<< /Names << /EmbeddedFiles 6 0 R >> >>\nendobj\n"),
+			reason:   "embedded file",
+		},
+	}
+
+	validator := NewPDFValidator(core.ScanConfig{PDFMaxDecodedSize: 1 << 30, PDFMaxCompressionRatio: 1000})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := tt.format
+			if format.Name == "" {
+				format = formats.PDF
+			}
+
+			err := validator.Scan(context.Background(), bytes.NewReader(tt.document), format)
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("expected clean document, got %v", err)
+				}
+				return
+			}
+
+			var rejection *Rejection
+			if !errors.As(err, &rejection) || !errors.Is(err, ErrRejected) {
+				t.Fatalf("expected rejection %q, got %v", tt.reason, err)
+			}
+			if rejection.Scanner != "pdf" || rejection.Reason != tt.reason {
+				t.Fatalf("expected rejection %q, got %+v", tt.reason, rejection)
+			}
+		})
+	}
+}
+
+func TestPDFValidatorZipBomb(t *testing.T) {
+	zeros := make([]byte, 80<<20)
+	once := deflate(t, zeros)
+	twice := deflate(t, once)
+
+	tests := []struct {
+		name     string
+		document []byte
+		cfg      core.ScanConfig
+		reject   bool
+	}{
+		{
+			name:     "within limits",
+			document: pdfDocument(pdfStream("/Filter /FlateDecode", once, "")),
+			cfg:      core.ScanConfig{PDFMaxDecodedSize: 1 << 30, PDFMaxCompressionRatio: 1100},
+		},
+		{
+			name:     "decoded size",
+			document: pdfDocument(pdfStream("/Filter /FlateDecode", once, "7 0 R")),
+			cfg:      core.ScanConfig{PDFMaxDecodedSize: 16 << 20, PDFMaxCompressionRatio: 1100},
+			reject:   true,
+		},
+		{
+			name:     "nested compression",
+			document: pdfDocument(pdfStream("/Filter [/FlateDecode /FlateDecode]", twice, "")),
+			cfg:      core.ScanConfig{PDFMaxDecodedSize: 1 << 30, PDFMaxCompressionRatio: 1100},
+			reject:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewPDFValidator(tt.cfg).Scan(context.Background(), bytes.NewReader(tt.document), formats.PDF)
+			if tt.reject != errors.Is(err, ErrRejected) {
+				t.Fatalf("expected rejection %v, got %v", tt.reject, err)
+			}
+			if !tt.reject && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
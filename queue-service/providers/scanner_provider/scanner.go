@@ -0,0 +1,38 @@
+// Package scanner_provider проверки документа перед анонимизацией: антивирус ClamAV
+// и разбор структуры PDF. Документ, не прошедший проверку, отправляется в карантин
+package scanner_provider
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"gitlab.com/docshade/common/formats"
+)
+
+// ErrRejected документ не прошёл проверку
+var ErrRejected = errors.New("document rejected by scanner")
+
+// Rejection причина, по которой проверка отклонила документ
+type Rejection struct {
+	// Scanner имя проверки, отклонившей документ
+	Scanner string
+	Reason  string
+}
+
+func (r *Rejection) Error() string {
+	return r.Scanner + ": " + r.Reason
+}
+
+func (r *Rejection) Unwrap() error {
+	return ErrRejected
+}
+
+type Scanner interface {
+	// Name имя проверки для метрик и причины отказа
+	Name() string
+	// Scan проверяет документ, читая его потоком, и может остановиться раньше его конца.
+	// Отклонённый документ возвращает ошибку *Rejection, остальные ошибки означают,
+	// что проверку выполнить не удалось и её нужно повторить
+	Scan(ctx context.Context, document io.Reader, format formats.Format) error
+}
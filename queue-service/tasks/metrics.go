@@ -0,0 +1,49 @@
+package tasks
+
+import (
+	"context"
+	"log"
+	"queue-service/providers/rabbitmq_provider"
+	"queue-service/usecases/queue_service"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/docshade/common/metrics"
+)
+
+// queueMetricsInterval как часто опрашивать брокер о глубине очередей
+const queueMetricsInterval = 15 * time.Second
+
+var queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "queue",
+	Name:      "messages",
+	Help:      "Number of messages waiting in a queue.",
+}, []string{"queue"})
+
+// StartQueueMetrics периодически обновляет глубину входящей очереди и её dead-letter очереди
+func StartQueueMetrics(ctx context.Context, queueService queue_service.QueueService) error {
+	queues := []string{inQueue, rabbitmq_provider.DeadLetterQueue(inQueue)}
+
+	ticker := time.NewTicker(queueMetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, queueName := range queues {
+			depth, err := queueService.QueueDepth(ctx, queueName)
+			if err != nil {
+				// Брокер может быть временно недоступен, это не повод останавливать сервис
+				log.Printf("Failed to get depth of queue %s: %v", queueName, err)
+				continue
+			}
+			queueDepth.WithLabelValues(queueName).Set(float64(depth))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
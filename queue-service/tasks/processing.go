@@ -2,13 +2,19 @@ package tasks
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"queue-service/usecases/queue_service"
 )
 
-func StartQueueListener(ctx context.Context, queueService queue_service.QueueService) {
-	err := queueService.ConsumeMessages(ctx, "in_queue", queueService.ProcessDocumentMessage)
+// inQueue очередь документов, ожидающих анонимизации
+const inQueue = "in_queue"
+
+// StartQueueListener читает входящую очередь до отмены контекста
+func StartQueueListener(ctx context.Context, queueService queue_service.QueueService) error {
+	err := queueService.ConsumeMessages(ctx, inQueue, queueService.ProcessDocumentMessage)
 	if err != nil {
-		log.Fatalf("Failed to start queue listener: %v", err)
+		return fmt.Errorf("queue listener: %w", err)
 	}
+
+	return nil
 }
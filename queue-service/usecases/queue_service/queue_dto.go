@@ -1,35 +1,40 @@
 package queue_service
 
-import "context"
+import (
+	"context"
+	"io"
+	"queue-service/providers/rabbitmq_provider"
+
+	"gitlab.com/docshade/common/broker"
+	"gitlab.com/docshade/common/storage"
+)
 
 type QueueServiceRabbitMQ interface {
 	PublishMessage(ctx context.Context, exchange, routingKey string, message []byte) error
 	CreateQueueAndBind(ctx context.Context, queueName, exchange, routingKey string) error
 	CreateExchange(ctx context.Context, exchange string) error
-	ConsumeMessages(ctx context.Context, queueName string, handler func(DocumentMessage) error) error
+	ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, rabbitmq_provider.DocumentMessage) error) error
+	QueueDepth(ctx context.Context, queueName string) (int, error)
+	State() broker.State
 }
 
-type QueueServices3Service interface {
-	Put(ctx context.Context, objectName, path string, objectBody []byte, metaData map[string]string) error
-	IsObjectExist(ctx context.Context, path, objectName string) (bool, error)
-	Remove(ctx context.Context, objectName, path string) error
-	Move(ctx context.Context, objectName, srcPath, destPath, newDirName string) (string, error)
+type QueueServiceStorage interface {
+	Put(ctx context.Context, bucket, key string, body io.Reader, size int64, opts storage.PutOptions) error
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, bucket, key string) (storage.ObjectInfo, error)
+	Delete(ctx context.Context, bucket, key string) error
+	Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error
 }
 
 type QueueAnonymizerService interface {
-	AnonymizeDocument(document []byte) ([]byte, error)
+	AnonymizeDocument(ctx context.Context, document io.Reader, filename, contentType string) (io.ReadCloser, error)
 }
 
 // HealthDtoOut Output DTO for Health Method
 type HealthDtoOut struct {
 	Message string
-}
-
-type DocumentMessage struct {
-	DocumentID       string `json:"document_id"`
-	OriginalFileName string `json:"original_file_name"`
-	S3Path           string `json:"s3_path"`
-	SessionID        string `json:"session_id"`
+	// RabbitMQ состояние соединения с брокером
+	RabbitMQ broker.State
 }
 
 // HealthDtoIn Input DTO for Health Method
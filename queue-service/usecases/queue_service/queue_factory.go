@@ -3,7 +3,10 @@ package queue_service
 import (
 	anonymizer_service "queue-service/providers/py-anonymizer_provider"
 	"queue-service/providers/rabbitmq_provider"
-	"queue-service/providers/s3_provider"
+	"queue-service/providers/scanner_provider"
+
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/storage"
 )
 
 type QueueServiceFactory interface {
@@ -12,26 +15,35 @@ type QueueServiceFactory interface {
 
 type queueServiceFactory struct {
 	rabbitmq   rabbitmq_provider.RabbitMQ
-	s3         s3_provider.S3
+	storage    storage.Storage
+	buckets    storage.Buckets
 	anonymizer anonymizer_service.Anonymizer
+	scanners   []scanner_provider.Scanner
+	jobs       jobs.Repository
 }
 
-func NewQueueFactory(rabbitmq rabbitmq_provider.RabbitMQ, s3 s3_provider.S3, anonymizer anonymizer_service.Anonymizer) QueueServiceFactory {
+func NewQueueFactory(rabbitmq rabbitmq_provider.RabbitMQ, store storage.Storage, buckets storage.Buckets, anonymizer anonymizer_service.Anonymizer, scanners []scanner_provider.Scanner, jobs jobs.Repository) QueueServiceFactory {
 	return &queueServiceFactory{
 		rabbitmq:   rabbitmq,
-		s3:         s3,
+		storage:    store,
+		buckets:    buckets,
 		anonymizer: anonymizer,
+		scanners:   scanners,
+		jobs:       jobs,
 	}
 }
 
 func (c *queueServiceFactory) GetService() QueueService {
-	return newQueueService(c.rabbitmq, c.s3, c.anonymizer)
+	return newQueueService(c.rabbitmq, c.storage, c.buckets, c.anonymizer, c.scanners, c.jobs)
 }
 
-func newQueueService(rabbitmq rabbitmq_provider.RabbitMQ, s3 s3_provider.S3, anonymizer anonymizer_service.Anonymizer) QueueService {
+func newQueueService(rabbitmq rabbitmq_provider.RabbitMQ, store storage.Storage, buckets storage.Buckets, anonymizer anonymizer_service.Anonymizer, scanners []scanner_provider.Scanner, jobs jobs.Repository) QueueService {
 	return &queueService{
 		rabbitmq:   rabbitmq,
-		s3Service:  s3,
+		storage:    store,
+		buckets:    buckets,
 		anonymizer: anonymizer,
+		scanners:   scanners,
+		jobs:       jobs,
 	}
 }
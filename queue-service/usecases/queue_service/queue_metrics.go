@@ -0,0 +1,82 @@
+package queue_service
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gitlab.com/docshade/common/metrics"
+)
+
+// Результаты обработки сообщения для метрики documentsProcessed
+const (
+	resultDone   = "done"
+	resultRetry  = "retry"
+	resultFailed = "failed"
+	// resultRejected документ отклонён проверкой и перенесён в карантин
+	resultRejected = "rejected"
+)
+
+var (
+	consumerLag = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "queue",
+		Name:      "consumer_lag_seconds",
+		Help:      "Time between document upload and the start of its processing attempt.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 14),
+	})
+
+	anonymizationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "queue",
+		Name:      "anonymization_duration_seconds",
+		Help:      "Time to anonymize a document and store the result, by format.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"format"})
+
+	anonymizationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "queue",
+		Name:      "anonymization_failures_total",
+		Help:      "Number of failed anonymization attempts, by format.",
+	}, []string{"format"})
+
+	checksumMismatches = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "queue",
+		Name:      "checksum_mismatches_total",
+		Help:      "Number of downloaded documents that did not match the checksum computed at upload, by format.",
+	}, []string{"format"})
+
+	scanDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "queue",
+		Name:      "scan_duration_seconds",
+		Help:      "Time to scan a document before anonymization, by scanner.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 14),
+	}, []string{"scanner"})
+
+	documentsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "queue",
+		Name:      "documents_rejected_total",
+		Help:      "Number of documents rejected before anonymization and moved to quarantine, by scanner.",
+	}, []string{"scanner"})
+
+	documentsProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "queue",
+		Name:      "documents_processed_total",
+		Help:      "Number of processing attempts by result: done, retry, failed or rejected.",
+	}, []string{"result"})
+)
+
+// processingResult результат попытки: ошибка на последней попытке означает, что документ не будет обработан
+func processingResult(err error, finalAttempt bool) string {
+	switch {
+	case err == nil:
+		return resultDone
+	case finalAttempt:
+		return resultFailed
+	default:
+		return resultRetry
+	}
+}
@@ -1 +1,224 @@
 package queue_service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"queue-service/providers/rabbitmq_provider"
+	"queue-service/providers/scanner_provider"
+	"time"
+
+	"gitlab.com/docshade/common/formats"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/storage"
+)
+
+// anonymize прогоняет исходный документ через анонимайзер и сохраняет результат, не загружая
+// документ в память и не копируя его на диск. До передачи анонимайзеру исходный документ сверяется
+// с контрольной суммой и проверяется сканерами. Сумма результата считается по пути в хранилище
+// и записывается в метаданные объекта после записи. Возвращает контрольную сумму результата
+func (r *queueService) anonymize(ctx context.Context, msg rabbitmq_provider.DocumentMessage, format formats.Format, destBucket, destKey string) (string, error) {
+	if err := r.inspect(ctx, msg, format); err != nil {
+		return "", err
+	}
+
+	// Step 1: Download the file from storage
+	object, err := r.storage.Get(ctx, msg.Bucket, msg.ObjectKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to download document: %w", err)
+	}
+	defer object.Close()
+
+	// Step 2: Anonymize the document
+	// Анонимайзер отдаёт результат потоком, поэтому его время измеряется вместе с сохранением результата
+	start := time.Now()
+	anonymizedDocument, err := r.anonymizer.AnonymizeDocument(ctx, object, msg.ObjectKey, format.MediaType)
+	if err != nil {
+		anonymizationFailures.WithLabelValues(format.Name).Inc()
+		return "", fmt.Errorf("failed to anonymize document: %w", err)
+	}
+	defer anonymizedDocument.Close()
+
+	// Step 3: Upload the anonymized document to storage
+	hash := sha256.New()
+	err = r.storage.Put(ctx, destBucket, destKey, io.TeeReader(anonymizedDocument, hash), -1, storage.PutOptions{
+		ContentType: format.MediaType,
+	})
+	if err != nil {
+		anonymizationFailures.WithLabelValues(format.Name).Inc()
+		return "", fmt.Errorf("failed to upload anonymized document: %w", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	// Результат без суммы следующая попытка создаст заново
+	if err := storage.SetChecksum(ctx, r.storage, destBucket, destKey, sum); err != nil {
+		return "", fmt.Errorf("failed to save anonymized document checksum: %w", err)
+	}
+	anonymizationDuration.WithLabelValues(format.Name).Observe(time.Since(start).Seconds())
+
+	return sum, nil
+}
+
+// inspect прогоняет исходный документ через сканеры по порядку до первого отказа. Каждый сканер
+// читает документ из хранилища заново, а при первом чтении документ сверяется с контрольной суммой
+func (r *queueService) inspect(ctx context.Context, msg rabbitmq_provider.DocumentMessage, format formats.Format) error {
+	scanners := r.scanners
+
+	// Сообщения старых версий приходят без суммы, такие документы не сверяются
+	if msg.SHA256 != "" {
+		var first scanner_provider.Scanner
+		if len(scanners) > 0 {
+			first, scanners = scanners[0], scanners[1:]
+		}
+		if err := r.verify(ctx, msg, format, first); err != nil {
+			return err
+		}
+	}
+
+	for _, scanner := range scanners {
+		err := r.readSource(ctx, msg, func(document io.Reader) error {
+			return r.scan(ctx, scanner, document, format)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verify сверяет исходный документ с суммой из сообщения, по пути передавая его сканеру, если он задан.
+// Сканер может остановиться раньше конца документа, поэтому остаток дочитывается. Несовпадение суммы
+// важнее отказа сканера: проверено было не то содержимое, которое загрузил клиент
+func (r *queueService) verify(ctx context.Context, msg rabbitmq_provider.DocumentMessage, format formats.Format, scanner scanner_provider.Scanner) error {
+	return r.readSource(ctx, msg, func(document io.Reader) error {
+		hash := sha256.New()
+		document = io.TeeReader(document, hash)
+
+		var scanErr error
+		if scanner != nil {
+			scanErr = r.scan(ctx, scanner, document, format)
+		}
+		if _, err := io.Copy(io.Discard, document); err != nil {
+			return fmt.Errorf("failed to download document: %w", err)
+		}
+
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != msg.SHA256 {
+			checksumMismatches.WithLabelValues(format.Name).Inc()
+			return fmt.Errorf("%w: document %s/%s expected sha256 %s, got %s", storage.ErrChecksumMismatch, msg.Bucket, msg.ObjectKey, msg.SHA256, sum)
+		}
+
+		return scanErr
+	})
+}
+
+// readSource открывает исходный документ в хранилище и передаёт его read
+func (r *queueService) readSource(ctx context.Context, msg rabbitmq_provider.DocumentMessage, read func(document io.Reader) error) error {
+	object, err := r.storage.Get(ctx, msg.Bucket, msg.ObjectKey)
+	if err != nil {
+		return fmt.Errorf("failed to download document: %w", err)
+	}
+	defer object.Close()
+
+	return read(object)
+}
+
+// scan проверяет документ одним сканером
+func (r *queueService) scan(ctx context.Context, scanner scanner_provider.Scanner, document io.Reader, format formats.Format) error {
+	start := time.Now()
+	err := scanner.Scan(ctx, document, format)
+	scanDuration.WithLabelValues(scanner.Name()).Observe(time.Since(start).Seconds())
+
+	var rejection *scanner_provider.Rejection
+	if errors.As(err, &rejection) {
+		documentsRejected.WithLabelValues(scanner.Name()).Inc()
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to scan document with %s: %w", scanner.Name(), err)
+	}
+
+	return nil
+}
+
+// quarantine переносит отклонённый документ в бакет карантина и сообщает об отказе.
+// Исходный объект удаляется последним: если перенос или уведомление не удались, повтор начнётся заново
+func (r *queueService) quarantine(ctx context.Context, msg rabbitmq_provider.DocumentMessage, rejection *scanner_provider.Rejection) error {
+	err := r.storage.Copy(ctx, msg.Bucket, msg.ObjectKey, r.buckets.Quarantine, msg.ObjectKey)
+	if err != nil {
+		return fmt.Errorf("failed to quarantine document: %w", err)
+	}
+	log.Printf("Document %s quarantined to %s/%s: %v", msg.DocumentID, r.buckets.Quarantine, msg.ObjectKey, rejection)
+
+	r.setStatus(ctx, msg.DocumentID, jobs.StatusQuarantined, rejection.Error())
+
+	err = r.publishNotification(ctx, &messaging.DocumentProcessed{
+		SessionID:        msg.SessionID,
+		DocumentID:       msg.DocumentID,
+		OriginalFileName: msg.OriginalFileName,
+		Format:           msg.Format,
+		Status:           messaging.StatusRejected,
+		Error:            rejectionReason + rejection.Reason,
+		ProcessedAt:      time.Now().UTC(),
+		Callback:         msg.Callback,
+		BatchID:          msg.BatchID,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Оставшийся исходный объект удалит очистка по сроку хранения
+	if err := r.storage.Delete(ctx, msg.Bucket, msg.ObjectKey); err != nil {
+		log.Printf("Failed to remove quarantined document %s: %v", msg.ObjectKey, err)
+	}
+
+	return nil
+}
+
+const rejectionReason = "Document rejected by security checks: "
+
+const failureReason = "Something went wrong, please try again later"
+
+const corruptedReason = "Document was damaged after upload, please upload it again"
+
+// publishFailure сообщает сервису уведомлений, что документ обработать не удалось
+func (r *queueService) publishFailure(ctx context.Context, msg rabbitmq_provider.DocumentMessage, reason string) error {
+	return r.publishNotification(ctx, &messaging.DocumentProcessed{
+		SessionID:        msg.SessionID,
+		DocumentID:       msg.DocumentID,
+		OriginalFileName: msg.OriginalFileName,
+		Format:           msg.Format,
+		Status:           messaging.StatusError,
+		Error:            reason,
+		ProcessedAt:      time.Now().UTC(),
+		Callback:         msg.Callback,
+		BatchID:          msg.BatchID,
+	})
+}
+
+func (r *queueService) publishNotification(ctx context.Context, event *messaging.DocumentProcessed) error {
+	messageBytes, err := messaging.Encode(event)
+	if err != nil {
+		return err
+	}
+
+	err = r.rabbitmq.PublishMessage(ctx, "document-exchange", "out-routing-key", messageBytes)
+	if err != nil {
+		return errors.New("failed to publish message to RabbitMQ: " + err.Error())
+	}
+
+	return nil
+}
+
+// setStatus обновляет состояние документа. Ошибка хранилища состояний не должна
+// останавливать обработку самого документа, поэтому она только логируется
+func (r *queueService) setStatus(ctx context.Context, documentID string, status jobs.Status, errorReason string) {
+	err := r.jobs.SetStatus(ctx, documentID, status, errorReason)
+	if err != nil {
+		log.Printf("Failed to set status %s for document %s: %v", status, documentID, err)
+	}
+}
@@ -2,105 +2,158 @@ package queue_service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	anonymizer_provider "queue-service/providers/py-anonymizer_provider"
 	"queue-service/providers/rabbitmq_provider"
-	"queue-service/providers/s3_provider"
+	"queue-service/providers/scanner_provider"
+	"time"
+
+	"gitlab.com/docshade/common/formats"
+	"gitlab.com/docshade/common/jobs"
+	"gitlab.com/docshade/common/messaging"
+	"gitlab.com/docshade/common/storage"
 )
 
 type QueueService interface {
 	GetHealth(ctx context.Context, data HealthDtoIn) (HealthDtoOut, error)
 	ProcessDocumentMessage(ctx context.Context, msg rabbitmq_provider.DocumentMessage) error
 	ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, rabbitmq_provider.DocumentMessage) error) error
+	// QueueDepth количество сообщений, ожидающих в очереди
+	QueueDepth(ctx context.Context, queueName string) (int, error)
 }
 
 type queueService struct {
-	s3Service  s3_provider.S3
+	storage    storage.Storage
+	buckets    storage.Buckets
 	rabbitmq   rabbitmq_provider.RabbitMQ
 	anonymizer anonymizer_provider.Anonymizer
+	// scanners проверки документа перед анонимизацией, выполняются по порядку
+	scanners []scanner_provider.Scanner
+	jobs     jobs.Repository
 }
 
-func NewQueueService(s3Service s3_provider.S3, rabbitmq rabbitmq_provider.RabbitMQ, anonymizer anonymizer_provider.Anonymizer) QueueService {
+func NewQueueService(store storage.Storage, buckets storage.Buckets, rabbitmq rabbitmq_provider.RabbitMQ, anonymizer anonymizer_provider.Anonymizer, scanners []scanner_provider.Scanner, jobs jobs.Repository) QueueService {
 	return &queueService{
-		s3Service:  s3Service,
+		storage:    store,
+		buckets:    buckets,
 		rabbitmq:   rabbitmq,
 		anonymizer: anonymizer,
+		scanners:   scanners,
+		jobs:       jobs,
 	}
 }
 
 func (r *queueService) GetHealth(ctx context.Context, data HealthDtoIn) (HealthDtoOut, error) {
-	return HealthDtoOut{Message: "hello " + data.Message}, nil
+	return HealthDtoOut{Message: "hello " + data.Message, RabbitMQ: r.rabbitmq.State()}, nil
 }
 
+// ProcessDocumentMessage обрабатывает документ из входящей очереди.
+// Ошибка возвращается брокеру для повторной попытки; если попытка последняя, пользователю уходит уведомление об ошибке,
+// а исходный документ остаётся в preprocessing для разбора вместе с сообщением в dead-letter очереди
 func (r *queueService) ProcessDocumentMessage(ctx context.Context, msg rabbitmq_provider.DocumentMessage) error {
-	var textMessage string
-	var notificationMessage map[string]interface{}
-	// Step 1: Download the file from S3
-	object, err := r.s3Service.Get(ctx, msg.S3Path, msg.DocumentID+".pdf")
-	if err != nil {
-		return err
+	if !msg.UploadedAt.IsZero() {
+		consumerLag.Observe(time.Since(msg.UploadedAt).Seconds())
 	}
 
-	// Step 2: Anonymize the document
-	anonymizedDocument, errByAnonim := r.anonymizer.AnonymizeDocument(object, msg.DocumentID+".pdf")
-	if errByAnonim != nil {
-		textMessage = "Somthing going wrong pls try another time"
-	}
+	r.setStatus(ctx, msg.DocumentID, jobs.StatusAnonymizing, "")
 
-	// Step 3: Upload the anonymized document to S3
-	destPath := "postprocessing"
-	err = r.s3Service.Put(ctx, msg.DocumentID, destPath, anonymizedDocument, nil)
-	if err != nil {
-		return err
+	err := r.processDocument(ctx, msg)
+
+	// Отклонённый документ не станет чище при повторе, поэтому сообщение подтверждается сразу
+	var rejection *scanner_provider.Rejection
+	if errors.As(err, &rejection) {
+		err = r.quarantine(ctx, msg, rejection)
+		if err == nil {
+			documentsProcessed.WithLabelValues(resultRejected).Inc()
+			return nil
+		}
 	}
-	//object, err := r.s3Service.Get(ctx, msg.S3Path, msg.DocumentID+".pdf")
-	// Step 4: Remove the original document from the preprocessing bucket
-	err = r.s3Service.Remove(ctx, msg.S3Path, msg.DocumentID+".pdf")
-	if err != nil {
-		return err
+
+	// Документ, не совпавший с контрольной суммой, не исправится при повторе: обработка завершается сразу,
+	// а исходный документ остаётся в preprocessing для разбора
+	if errors.Is(err, storage.ErrChecksumMismatch) {
+		documentsProcessed.WithLabelValues(resultFailed).Inc()
+		return r.fail(ctx, msg, err, corruptedReason)
 	}
 
-	if errByAnonim != nil {
-		notificationMessage = map[string]interface{}{
-			"session_id":         msg.SessionID,
-			"document_id":        msg.DocumentID,
-			"s3_path":            errByAnonim,
-			"original_file_name": "error process file",
-			"status":             textMessage,
-		}
-	} else {
-		// Step 5: Send a notification message
-		notificationMessage = map[string]interface{}{
-			"session_id":         msg.SessionID,
-			"document_id":        msg.DocumentID,
-			"s3_path":            destPath + "/" + msg.DocumentID,
-			"original_file_name": msg.OriginalFileName,
-			"status":             "ok",
+	documentsProcessed.WithLabelValues(processingResult(err, msg.FinalAttempt)).Inc()
+	if err != nil && msg.FinalAttempt {
+		if notifyErr := r.fail(ctx, msg, err, failureReason); notifyErr != nil {
+			return fmt.Errorf("%w; %v", err, notifyErr)
 		}
 	}
-	// notificationMessage = map[string]interface{}{
-	// 	"session_id":         msg.SessionID,
-	// 	"document_id":        msg.DocumentID,
-	// 	"s3_path":            destPath + "/" + msg.DocumentID,
-	// 	"original_file_name": msg.OriginalFileName,
-	// 	"status":             "ok",
-	// }
-	messageBytes, err := json.Marshal(notificationMessage)
-	if err != nil {
-		return err
+
+	return err
+}
+
+// fail отмечает документ неудачным и сообщает об этом пользователю с причиной reason.
+// Ошибку возвращает, только если уведомление отправить не удалось
+func (r *queueService) fail(ctx context.Context, msg rabbitmq_provider.DocumentMessage, err error, reason string) error {
+	r.setStatus(ctx, msg.DocumentID, jobs.StatusFailed, err.Error())
+	if notifyErr := r.publishFailure(ctx, msg, reason); notifyErr != nil {
+		return fmt.Errorf("failed to notify about failure: %w", notifyErr)
 	}
 
-	err = r.rabbitmq.PublishMessage(ctx, "document-exchange", "out-routing-key", messageBytes)
+	return nil
+}
+
+func (r *queueService) processDocument(ctx context.Context, msg rabbitmq_provider.DocumentMessage) error {
+	format, ok := formats.ByName(msg.Format)
+	if !ok {
+		return fmt.Errorf("unsupported document format %q", msg.Format)
+	}
+
+	destBucket := r.buckets.Processed
+	destKey := format.ObjectKey(msg.DocumentID)
+
+	// Результат мог быть сохранён предыдущей попыткой, которая упала позже,
+	// тогда его контрольная сумма берётся из метаданных объекта. Результат без суммы
+	// остался от попытки, упавшей до её записи, и создаётся заново
+	info, err := r.storage.Stat(ctx, destBucket, destKey)
+	checksum := storage.Checksum(info)
+	switch {
+	case errors.Is(err, storage.ErrNotFound), err == nil && checksum == "":
+		checksum, err = r.anonymize(ctx, msg, format, destBucket, destKey)
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("failed to check anonymized document: %w", err)
+	}
+
+	// Step 4: Remove the original document from the preprocessing bucket
+	err = r.storage.Delete(ctx, msg.Bucket, msg.ObjectKey)
 	if err != nil {
-		return errors.New("failed to publish message to RabbitMQ: " + err.Error())
+		return fmt.Errorf("failed to remove original document: %w", err)
 	}
 
-	return nil
+	r.setStatus(ctx, msg.DocumentID, jobs.StatusDone, "")
+
+	// Step 5: Send a notification message
+	return r.publishNotification(ctx, &messaging.DocumentProcessed{
+		SessionID:        msg.SessionID,
+		DocumentID:       msg.DocumentID,
+		OriginalFileName: msg.OriginalFileName,
+		Format:           format.Name,
+		Status:           messaging.StatusOK,
+		Bucket:           destBucket,
+		ObjectKey:        destKey,
+		ProcessedAt:      time.Now().UTC(),
+		Callback:         msg.Callback,
+		BatchID:          msg.BatchID,
+		SHA256:           checksum,
+	})
+}
+
+func (r *queueService) QueueDepth(ctx context.Context, queueName string) (int, error) {
+	return r.rabbitmq.QueueDepth(ctx, queueName)
 }
 
 func (r *queueService) ConsumeMessages(ctx context.Context, queueName string, handler func(context.Context, rabbitmq_provider.DocumentMessage) error) error {
-	return r.rabbitmq.ConsumeMessages(ctx, queueName, func(msg rabbitmq_provider.DocumentMessage) error {
-		return handler(ctx, msg)
+	// Остановка чтения очереди не должна прерывать обработку уже полученного документа,
+	// а контекст сообщения несёт его трассировку
+	return r.rabbitmq.ConsumeMessages(ctx, queueName, func(msgCtx context.Context, msg rabbitmq_provider.DocumentMessage) error {
+		return handler(context.WithoutCancel(msgCtx), msg)
 	})
 }